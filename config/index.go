@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -31,3 +32,133 @@ var JwtSecret = os.Getenv("JWT_SECRET")
 var PaystackSecretKey = os.Getenv("PAYSTACK_SECRET_KEY")
 var PaystackCallbackURL = os.Getenv("PAYSTACK_CALLBACK_URL")
 var PaystackBaseURL = os.Getenv("PAYSTACK_BASE_URL")
+var TermiiBaseURL = os.Getenv("TERMII_BASE_URL")
+var TermiiAPIKey = os.Getenv("TERMII_API_KEY")
+var TermiiSenderID = os.Getenv("TERMII_SENDER_ID")
+
+// fraud rules for withdrawals, scores are out of 100
+var FraudReviewScore = envInt("FRAUD_REVIEW_SCORE", 40)
+var FraudBlockScore = envInt("FRAUD_BLOCK_SCORE", 80)
+var FraudNewAccountHours = envInt("FRAUD_NEW_ACCOUNT_HOURS", 24)
+var FraudTopUpWindowMinutes = envInt("FRAUD_TOPUP_WINDOW_MINUTES", 60)
+var FraudHourlyWithdrawalLimit = envInt("FRAUD_HOURLY_WITHDRAWAL_LIMIT", 3)
+var FraudMaxFailedPins = envInt("FRAUD_MAX_FAILED_PINS", 3)
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// manual wallet adjustments above this amount need a second admin to approve
+var AdjustmentApprovalThreshold = float64(envInt("ADJUSTMENT_APPROVAL_THRESHOLD", 50000))
+
+// pending top-ups older than this are verified with Paystack and expired if unpaid
+var TopUpExpiryMinutes = envInt("TOPUP_EXPIRY_MINUTES", 60)
+var TopUpExpiryIntervalMinutes = envInt("TOPUP_EXPIRY_INTERVAL_MINUTES", 15)
+
+// subscription renewals, failed charges are retried this many times a day apart before the plan expires
+var SubscriptionMaxRetries = envInt("SUBSCRIPTION_MAX_RETRIES", 3)
+var SubscriptionRetryHours = envInt("SUBSCRIPTION_RETRY_HOURS", 24)
+var SubscriptionJobIntervalMinutes = envInt("SUBSCRIPTION_JOB_INTERVAL_MINUTES", 60)
+
+// zone used for anyone who has not set one, schedules and reminders are rendered in it
+var DefaultTimeZone = envString("DEFAULT_TIME_ZONE", "Africa/Lagos")
+
+func envString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// patient cancellation and reschedule policy, hours are counted back from the appointment time
+var PatientRescheduleMinHours = envInt("PATIENT_RESCHEDULE_MIN_HOURS", 12)
+var PatientMaxReschedules = envInt("PATIENT_MAX_RESCHEDULES", 2)
+var CancelFullRefundHours = envInt("CANCEL_FULL_REFUND_HOURS", 24)
+var CancelPartialRefundHours = envInt("CANCEL_PARTIAL_REFUND_HOURS", 6)
+var CancelPartialRefundPercent = envInt("CANCEL_PARTIAL_REFUND_PERCENT", 50)
+
+// bookings the doctor has not answered within this many hours are expired and refunded
+var AppointmentConfirmHours = envInt("APPOINTMENT_CONFIRM_HOURS", 24)
+var AppointmentExpiryIntervalMinutes = envInt("APPOINTMENT_EXPIRY_INTERVAL_MINUTES", 15)
+
+// video consultations can be joined from a little before the appointment until its slot plus the grace period
+// has passed, room tokens only need to live long enough to open the signaling socket
+var ConsultationJoinEarlyMinutes = envInt("CONSULTATION_JOIN_EARLY_MINUTES", 10)
+var ConsultationJoinGraceMinutes = envInt("CONSULTATION_JOIN_GRACE_MINUTES", 30)
+var RoomTokenMinutes = envInt("ROOM_TOKEN_MINUTES", 5)
+var ConsultationExpiryIntervalMinutes = envInt("CONSULTATION_EXPIRY_INTERVAL_MINUTES", 5)
+var StunServers = envString("STUN_SERVERS", "stun:stun.l.google.com:19302")
+var TurnURL = os.Getenv("TURN_URL")
+var TurnUsername = os.Getenv("TURN_USERNAME")
+var TurnCredential = os.Getenv("TURN_CREDENTIAL")
+
+// chat stays open for follow-up questions this many days after the appointment time
+var ChatFollowUpDays = envInt("CHAT_FOLLOW_UP_DAYS", 7)
+var ChatMaxMessageLength = envInt("CHAT_MAX_MESSAGE_LENGTH", 4000)
+
+// doctors keep access to the patient's record this many hours after the call closes, to write up the visit
+var RecordWriteUpHours = envInt("RECORD_WRITE_UP_HOURS", 72)
+
+// uploaded files, STORAGE_BACKEND is "local" or "s3" (any S3 compatible store such as MinIO)
+var StorageBackend = envString("STORAGE_BACKEND", "local")
+var LocalStorageDir = envString("LOCAL_STORAGE_DIR", "./uploads")
+var S3Endpoint = os.Getenv("S3_ENDPOINT")
+var S3Bucket = os.Getenv("S3_BUCKET")
+var S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+var S3SecretKey = os.Getenv("S3_SECRET_KEY")
+var S3Region = os.Getenv("S3_REGION")
+var S3UseSSL = os.Getenv("S3_USE_SSL") != "false"
+
+// attachments larger than this are refused, download links stop working after the TTL
+var AttachmentMaxBytes = envInt("ATTACHMENT_MAX_BYTES", 10*1024*1024)
+var AttachmentAllowedTypes = envString("ATTACHMENT_ALLOWED_TYPES", "application/pdf,image/jpeg,image/png,image/webp")
+var AttachmentURLMinutes = envInt("ATTACHMENT_URL_MINUTES", 15)
+
+// reminders go out this many minutes before a confirmed appointment, comma separated
+var ReminderLeadMinutes = envString("REMINDER_LEAD_MINUTES", "1440,60,10")
+var ReminderIntervalSeconds = envInt("REMINDER_INTERVAL_SECONDS", 60)
+
+// waitlist offers are held this long for the patient, and only slots at least the lead time away are offered
+var WaitlistHoldMinutes = envInt("WAITLIST_HOLD_MINUTES", 30)
+var WaitlistMinLeadMinutes = envInt("WAITLIST_MIN_LEAD_MINUTES", 120)
+var WaitlistMaxRangeDays = envInt("WAITLIST_MAX_RANGE_DAYS", 60)
+var WaitlistIntervalMinutes = envInt("WAITLIST_INTERVAL_MINUTES", 5)
+
+// how many open (pending, proposed or confirmed) appointments a patient may hold, in total and with one doctor
+var MaxOpenAppointments = envInt("MAX_OPEN_APPOINTMENTS", 5)
+var MaxOpenAppointmentsPerDoctor = envInt("MAX_OPEN_APPOINTMENTS_PER_DOCTOR", 1)
+
+// doctors can book a follow-up up to this many days after the original visit
+var FollowUpWindowDays = envInt("FOLLOW_UP_WINDOW_DAYS", 30)
+
+// calendar invites and feeds, event UIDs end in the domain and feed URLs start with the public base URL
+var CalendarUIDDomain = envString("CALENDAR_UID_DOMAIN", "telemed.app")
+var PublicBaseURL = os.Getenv("PUBLIC_BASE_URL")
+var CalendarFeedPastDays = envInt("CALENDAR_FEED_PAST_DAYS", 30)
+
+// dependents can be handed over to their own account from this age
+var DependentAdultAge = envInt("DEPENDENT_ADULT_AGE", 18)
+
+// growth charts flag a fall of this many z-scores between two measurements, 0.67 is one major percentile line
+var GrowthZDropAlert = float64(envInt("GROWTH_Z_DROP_ALERT_HUNDREDTHS", 100)) / 100
+
+// immunization schedule, a bundled name (ng-npi) or a path to a CSV with the same columns. Guardians are
+// reminded this many days before a dose is due, and again once it is this many days late
+var ImmunizationSchedule = envString("IMMUNIZATION_SCHEDULE", "ng-npi")
+var ImmunizationReminderLeadDays = envInt("IMMUNIZATION_REMINDER_LEAD_DAYS", 7)
+var ImmunizationOverdueDays = envInt("IMMUNIZATION_OVERDUE_DAYS", 28)
+var ImmunizationIntervalMinutes = envInt("IMMUNIZATION_INTERVAL_MINUTES", 60)
+
+// nutrition guidance rule set, a bundled name (default) or a path to a JSON file in the same shape
+var NutritionRules = envString("NUTRITION_RULES", "default")
+
+// FHIR identifiers we issue use systems under this URL, e.g. <base>/usertag
+var FHIRIdentifierBase = envString("FHIR_IDENTIFIER_BASE", "https://telemed.app/fhir/identifier")
+
+// the longest a patient's sharing grant can run, and the shortest justification an admin can give for break-glass access
+var ConsentMaxDays = envInt("CONSENT_MAX_DAYS", 365)
+var BreakGlassMinReason = envInt("BREAK_GLASS_MIN_REASON", 20)
@@ -5,6 +5,7 @@ import (
 	"telemed/models"
 	"telemed/responses"
 	"telemed/servers"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -173,6 +174,7 @@ func (AdminController) UpdateAppointmentStatus(c *fiber.Ctx) error {
 		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
 	}
 	payload.Appointment_id = c.Params("id")
+	payload.Admintag = c.Locals("usertag").(string)
 	if payload.Appointment_id == "" || payload.Status == "" {
 		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
 	}
@@ -396,6 +398,11 @@ func (AdminController) CreateHospital(c *fiber.Ctx) error {
 	if payload.HospitalName == "" || payload.Address == "" || payload.Country == "" || payload.State == "" {
 		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
 	}
+	if payload.TimeZone != "" {
+		if _, err := time.LoadLocation(payload.TimeZone); err != nil {
+			return responses.ErrorResponse(c, "time_zone must be an IANA zone name like Africa/Lagos", 400)
+		}
+	}
 	res, err := adminServer.CreateHospital(payload)
 	if err != nil {
 		return responses.ErrorResponse(c, err.Error(), 400)
@@ -435,6 +442,11 @@ func (AdminController) UpdateHospital(c *fiber.Ctx) error {
 	if payload.HospitalID == "" || payload.HospitalName == "" || payload.Address == "" || payload.Country == "" || payload.State == "" {
 		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
 	}
+	if payload.TimeZone != "" {
+		if _, err := time.LoadLocation(payload.TimeZone); err != nil {
+			return responses.ErrorResponse(c, "time_zone must be an IANA zone name like Africa/Lagos", 400)
+		}
+	}
 	res, err := adminServer.UpdateHospital(payload)
 	if err != nil {
 		return responses.ErrorResponse(c, err.Error(), 400)
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var walletStatuses = map[string]bool{
+	"active":   true,
+	"inactive": true,
+	"frozen":   true,
+}
+
+func (AdminController) FetchWallet(c *fiber.Ctx) error {
+	usertag := c.Params("usertag")
+	if usertag == "" {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := adminServer.GetWallet(usertag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (AdminController) UpdateWalletStatus(c *fiber.Ctx) error {
+	var payload models.WalletStatusReq
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	payload.Usertag = c.Params("usertag")
+	payload.AdminTag = c.Locals("usertag").(string)
+	if payload.Usertag == "" || payload.Reason == "" || !walletStatuses[payload.Status] {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := adminServer.UpdateWalletStatus(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (AdminController) FetchLedger(c *fiber.Ctx) error {
+	var data models.LedgerReq
+	data.Usertag = c.Params("usertag")
+	if data.Usertag == "" {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	if c.Query("page") != "" {
+		data.Page, _ = strconv.Atoi(c.Query("page"))
+	} else {
+		data.Page = 1
+	}
+	if c.Query("limit") != "" {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		data.Limit = min(limit, 100)
+	} else {
+		data.Limit = 100
+	}
+	res, err := adminServer.GetLedger(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (AdminController) CreateWalletAdjustment(c *fiber.Ctx) error {
+	var payload models.WalletAdjustmentReq
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	payload.Usertag = c.Params("usertag")
+	payload.AdminTag = c.Locals("usertag").(string)
+	if payload.Usertag == "" || payload.Amount <= 0 || (payload.AdjustmentType != "credit" && payload.AdjustmentType != "debit") {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	if payload.Reason == "" {
+		return responses.ErrorResponse(c, "a reason is required for every adjustment", 400)
+	}
+	res, err := adminServer.CreateWalletAdjustment(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (AdminController) FetchWalletAdjustments(c *fiber.Ctx) error {
+	var data models.GetDataReq
+	if c.Query("page") != "" {
+		data.Page, _ = strconv.Atoi(c.Query("page"))
+	} else {
+		data.Page = 1
+	}
+	if c.Query("limit") != "" {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		data.Limit = min(limit, 100)
+	} else {
+		data.Limit = 100
+	}
+	data.Status = c.Query("status")
+
+	res, err := adminServer.GetWalletAdjustments(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (AdminController) DecideWalletAdjustment(c *fiber.Ctx) error {
+	var payload models.DecideAdjustmentReq
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	payload.AdjustmentID = c.Params("adjustment_id")
+	payload.AdminTag = c.Locals("usertag").(string)
+	if payload.AdjustmentID == "" || (payload.Decision != "approve" && payload.Decision != "reject") {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := adminServer.DecideWalletAdjustment(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (AdminController) FetchAuditLogs(c *fiber.Ctx) error {
+	var data models.GetDataReq
+	if c.Query("page") != "" {
+		data.Page, _ = strconv.Atoi(c.Query("page"))
+	} else {
+		data.Page = 1
+	}
+	if c.Query("limit") != "" {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		data.Limit = min(limit, 100)
+	} else {
+		data.Limit = 100
+	}
+	data.Search = c.Query("search")
+
+	res, err := adminServer.GetAuditLogs(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (AdminController) FetchTopUpSummary(c *fiber.Ctx) error {
+	res, err := adminServer.GetTopUpSummary()
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AppointmentController struct{}
+
+var appointmentServer servers.AppointmentServer
+
+func (AppointmentController) FetchCancellationQuote(c *fiber.Ctx) error {
+	usertag := c.Locals("usertag").(string)
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := appointmentServer.GetCancellationQuote(usertag, appointmentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (AppointmentController) CancelAppointment(c *fiber.Ctx) error {
+	var data models.CancelAppointmentReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.AppointmentID = appointmentID
+	data.Usertag = c.Locals("usertag").(string)
+	res, err := appointmentServer.CancelAppointment(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (AppointmentController) RescheduleAppointment(c *fiber.Ctx) error {
+	var data models.PatientRescheduleReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.AppointmentID = appointmentID
+	data.Usertag = c.Locals("usertag").(string)
+	if data.NewScheduledAt.IsZero() {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	if data.NewScheduledAt.Before(time.Now()) {
+		return responses.ErrorResponse(c, "appointment date must be in the future", 400)
+	}
+	res, err := appointmentServer.RescheduleAppointment(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (AppointmentController) RespondToProposal(c *fiber.Ctx) error {
+	var data models.ProposalResponseReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.AppointmentID = appointmentID
+	data.Usertag = c.Locals("usertag").(string)
+	res, err := appointmentServer.RespondToProposal(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (AppointmentController) FetchStatusHistory(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := appointmentServer.GetStatusHistory(c.Locals("usertag").(string), appointmentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
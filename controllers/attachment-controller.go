@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"mime"
+	"strconv"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AttachmentController struct{}
+
+var attachmentServer servers.AttachmentServer
+
+func (AttachmentController) UploadAttachment(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return responses.ErrorResponse(c, "a file is required", 400)
+	}
+	role, tag := appointmentParty(c)
+	res, err := attachmentServer.UploadAttachment(appointmentID, role, tag, c.FormValue("category"), file)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (AttachmentController) FetchAttachments(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	role, tag := appointmentParty(c)
+	res, err := attachmentServer.GetAttachments(appointmentID, role, tag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (AttachmentController) FetchAttachment(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	attachmentID, err := strconv.Atoi(c.Params("attachment_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	role, tag := appointmentParty(c)
+	res, err := attachmentServer.GetAttachment(appointmentID, attachmentID, role, tag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (AttachmentController) DeleteAttachment(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	attachmentID, err := strconv.Atoi(c.Params("attachment_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	role, tag := appointmentParty(c)
+	res, err := attachmentServer.DeleteAttachment(appointmentID, attachmentID, role, tag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
+
+// Download serves a signed link, the signature stands in for the login so the link works in a browser tab
+func (AttachmentController) Download(c *fiber.Ctx) error {
+	attachmentID, err := strconv.Atoi(c.Params("attachment_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		return responses.ErrorResponse(c, "invalid download link", 403)
+	}
+	attachment, file, err := attachmentServer.OpenDownload(attachmentID, expires, c.Query("sig"))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 403)
+	}
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	c.Set("X-Content-Type-Options", "nosniff")
+	return c.SendStream(file, int(attachment.SizeBytes))
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"strings"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CalendarController struct{}
+
+var calendarServer servers.CalendarServer
+
+func (CalendarController) FetchFeed(c *fiber.Ctx) error {
+	ownerType, ownerTag := appointmentParty(c)
+	res, err := calendarServer.GetFeed(ownerType, ownerTag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (CalendarController) RotateFeed(c *fiber.Ctx) error {
+	ownerType, ownerTag := appointmentParty(c)
+	res, err := calendarServer.RotateFeed(ownerType, ownerTag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+// ServeFeed answers calendar apps polling a subscription URL, the token in the path is the only credential
+func (CalendarController) ServeFeed(c *fiber.Ctx) error {
+	feed, err := calendarServer.RenderFeed(strings.TrimSuffix(c.Params("token"), ".ics"))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 404)
+	}
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=UTF-8")
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Send(feed)
+}
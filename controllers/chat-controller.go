@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+	"telemed/utils"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ChatController struct{}
+
+var chatServer servers.ChatServer
+
+// appointmentParty tells the patient from the doctor by the middleware that let the request in
+func appointmentParty(c *fiber.Ctx) (string, string) {
+	if doctortag, ok := c.Locals("doctortag").(string); ok {
+		return servers.ActorDoctor, doctortag
+	}
+	return servers.ActorPatient, c.Locals("usertag").(string)
+}
+
+func chatPage(c *fiber.Ctx) models.GetDataReq {
+	data := models.GetDataReq{Page: 1, Limit: 50}
+	if c.Query("page") != "" {
+		data.Page, _ = strconv.Atoi(c.Query("page"))
+	}
+	if c.Query("limit") != "" {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		data.Limit = min(limit, 100)
+	}
+	return data
+}
+
+func (ChatController) FetchToken(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	role, tag := appointmentParty(c)
+	res, err := chatServer.GetToken(appointmentID, role, tag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (ChatController) FetchMessages(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	role, tag := appointmentParty(c)
+	res, err := chatServer.GetMessages(appointmentID, role, tag, chatPage(c))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (ChatController) SendMessage(c *fiber.Ctx) error {
+	var data models.SendMessageReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	role, tag := appointmentParty(c)
+	res, err := chatServer.SendMessage(appointmentID, role, tag, data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (ChatController) MarkRead(c *fiber.Ctx) error {
+	var data models.MarkReadReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	role, tag := appointmentParty(c)
+	res, err := chatServer.MarkRead(appointmentID, role, tag, data.UpTo)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (ChatController) SocketUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return responses.ErrorResponse(c, "websocket upgrade required", fiber.StatusUpgradeRequired)
+	}
+	room, err := utils.ParseRoomToken(c.Query("token"), "chat")
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), fiber.StatusUnauthorized)
+	}
+	c.Locals("room", room)
+	return c.Next()
+}
+
+func (ChatController) Socket() fiber.Handler {
+	return websocket.New(func(conn *websocket.Conn) {
+		servers.ServeChat(conn, conn.Locals("room").(models.RoomClaims))
+	})
+}
+
+// FetchAppointmentMessages is the admin's audited, read-only view of a chat, a reason is required
+func (AdminController) FetchAppointmentMessages(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	reason := c.Query("reason")
+	if reason == "" {
+		return responses.ErrorResponse(c, "a reason is required to read an appointment chat", 400)
+	}
+	res, err := adminServer.GetAppointmentMessages(c.Locals("usertag").(string), appointmentID, reason, chatPage(c))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
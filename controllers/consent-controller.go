@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ConsentController struct{}
+
+var consentServer servers.ConsentServer
+
+func (ConsentController) GrantConsent(c *fiber.Ctx) error {
+	var data models.ConsentReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.Usertag = c.Locals("usertag").(string)
+	if data.Grantee == "" || data.ExpiresAt == "" {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := consentServer.GrantConsent(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (ConsentController) FetchConsents(c *fiber.Ctx) error {
+	res, err := consentServer.GetConsents(c.Locals("usertag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (ConsentController) RevokeConsent(c *fiber.Ctx) error {
+	consentID, err := strconv.Atoi(c.Params("consent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := consentServer.RevokeConsent(c.Locals("usertag").(string), consentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (ConsentController) FetchBreakGlassLog(c *fiber.Ctx) error {
+	res, err := consentServer.GetBreakGlassLog(c.Locals("usertag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (ConsentController) DoctorFetchSharedRecords(c *fiber.Ctx) error {
+	res, err := consentServer.GetSharedRecords(c.Locals("doctortag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (ConsentController) DoctorFetchSharedRecord(c *fiber.Ctx) error {
+	consentID, err := strconv.Atoi(c.Params("consent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := consentServer.GetSharedRecord(c.Locals("doctortag").(string), consentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+// FetchPatientRecord is the admin's break-glass view of a patient's clinical record, a reason is required
+func (AdminController) FetchPatientRecord(c *fiber.Ctx) error {
+	data := models.BreakGlassReq{
+		Admintag: c.Locals("usertag").(string),
+		Usertag:  c.Params("usertag"),
+		Reason:   c.Query("reason"),
+	}
+	if raw := c.Query("dependent_id"); raw != "" {
+		dependentID, err := strconv.Atoi(raw)
+		if err != nil {
+			return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+		}
+		data.DependentID = &dependentID
+	}
+	res, err := adminServer.BreakGlass(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+	"telemed/utils"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ConsultationController struct{}
+
+var consultationServer servers.ConsultationServer
+
+func (ConsultationController) JoinSession(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := consultationServer.JoinSession(appointmentID, servers.ActorPatient, c.Locals("usertag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (ConsultationController) FetchSession(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := consultationServer.GetSession(appointmentID, "patient_tag", c.Locals("usertag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (ConsultationController) DoctorJoinSession(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := consultationServer.JoinSession(appointmentID, servers.ActorDoctor, c.Locals("doctortag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (ConsultationController) DoctorFetchSession(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := consultationServer.GetSession(appointmentID, "doctor_tag", c.Locals("doctortag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+// SignalingUpgrade lets a request through to the socket only with a valid room token, browsers cannot set
+// headers on a WebSocket so the token comes in the query string
+func (ConsultationController) SignalingUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return responses.ErrorResponse(c, "websocket upgrade required", fiber.StatusUpgradeRequired)
+	}
+	room, err := utils.ParseRoomToken(c.Query("token"), "call")
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), fiber.StatusUnauthorized)
+	}
+	c.Locals("room", room)
+	return c.Next()
+}
+
+func (ConsultationController) Signaling() fiber.Handler {
+	return websocket.New(func(conn *websocket.Conn) {
+		servers.ServeSignaling(conn, conn.Locals("room").(models.RoomClaims))
+	})
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DependentController struct{}
+
+var dependentServer servers.DependentServer
+
+func (DependentController) AddDependent(c *fiber.Ctx) error {
+	var data models.DependentReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.Usertag = c.Locals("usertag").(string)
+	res, err := dependentServer.AddDependent(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (DependentController) FetchDependents(c *fiber.Ctx) error {
+	res, err := dependentServer.GetDependents(c.Locals("usertag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (DependentController) UpdateDependent(c *fiber.Ctx) error {
+	var data models.DependentReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.DependentID = dependentID
+	data.Usertag = c.Locals("usertag").(string)
+	res, err := dependentServer.UpdateDependent(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (DependentController) StartTransfer(c *fiber.Ctx) error {
+	var data models.DependentTransferReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	if data.Email == "" {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	data.DependentID = dependentID
+	data.Usertag = c.Locals("usertag").(string)
+	res, err := dependentServer.StartTransfer(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (DependentController) CancelTransfer(c *fiber.Ctx) error {
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := dependentServer.CancelTransfer(c.Locals("usertag").(string), dependentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (DependentController) FetchIncomingTransfers(c *fiber.Ctx) error {
+	res, err := dependentServer.GetIncomingTransfers(c.Locals("usertag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (DependentController) AcceptTransfer(c *fiber.Ctx) error {
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := dependentServer.AcceptTransfer(c.Locals("usertag").(string), dependentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DoctorController struct{}
+
+var doctorServer servers.DoctorServer
+
+func (DoctorController) Login(c *fiber.Ctx) error {
+	var data models.DoctorLoginReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	if data.Email == "" || data.Password == "" {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := doctorServer.Login(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (DoctorController) FetchAppointments(c *fiber.Ctx) error {
+	var data models.GetDataReq
+	if c.Query("page") != "" {
+		data.Page, _ = strconv.Atoi(c.Query("page"))
+	} else {
+		data.Page = 1
+	}
+	if c.Query("limit") != "" {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		data.Limit = min(limit, 100)
+	} else {
+		data.Limit = 100
+	}
+	data.Status = c.Query("status")
+
+	res, err := doctorServer.GetAppointments(c.Locals("doctortag").(string), data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (DoctorController) FetchStatusHistory(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := doctorServer.GetStatusHistory(c.Locals("doctortag").(string), appointmentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+// parseDoctorAction reads the optional body and the appointment id shared by every doctor action
+func parseDoctorAction(c *fiber.Ctx) (models.DoctorActionReq, error) {
+	var data models.DoctorActionReq
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&data); err != nil {
+			return data, err
+		}
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return data, err
+	}
+	data.AppointmentID = appointmentID
+	data.Doctortag = c.Locals("doctortag").(string)
+	return data, nil
+}
+
+func (DoctorController) doAction(c *fiber.Ctx, action func(models.DoctorActionReq) (any, error)) error {
+	data, err := parseDoctorAction(c)
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := action(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (d DoctorController) AcceptAppointment(c *fiber.Ctx) error {
+	return d.doAction(c, doctorServer.AcceptAppointment)
+}
+
+func (d DoctorController) DeclineAppointment(c *fiber.Ctx) error {
+	return d.doAction(c, doctorServer.DeclineAppointment)
+}
+
+func (d DoctorController) CompleteAppointment(c *fiber.Ctx) error {
+	return d.doAction(c, doctorServer.CompleteAppointment)
+}
+
+func (d DoctorController) MarkNoShow(c *fiber.Ctx) error {
+	return d.doAction(c, doctorServer.MarkNoShow)
+}
+
+func (d DoctorController) CancelAppointment(c *fiber.Ctx) error {
+	return d.doAction(c, doctorServer.CancelAppointment)
+}
+
+func (DoctorController) ProposeNewTime(c *fiber.Ctx) error {
+	data, err := parseDoctorAction(c)
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	if data.NewScheduledAt.IsZero() {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	if data.NewScheduledAt.Before(time.Now()) {
+		return responses.ErrorResponse(c, "appointment date must be in the future", 400)
+	}
+	res, err := doctorServer.ProposeNewTime(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (DoctorController) CreateFollowUp(c *fiber.Ctx) error {
+	var data models.FollowUpReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	if data.ScheduledAt.IsZero() {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	data.AppointmentID = appointmentID
+	data.Doctortag = c.Locals("doctortag").(string)
+	res, err := doctorServer.CreateFollowUp(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"encoding/json"
+	"telemed/fhir"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FHIRController struct{}
+
+var fhirServer servers.FHIRServer
+
+// fhirError answers in FHIR terms, hospital systems expect an OperationOutcome rather than our JSON envelope
+func fhirError(c *fiber.Ctx, message string, status int) error {
+	code := fhir.IssueCodeInvalid
+	if status == 404 {
+		code = fhir.IssueCodeNotFound
+	} else if status >= 500 {
+		code = fhir.IssueCodeProcessing
+	}
+	out, _ := json.Marshal(fhir.Outcome(fhir.Issue{Severity: fhir.IssueSeverityError, Code: code, Diagnostics: message}))
+	return fhirResponse(c, out, status)
+}
+
+func fhirResponse(c *fiber.Ctx, body []byte, status int) error {
+	c.Set(fiber.HeaderContentType, fhir.ContentType)
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Status(status).Send(body)
+}
+
+func fhirStatus(err error) int {
+	if err.Error() == "patient not found" {
+		return 404
+	}
+	return 400
+}
+
+func (FHIRController) FetchPatient(c *fiber.Ctx) error {
+	res, err := fhirServer.GetPatient(c.Locals("hospital_id").(int), c.Params("id"))
+	if err != nil {
+		return fhirError(c, err.Error(), fhirStatus(err))
+	}
+	return fhirResponse(c, res, 200)
+}
+
+func (FHIRController) FetchEverything(c *fiber.Ctx) error {
+	res, err := fhirServer.Everything(c.Locals("hospital_id").(int), c.Params("id"))
+	if err != nil {
+		return fhirError(c, err.Error(), fhirStatus(err))
+	}
+	return fhirResponse(c, res, 200)
+}
+
+func (FHIRController) Search(c *fiber.Ctx) error {
+	res, err := fhirServer.Search(c.Locals("hospital_id").(int), c.Params("type"), c.Query("patient"))
+	if err != nil {
+		return fhirError(c, err.Error(), fhirStatus(err))
+	}
+	return fhirResponse(c, res, 200)
+}
+
+// Import takes a batch, transaction or collection bundle and answers with a response bundle, one entry per resource
+func (FHIRController) Import(c *fiber.Ctx) error {
+	status, res, err := fhirServer.Import(c.Locals("hospital_id").(int), c.Body())
+	if err != nil {
+		return fhirError(c, err.Error(), status)
+	}
+	return fhirResponse(c, res, status)
+}
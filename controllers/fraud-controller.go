@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FraudController struct{}
+
+var fraudServer servers.FraudServer
+
+func (FraudController) FetchWithdrawalReviews(c *fiber.Ctx) error {
+	var data models.GetDataReq
+	if c.Query("page") != "" {
+		data.Page, _ = strconv.Atoi(c.Query("page"))
+	} else {
+		data.Page = 1
+	}
+	if c.Query("limit") != "" {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		data.Limit = min(limit, 100)
+	} else {
+		data.Limit = 100
+	}
+	data.Status = c.Query("status", "pending")
+
+	res, err := fraudServer.GetWithdrawalReviews(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (FraudController) ReviewWithdrawal(c *fiber.Ctx) error {
+	var payload models.ReviewWithdrawalReq
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	payload.ReviewID = c.Params("review_id")
+	payload.AdminTag = c.Locals("usertag").(string)
+	if payload.ReviewID == "" || (payload.Decision != "approve" && payload.Decision != "reject") {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := fraudServer.ReviewWithdrawal(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type GrowthController struct{}
+
+var growthServer servers.GrowthServer
+
+func (GrowthController) FetchChart(c *fiber.Ctx) error {
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := growthServer.GetGuardianChart(c.Locals("usertag").(string), dependentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (GrowthController) AddMeasurement(c *fiber.Ctx) error {
+	var data models.GrowthMeasurementReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.DependentID = dependentID
+	res, err := growthServer.AddGuardianMeasurement(c.Locals("usertag").(string), data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (GrowthController) RemoveMeasurement(c *fiber.Ctx) error {
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	measurementID, err := strconv.Atoi(c.Params("measurement_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := growthServer.RemoveGuardianMeasurement(c.Locals("usertag").(string), dependentID, measurementID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
+
+func (GrowthController) DoctorFetchChart(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := growthServer.GetDoctorChart(c.Locals("doctortag").(string), appointmentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (GrowthController) DoctorAddMeasurement(c *fiber.Ctx) error {
+	var data models.GrowthMeasurementReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := growthServer.AddDoctorMeasurement(c.Locals("doctortag").(string), appointmentID, data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (GrowthController) DoctorRemoveMeasurement(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	measurementID, err := strconv.Atoi(c.Params("measurement_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := growthServer.RemoveDoctorMeasurement(c.Locals("doctortag").(string), appointmentID, measurementID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
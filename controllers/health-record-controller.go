@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type HealthRecordController struct{}
+
+var healthRecordServer servers.HealthRecordServer
+
+func (HealthRecordController) FetchRecord(c *fiber.Ctx) error {
+	var dependentID *int
+	if c.Query("dependent_id") != "" {
+		id, err := strconv.Atoi(c.Query("dependent_id"))
+		if err != nil {
+			return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+		}
+		dependentID = &id
+	}
+	res, err := healthRecordServer.GetPatientRecord(c.Locals("usertag").(string), dependentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (HealthRecordController) AddEntry(c *fiber.Ctx) error {
+	var data models.HealthRecordEntryReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.EntryID = 0
+	res, err := healthRecordServer.SavePatientEntry(c.Locals("usertag").(string), data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (HealthRecordController) UpdateEntry(c *fiber.Ctx) error {
+	var data models.HealthRecordEntryReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	entryID, err := strconv.Atoi(c.Params("entry_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.EntryID = entryID
+	res, err := healthRecordServer.SavePatientEntry(c.Locals("usertag").(string), data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (HealthRecordController) RemoveEntry(c *fiber.Ctx) error {
+	entryID, err := strconv.Atoi(c.Params("entry_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := healthRecordServer.RemovePatientEntry(c.Locals("usertag").(string), entryID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
+
+func (HealthRecordController) FetchEntryHistory(c *fiber.Ctx) error {
+	entryID, err := strconv.Atoi(c.Params("entry_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := healthRecordServer.GetPatientEntryHistory(c.Locals("usertag").(string), entryID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (HealthRecordController) DoctorFetchRecord(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := healthRecordServer.GetDoctorRecord(c.Locals("doctortag").(string), appointmentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (HealthRecordController) DoctorAddEntry(c *fiber.Ctx) error {
+	var data models.HealthRecordEntryReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.EntryID = 0
+	res, err := healthRecordServer.SaveDoctorEntry(c.Locals("doctortag").(string), appointmentID, data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (HealthRecordController) DoctorUpdateEntry(c *fiber.Ctx) error {
+	var data models.HealthRecordEntryReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	entryID, err := strconv.Atoi(c.Params("entry_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.EntryID = entryID
+	res, err := healthRecordServer.SaveDoctorEntry(c.Locals("doctortag").(string), appointmentID, data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (HealthRecordController) DoctorRemoveEntry(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	entryID, err := strconv.Atoi(c.Params("entry_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := healthRecordServer.RemoveDoctorEntry(c.Locals("doctortag").(string), appointmentID, entryID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
+
+func (HealthRecordController) DoctorFetchEntryHistory(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	entryID, err := strconv.Atoi(c.Params("entry_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := healthRecordServer.GetDoctorEntryHistory(c.Locals("doctortag").(string), appointmentID, entryID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
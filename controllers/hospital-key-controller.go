@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/responses"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (AdminController) FetchHospitalAPIKeys(c *fiber.Ctx) error {
+	hospitalID, err := strconv.Atoi(c.Params("hospital_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := adminServer.GetHospitalAPIKeys(hospitalID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+// CreateHospitalAPIKey returns the key once, only its hash is stored
+func (AdminController) CreateHospitalAPIKey(c *fiber.Ctx) error {
+	hospitalID, err := strconv.Atoi(c.Params("hospital_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := adminServer.CreateHospitalAPIKey(c.Locals("usertag").(string), hospitalID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (AdminController) RevokeHospitalAPIKey(c *fiber.Ctx) error {
+	hospitalID, err := strconv.Atoi(c.Params("hospital_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	keyID, err := strconv.Atoi(c.Params("key_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := adminServer.RevokeHospitalAPIKey(c.Locals("usertag").(string), hospitalID, keyID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ImmunizationController struct{}
+
+var immunizationServer servers.ImmunizationServer
+
+func (ImmunizationController) FetchStatus(c *fiber.Ctx) error {
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := immunizationServer.GetGuardianStatus(c.Locals("usertag").(string), dependentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (ImmunizationController) RecordDose(c *fiber.Ctx) error {
+	var data models.ImmunizationDoseReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.DependentID = dependentID
+	res, err := immunizationServer.RecordGuardianDose(c.Locals("usertag").(string), data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (ImmunizationController) RemoveDose(c *fiber.Ctx) error {
+	dependentID, err := strconv.Atoi(c.Params("dependent_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	doseID, err := strconv.Atoi(c.Params("dose_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := immunizationServer.RemoveGuardianDose(c.Locals("usertag").(string), dependentID, doseID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
+
+func (ImmunizationController) DoctorFetchStatus(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := immunizationServer.GetDoctorStatus(c.Locals("doctortag").(string), appointmentID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (ImmunizationController) DoctorRecordDose(c *fiber.Ctx) error {
+	var data models.ImmunizationDoseReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := immunizationServer.RecordDoctorDose(c.Locals("doctortag").(string), appointmentID, data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (ImmunizationController) DoctorRemoveDose(c *fiber.Ctx) error {
+	appointmentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	doseID, err := strconv.Atoi(c.Params("dose_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := immunizationServer.RemoveDoctorDose(c.Locals("doctortag").(string), appointmentID, doseID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
+
+func (ImmunizationController) FetchSchedule(c *fiber.Ctx) error {
+	res, err := immunizationServer.GetSchedule()
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
@@ -294,6 +294,11 @@ func (Controller) UpdateProfile(c *fiber.Ctx) error {
 		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
 	}
 	data.Usertag = c.Locals("usertag").(string)
+	if data.TimeZone != "" {
+		if _, err := time.LoadLocation(data.TimeZone); err != nil {
+			return responses.ErrorResponse(c, "time_zone must be an IANA zone name like Africa/Lagos", 400)
+		}
+	}
 	res, err := UserServer.UpdateProfile(data)
 	if err != nil {
 		return responses.ErrorResponse(c, err.Error(), 400)
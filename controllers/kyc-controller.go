@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type KycController struct{}
+
+var kycServer servers.KycServer
+
+var kycDocumentTypes = map[string]bool{
+	"bvn":             true,
+	"nin":             true,
+	"passport":        true,
+	"drivers_license": true,
+	"voters_card":     true,
+}
+
+func (KycController) FetchKycStatus(c *fiber.Ctx) error {
+	usertag := c.Locals("usertag").(string)
+	res, err := kycServer.GetKycStatus(usertag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (KycController) SendPhoneOTP(c *fiber.Ctx) error {
+	usertag := c.Locals("usertag").(string)
+	res, err := kycServer.SendPhoneOTP(usertag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.SMS_OTP_SENT, res, 200)
+}
+
+func (KycController) VerifyPhone(c *fiber.Ctx) error {
+	var data models.VerifyPhoneReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.Usertag = c.Locals("usertag").(string)
+	if data.OTP == "" {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := kycServer.VerifyPhone(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.OTP_VERIFIED, res, 200)
+}
+
+func (KycController) SubmitDocument(c *fiber.Ctx) error {
+	var data models.KycDocumentReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.Usertag = c.Locals("usertag").(string)
+	if data.DocumentNumber == "" || !kycDocumentTypes[data.DocumentType] {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	// bvn and nin are verified by number alone, every other document needs an image
+	if data.DocumentType != "bvn" && data.DocumentType != "nin" && data.DocumentURL == "" {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := kycServer.SubmitDocument(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (KycController) FetchKycDocuments(c *fiber.Ctx) error {
+	var data models.GetDataReq
+	if c.Query("page") != "" {
+		data.Page, _ = strconv.Atoi(c.Query("page"))
+	} else {
+		data.Page = 1
+	}
+	if c.Query("limit") != "" {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		data.Limit = min(limit, 100)
+	} else {
+		data.Limit = 100
+	}
+	data.Status = c.Query("status", "pending")
+
+	res, err := kycServer.GetKycDocuments(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (KycController) ReviewKycDocument(c *fiber.Ctx) error {
+	var payload models.ReviewKycDocumentReq
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	payload.DocumentID = c.Params("document_id")
+	payload.AdminTag = c.Locals("usertag").(string)
+	if payload.DocumentID == "" || (payload.Status != "approved" && payload.Status != "rejected") {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	if payload.Status == "rejected" && payload.ReviewNote == "" {
+		return responses.ErrorResponse(c, "a review note is required when rejecting a document", 400)
+	}
+	res, err := kycServer.ReviewKycDocument(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
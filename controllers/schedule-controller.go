@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ScheduleController struct{}
+
+var scheduleServer servers.ScheduleServer
+
+// validWindow checks an "HH:MM"-"HH:MM" window that ends after it starts
+func validWindow(start, end string) bool {
+	startTime, err := time.Parse("15:04", start)
+	if err != nil {
+		return false
+	}
+	endTime, err := time.Parse("15:04", end)
+	if err != nil {
+		return false
+	}
+	return endTime.After(startTime)
+}
+
+func (ScheduleController) FetchSchedule(c *fiber.Ctx) error {
+	res, err := scheduleServer.GetSchedule(c.Params("doctortag"))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (ScheduleController) UpdateSchedule(c *fiber.Ctx) error {
+	var payload models.UpdateScheduleReq
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	payload.Doctortag = c.Params("doctortag")
+	if payload.TimeZone != "" {
+		if _, err := time.LoadLocation(payload.TimeZone); err != nil {
+			return responses.ErrorResponse(c, "time_zone must be an IANA zone name like Africa/Lagos", 400)
+		}
+	}
+	if payload.SlotDurationMinutes < 5 || payload.SlotDurationMinutes > 240 {
+		return responses.ErrorResponse(c, "slot duration must be between 5 and 240 minutes", 400)
+	}
+	for _, window := range append(payload.WorkingHours, payload.Breaks...) {
+		if window.DayOfWeek < 0 || window.DayOfWeek > 6 || !validWindow(window.StartTime, window.EndTime) {
+			return responses.ErrorResponse(c, "each window needs a day_of_week from 0 to 6 and HH:MM times that end after they start", 400)
+		}
+	}
+	res, err := scheduleServer.UpdateSchedule(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (ScheduleController) AddOverride(c *fiber.Ctx) error {
+	var payload models.ScheduleOverride
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	payload.Doctortag = c.Params("doctortag")
+	if _, err := time.Parse("2006-01-02", payload.Date); err != nil {
+		return responses.ErrorResponse(c, "date must be in YYYY-MM-DD format", 400)
+	}
+	// leaving both times empty marks the whole day off
+	if (payload.StartTime != "" || payload.EndTime != "") && !validWindow(payload.StartTime, payload.EndTime) {
+		return responses.ErrorResponse(c, "start_time and end_time must be HH:MM and end after they start", 400)
+	}
+	res, err := scheduleServer.AddOverride(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (ScheduleController) DeleteOverride(c *fiber.Ctx) error {
+	res, err := scheduleServer.DeleteOverride(c.Params("doctortag"), c.Params("override_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
+
+func (ScheduleController) AddTimeOff(c *fiber.Ctx) error {
+	var payload models.TimeOff
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	payload.Doctortag = c.Params("doctortag")
+	if payload.StartsAt.IsZero() || !payload.EndsAt.After(payload.StartsAt) {
+		return responses.ErrorResponse(c, "ends_at must be after starts_at", 400)
+	}
+	res, err := scheduleServer.AddTimeOff(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (ScheduleController) DeleteTimeOff(c *fiber.Ctx) error {
+	res, err := scheduleServer.DeleteTimeOff(c.Params("doctortag"), c.Params("time_off_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
+
+func (ScheduleController) FetchOpenSlots(c *fiber.Ctx) error {
+	data := models.SlotsReq{
+		Doctortag: c.Params("doctortag"),
+		Usertag:   c.Locals("usertag").(string),
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+	}
+	res, err := scheduleServer.GetOpenSlots(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (ScheduleController) FetchFirstAvailable(c *fiber.Ctx) error {
+	data := models.FirstAvailableReq{
+		Usertag:        c.Locals("usertag").(string),
+		Specialization: c.Query("specialization"),
+		State:          c.Query("state"),
+		From:           c.Query("from"),
+	}
+	if data.Specialization == "" {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	if c.Query("limit") != "" {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		data.Limit = min(max(limit, 1), 50)
+	} else {
+		data.Limit = 10
+	}
+	res, err := scheduleServer.FirstAvailable(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SubscriptionController struct{}
+
+var subscriptionServer servers.SubscriptionServer
+
+func (SubscriptionController) FetchPlans(c *fiber.Ctx) error {
+	res, err := subscriptionServer.GetPlans()
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (SubscriptionController) Subscribe(c *fiber.Ctx) error {
+	var data models.SubscribeReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.Usertag = c.Locals("usertag").(string)
+	if data.PlanID == 0 || (data.PaymentMethod != "wallet" && data.PaymentMethod != "card") {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	if data.PaymentMethod == "card" && data.CardID == 0 {
+		return responses.ErrorResponse(c, "select a saved card to pay with", 400)
+	}
+	res, err := subscriptionServer.Subscribe(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (SubscriptionController) FetchSubscription(c *fiber.Ctx) error {
+	usertag := c.Locals("usertag").(string)
+	res, err := subscriptionServer.GetSubscription(usertag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (SubscriptionController) FetchInvoices(c *fiber.Ctx) error {
+	usertag := c.Locals("usertag").(string)
+	res, err := subscriptionServer.GetInvoices(usertag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (SubscriptionController) ChangePlan(c *fiber.Ctx) error {
+	var data models.ChangePlanReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.Usertag = c.Locals("usertag").(string)
+	if data.PlanID == 0 {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := subscriptionServer.ChangePlan(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (SubscriptionController) CancelSubscription(c *fiber.Ctx) error {
+	usertag := c.Locals("usertag").(string)
+	res, err := subscriptionServer.CancelSubscription(usertag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (SubscriptionController) FetchSavedCards(c *fiber.Ctx) error {
+	usertag := c.Locals("usertag").(string)
+	res, err := subscriptionServer.GetSavedCards(usertag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (SubscriptionController) FetchCheckoutSummary(c *fiber.Ctx) error {
+	usertag := c.Locals("usertag").(string)
+	res, err := subscriptionServer.GetCheckoutSummary(usertag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+// Checkout pays for the cart from the wallet with the plan discount applied
+func (SubscriptionController) Checkout(c *fiber.Ctx) error {
+	usertag := c.Locals("usertag").(string)
+	res, err := subscriptionServer.Checkout(usertag)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (AdminController) FetchSubscriptionPlans(c *fiber.Ctx) error {
+	res, err := adminServer.GetSubscriptionPlans()
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (AdminController) CreateSubscriptionPlan(c *fiber.Ctx) error {
+	var payload models.SubscriptionPlan
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	if payload.Name == "" || payload.MonthlyPrice <= 0 || payload.ConsultationsPerCycle < 0 ||
+		payload.MedicationDiscountPercent < 0 || payload.MedicationDiscountPercent > 100 {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := adminServer.CreateSubscriptionPlan(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (AdminController) UpdateSubscriptionPlan(c *fiber.Ctx) error {
+	var payload models.SubscriptionPlan
+	if err := c.BodyParser(&payload); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	planID, err := strconv.Atoi(c.Params("plan_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	payload.PlanID = planID
+	if payload.Name == "" || payload.MonthlyPrice <= 0 || payload.ConsultationsPerCycle < 0 ||
+		payload.MedicationDiscountPercent < 0 || payload.MedicationDiscountPercent > 100 {
+		return responses.ErrorResponse(c, responses.INCOMPLETE_DATA, 400)
+	}
+	res, err := adminServer.UpdateSubscriptionPlan(payload)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (AdminController) FetchSubscriptions(c *fiber.Ctx) error {
+	var data models.GetDataReq
+	if c.Query("page") != "" {
+		data.Page, _ = strconv.Atoi(c.Query("page"))
+	} else {
+		data.Page = 1
+	}
+	if c.Query("limit") != "" {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		data.Limit = min(limit, 100)
+	} else {
+		data.Limit = 100
+	}
+	data.Status = c.Query("status")
+
+	res, err := adminServer.GetSubscriptions(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type WaitlistController struct{}
+
+var waitlistServer servers.WaitlistServer
+
+func (WaitlistController) JoinWaitlist(c *fiber.Ctx) error {
+	var data models.JoinWaitlistReq
+	if err := c.BodyParser(&data); err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	data.Usertag = c.Locals("usertag").(string)
+	if data.Doctortag == "" && data.Specialization == "" {
+		return responses.ErrorResponse(c, "choose a doctor or a specialization", 400)
+	}
+	res, err := waitlistServer.JoinWaitlist(data)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (WaitlistController) FetchWaitlist(c *fiber.Ctx) error {
+	res, err := waitlistServer.GetWaitlist(c.Locals("usertag").(string))
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_FETCHED, res, 200)
+}
+
+func (WaitlistController) AcceptOffer(c *fiber.Ctx) error {
+	entryID, err := strconv.Atoi(c.Params("entry_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := waitlistServer.AcceptOffer(c.Locals("usertag").(string), entryID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_CREATED, res, 200)
+}
+
+func (WaitlistController) DeclineOffer(c *fiber.Ctx) error {
+	entryID, err := strconv.Atoi(c.Params("entry_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := waitlistServer.DeclineOffer(c.Locals("usertag").(string), entryID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_UPDATED, res, 200)
+}
+
+func (WaitlistController) LeaveWaitlist(c *fiber.Ctx) error {
+	entryID, err := strconv.Atoi(c.Params("entry_id"))
+	if err != nil {
+		return responses.ErrorResponse(c, responses.BAD_DATA, 400)
+	}
+	res, err := waitlistServer.LeaveWaitlist(c.Locals("usertag").(string), entryID)
+	if err != nil {
+		return responses.ErrorResponse(c, err.Error(), 400)
+	}
+	return responses.SuccessResponse(c, responses.DATA_DELETED, res, 200)
+}
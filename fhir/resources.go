@@ -0,0 +1,248 @@
+// Package fhir holds the subset of FHIR R4 used to exchange records with partner hospitals. Only the elements
+// we read or write are declared, anything else in an incoming resource is ignored
+package fhir
+
+import "encoding/json"
+
+const ContentType = "application/fhir+json"
+
+// code systems we emit or read
+const (
+	LOINC                  = "http://loinc.org"
+	UCUM                   = "http://unitsofmeasure.org"
+	ObservationCategory    = "http://terminology.hl7.org/CodeSystem/observation-category"
+	AllergyClinicalStatus  = "http://terminology.hl7.org/CodeSystem/allergyintolerance-clinical"
+	AllergyVerification    = "http://terminology.hl7.org/CodeSystem/allergyintolerance-verification"
+	IssueSeverityError     = "error"
+	IssueSeverityInfo      = "information"
+	IssueCodeInvalid       = "invalid"
+	IssueCodeNotSupported  = "not-supported"
+	IssueCodeNotFound      = "not-found"
+	IssueCodeDuplicate     = "duplicate"
+	IssueCodeProcessing    = "processing"
+	IssueCodeInformational = "informational"
+)
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Label is the text of the concept, falling back to the first coding's display
+func (c *CodeableConcept) Label() string {
+	if c == nil {
+		return ""
+	}
+	if c.Text != "" {
+		return c.Text
+	}
+	for _, coding := range c.Coding {
+		if coding.Display != "" {
+			return coding.Display
+		}
+	}
+	return ""
+}
+
+// CodeIn returns the first code from the given system, or from any system when system is empty
+func (c *CodeableConcept) CodeIn(system string) string {
+	if c == nil {
+		return ""
+	}
+	for _, coding := range c.Coding {
+		if system == "" || coding.System == system {
+			return coding.Code
+		}
+	}
+	return ""
+}
+
+type Identifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type HumanName struct {
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Address struct {
+	Text  string `json:"text,omitempty"`
+	State string `json:"state,omitempty"`
+}
+
+type Quantity struct {
+	Value  *float64 `json:"value,omitempty"`
+	Unit   string   `json:"unit,omitempty"`
+	System string   `json:"system,omitempty"`
+	Code   string   `json:"code,omitempty"`
+}
+
+type Annotation struct {
+	Text string `json:"text"`
+}
+
+type PatientContact struct {
+	Relationship []CodeableConcept `json:"relationship,omitempty"`
+	Name         *HumanName        `json:"name,omitempty"`
+}
+
+type Patient struct {
+	ResourceType string           `json:"resourceType"`
+	ID           string           `json:"id,omitempty"`
+	Identifier   []Identifier     `json:"identifier,omitempty"`
+	Name         []HumanName      `json:"name,omitempty"`
+	Telecom      []ContactPoint   `json:"telecom,omitempty"`
+	Gender       string           `json:"gender,omitempty"`
+	BirthDate    string           `json:"birthDate,omitempty"`
+	Address      []Address        `json:"address,omitempty"`
+	Contact      []PatientContact `json:"contact,omitempty"`
+}
+
+type Qualification struct {
+	Code CodeableConcept `json:"code"`
+}
+
+type Practitioner struct {
+	ResourceType  string          `json:"resourceType"`
+	ID            string          `json:"id,omitempty"`
+	Identifier    []Identifier    `json:"identifier,omitempty"`
+	Name          []HumanName     `json:"name,omitempty"`
+	Telecom       []ContactPoint  `json:"telecom,omitempty"`
+	Gender        string          `json:"gender,omitempty"`
+	Qualification []Qualification `json:"qualification,omitempty"`
+}
+
+type AppointmentParticipant struct {
+	Actor  Reference `json:"actor"`
+	Status string    `json:"status"`
+}
+
+type Appointment struct {
+	ResourceType    string                   `json:"resourceType"`
+	ID              string                   `json:"id,omitempty"`
+	Identifier      []Identifier             `json:"identifier,omitempty"`
+	Status          string                   `json:"status"`
+	ReasonCode      []CodeableConcept        `json:"reasonCode,omitempty"`
+	Start           string                   `json:"start,omitempty"`
+	End             string                   `json:"end,omitempty"`
+	MinutesDuration int                      `json:"minutesDuration,omitempty"`
+	Created         string                   `json:"created,omitempty"`
+	Participant     []AppointmentParticipant `json:"participant"`
+}
+
+type Dosage struct {
+	Text string `json:"text,omitempty"`
+}
+
+type MedicationRequest struct {
+	ResourceType              string           `json:"resourceType"`
+	ID                        string           `json:"id,omitempty"`
+	Identifier                []Identifier     `json:"identifier,omitempty"`
+	Status                    string           `json:"status"`
+	Intent                    string           `json:"intent"`
+	ReportedBoolean           bool             `json:"reportedBoolean,omitempty"`
+	MedicationCodeableConcept *CodeableConcept `json:"medicationCodeableConcept,omitempty"`
+	Subject                   Reference        `json:"subject"`
+	AuthoredOn                string           `json:"authoredOn,omitempty"`
+	Requester                 *Reference       `json:"requester,omitempty"`
+	DosageInstruction         []Dosage         `json:"dosageInstruction,omitempty"`
+	Note                      []Annotation     `json:"note,omitempty"`
+}
+
+type Observation struct {
+	ResourceType      string            `json:"resourceType"`
+	ID                string            `json:"id,omitempty"`
+	Identifier        []Identifier      `json:"identifier,omitempty"`
+	Status            string            `json:"status"`
+	Category          []CodeableConcept `json:"category,omitempty"`
+	Code              CodeableConcept   `json:"code"`
+	Subject           Reference         `json:"subject"`
+	EffectiveDateTime string            `json:"effectiveDateTime,omitempty"`
+	ValueQuantity     *Quantity         `json:"valueQuantity,omitempty"`
+	Performer         []Reference       `json:"performer,omitempty"`
+	Note              []Annotation      `json:"note,omitempty"`
+}
+
+type AllergyReaction struct {
+	Manifestation []CodeableConcept `json:"manifestation"`
+	Severity      string            `json:"severity,omitempty"`
+}
+
+type AllergyIntolerance struct {
+	ResourceType       string            `json:"resourceType"`
+	ID                 string            `json:"id,omitempty"`
+	Identifier         []Identifier      `json:"identifier,omitempty"`
+	ClinicalStatus     *CodeableConcept  `json:"clinicalStatus,omitempty"`
+	VerificationStatus *CodeableConcept  `json:"verificationStatus,omitempty"`
+	Code               *CodeableConcept  `json:"code,omitempty"`
+	Patient            Reference         `json:"patient"`
+	OnsetDateTime      string            `json:"onsetDateTime,omitempty"`
+	RecordedDate       string            `json:"recordedDate,omitempty"`
+	Reaction           []AllergyReaction `json:"reaction,omitempty"`
+	Note               []Annotation      `json:"note,omitempty"`
+}
+
+type Issue struct {
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+}
+
+type OperationOutcome struct {
+	ResourceType string  `json:"resourceType"`
+	Issue        []Issue `json:"issue"`
+}
+
+// Outcome wraps issues in an OperationOutcome
+func Outcome(issues ...Issue) *OperationOutcome {
+	return &OperationOutcome{ResourceType: "OperationOutcome", Issue: issues}
+}
+
+type BundleResponse struct {
+	Status   string            `json:"status"`
+	Location string            `json:"location,omitempty"`
+	Outcome  *OperationOutcome `json:"outcome,omitempty"`
+}
+
+// BundleEntry keeps the resource raw, its type decides what it is decoded into
+type BundleEntry struct {
+	FullURL  string          `json:"fullUrl,omitempty"`
+	Resource json.RawMessage `json:"resource,omitempty"`
+	Response *BundleResponse `json:"response,omitempty"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	ID           string        `json:"id,omitempty"`
+	Type         string        `json:"type"`
+	Timestamp    string        `json:"timestamp,omitempty"`
+	Total        *int          `json:"total,omitempty"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+// ResourceHeader reads the fields every resource shares
+type ResourceHeader struct {
+	ResourceType string       `json:"resourceType"`
+	ID           string       `json:"id"`
+	Identifier   []Identifier `json:"identifier"`
+}
@@ -0,0 +1,172 @@
+// Package growth scores child measurements against the WHO Child Growth Standards (2006) for ages 0 to 5 years.
+// who_lms.csv holds the L, M and S parameters of the WHO tables at selected ages, ages in between are interpolated
+package growth
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	Weight = "weight" // weight-for-age, kg
+	Height = "height" // length-for-age under 24 months, height-for-age after, cm
+	Head   = "head"   // head circumference-for-age, cm
+	BMI    = "bmi"    // BMI-for-age, kg/m²
+)
+
+// Indicators lists what can be charted, in display order
+var Indicators = []string{Weight, Height, Head, BMI}
+
+// MaxAgeMonths is where the standards end, older children are not scored
+const MaxAgeMonths = 60
+
+// DaysPerMonth is the average month length the WHO tables use to convert age in days
+const DaysPerMonth = 30.4375
+
+type lms struct {
+	ageMonths float64
+	l, m, s   float64
+}
+
+//go:embed who_lms.csv
+var whoCSV string
+
+// tables is keyed by indicator and sex, each slice sorted by age
+var tables = loadTables()
+
+func loadTables() map[string][]lms {
+	records, err := csv.NewReader(strings.NewReader(whoCSV)).ReadAll()
+	if err != nil {
+		log.Fatal("Failed to read WHO growth tables: ", err)
+	}
+	out := map[string][]lms{}
+	for _, r := range records[1:] {
+		values := make([]float64, 4)
+		for i, field := range r[2:6] {
+			if values[i], err = strconv.ParseFloat(field, 64); err != nil {
+				log.Fatal("Invalid WHO growth table row: ", r)
+			}
+		}
+		key := r[0] + "/" + r[1]
+		out[key] = append(out[key], lms{ageMonths: values[0], l: values[1], m: values[2], s: values[3]})
+	}
+	for _, rows := range out {
+		sort.Slice(rows, func(i, j int) bool { return rows[i].ageMonths < rows[j].ageMonths })
+	}
+	return out
+}
+
+// NormalizeSex maps the free-text gender stored on profiles to the sex the tables are split by, "" when unknown
+func NormalizeSex(gender string) string {
+	switch strings.ToLower(strings.TrimSpace(gender)) {
+	case "male", "m", "boy":
+		return "male"
+	case "female", "f", "girl":
+		return "female"
+	}
+	return ""
+}
+
+func lookup(indicator, sex string, ageMonths float64) (lms, bool) {
+	rows := tables[indicator+"/"+sex]
+	if len(rows) == 0 || ageMonths < 0 || ageMonths > MaxAgeMonths {
+		return lms{}, false
+	}
+	i := sort.Search(len(rows), func(i int) bool { return rows[i].ageMonths >= ageMonths })
+	if rows[i].ageMonths == ageMonths || i == 0 {
+		return rows[i], true
+	}
+	lo, hi := rows[i-1], rows[i]
+	f := (ageMonths - lo.ageMonths) / (hi.ageMonths - lo.ageMonths)
+	return lms{
+		ageMonths: ageMonths,
+		l:         lo.l + f*(hi.l-lo.l),
+		m:         lo.m + f*(hi.m-lo.m),
+		s:         lo.s + f*(hi.s-lo.s),
+	}, true
+}
+
+// valueAt is the measurement sitting at z standard deviations
+func (p lms) valueAt(z float64) float64 {
+	if p.l == 0 {
+		return p.m * math.Exp(p.s*z)
+	}
+	return p.m * math.Pow(1+p.l*p.s*z, 1/p.l)
+}
+
+func (p lms) zScore(value float64) float64 {
+	if p.l == 0 {
+		return math.Log(value/p.m) / p.s
+	}
+	return (math.Pow(value/p.m, p.l) - 1) / (p.l * p.s)
+}
+
+// ZScore scores a measurement, ok is false outside 0 to 5 years or when sex is unknown. Weight and BMI beyond
+// ±3 use the WHO restricted method, which measures the tail in steps of the distance between the 2 and 3 SD lines
+func ZScore(indicator, sex string, ageMonths, value float64) (z float64, ok bool) {
+	p, ok := lookup(indicator, sex, ageMonths)
+	if !ok || value <= 0 {
+		return 0, false
+	}
+	z = p.zScore(value)
+	if indicator != Weight && indicator != BMI {
+		return z, true
+	}
+	if z > 3 {
+		sd3 := p.valueAt(3)
+		z = 3 + (value-sd3)/(sd3-p.valueAt(2))
+	} else if z < -3 {
+		sd3 := p.valueAt(-3)
+		z = -3 - (sd3-value)/(p.valueAt(-2)-sd3)
+	}
+	return z, true
+}
+
+// Percentile converts a z-score to the share of the reference population below it, 0 to 100
+func Percentile(z float64) float64 {
+	return 50 * (1 + math.Erf(z/math.Sqrt2))
+}
+
+// ReferencePoint holds the values on the usual chart lines at one age
+type ReferencePoint struct {
+	AgeMonths float64 `json:"age_months"`
+	P3        float64 `json:"p3"`
+	P15       float64 `json:"p15"`
+	P50       float64 `json:"p50"`
+	P85       float64 `json:"p85"`
+	P97       float64 `json:"p97"`
+}
+
+// percentile lines as z-scores
+const (
+	z3  = -1.8808
+	z15 = -1.0364
+	z85 = 1.0364
+	z97 = 1.8808
+)
+
+// ReferenceCurve returns the 3rd to 97th percentile lines of an indicator month by month, for drawing the chart
+func ReferenceCurve(indicator, sex string) []ReferencePoint {
+	var curve []ReferencePoint
+	for month := 0; month <= MaxAgeMonths; month++ {
+		p, ok := lookup(indicator, sex, float64(month))
+		if !ok {
+			return nil
+		}
+		round := func(v float64) float64 { return math.Round(v*100) / 100 }
+		curve = append(curve, ReferencePoint{
+			AgeMonths: float64(month),
+			P3:        round(p.valueAt(z3)),
+			P15:       round(p.valueAt(z15)),
+			P50:       round(p.m),
+			P85:       round(p.valueAt(z85)),
+			P97:       round(p.valueAt(z97)),
+		})
+	}
+	return curve
+}
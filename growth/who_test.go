@@ -0,0 +1,123 @@
+package growth
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name      string
+		indicator string
+		sex       string
+		ageMonths float64
+		ok        bool
+		want      lms
+	}{
+		{"exact row", Weight, "male", 0, true, lms{ageMonths: 0, l: 0.3487, m: 3.3464, s: 0.14602}},
+		{"exact row later", Height, "female", 12, true, lms{ageMonths: 12, l: 1, m: 74.0150, s: 0.03479}},
+		{"interpolated halfway", Weight, "male", 1.5, true, lms{ageMonths: 1.5, l: (0.2297 + 0.1970) / 2, m: (4.4709 + 5.5675) / 2, s: (0.13395 + 0.12385) / 2}},
+		{"last month", Weight, "female", MaxAgeMonths, true, lms{}},
+		{"negative age", Weight, "male", -1, false, lms{}},
+		{"past five years", Weight, "male", MaxAgeMonths + 0.1, false, lms{}},
+		{"unknown sex", Weight, "", 6, false, lms{}},
+		{"unknown indicator", "armspan", "male", 6, false, lms{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := lookup(tt.indicator, tt.sex, tt.ageMonths)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok || tt.want == (lms{}) {
+				return
+			}
+			if !near(got.ageMonths, tt.want.ageMonths) || !near(got.l, tt.want.l) || !near(got.m, tt.want.m) || !near(got.s, tt.want.s) {
+				t.Errorf("lookup = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZScore(t *testing.T) {
+	weight, _ := lookup(Weight, "male", 12)
+	height, _ := lookup(Height, "male", 12)
+	tests := []struct {
+		name      string
+		indicator string
+		sex       string
+		ageMonths float64
+		value     float64
+		want      float64
+		ok        bool
+	}{
+		{"median weight", Weight, "male", 12, weight.m, 0, true},
+		{"median bmi", BMI, "female", 0, 13.3363, 0, true},
+		{"one sd above median height", Height, "male", 12, height.m * (1 + height.s), 1, true},
+		{"two sd below median height", Height, "male", 12, height.m * (1 - 2*height.s), -2, true},
+		{"at the +2 line", Weight, "male", 12, weight.valueAt(2), 2, true},
+		// beyond ±3 the restricted method steps by the distance between the 2 and 3 SD lines
+		{"restricted above +3", Weight, "male", 12, 2*weight.valueAt(3) - weight.valueAt(2), 4, true},
+		{"restricted below -3", Weight, "male", 12, 2*weight.valueAt(-3) - weight.valueAt(-2), -4, true},
+		{"zero value", Weight, "male", 12, 0, 0, false},
+		{"too old", Weight, "male", 61, 18, 0, false},
+		{"unknown sex", Weight, "", 12, 9.6, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z, ok := ZScore(tt.indicator, tt.sex, tt.ageMonths, tt.value)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !near(z, tt.want) {
+				t.Errorf("z = %v, want %v", z, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeightBeyondThreeIsNotRestricted(t *testing.T) {
+	p, _ := lookup(Height, "female", 12)
+	z, ok := ZScore(Height, "female", 12, p.m*(1+4*p.s))
+	if !ok || !near(z, 4) {
+		t.Errorf("z = %v, %v, want 4, true", z, ok)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		z    float64
+		want float64
+	}{
+		{0, 50},
+		{z97, 97},
+		{z3, 3},
+		{z85, 85},
+		{z15, 15},
+	}
+	for _, tt := range tests {
+		if got := Percentile(tt.z); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("Percentile(%v) = %v, want %v", tt.z, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSex(t *testing.T) {
+	tests := map[string]string{
+		"Male":      "male",
+		" f ":       "female",
+		"girl":      "female",
+		"BOY":       "male",
+		"":          "",
+		"nonbinary": "",
+	}
+	for gender, want := range tests {
+		if got := NormalizeSex(gender); got != want {
+			t.Errorf("NormalizeSex(%q) = %q, want %q", gender, got, want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Package immunization loads national immunization schedules kept as data. Bundled schedules live in
+// schedules/<name>.csv, any other name is read as a path so a deployment can ship its own file
+package immunization
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed schedules/*.csv
+var bundled embed.FS
+
+// Dose is one entry of a schedule, due AgeDays after birth. MaxAgeDays is the oldest a child can still get it,
+// 0 when there is no limit, and Sex limits it to boys or girls when set
+type Dose struct {
+	Code       string `json:"code"`
+	Vaccine    string `json:"vaccine"`
+	DoseNumber int    `json:"dose_number"`
+	AgeDays    int    `json:"age_days"`
+	MaxAgeDays int    `json:"max_age_days,omitempty"`
+	Sex        string `json:"sex,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+}
+
+type Schedule struct {
+	Name  string `json:"name"`
+	Doses []Dose `json:"doses"`
+}
+
+// Load reads a bundled schedule by name, or a CSV file with the same columns by path
+func Load(name string) (Schedule, error) {
+	data, err := bundled.ReadFile("schedules/" + name + ".csv")
+	if err != nil {
+		if data, err = os.ReadFile(name); err != nil {
+			return Schedule{}, fmt.Errorf("immunization schedule %q not found", name)
+		}
+	}
+	doses, err := parse(strings.NewReader(string(data)))
+	if err != nil {
+		return Schedule{}, fmt.Errorf("immunization schedule %q: %w", name, err)
+	}
+	return Schedule{Name: name, Doses: doses}, nil
+}
+
+func parse(r io.Reader) ([]Dose, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("no doses")
+	}
+	seen := map[string]bool{}
+	var doses []Dose
+	for i, rec := range records[1:] {
+		if len(rec) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 columns", i+2)
+		}
+		d := Dose{Code: strings.ToUpper(strings.TrimSpace(rec[0])), Vaccine: rec[1], Sex: rec[5], Notes: rec[6]}
+		if d.Code == "" || seen[d.Code] {
+			return nil, fmt.Errorf("line %d: missing or repeated code", i+2)
+		}
+		seen[d.Code] = true
+		for j, field := range []*int{&d.DoseNumber, &d.AgeDays, &d.MaxAgeDays} {
+			value := strings.TrimSpace(rec[j+2])
+			if value == "" {
+				continue
+			}
+			if *field, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("line %d: %s is not a number", i+2, value)
+			}
+		}
+		if d.MaxAgeDays != 0 && d.MaxAgeDays < d.AgeDays {
+			return nil, fmt.Errorf("line %d: max_age_days is before age_days", i+2)
+		}
+		doses = append(doses, d)
+	}
+	return doses, nil
+}
+
+// Find looks a dose up by its code
+func (s Schedule) Find(code string) (Dose, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, d := range s.Doses {
+		if d.Code == code {
+			return d, true
+		}
+	}
+	return Dose{}, false
+}
+
+// AppliesTo reports whether the dose is meant for a child of this sex, an unknown sex gets every dose
+func (d Dose) AppliesTo(sex string) bool {
+	return d.Sex == "" || sex == "" || d.Sex == sex
+}
+
+// DueOn is the date the dose falls due for a child born on dob
+func (d Dose) DueOn(dob time.Time) time.Time {
+	return dob.AddDate(0, 0, d.AgeDays)
+}
+
+// LastOn is the last date the dose can still be given, nil when it has no upper age
+func (d Dose) LastOn(dob time.Time) *time.Time {
+	if d.MaxAgeDays == 0 {
+		return nil
+	}
+	last := dob.AddDate(0, 0, d.MaxAgeDays)
+	return &last
+}
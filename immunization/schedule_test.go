@@ -0,0 +1,117 @@
+package immunization
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const header = "code,vaccine,dose,age_days,max_age_days,sex,notes\n"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []Dose
+		wantErr string
+	}{
+		{
+			name: "codes are trimmed and upper cased, empty numbers stay zero",
+			csv:  header + " bcg ,BCG,1,0,365,,At birth\nhpv1,HPV,1,3285,,female,\n",
+			want: []Dose{
+				{Code: "BCG", Vaccine: "BCG", DoseNumber: 1, AgeDays: 0, MaxAgeDays: 365, Notes: "At birth"},
+				{Code: "HPV1", Vaccine: "HPV", DoseNumber: 1, AgeDays: 3285, Sex: "female"},
+			},
+		},
+		{name: "header only", csv: header, wantErr: "no doses"},
+		{name: "wrong column count", csv: "code,vaccine,dose,age_days,max_age_days,sex\nBCG,BCG,1,0,,\n", wantErr: "line 2: expected 7 columns"},
+		{name: "ragged rows", csv: header + "BCG,BCG,1,0\n", wantErr: "record on line 2: wrong number of fields"},
+		{name: "missing code", csv: header + ",BCG,1,0,,,\n", wantErr: "line 2: missing or repeated code"},
+		{name: "repeated code", csv: header + "BCG,BCG,1,0,,,\nbcg,BCG,2,0,,,\n", wantErr: "line 3: missing or repeated code"},
+		{name: "not a number", csv: header + "BCG,BCG,one,0,,,\n", wantErr: "line 2: one is not a number"},
+		{name: "max before due", csv: header + "BCG,BCG,1,30,10,,\n", wantErr: "line 2: max_age_days is before age_days"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parse(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d doses, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("dose %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBundledSchedulesLoad(t *testing.T) {
+	s, err := Load("ng-npi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Find(" bcg "); !ok {
+		t.Error("BCG not found in ng-npi")
+	}
+	if _, ok := s.Find("NOPE"); ok {
+		t.Error("found a dose that is not in the schedule")
+	}
+	if _, err := Load("missing-schedule"); err == nil {
+		t.Error("expected an error for an unknown schedule")
+	}
+}
+
+func TestDoseDates(t *testing.T) {
+	dob := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		dose Dose
+		due  time.Time
+		last *time.Time
+	}{
+		{"no upper age", Dose{AgeDays: 42}, time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC), nil},
+		{"with upper age", Dose{AgeDays: 0, MaxAgeDays: 14}, dob, ptr(time.Date(2024, 2, 14, 0, 0, 0, 0, time.UTC))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dose.DueOn(dob); !got.Equal(tt.due) {
+				t.Errorf("DueOn = %v, want %v", got, tt.due)
+			}
+			got := tt.dose.LastOn(dob)
+			if (got == nil) != (tt.last == nil) || (got != nil && !got.Equal(*tt.last)) {
+				t.Errorf("LastOn = %v, want %v", got, tt.last)
+			}
+		})
+	}
+}
+
+func TestAppliesTo(t *testing.T) {
+	tests := []struct {
+		doseSex, childSex string
+		want              bool
+	}{
+		{"", "male", true},
+		{"female", "", true},
+		{"female", "female", true},
+		{"female", "male", false},
+	}
+	for _, tt := range tests {
+		if got := (Dose{Sex: tt.doseSex}).AppliesTo(tt.childSex); got != tt.want {
+			t.Errorf("Dose{Sex: %q}.AppliesTo(%q) = %v, want %v", tt.doseSex, tt.childSex, got, tt.want)
+		}
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
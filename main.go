@@ -7,6 +7,8 @@ import (
 	"telemed/database"
 	"telemed/routes"
 	"telemed/servers"
+	"telemed/storage"
+	_ "time/tzdata" // IANA zones must load even on images without a zoneinfo database
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -15,8 +17,18 @@ import (
 func main() {
 	servers.Ctx = context.Background()
 	servers.Db = database.NewConnection()
+	servers.Storage = storage.NewBackend()
+	servers.BackfillAppointmentConsents()
+	go servers.StartTopUpExpiryJob()
+	go servers.StartSubscriptionRenewalJob()
+	go servers.StartAppointmentExpiryJob()
+	go servers.StartReminderJob()
+	go servers.StartWaitlistJob()
+	go servers.StartImmunizationReminderJob()
+	go servers.StartConsultationExpiryJob()
 	app := fiber.New(fiber.Config{
-		AppName: "Telemedicine Backend",
+		AppName:   "Telemedicine Backend",
+		BodyLimit: config.AttachmentMaxBytes + 1024*1024, // room for the multipart envelope around an attachment
 	})
 	app.Use(logger.New())
 	app.Get("/admin/healthchecker", func(c *fiber.Ctx) error {
@@ -37,6 +49,8 @@ func main() {
 		return c.Next()
 	})
 	routes.AdminRoutes(app)
+	routes.DoctorRoutes(app)
+	routes.FHIRRoutes(app)
 	routes.Routes(app)
 	app.All("*", func(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
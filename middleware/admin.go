@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"telemed/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AdminProtected accepts only tokens issued by the admin OTP login with one of the given roles and sets the
+// admintag in context as usertag, where the admin controllers read it
+func AdminProtected(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "Missing or invalid Authorization header",
+			})
+		}
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+		secret := config.JwtSecret
+		if secret == "" {
+			log.Println("No JWT secret key found in config")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Something went wrong, please try again later",
+			})
+		}
+		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(secret), nil
+		})
+		if err != nil || !token.Valid {
+			log.Printf("Token validation error: %v", err)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid or expired token",
+			})
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		role, _ := claims["role"].(string)
+		if !ok || !slices.Contains(roles, role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": "Unauthorized access",
+			})
+		}
+		admintag, ok := claims["admintag"].(string)
+		if !ok || admintag == "" {
+			log.Println("Admintag missing or invalid in token claims")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "Unauthorized: Please log in again",
+			})
+		}
+		c.Locals("usertag", admintag)
+		return c.Next()
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"telemed/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DoctorProtected accepts only tokens issued by the doctor login and sets doctortag in context
+func DoctorProtected() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "Missing or invalid Authorization header",
+			})
+		}
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+		secret := config.JwtSecret
+		if secret == "" {
+			log.Println("No JWT secret key found in config")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Something went wrong, please try again later",
+			})
+		}
+		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(secret), nil
+		})
+		if err != nil || !token.Valid {
+			log.Printf("Token validation error: %v", err)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid or expired token",
+			})
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok || claims["role"] != "doctor" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": "Unauthorized access",
+			})
+		}
+		doctortag, ok := claims["doctortag"].(string)
+		if !ok || doctortag == "" {
+			log.Println("Doctortag missing or invalid in token claims")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "Unauthorized: Please log in again",
+			})
+		}
+		c.Locals("doctortag", doctortag)
+		return c.Next()
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strings"
+	"telemed/servers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HospitalProtected accepts a partner hospital's API key as a bearer token and sets hospital_id in context
+func HospitalProtected() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "Missing or invalid Authorization header",
+			})
+		}
+		hospitalID, err := servers.HospitalForAPIKey(strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+		c.Locals("hospital_id", hospitalID)
+		return c.Next()
+	}
+}
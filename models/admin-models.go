@@ -54,9 +54,7 @@ type Appointment struct {
 	UserTag      string    `json:"usertag"`
 	DoctorTag    string    `json:"doctortag"`
 	Scheduled_at time.Time `json:"appointment_date"`
-	Reason       string    `json:"reason"`
 	Status       string    `json:"status"`
-	Fileurl      string    `json:"fileurl"`
 	Created_at   time.Time `json:"created_at"`
 }
 
@@ -81,8 +79,6 @@ type AppointmentIDResp struct {
 	UserTag         string    `json:"usertag"`
 	DoctorTag       string    `json:"doctortag"`
 	Scheduled_At    string    `json:"appointment_date"`
-	Reason          string    `json:"reason"`
-	File_URL        string    `json:"fileurl"`
 	Status          string    `json:"status"`
 	Created_At      time.Time `json:"created_at"`
 	First_name      string    `json:"firstname"`
@@ -99,25 +95,27 @@ type Doctorreq struct {
 }
 
 type Doctor struct {
-	DoctorTag           string         `json:"doctortag"`
-	FullName            string         `json:"fullname"`
-	Dob                 string         `json:"date_of_birth"`
-	Phone_no            string         `json:"phone_number"`
-	Gender              string         `json:"gender"`
-	Specialization      string         `json:"specialization"`
-	Country             string         `json:"country"`
-	City                string         `json:"city"`
-	YearsOfExperience   int            `json:"yrs_of_experience"`
-	Price               float64        `json:"price_per_session"`
-	About               string         `json:"about"`
-	Availability        datatypes.JSON `json:"availability"` // or []string if unmarshalled
-	ProfilePicURL       string         `json:"profile_pic_url"`
-	HospitalAffiliation string         `json:"hospital_affiliation"` // from hospital.name
+	DoctorTag           string  `json:"doctortag"`
+	FullName            string  `json:"fullname"`
+	Dob                 string  `json:"date_of_birth"`
+	Phone_no            string  `json:"phone_number"`
+	Gender              string  `json:"gender"`
+	Specialization      string  `json:"specialization"`
+	Country             string  `json:"country"`
+	City                string  `json:"city"`
+	YearsOfExperience   int     `json:"yrs_of_experience"`
+	Price               float64 `json:"price_per_session"`
+	About               string  `json:"about"`
+	SlotDuration        int     `json:"slot_duration_minutes"`
+	ProfilePicURL       string  `json:"profile_pic_url"`
+	HospitalAffiliation string  `json:"hospital_affiliation"` // from hospital.name
 }
 
 type UpdateAppointmentStatus struct {
 	Status         string `json:"status"`
 	Appointment_id string `json:"appointment_id"`
+	Note           string `json:"note"`
+	Admintag       string `json:"admintag"`
 }
 
 type RescheduleAppointmentReq struct {
@@ -139,16 +137,15 @@ type PatientIdReq struct {
 	Usertag string
 }
 
+// PatientIdResp is what an admin sees of a patient without break-glass access, demographics only
 type PatientIdResp struct {
-	UserTag          string         `json:"usertag"`
-	Name             string         `json:"name"`
-	Phone_No         string         `json:"phone_no"`
-	Gender           string         `json:"gender"`
-	Dob              datatypes.Date `json:"dob"`
-	Reason           string         `json:"reason"`
-	Attending_Doctor string         `json:"attending_doctor"`
-	File_URL         string         `json:"file_url"`
-	Status           string         `json:"status"`
+	UserTag  string     `json:"usertag"`
+	Name     string     `json:"name"`
+	Email    string     `json:"email"`
+	Phone_No string     `json:"phone_no"`
+	Gender   string     `json:"gender"`
+	Dob      *time.Time `json:"dob"`
+	State    string     `json:"state"`
 }
 
 type Pharmacy struct {
@@ -169,6 +166,7 @@ type Hospital struct {
 	State        string `json:"state"`
 	About        string `json:"about"`
 	Picture_url  string `json:"picture_url"`
+	TimeZone     string `json:"time_zone"`
 }
 
 type Inventory struct {
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AdminWalletResp struct {
+	Usertag        string  `json:"usertag"`
+	Balance        float64 `json:"balance"`
+	PendingBalance float64 `json:"pending_balance"`
+	WalletStatus   string  `json:"wallet_status"`
+	StatusReason   string  `json:"status_reason"`
+	KycTier        int     `json:"kyc_tier"`
+}
+
+type WalletStatusReq struct {
+	Usertag  string `json:"usertag"`
+	AdminTag string `json:"admintag"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason"`
+}
+
+type LedgerReq struct {
+	Usertag string
+	Page    int
+	Limit   int
+}
+
+type WalletTransaction struct {
+	TransactionID        int       `json:"transaction_id"`
+	Usertag              string    `json:"usertag"`
+	Amount               float64   `json:"amount"`
+	TransactionType      string    `json:"transaction_type"`
+	TransactionReference string    `json:"transaction_reference"`
+	Narration            string    `json:"narration"`
+	Status               string    `json:"status"`
+	Created_at           time.Time `json:"created_at"`
+}
+
+type WalletAdjustmentReq struct {
+	Usertag        string  `json:"usertag"`
+	AdminTag       string  `json:"admintag"`
+	AdjustmentType string  `json:"adjustment_type"`
+	Amount         float64 `json:"amount"`
+	Reason         string  `json:"reason"`
+}
+
+type WalletAdjustment struct {
+	AdjustmentID         int        `json:"adjustment_id"`
+	Usertag              string     `json:"usertag"`
+	AdjustmentType       string     `json:"adjustment_type"`
+	Amount               float64    `json:"amount"`
+	Reason               string     `json:"reason"`
+	Status               string     `json:"status"`
+	RequestedBy          string     `json:"requested_by"`
+	ApprovedBy           string     `json:"approved_by"`
+	TransactionReference string     `json:"transaction_reference"`
+	Created_at           time.Time  `json:"created_at"`
+	DecidedAt            *time.Time `json:"decided_at"`
+}
+
+type DecideAdjustmentReq struct {
+	AdjustmentID string `json:"adjustment_id"`
+	AdminTag     string `json:"admintag"`
+	Decision     string `json:"decision"`
+	Note         string `json:"note"`
+}
+
+type AuditLog struct {
+	LogID      int             `json:"log_id"`
+	AdminTag   string          `json:"admintag"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Details    json.RawMessage `json:"details"`
+	Created_at time.Time       `json:"created_at"`
+}
+
+type TopUpSummary struct {
+	PendingCount        int     `json:"pending_count"`
+	PendingAmount       float64 `json:"pending_amount"`
+	StalePendingCount   int     `json:"stale_pending_count"`
+	ExpiredCount        int     `json:"expired_count"`
+	ExpiredAmount       float64 `json:"expired_amount"`
+	SuccessCount        int     `json:"success_count"`
+	SuccessAmount       float64 `json:"success_amount"`
+	ExpiryWindowMinutes int     `json:"expiry_window_minutes"`
+}
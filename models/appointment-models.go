@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+type CancelAppointmentReq struct {
+	Usertag       string `json:"usertag"`
+	AppointmentID int    `json:"appointment_id"`
+	Reason        string `json:"reason"`
+}
+
+type PatientRescheduleReq struct {
+	Usertag        string    `json:"usertag"`
+	AppointmentID  int       `json:"appointment_id"`
+	NewScheduledAt time.Time `json:"new_scheduled_at"`
+}
+
+type CancellationQuote struct {
+	AppointmentID int     `json:"appointment_id"`
+	AmountPaid    float64 `json:"amount_paid"`
+	RefundPercent int     `json:"refund_percent"`
+	RefundAmount  float64 `json:"refund_amount"`
+	Policy        string  `json:"policy"`
+	CanReschedule bool    `json:"can_reschedule"`
+}
+
+type ProposalResponseReq struct {
+	Usertag       string `json:"usertag"`
+	AppointmentID int    `json:"appointment_id"`
+	Accept        bool   `json:"accept"`
+}
+
+type AppointmentStatusChange struct {
+	FromStatus   string    `json:"from_status"`
+	ToStatus     string    `json:"to_status"`
+	ChangedBy    string    `json:"changed_by"`
+	Note         string    `json:"note"`
+	RefundAmount float64   `json:"refund_amount"`
+	Created_at   time.Time `json:"created_at"`
+}
+
+type DoctorLoginReq struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type DoctorActionReq struct {
+	Doctortag      string    `json:"doctortag"`
+	AppointmentID  int       `json:"appointment_id"`
+	Note           string    `json:"note"`
+	NewScheduledAt time.Time `json:"new_scheduled_at"`
+}
+
+type DoctorAppointment struct {
+	AppointmentID int        `json:"appointment_id"`
+	PatientTag    string     `json:"usertag"`
+	PatientName   string     `json:"patient_name"` // the dependent's name when a guardian booked for them
+	DependentID   *int       `json:"dependent_id"`
+	GuardianName  string     `json:"guardian_name,omitempty"`
+	Scheduled_at  time.Time  `json:"appointment_date"`
+	ProposedAt    *time.Time `json:"proposed_at"`
+	FollowUpOf    *int       `json:"follow_up_of"`
+	Reason        string     `json:"reason"`
+	Status        string     `json:"status"`
+	Created_at    time.Time  `json:"created_at"`
+}
+
+type FollowUpReq struct {
+	Doctortag       string    `json:"doctortag"`
+	AppointmentID   int       `json:"appointment_id"`
+	ScheduledAt     time.Time `json:"appointment_date"`
+	Reason          string    `json:"reason"`
+	DiscountPercent int       `json:"discount_percent"` // 100 makes the follow-up free
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type Attachment struct {
+	AttachmentID   int       `json:"attachment_id"`
+	AppointmentID  int       `json:"appointment_id"`
+	UploadedByType string    `json:"uploaded_by_type"`
+	UploadedBy     string    `json:"uploaded_by"`
+	Category       string    `json:"category"`
+	FileName       string    `json:"file_name"`
+	ContentType    string    `json:"content_type"`
+	SizeBytes      int64     `json:"size_bytes"`
+	DownloadURL    string    `json:"download_url"`
+	URLExpiresAt   time.Time `json:"url_expires_at"`
+	Created_at     time.Time `json:"created_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type CalendarEvent struct {
+	UID         string
+	Sequence    int
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Status      string // TENTATIVE, CONFIRMED or CANCELLED
+	Attendees   []CalendarAttendee
+}
+
+// CalendarAttendee is who an emailed invite is addressed to, feeds carry none
+type CalendarAttendee struct {
+	Name  string
+	Email string
+}
+
+type CalendarFeedResp struct {
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+type ChatMessage struct {
+	MessageID      int        `json:"message_id"`
+	AppointmentID  int        `json:"appointment_id"`
+	SenderType     string     `json:"sender_type"`
+	SenderTag      string     `json:"sender_tag"`
+	Body           string     `json:"body"`
+	AttachmentID   *int       `json:"attachment_id,omitempty"` // fetched through the appointment's attachments endpoint
+	AttachmentName string     `json:"attachment_name,omitempty"`
+	AttachmentType string     `json:"attachment_type,omitempty"`
+	ReadAt         *time.Time `json:"read_at"`
+	Created_at     time.Time  `json:"created_at"`
+}
+
+// SendMessageReq may point at a file already uploaded to the same appointment's attachments
+type SendMessageReq struct {
+	Body         string `json:"body"`
+	AttachmentID *int   `json:"attachment_id"`
+}
+
+type MarkReadReq struct {
+	UpTo int `json:"up_to"`
+}
+
+// ChatFrame is what a client sends on the chat socket: a "message" or a "read" receipt
+type ChatFrame struct {
+	Type string `json:"type"`
+	UpTo int    `json:"up_to"`
+	SendMessageReq
+}
+
+// ChatEvent is what the server pushes to everyone connected to an appointment's chat
+type ChatEvent struct {
+	Type    string       `json:"type"`
+	Message *ChatMessage `json:"message,omitempty"`
+	UpTo    int          `json:"up_to,omitempty"`
+	From    string       `json:"from,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+type ChatTokenResp struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SocketURL string    `json:"socket_url"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+type ConsentReq struct {
+	Usertag     string `json:"usertag"`
+	DependentID *int   `json:"dependent_id"` // empty shares the account holder's own record
+	GranteeType string `json:"grantee_type"` // doctor or hospital
+	Grantee     string `json:"grantee"`      // doctortag or hospital_id
+	Purpose     string `json:"purpose"`
+	ExpiresAt   string `json:"expires_at"` // YYYY-MM-DD, the grant runs to the end of that day
+}
+
+// Consent is one sharing grant, PatientName is the dependent or account holder whose record it covers. AppointmentID is
+// set on the grant made by booking, which lasts while the appointment is open
+type Consent struct {
+	ConsentID     int        `json:"consent_id"`
+	DependentID   *int       `json:"dependent_id"`
+	PatientName   string     `json:"patient_name"`
+	GranteeType   string     `json:"grantee_type"`
+	Grantee       string     `json:"grantee"`
+	GranteeName   string     `json:"grantee_name"`
+	Purpose       string     `json:"purpose"`
+	AppointmentID *int       `json:"appointment_id"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	Active        bool       `json:"active"`
+	Created_at    time.Time  `json:"created_at"`
+}
+
+// BreakGlassAccess is one look at a patient's clinical data without consent, AppointmentID is set when it was one visit's chat
+type BreakGlassAccess struct {
+	AccessID      int       `json:"access_id"`
+	Admintag      string    `json:"admintag"`
+	DependentID   *int      `json:"dependent_id"`
+	AppointmentID *int      `json:"appointment_id"`
+	Reason        string    `json:"reason"`
+	Created_at    time.Time `json:"created_at"`
+}
+
+type BreakGlassReq struct {
+	Admintag    string
+	Usertag     string
+	DependentID *int
+	Reason      string
+}
+
+type BreakGlassAppointment struct {
+	AppointmentID int       `json:"appointment_id"`
+	DoctorTag     string    `json:"doctortag"`
+	ScheduledAt   time.Time `json:"scheduled_at"`
+	Reason        string    `json:"reason"`
+	FileURL       string    `json:"file_url"`
+	Status        string    `json:"status"`
+}
+
+// BreakGlassRecord is the clinical view an admin gets after justifying the access
+type BreakGlassRecord struct {
+	Patient      PatientIdResp           `json:"patient"`
+	Appointments []BreakGlassAppointment `json:"appointments"`
+	HealthRecord any                     `json:"health_record"`
+}
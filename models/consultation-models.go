@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type ConsultationSession struct {
+	SessionID       int        `json:"session_id"`
+	AppointmentID   int        `json:"appointment_id"`
+	Status          string     `json:"status"`
+	PatientJoinedAt *time.Time `json:"patient_joined_at"`
+	DoctorJoinedAt  *time.Time `json:"doctor_joined_at"`
+	StartedAt       *time.Time `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at"`
+	EndedBy         string     `json:"ended_by"`
+	DurationSeconds int        `json:"duration_seconds"`
+}
+
+type IceServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+type SessionJoinResp struct {
+	SessionID    int         `json:"session_id"`
+	Role         string      `json:"role"`
+	Token        string      `json:"token"`
+	ExpiresAt    time.Time   `json:"expires_at"`
+	SignalingURL string      `json:"signaling_url"`
+	IceServers   []IceServer `json:"ice_servers"`
+}
+
+// RoomClaims is what a room token carries into a socket, Kind is "call" for signaling or "chat"
+type RoomClaims struct {
+	Kind          string
+	SessionID     int
+	AppointmentID int
+	Role          string
+	Tag           string
+}
+
+type SignalMessage struct {
+	Type    string          `json:"type"`
+	From    string          `json:"from,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
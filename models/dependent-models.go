@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type DependentReq struct {
+	Usertag      string `json:"usertag"`
+	DependentID  int    `json:"dependent_id"`
+	Firstname    string `json:"firstname"`
+	Lastname     string `json:"lastname"`
+	DateOfBirth  string `json:"date_of_birth"` // YYYY-MM-DD
+	Gender       string `json:"gender"`
+	Relationship string `json:"relationship"`
+}
+
+type Dependent struct {
+	DependentID  int       `json:"dependent_id"`
+	Firstname    string    `json:"firstname"`
+	Lastname     string    `json:"lastname"`
+	DateOfBirth  time.Time `json:"date_of_birth"`
+	Gender       string    `json:"gender"`
+	Relationship string    `json:"relationship"`
+	Status       string    `json:"status"`
+	Created_at   time.Time `json:"created_at"`
+}
+
+type DependentTransferReq struct {
+	Usertag     string `json:"usertag"`
+	DependentID int    `json:"dependent_id"`
+	Email       string `json:"email"` // the dependent's own account
+}
+
+type DependentTransfer struct {
+	DependentID  int       `json:"dependent_id"`
+	Firstname    string    `json:"firstname"`
+	Lastname     string    `json:"lastname"`
+	DateOfBirth  time.Time `json:"date_of_birth"`
+	GuardianName string    `json:"guardian_name"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type HospitalAPIKey struct {
+	KeyID      int        `json:"key_id"`
+	HospitalID int        `json:"hospital_id"`
+	KeyPrefix  string     `json:"key_prefix"`
+	CreatedBy  string     `json:"created_by"`
+	Created_at time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// NewHospitalAPIKey carries the key itself, it is shown once and only its hash is stored
+type NewHospitalAPIKey struct {
+	HospitalAPIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type RiskAssessment struct {
+	Score    int      `json:"score"`
+	Decision string   `json:"decision"`
+	Reasons  []string `json:"reasons"`
+}
+
+type WithdrawalReview struct {
+	ReviewID             int        `json:"review_id"`
+	Usertag              string     `json:"usertag"`
+	TransactionReference string     `json:"transaction_reference"`
+	RecipientCode        string     `json:"recipient_code"`
+	Amount               float64    `json:"amount"`
+	RiskScore            int        `json:"risk_score"`
+	Reasons              []string   `json:"reasons"`
+	Decision             string     `json:"decision"`
+	Status               string     `json:"status"`
+	ReviewedBy           string     `json:"reviewed_by"`
+	ReviewNote           string     `json:"review_note"`
+	ReviewedAt           *time.Time `json:"reviewed_at"`
+	Created_at           time.Time  `json:"created_at"`
+}
+
+type ReviewWithdrawalReq struct {
+	ReviewID   string `json:"review_id"`
+	AdminTag   string `json:"admintag"`
+	Decision   string `json:"decision"`
+	ReviewNote string `json:"review_note"`
+}
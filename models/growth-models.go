@@ -0,0 +1,62 @@
+package models
+
+import (
+	"telemed/growth"
+	"time"
+)
+
+type GrowthMeasurementReq struct {
+	DependentID         int      `json:"dependent_id"`
+	MeasuredOn          string   `json:"measured_on"` // YYYY-MM-DD
+	WeightKg            *float64 `json:"weight_kg"`
+	HeightCm            *float64 `json:"height_cm"`
+	HeadCircumferenceCm *float64 `json:"head_circumference_cm"`
+	Notes               string   `json:"notes"`
+}
+
+// GrowthScore is one measured value, z-score and percentile are missing outside the 0 to 5 year standards
+type GrowthScore struct {
+	Value      float64  `json:"value"`
+	ZScore     *float64 `json:"z_score"`
+	Percentile *float64 `json:"percentile"`
+}
+
+type GrowthMeasurement struct {
+	MeasurementID  int          `json:"measurement_id"`
+	MeasuredOn     time.Time    `json:"measured_on"`
+	AgeDays        int          `json:"age_days"`
+	AgeMonths      float64      `json:"age_months"`
+	Weight         *GrowthScore `json:"weight"`
+	Height         *GrowthScore `json:"height"`
+	Head           *GrowthScore `json:"head_circumference"`
+	BMI            *GrowthScore `json:"bmi"`
+	Notes          string       `json:"notes"`
+	RecordedByType string       `json:"recorded_by_type"`
+	RecordedBy     string       `json:"recorded_by"`
+	AppointmentID  *int         `json:"appointment_id"`
+}
+
+type GrowthPoint struct {
+	MeasuredOn time.Time `json:"measured_on"`
+	AgeMonths  float64   `json:"age_months"`
+	GrowthScore
+}
+
+type GrowthFlag struct {
+	MeasuredOn time.Time `json:"measured_on"`
+	Indicator  string    `json:"indicator"`
+	Kind       string    `json:"kind"`
+	Message    string    `json:"message"`
+}
+
+// GrowthChart has one series per indicator and the WHO percentile lines to draw behind it
+type GrowthChart struct {
+	DependentID  int                                `json:"dependent_id"`
+	Name         string                             `json:"name"`
+	Sex          string                             `json:"sex"`
+	DateOfBirth  time.Time                          `json:"date_of_birth"`
+	Measurements []GrowthMeasurement                `json:"measurements"`
+	Series       map[string][]GrowthPoint           `json:"series"`
+	Reference    map[string][]growth.ReferencePoint `json:"reference"`
+	Flags        []GrowthFlag                       `json:"flags"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type HealthRecordEntryReq struct {
+	EntryID     int    `json:"entry_id"`
+	DependentID *int   `json:"dependent_id"`
+	Category    string `json:"category"`
+	Name        string `json:"name"`
+	Code        string `json:"code"`
+	Status      string `json:"status"`
+	Severity    string `json:"severity"`
+	Reaction    string `json:"reaction"`
+	Dosage      string `json:"dosage"`
+	Frequency   string `json:"frequency"`
+	Relation    string `json:"relation"`
+	OnsetDate   string `json:"onset_date"` // YYYY-MM-DD
+	EndDate     string `json:"end_date"`
+	Notes       string `json:"notes"`
+}
+
+type HealthRecordEntry struct {
+	EntryID       int        `json:"entry_id"`
+	Category      string     `json:"category"`
+	Name          string     `json:"name"`
+	Code          string     `json:"code"`
+	Status        string     `json:"status"`
+	Severity      string     `json:"severity,omitempty"`
+	Reaction      string     `json:"reaction,omitempty"`
+	Dosage        string     `json:"dosage,omitempty"`
+	Frequency     string     `json:"frequency,omitempty"`
+	Relation      string     `json:"relation,omitempty"`
+	OnsetDate     *time.Time `json:"onset_date"`
+	EndDate       *time.Time `json:"end_date"`
+	Notes         string     `json:"notes"`
+	CreatedByType string     `json:"created_by_type"`
+	CreatedBy     string     `json:"created_by"`
+	UpdatedByType string     `json:"updated_by_type"`
+	UpdatedBy     string     `json:"updated_by"`
+	Created_at    time.Time  `json:"created_at"`
+	Updated_at    time.Time  `json:"updated_at"`
+}
+
+type HealthRecord struct {
+	PatientName   string              `json:"patient_name"`
+	DateOfBirth   *time.Time          `json:"date_of_birth"`
+	Gender        string              `json:"gender"`
+	Allergies     []HealthRecordEntry `json:"allergies"`
+	Conditions    []HealthRecordEntry `json:"conditions"`
+	Medications   []HealthRecordEntry `json:"medications"`
+	Surgeries     []HealthRecordEntry `json:"surgeries"`
+	FamilyHistory []HealthRecordEntry `json:"family_history"`
+	Immunizations []HealthRecordEntry `json:"immunizations"`
+}
+
+type HealthRecordChange struct {
+	Action        string          `json:"action"`
+	ChangedByType string          `json:"changed_by_type"`
+	ChangedBy     string          `json:"changed_by"`
+	AppointmentID *int            `json:"appointment_id"`
+	Snapshot      json.RawMessage `json:"snapshot"`
+	ChangedAt     time.Time       `json:"changed_at"`
+}
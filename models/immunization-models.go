@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+type ImmunizationDoseReq struct {
+	DependentID    int    `json:"dependent_id"`
+	Code           string `json:"code"`            // dose code from the schedule, e.g. PENTA1
+	AdministeredOn string `json:"administered_on"` // YYYY-MM-DD
+	LotNumber      string `json:"lot_number"`
+	Facility       string `json:"facility"`
+	Notes          string `json:"notes"`
+}
+
+type ImmunizationDose struct {
+	DoseID         int       `json:"dose_id"`
+	Code           string    `json:"code"`
+	AdministeredOn time.Time `json:"administered_on"`
+	LotNumber      string    `json:"lot_number"`
+	Facility       string    `json:"facility"`
+	Notes          string    `json:"notes"`
+	RecordedByType string    `json:"recorded_by_type"`
+	RecordedBy     string    `json:"recorded_by"`
+	AppointmentID  *int      `json:"appointment_id"`
+	Created_at     time.Time `json:"created_at"`
+}
+
+// ImmunizationItem is one scheduled dose for a child. Status is given, upcoming, due, overdue, or missed once
+// the child is past the last age the dose can be given
+type ImmunizationItem struct {
+	Code       string            `json:"code"`
+	Vaccine    string            `json:"vaccine"`
+	DoseNumber int               `json:"dose_number"`
+	DueOn      time.Time         `json:"due_on"`
+	LastOn     *time.Time        `json:"last_on"`
+	Notes      string            `json:"notes"`
+	Status     string            `json:"status"`
+	Given      *ImmunizationDose `json:"given"`
+}
+
+type ImmunizationStatus struct {
+	DependentID int                `json:"dependent_id"`
+	Name        string             `json:"name"`
+	DateOfBirth time.Time          `json:"date_of_birth"`
+	Schedule    string             `json:"schedule"`
+	Items       []ImmunizationItem `json:"items"`
+}
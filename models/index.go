@@ -40,6 +40,7 @@ type BookAppointment struct {
 	Scheduled_at time.Time `json:"appointment_date"`
 	Reason       string    `json:"reason"`
 	Amount       float64   `json:"amount"`
+	DependentID  *int      `json:"dependent_id"` // book for one of the user's dependents, billed to the user
 }
 
 
@@ -62,6 +63,9 @@ type GetAppointmentsResp struct {
 	Scheduled_at     time.Time `json:"appointment_date"`
 	Status           string    `json:"status"`
 	Reason           string    `json:"reason"`
+	FollowUpOf       *int      `json:"follow_up_of"`
+	DependentID      *int      `json:"dependent_id"`
+	DependentName    string    `json:"dependent_name,omitempty"`
 	Created_at       time.Time `json:"created_at"`
 }
 
@@ -321,6 +325,7 @@ type UserProfile struct {
 	Gender    string  `json:"gender"`
 	Dob       string  `json:"dob"`
 	Photo_url string `json:"photo_url"`
+	TimeZone  string `json:"time_zone"`
 }
 
 type UpdateProfileReq struct {
@@ -332,6 +337,7 @@ type UpdateProfileReq struct {
 	Gender    string  `json:"gender"`
 	Dob       string  `json:"dob"`
 	Photo_url string `json:"photo_url"`
+	TimeZone  string `json:"time_zone"`
 }
 
 type ChangePasswordReq struct {
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+type KycTierLimit struct {
+	Tier                   int     `json:"tier"`
+	Name                   string  `json:"name"`
+	SingleTransactionLimit float64 `json:"single_transaction_limit"`
+	DailyLimit             float64 `json:"daily_limit"`
+	MaxBalance             float64 `json:"max_balance"`
+}
+
+type KycStatusResp struct {
+	Usertag        string       `json:"usertag"`
+	Tier           int          `json:"tier"`
+	PhoneVerified  bool         `json:"phone_verified"`
+	Limits         KycTierLimit `json:"limits"`
+	CreditedToday  float64      `json:"credited_today"`
+	DebitedToday   float64      `json:"debited_today"`
+	PendingReviews int          `json:"pending_reviews"`
+}
+
+type VerifyPhoneReq struct {
+	Usertag string `json:"usertag"`
+	OTP     string `json:"otp"`
+}
+
+type KycDocumentReq struct {
+	Usertag        string `json:"usertag"`
+	DocumentType   string `json:"document_type"`
+	DocumentNumber string `json:"document_number"`
+	DocumentURL    string `json:"document_url"`
+}
+
+type KycDocument struct {
+	DocumentID     int        `json:"document_id"`
+	Usertag        string     `json:"usertag"`
+	DocumentType   string     `json:"document_type"`
+	DocumentNumber string     `json:"document_number"`
+	DocumentURL    string     `json:"document_url"`
+	Status         string     `json:"status"`
+	ReviewNote     string     `json:"review_note"`
+	ReviewedBy     string     `json:"reviewed_by"`
+	ReviewedAt     *time.Time `json:"reviewed_at"`
+	Created_at     time.Time  `json:"created_at"`
+}
+
+type ReviewKycDocumentReq struct {
+	DocumentID string `json:"document_id"`
+	AdminTag   string `json:"admintag"`
+	Status     string `json:"status"`
+	ReviewNote string `json:"review_note"`
+}
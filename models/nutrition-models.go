@@ -0,0 +1,34 @@
+package models
+
+import (
+	"telemed/nutrition"
+	"time"
+)
+
+// NutritionReviewReq approves the generated guidance, or replaces it with Items when Action is override
+type NutritionReviewReq struct {
+	Action string                     `json:"action"` // approve or override
+	Items  []nutrition.Recommendation `json:"items"`
+	Note   string                     `json:"note"`
+}
+
+// NutritionRecommendation is one generated set of guidance. Effective is what the guardian should follow,
+// the doctor's items once overridden and the engine's otherwise
+type NutritionRecommendation struct {
+	RecommendationID int                        `json:"recommendation_id"`
+	DependentID      int                        `json:"dependent_id"`
+	Engine           string                     `json:"engine"`
+	EngineVersion    string                     `json:"engine_version"`
+	Profile          nutrition.Profile          `json:"profile"`
+	Items            []nutrition.Recommendation `json:"items"`
+	Status           string                     `json:"status"`
+	OverrideItems    []nutrition.Recommendation `json:"override_items"`
+	ReviewNote       string                     `json:"review_note"`
+	ReviewedBy       string                     `json:"reviewed_by"`
+	RequestedByType  string                     `json:"requested_by_type"`
+	RequestedBy      string                     `json:"requested_by"`
+	AppointmentID    *int                       `json:"appointment_id"`
+	Effective        []nutrition.Recommendation `json:"effective"`
+	Created_at       time.Time                  `json:"created_at"`
+	ReviewedAt       *time.Time                 `json:"reviewed_at"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// WorkingHours is a recurring weekly window, times are "HH:MM" in the doctor's time zone
+type WorkingHours struct {
+	DayOfWeek int    `json:"day_of_week"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+type ScheduleOverride struct {
+	OverrideID int    `json:"override_id"`
+	Doctortag  string `json:"doctortag"`
+	Date       string `json:"date"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+}
+
+type TimeOff struct {
+	TimeOffID int       `json:"time_off_id"`
+	Doctortag string    `json:"doctortag"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Reason    string    `json:"reason"`
+}
+
+type DoctorSchedule struct {
+	Doctortag           string             `json:"doctortag"`
+	TimeZone            string             `json:"time_zone"`
+	SlotDurationMinutes int                `json:"slot_duration_minutes"`
+	WorkingHours        []WorkingHours     `json:"working_hours"`
+	Breaks              []WorkingHours     `json:"breaks"`
+	Overrides           []ScheduleOverride `json:"overrides"`
+	TimeOff             []TimeOff          `json:"time_off"`
+}
+
+type UpdateScheduleReq struct {
+	Doctortag           string         `json:"doctortag"`
+	TimeZone            string         `json:"time_zone"`
+	SlotDurationMinutes int            `json:"slot_duration_minutes"`
+	WorkingHours        []WorkingHours `json:"working_hours"`
+	Breaks              []WorkingHours `json:"breaks"`
+}
+
+type Slot struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+type SlotsReq struct {
+	Doctortag string
+	Usertag   string
+	From      string
+	To        string
+}
+
+type FirstAvailableReq struct {
+	Usertag        string
+	Specialization string
+	State          string
+	From           string
+	Limit          int
+}
+
+type AvailableDoctor struct {
+	Doctortag      string  `json:"doctortag"`
+	Fullname       string  `json:"fullname"`
+	Specialization string  `json:"specialization"`
+	Price          float64 `json:"price_per_session"`
+	Hospital       string  `json:"hospital"`
+	State          string  `json:"state"`
+	ProfilePicURL  string  `json:"profile_pic_url"`
+	NextSlot       Slot    `json:"next_slot"`
+}
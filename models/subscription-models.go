@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+type SubscriptionPlan struct {
+	PlanID                    int       `json:"plan_id"`
+	Name                      string    `json:"name"`
+	Description               string    `json:"description"`
+	MonthlyPrice              float64   `json:"monthly_price"`
+	ConsultationsPerCycle     int       `json:"consultations_per_cycle"`
+	MedicationDiscountPercent float64   `json:"medication_discount_percent"`
+	IsActive                  bool      `json:"is_active"`
+	Created_at                time.Time `json:"created_at"`
+}
+
+type SubscribeReq struct {
+	Usertag       string `json:"usertag"`
+	PlanID        int    `json:"plan_id"`
+	PaymentMethod string `json:"payment_method"`
+	CardID        int    `json:"card_id"`
+}
+
+type ChangePlanReq struct {
+	Usertag string `json:"usertag"`
+	PlanID  int    `json:"plan_id"`
+}
+
+type Subscription struct {
+	SubscriptionID     int              `json:"subscription_id"`
+	Usertag            string           `json:"usertag"`
+	Plan               SubscriptionPlan `json:"plan"`
+	Status             string           `json:"status"`
+	PaymentMethod      string           `json:"payment_method"`
+	CardID             *int             `json:"card_id"`
+	CurrentPeriodStart time.Time        `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time        `json:"current_period_end"`
+	ConsultationsUsed  int              `json:"consultations_used"`
+	ConsultationsLeft  int              `json:"consultations_left"`
+	CancelAtPeriodEnd  bool             `json:"cancel_at_period_end"`
+	FailedAttempts     int              `json:"failed_attempts"`
+	NextRetryAt        *time.Time       `json:"next_retry_at"`
+}
+
+type SubscriptionInvoice struct {
+	InvoiceID            int       `json:"invoice_id"`
+	SubscriptionID       int       `json:"subscription_id"`
+	Amount               float64   `json:"amount"`
+	Description          string    `json:"description"`
+	Status               string    `json:"status"`
+	PaymentMethod        string    `json:"payment_method"`
+	TransactionReference string    `json:"transaction_reference"`
+	FailureReason        string    `json:"failure_reason"`
+	Created_at           time.Time `json:"created_at"`
+}
+
+type SavedCard struct {
+	CardID   int    `json:"card_id"`
+	Last4    string `json:"last4"`
+	CardType string `json:"card_type"`
+	Bank     string `json:"bank"`
+	ExpMonth string `json:"exp_month"`
+	ExpYear  string `json:"exp_year"`
+}
+
+type CheckoutSummary struct {
+	Subtotal        float64 `json:"subtotal"`
+	DiscountPercent float64 `json:"discount_percent"`
+	Discount        float64 `json:"discount"`
+	Total           float64 `json:"total"`
+	PlanName        string  `json:"plan_name,omitempty"`
+}
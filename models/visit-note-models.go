@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+type Diagnosis struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+type VisitNoteReq struct {
+	Doctortag     string      `json:"doctortag"`
+	AppointmentID int         `json:"appointment_id"`
+	Subjective    string      `json:"subjective"`
+	Objective     string      `json:"objective"`
+	Assessment    string      `json:"assessment"`
+	Plan          string      `json:"plan"`
+	Diagnoses     []Diagnosis `json:"diagnoses"`
+}
+
+type AddendumReq struct {
+	Doctortag     string `json:"doctortag"`
+	AppointmentID int    `json:"appointment_id"`
+	Body          string `json:"body"`
+}
+
+type Addendum struct {
+	AddendumID int       `json:"addendum_id"`
+	Body       string    `json:"body"`
+	Created_at time.Time `json:"created_at"`
+}
+
+type VisitNote struct {
+	NoteID        int         `json:"note_id"`
+	AppointmentID int         `json:"appointment_id"`
+	Doctortag     string      `json:"doctortag"`
+	Subjective    string      `json:"subjective"`
+	Objective     string      `json:"objective"`
+	Assessment    string      `json:"assessment"`
+	Plan          string      `json:"plan"`
+	Diagnoses     []Diagnosis `json:"diagnoses"`
+	Status        string      `json:"status"`
+	SignedAt      *time.Time  `json:"signed_at"`
+	Addenda       []Addendum  `json:"addenda"`
+	Created_at    time.Time   `json:"created_at"`
+	Updated_at    time.Time   `json:"updated_at"`
+}
+
+// VisitSummary is the patient's view of a signed note, the clinical working (subjective, objective) stays out
+type VisitSummary struct {
+	AppointmentID int         `json:"appointment_id"`
+	DoctorName    string      `json:"doctor_name"`
+	PatientName   string      `json:"patient_name"`
+	VisitDate     time.Time   `json:"visit_date"`
+	Diagnoses     []Diagnosis `json:"diagnoses"`
+	Assessment    string      `json:"assessment"`
+	Plan          string      `json:"plan"`
+	Addenda       []Addendum  `json:"addenda"`
+	SignedAt      *time.Time  `json:"signed_at"`
+}
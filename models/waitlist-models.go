@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type JoinWaitlistReq struct {
+	Usertag        string    `json:"usertag"`
+	Doctortag      string    `json:"doctortag"`
+	Specialization string    `json:"specialization"`
+	EarliestAt     time.Time `json:"earliest_at"`
+	LatestAt       time.Time `json:"latest_at"`
+	Reason         string    `json:"reason"`
+	DependentID    *int      `json:"dependent_id"`
+}
+
+type WaitlistEntry struct {
+	EntryID          int        `json:"entry_id"`
+	Doctortag        string     `json:"doctortag"`
+	Specialization   string     `json:"specialization"`
+	EarliestAt       time.Time  `json:"earliest_at"`
+	LatestAt         time.Time  `json:"latest_at"`
+	Reason           string     `json:"reason"`
+	DependentID      *int       `json:"dependent_id"`
+	Status           string     `json:"status"`
+	Position         int        `json:"position,omitempty"`
+	OfferedDoctortag string     `json:"offered_doctortag,omitempty"`
+	OfferedStartsAt  *time.Time `json:"offered_starts_at"`
+	HoldExpiresAt    *time.Time `json:"hold_expires_at"`
+	AppointmentID    *int       `json:"appointment_id"`
+	Created_at       time.Time  `json:"created_at"`
+}
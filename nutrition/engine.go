@@ -0,0 +1,164 @@
+// Package nutrition turns a child's age, growth, allergies and conditions into meal guidance. Engine is the
+// seam: today it is the rule engine below, a trained model can later stand behind the same interface
+package nutrition
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Profile is everything an engine may look at, z-scores are nil when there is no measurement to score
+type Profile struct {
+	AgeMonths   float64  `json:"age_months"`
+	Sex         string   `json:"sex"`
+	WeightZ     *float64 `json:"weight_z"`
+	HeightZ     *float64 `json:"height_z"`
+	BMIZ        *float64 `json:"bmi_z"`
+	GrowthFlags []string `json:"growth_flags"` // kinds from the latest growth measurement, e.g. stunted
+	Allergies   []string `json:"allergies"`
+	Conditions  []string `json:"conditions"`
+}
+
+// Categories a recommendation can have, referral asks the guardian to see a doctor
+var Categories = []string{"feeding", "food_group", "supplement", "caution", "referral"}
+
+// Priority 1 is urgent, 2 is the usual advice and 3 is nice to know
+type Recommendation struct {
+	RuleID   string `json:"rule_id"`
+	Category string `json:"category"`
+	Title    string `json:"title"`
+	Advice   string `json:"advice"`
+	Priority int    `json:"priority"`
+}
+
+type Engine interface {
+	Name() string
+	Version() string
+	Recommend(p Profile) []Recommendation
+}
+
+// Condition matches when every field that is set matches. Lists match when any entry does, allergies and
+// conditions by case-insensitive substring so "peanut" matches "Peanut allergy"
+type Condition struct {
+	MinAgeMonths    *float64 `json:"min_age_months"`
+	MaxAgeMonths    *float64 `json:"max_age_months"` // exclusive
+	Sex             string   `json:"sex"`
+	GrowthFlags     []string `json:"growth_flags"`
+	WeightZBelow    *float64 `json:"weight_z_below"`
+	HeightZBelow    *float64 `json:"height_z_below"`
+	BMIZAbove       *float64 `json:"bmi_z_above"`
+	BMIZBelow       *float64 `json:"bmi_z_below"`
+	Allergies       []string `json:"allergies"`
+	Conditions      []string `json:"conditions"`
+	UnlessAllergies []string `json:"unless_allergies"` // advice built around a food the child reacts to is left out
+}
+
+type Rule struct {
+	ID       string    `json:"id"`
+	When     Condition `json:"when"`
+	Category string    `json:"category"`
+	Title    string    `json:"title"`
+	Advice   string    `json:"advice"`
+	Priority int       `json:"priority"`
+}
+
+type RuleSet struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Rules   []Rule `json:"rules"`
+}
+
+//go:embed rules/*.json
+var bundled embed.FS
+
+// RuleEngine is the deterministic Engine, it applies one rule set
+type RuleEngine struct {
+	set RuleSet
+}
+
+// LoadRules reads a bundled rule set by name, or a JSON file in the same shape by path
+func LoadRules(name string) (*RuleEngine, error) {
+	data, err := bundled.ReadFile("rules/" + name + ".json")
+	if err != nil {
+		if data, err = os.ReadFile(name); err != nil {
+			return nil, fmt.Errorf("nutrition rule set %q not found", name)
+		}
+	}
+	var set RuleSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("nutrition rule set %q: %w", name, err)
+	}
+	seen := map[string]bool{}
+	for _, r := range set.Rules {
+		if r.ID == "" || seen[r.ID] {
+			return nil, fmt.Errorf("nutrition rule set %q: missing or repeated rule id %q", name, r.ID)
+		}
+		if !slices.Contains(Categories, r.Category) || r.Priority < 1 || r.Priority > 3 {
+			return nil, fmt.Errorf("nutrition rule set %q: rule %s needs a known category and a priority from 1 to 3", name, r.ID)
+		}
+		seen[r.ID] = true
+	}
+	return &RuleEngine{set: set}, nil
+}
+
+func (e *RuleEngine) Name() string    { return "rules/" + e.set.Name }
+func (e *RuleEngine) Version() string { return e.set.Version }
+
+// Recommend returns every matching rule, most urgent first and in rule set order within a priority
+func (e *RuleEngine) Recommend(p Profile) []Recommendation {
+	out := []Recommendation{}
+	for _, r := range e.set.Rules {
+		if r.When.matches(p) {
+			out = append(out, Recommendation{RuleID: r.ID, Category: r.Category, Title: r.Title, Advice: r.Advice, Priority: r.Priority})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Priority < out[j].Priority })
+	return out
+}
+
+func (c Condition) matches(p Profile) bool {
+	if c.MinAgeMonths != nil && p.AgeMonths < *c.MinAgeMonths {
+		return false
+	}
+	if c.MaxAgeMonths != nil && p.AgeMonths >= *c.MaxAgeMonths {
+		return false
+	}
+	if c.Sex != "" && c.Sex != p.Sex {
+		return false
+	}
+	if len(c.GrowthFlags) > 0 && !slices.ContainsFunc(c.GrowthFlags, func(f string) bool { return slices.Contains(p.GrowthFlags, f) }) {
+		return false
+	}
+	below := func(limit, z *float64) bool { return limit == nil || (z != nil && *z < *limit) }
+	if !below(c.WeightZBelow, p.WeightZ) || !below(c.HeightZBelow, p.HeightZ) || !below(c.BMIZBelow, p.BMIZ) {
+		return false
+	}
+	if c.BMIZAbove != nil && (p.BMIZ == nil || *p.BMIZ <= *c.BMIZAbove) {
+		return false
+	}
+	if len(c.Allergies) > 0 && !mentions(p.Allergies, c.Allergies) {
+		return false
+	}
+	if len(c.Conditions) > 0 && !mentions(p.Conditions, c.Conditions) {
+		return false
+	}
+	return !mentions(p.Allergies, c.UnlessAllergies)
+}
+
+// mentions reports whether any recorded name contains any of the terms
+func mentions(names, terms []string) bool {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		for _, term := range terms {
+			if strings.Contains(name, strings.ToLower(term)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package nutrition
+
+import "testing"
+
+func f(v float64) *float64 {
+	return &v
+}
+
+func TestConditionMatches(t *testing.T) {
+	toddler := Profile{AgeMonths: 18, Sex: "female", WeightZ: f(-2.5), HeightZ: f(-1), BMIZ: f(0.5),
+		GrowthFlags: []string{"underweight"}, Allergies: []string{"Peanut allergy"}, Conditions: []string{"Sickle cell disease"}}
+	unmeasured := Profile{AgeMonths: 18}
+	tests := []struct {
+		name    string
+		when    Condition
+		profile Profile
+		want    bool
+	}{
+		{"empty condition matches anyone", Condition{}, unmeasured, true},
+		{"at the minimum age", Condition{MinAgeMonths: f(18)}, toddler, true},
+		{"below the minimum age", Condition{MinAgeMonths: f(24)}, toddler, false},
+		{"maximum age is exclusive", Condition{MaxAgeMonths: f(18)}, toddler, false},
+		{"under the maximum age", Condition{MaxAgeMonths: f(24)}, toddler, true},
+		{"sex matches", Condition{Sex: "female"}, toddler, true},
+		{"sex differs", Condition{Sex: "male"}, toddler, false},
+		{"any growth flag", Condition{GrowthFlags: []string{"stunted", "underweight"}}, toddler, true},
+		{"no growth flag", Condition{GrowthFlags: []string{"stunted"}}, toddler, false},
+		{"weight z below the limit", Condition{WeightZBelow: f(-2)}, toddler, true},
+		{"height z not below the limit", Condition{HeightZBelow: f(-2)}, toddler, false},
+		{"unscored z never counts as below", Condition{WeightZBelow: f(-2)}, unmeasured, false},
+		{"bmi z above the limit", Condition{BMIZAbove: f(0)}, toddler, true},
+		{"bmi z at the limit is not above", Condition{BMIZAbove: f(0.5)}, toddler, false},
+		{"unscored bmi is not above", Condition{BMIZAbove: f(0)}, unmeasured, false},
+		{"allergy by case-insensitive substring", Condition{Allergies: []string{"PEANUT"}}, toddler, true},
+		{"allergy not recorded", Condition{Allergies: []string{"egg"}}, toddler, false},
+		{"condition by substring", Condition{Conditions: []string{"sickle"}}, toddler, true},
+		{"condition not recorded", Condition{Conditions: []string{"diabetes"}}, toddler, false},
+		{"left out for an allergy", Condition{UnlessAllergies: []string{"peanut"}}, toddler, false},
+		{"kept when the allergy is absent", Condition{UnlessAllergies: []string{"peanut"}}, unmeasured, true},
+		{"every set field has to match", Condition{MinAgeMonths: f(6), Sex: "female", WeightZBelow: f(-3)}, toddler, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.when.matches(tt.profile); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecommendOrdersByPriority(t *testing.T) {
+	e := &RuleEngine{set: RuleSet{Rules: []Rule{
+		{ID: "a", Category: "feeding", Priority: 2},
+		{ID: "b", Category: "referral", Priority: 1, When: Condition{WeightZBelow: f(-3)}},
+		{ID: "c", Category: "caution", Priority: 1},
+		{ID: "d", Category: "food_group", Priority: 3, When: Condition{Sex: "male"}},
+		{ID: "e", Category: "supplement", Priority: 2},
+	}}}
+	got := e.Recommend(Profile{AgeMonths: 12, Sex: "female", WeightZ: f(-3.5)})
+	want := []string{"b", "c", "a", "e"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d recommendations, want %d", len(got), len(want))
+	}
+	for i, id := range want {
+		if got[i].RuleID != id {
+			t.Errorf("recommendation %d = %s, want %s", i, got[i].RuleID, id)
+		}
+	}
+}
+
+func TestBundledRulesLoad(t *testing.T) {
+	if _, err := LoadRules("default"); err != nil {
+		t.Fatal(err)
+	}
+}
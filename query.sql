@@ -10,10 +10,30 @@ CREATE TABLE users (
     password TEXT,
     transaction_pin VARCHAR(6),
     otp VARCHAR(10),
-    otp_expiry TIMESTAMP,
+    otp_expiry TIMESTAMPTZ,
     state VARCHAR(100),
     delivery_address TEXT,
-    profile_pic_url TEXT
+    profile_pic_url TEXT,
+    phone_verified BOOLEAN DEFAULT FALSE,
+    kyc_tier INTEGER DEFAULT 1 CHECK (kyc_tier IN (1, 2, 3)),
+    time_zone VARCHAR(64) DEFAULT 'Africa/Lagos' -- IANA name, used to show times in the patient's local time
+);
+
+-- DEPENDENTS TABLE, children and family members cared for under a guardian's account and billed to their wallet
+CREATE TABLE dependents (
+    dependent_id SERIAL PRIMARY KEY,
+    guardian_tag VARCHAR(50) NOT NULL,
+    firstname VARCHAR(100) NOT NULL,
+    lastname VARCHAR(100) NOT NULL,
+    date_of_birth DATE NOT NULL,
+    gender VARCHAR(10),
+    relationship VARCHAR(20) NOT NULL CHECK (relationship IN ('child', 'spouse', 'parent', 'sibling', 'ward', 'other')),
+    status VARCHAR(20) DEFAULT 'active' CHECK (status IN ('active', 'transfer_pending', 'transferred')),
+    transfer_to VARCHAR(50), -- the dependent's own account, set when the guardian starts a handover
+    transferred_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (guardian_tag) REFERENCES users(usertag) ON DELETE CASCADE,
+    FOREIGN KEY (transfer_to) REFERENCES users(usertag) ON DELETE SET NULL
 );
 
 -- HOSPITALS TABLE
@@ -24,13 +44,15 @@ CREATE TABLE hospitals (
     country VARCHAR(100),
     state VARCHAR(100),
     profile_pic_url TEXT,
-    about TEXT
+    about TEXT,
+    time_zone VARCHAR(64) DEFAULT 'Africa/Lagos'
 );
 
 -- DOCTORS TABLE
 CREATE TABLE doctors (
     doctortag VARCHAR(50) PRIMARY KEY,
     fullname VARCHAR(200),
+    email VARCHAR(255) UNIQUE,
     date_of_birth DATE,
     phone_number VARCHAR(20),
     gender VARCHAR(10),
@@ -42,7 +64,8 @@ CREATE TABLE doctors (
     about TEXT,
     password TEXT NOT NULL,
     hospital_id INTEGER,
-    availability JSONB, -- e.g. ["2025-08-01T10:00:00", "2025-08-02T14:00:00"]
+    slot_duration_minutes INTEGER DEFAULT 30 CHECK (slot_duration_minutes BETWEEN 5 AND 240),
+    time_zone VARCHAR(64), -- working hours are in this zone, falls back to the hospital's
     profile_pic_url TEXT,
     FOREIGN KEY (hospital_id) REFERENCES hospitals(hospital_id) ON DELETE SET NULL
 );
@@ -75,7 +98,7 @@ CREATE TABLE orders (
     total NUMERIC(10, 2),
     status VARCHAR(20) CHECK (status IN ('pending', 'processing', 'shipped', 'delivered', 'cancelled')),
     items JSONB, -- Stores array of {product_id, item_name, price, quantity}
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
 );
 
@@ -102,7 +125,9 @@ CREATE TABLE prescriptions (
     doctortag VARCHAR(50),
     prescription_date DATE,
     doctor_note_date DATE,
+    dependent_id INTEGER, -- set when written for a guardian's dependent, usertag is then the guardian
     FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE,
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE CASCADE,
     FOREIGN KEY (doctortag) REFERENCES doctors(doctortag) ON DELETE CASCADE
 );
 
@@ -127,7 +152,7 @@ CREATE TABLE admins (
     email VARCHAR(255) UNIQUE,
     password TEXT NOT NULL,
     otp VARCHAR(10),
-    otp_expiry TIMESTAMP,
+    otp_expiry TIMESTAMPTZ,
     profile_pic_url TEXT,
     role VARCHAR(50)
 );
@@ -137,13 +162,28 @@ CREATE TABLE appointments (
     appointment_id SERIAL PRIMARY KEY,
     patient_tag VARCHAR(50),
     doctor_tag VARCHAR(50),
-    scheduled_at TIMESTAMP,
+    scheduled_at TIMESTAMPTZ,
     reason TEXT,
     file_url TEXT,
-    status VARCHAR(20) CHECK (status IN ('pending', 'confirmed', 'completed', 'cancelled')),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    status VARCHAR(20) CHECK (status IN ('pending', 'confirmed', 'proposed', 'declined', 'completed', 'cancelled', 'no_show', 'expired')),
+    status_changed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    proposed_at TIMESTAMPTZ, -- new time offered by the doctor, waiting for the patient
+    follow_up_of INTEGER, -- the visit this follow-up was booked from by the doctor
+    follow_up_fee NUMERIC(10, 2), -- what the patient pays when they accept the follow-up
+    dependent_id INTEGER, -- the guardian's dependent being seen, patient_tag stays the guardian who pays
+    amount NUMERIC(10, 2) DEFAULT 0,
+    payment_reference VARCHAR(100),
+    reschedule_count INTEGER DEFAULT 0,
+    ical_sequence INTEGER NOT NULL DEFAULT 0, -- SEQUENCE of the calendar event, bumped whenever time or status changes
+    cancelled_by VARCHAR(20),
+    cancellation_reason TEXT,
+    refund_amount NUMERIC(10, 2),
+    cancelled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (patient_tag) REFERENCES users(usertag) ON DELETE CASCADE,
-    FOREIGN KEY (doctor_tag) REFERENCES doctors(doctortag) ON DELETE CASCADE
+    FOREIGN KEY (doctor_tag) REFERENCES doctors(doctortag) ON DELETE CASCADE,
+    FOREIGN KEY (follow_up_of) REFERENCES appointments(appointment_id) ON DELETE SET NULL,
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE CASCADE
 );
 
 --CARTS
@@ -173,7 +213,8 @@ CREATE TABLE wallets (
     usertag VARCHAR(50) PRIMARY KEY,
     balance NUMERIC(10, 2) DEFAULT 0.00 NOT NULL CHECK (balance >= 0),
     pending_balance FLOAT DEFAULT 0.00 CHECK (pending_balance >= 0),
-    wallet_status VARCHAR(20) CHECK (wallet_status IN ('active', 'inactive')) DEFAULT 'active',
+    wallet_status VARCHAR(20) CHECK (wallet_status IN ('active', 'inactive', 'frozen')) DEFAULT 'active',
+    status_reason TEXT,
     FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
 );
 
@@ -186,8 +227,10 @@ CREATE TABLE wallet_transactions (
     paystack_reference VARCHAR(100) UNIQUE,
     transfer_code VARCHAR(100),
     access_code VARCHAR(100),
-    status VARCHAR(20) CHECK (status IN ('pending', 'success', 'failed', 'reversed', 'disputed' )),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    narration TEXT,
+    status VARCHAR(20) CHECK (status IN ('initiated', 'held', 'pending', 'completed', 'success', 'failed', 'reversed', 'disputed', 'expired' )),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    credited_at TIMESTAMPTZ, -- when a top-up reached the balance, it can be well after created_at
     FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
 );
 
@@ -201,7 +244,540 @@ CREATE TABLE payout_accounts (
   account_name VARCHAR(100) NOT NULL,
   currency VARCHAR(3) DEFAULT 'NGN',
   is_active BOOLEAN DEFAULT TRUE,
-  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
   FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
-);
\ No newline at end of file
+);
+
+--KYC tiers: 1 = email only, 2 = phone verified, 3 = BVN/ID verified
+CREATE TABLE kyc_tier_limits (
+    tier INTEGER PRIMARY KEY CHECK (tier IN (1, 2, 3)),
+    name VARCHAR(50) NOT NULL,
+    single_transaction_limit NUMERIC(12, 2) NOT NULL,
+    daily_limit NUMERIC(12, 2) NOT NULL,
+    max_balance NUMERIC(12, 2) NOT NULL
+);
+
+INSERT INTO kyc_tier_limits (tier, name, single_transaction_limit, daily_limit, max_balance) VALUES
+    (1, 'email verified', 20000.00, 50000.00, 100000.00),
+    (2, 'phone verified', 100000.00, 200000.00, 500000.00),
+    (3, 'identity verified', 1000000.00, 5000000.00, 10000000.00);
+
+CREATE TABLE kyc_documents (
+    document_id SERIAL PRIMARY KEY,
+    usertag VARCHAR(50) NOT NULL,
+    document_type VARCHAR(30) CHECK (document_type IN ('bvn', 'nin', 'passport', 'drivers_license', 'voters_card')),
+    document_number VARCHAR(50) NOT NULL,
+    document_url TEXT,
+    status VARCHAR(20) CHECK (status IN ('pending', 'approved', 'rejected')) DEFAULT 'pending',
+    review_note TEXT,
+    reviewed_by VARCHAR(50),
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
+);
+
+--withdrawal fraud checks
+CREATE TABLE failed_pin_attempts (
+    attempt_id SERIAL PRIMARY KEY,
+    usertag VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
+);
+
+CREATE TABLE withdrawal_reviews (
+    review_id SERIAL PRIMARY KEY,
+    usertag VARCHAR(50) NOT NULL,
+    transaction_reference VARCHAR(100) UNIQUE,
+    recipient_code VARCHAR(50) NOT NULL,
+    amount NUMERIC(12, 2) NOT NULL,
+    risk_score INTEGER NOT NULL,
+    reasons JSONB, -- e.g. ["payout account created 12 minutes ago", "3 failed pin attempts in 24h"]
+    decision VARCHAR(20) CHECK (decision IN ('review', 'block')),
+    status VARCHAR(20) CHECK (status IN ('pending', 'approved', 'rejected', 'blocked', 'failed')) DEFAULT 'pending', -- failed: approved but the transfer could not be started, funds returned
+    reviewed_by VARCHAR(50),
+    review_note TEXT,
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
+);
+
+--admin wallet operations
+CREATE TABLE wallet_adjustments (
+    adjustment_id SERIAL PRIMARY KEY,
+    usertag VARCHAR(50) NOT NULL,
+    adjustment_type VARCHAR(10) CHECK (adjustment_type IN ('credit', 'debit')),
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    reason TEXT NOT NULL,
+    status VARCHAR(20) CHECK (status IN ('pending_approval', 'applied', 'rejected')),
+    requested_by VARCHAR(50) NOT NULL,
+    approved_by VARCHAR(50),
+    transaction_reference VARCHAR(100),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    decided_at TIMESTAMPTZ,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
+);
+
+CREATE TABLE admin_audit_logs (
+    log_id SERIAL PRIMARY KEY,
+    admintag VARCHAR(50) NOT NULL,
+    action VARCHAR(50) NOT NULL, -- e.g. wallet.freeze, wallet.adjustment.approve
+    target_type VARCHAR(30),
+    target_id VARCHAR(100),
+    details JSONB,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+--cards saved from successful paystack charges, used for recurring billing
+CREATE TABLE saved_cards (
+    card_id SERIAL PRIMARY KEY,
+    usertag VARCHAR(50) NOT NULL,
+    authorization_code VARCHAR(100) UNIQUE NOT NULL,
+    signature VARCHAR(100),
+    last4 VARCHAR(4),
+    card_type VARCHAR(30),
+    bank VARCHAR(100),
+    exp_month VARCHAR(2),
+    exp_year VARCHAR(4),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
+);
+
+--health subscription plans
+CREATE TABLE subscription_plans (
+    plan_id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    monthly_price NUMERIC(10, 2) NOT NULL CHECK (monthly_price >= 0),
+    consultations_per_cycle INTEGER NOT NULL DEFAULT 0,
+    medication_discount_percent NUMERIC(5, 2) DEFAULT 0 CHECK (medication_discount_percent BETWEEN 0 AND 100),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE subscriptions (
+    subscription_id SERIAL PRIMARY KEY,
+    usertag VARCHAR(50) NOT NULL,
+    plan_id INTEGER NOT NULL,
+    status VARCHAR(20) CHECK (status IN ('active', 'past_due', 'cancelled', 'expired')),
+    payment_method VARCHAR(10) CHECK (payment_method IN ('wallet', 'card')),
+    card_id INTEGER,
+    current_period_start TIMESTAMPTZ NOT NULL,
+    current_period_end TIMESTAMPTZ NOT NULL,
+    consultations_used INTEGER DEFAULT 0,
+    cancel_at_period_end BOOLEAN DEFAULT FALSE,
+    failed_attempts INTEGER DEFAULT 0,
+    next_retry_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE,
+    FOREIGN KEY (plan_id) REFERENCES subscription_plans(plan_id) ON DELETE RESTRICT,
+    FOREIGN KEY (card_id) REFERENCES saved_cards(card_id) ON DELETE SET NULL
+);
+
+-- only one live subscription per user
+CREATE UNIQUE INDEX one_live_subscription ON subscriptions (usertag) WHERE status IN ('active', 'past_due');
+
+CREATE TABLE subscription_invoices (
+    invoice_id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL,
+    usertag VARCHAR(50) NOT NULL,
+    amount NUMERIC(10, 2) NOT NULL,
+    description TEXT,
+    status VARCHAR(20) CHECK (status IN ('paid', 'failed', 'refunded')),
+    payment_method VARCHAR(10),
+    transaction_reference VARCHAR(100),
+    failure_reason TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (subscription_id) REFERENCES subscriptions(subscription_id) ON DELETE CASCADE,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE
+);
+
+--weekly recurring working hours in the doctor's time zone, day_of_week follows Go's time.Weekday (0 = Sunday)
+CREATE TABLE doctor_working_hours (
+    working_hours_id SERIAL PRIMARY KEY,
+    doctortag VARCHAR(50) NOT NULL,
+    day_of_week INTEGER NOT NULL CHECK (day_of_week BETWEEN 0 AND 6),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL CHECK (end_time > start_time),
+    FOREIGN KEY (doctortag) REFERENCES doctors(doctortag) ON DELETE CASCADE
+);
+
+--recurring breaks inside the working hours, e.g. lunch
+CREATE TABLE doctor_breaks (
+    break_id SERIAL PRIMARY KEY,
+    doctortag VARCHAR(50) NOT NULL,
+    day_of_week INTEGER NOT NULL CHECK (day_of_week BETWEEN 0 AND 6),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL CHECK (end_time > start_time),
+    FOREIGN KEY (doctortag) REFERENCES doctors(doctortag) ON DELETE CASCADE
+);
+
+--date specific hours that replace the weekly hours for that day, no times means the doctor is off all day
+CREATE TABLE doctor_schedule_overrides (
+    override_id SERIAL PRIMARY KEY,
+    doctortag VARCHAR(50) NOT NULL,
+    override_date DATE NOT NULL,
+    start_time TIME,
+    end_time TIME,
+    CHECK ((start_time IS NULL AND end_time IS NULL) OR end_time > start_time),
+    FOREIGN KEY (doctortag) REFERENCES doctors(doctortag) ON DELETE CASCADE
+);
+
+CREATE TABLE doctor_time_off (
+    time_off_id SERIAL PRIMARY KEY,
+    doctortag VARCHAR(50) NOT NULL,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL CHECK (ends_at > starts_at),
+    reason TEXT,
+    FOREIGN KEY (doctortag) REFERENCES doctors(doctortag) ON DELETE CASCADE
+);
+
+--reserved slots, the unique key is what stops two patients booking the same time; overlaps at other start times are checked under a lock on the doctor row
+CREATE TABLE appointment_slots (
+    slot_id SERIAL PRIMARY KEY,
+    doctortag VARCHAR(50) NOT NULL,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('open', 'booked', 'held')),
+    appointment_id INTEGER,
+    held_until TIMESTAMPTZ, -- a held slot is offered to a waitlisted patient and is bookable again once this passes
+    waitlist_entry_id INTEGER,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (doctortag, starts_at),
+    FOREIGN KEY (doctortag) REFERENCES doctors(doctortag) ON DELETE CASCADE,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE SET NULL
+);
+
+--in-app notifications for patients and doctors
+CREATE TABLE notifications (
+    notification_id SERIAL PRIMARY KEY,
+    recipient_type VARCHAR(10) NOT NULL CHECK (recipient_type IN ('user', 'doctor')),
+    recipient_tag VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT,
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX notifications_recipient ON notifications (recipient_type, recipient_tag, created_at DESC);
+
+--every appointment status change, who made it and why
+CREATE TABLE appointment_status_history (
+    history_id SERIAL PRIMARY KEY,
+    appointment_id INTEGER NOT NULL,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    changed_by_type VARCHAR(10) NOT NULL CHECK (changed_by_type IN ('patient', 'doctor', 'admin', 'system')),
+    changed_by VARCHAR(50),
+    note TEXT,
+    refund_amount NUMERIC(10, 2) DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE CASCADE
+);
+
+--video consultation for an appointment, duration only counts time both parties were connected
+CREATE TABLE consultation_sessions (
+    session_id SERIAL PRIMARY KEY,
+    appointment_id INTEGER NOT NULL UNIQUE,
+    status VARCHAR(10) DEFAULT 'waiting' CHECK (status IN ('waiting', 'active', 'ended')),
+    patient_joined_at TIMESTAMPTZ,
+    doctor_joined_at TIMESTAMPTZ,
+    started_at TIMESTAMPTZ,
+    active_since TIMESTAMPTZ,
+    ended_at TIMESTAMPTZ,
+    ended_by VARCHAR(10),
+    duration_seconds INTEGER DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE CASCADE
+);
+
+--messages between the patient and doctor of an appointment
+CREATE TABLE appointment_messages (
+    message_id SERIAL PRIMARY KEY,
+    appointment_id INTEGER NOT NULL,
+    sender_type VARCHAR(10) NOT NULL CHECK (sender_type IN ('patient', 'doctor')),
+    sender_tag VARCHAR(50) NOT NULL,
+    body TEXT,
+    attachment_id INTEGER, -- a file from appointment_attachments on the same appointment
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE CASCADE
+);
+
+CREATE INDEX appointment_messages_appointment ON appointment_messages (appointment_id, message_id);
+
+--lab results, images and documents shared on an appointment, the file itself lives in the storage backend
+CREATE TABLE appointment_attachments (
+    attachment_id SERIAL PRIMARY KEY,
+    appointment_id INTEGER NOT NULL,
+    uploaded_by_type VARCHAR(10) NOT NULL CHECK (uploaded_by_type IN ('patient', 'doctor')),
+    uploaded_by VARCHAR(50) NOT NULL,
+    category VARCHAR(20) DEFAULT 'other' CHECK (category IN ('lab_result', 'image', 'document', 'other')),
+    storage_key TEXT NOT NULL UNIQUE,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE CASCADE
+);
+
+--chat messages can carry one of these files, the table is created after appointment_messages
+ALTER TABLE appointment_messages ADD FOREIGN KEY (attachment_id) REFERENCES appointment_attachments(attachment_id) ON DELETE SET NULL;
+
+--SOAP note for an appointment, editable by the doctor until signed and only added to after that
+CREATE TABLE visit_notes (
+    note_id SERIAL PRIMARY KEY,
+    appointment_id INTEGER NOT NULL UNIQUE,
+    doctortag VARCHAR(50) NOT NULL,
+    subjective TEXT,
+    objective TEXT,
+    assessment TEXT,
+    plan TEXT,
+    diagnoses JSONB DEFAULT '[]', -- e.g. [{"code": "J06.9", "description": "Acute upper respiratory infection"}]
+    status VARCHAR(10) DEFAULT 'draft' CHECK (status IN ('draft', 'signed')),
+    signed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE CASCADE,
+    FOREIGN KEY (doctortag) REFERENCES doctors(doctortag) ON DELETE CASCADE
+);
+
+CREATE TABLE visit_note_addenda (
+    addendum_id SERIAL PRIMARY KEY,
+    note_id INTEGER NOT NULL,
+    doctortag VARCHAR(50) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (note_id) REFERENCES visit_notes(note_id) ON DELETE CASCADE
+);
+
+--scheduled notifications, one row per recipient and send time so they survive restarts. kind 'appointment' is a
+--reminder before a confirmed appointment at one of the lead times, the vaccine kinds remind a guardian of a dose
+--of their dependent's that is coming due or running late
+CREATE TABLE appointment_reminders (
+    reminder_id SERIAL PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL DEFAULT 'appointment' CHECK (kind IN ('appointment', 'vaccine_due', 'vaccine_overdue')),
+    appointment_id INTEGER,
+    dependent_id INTEGER,
+    vaccine_code VARCHAR(20), -- dose code in the configured immunization schedule
+    recipient_type VARCHAR(10) NOT NULL CHECK (recipient_type IN ('user', 'doctor')),
+    recipient_tag VARCHAR(50) NOT NULL,
+    lead_minutes INTEGER,
+    send_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(10) DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'cancelled', 'skipped')),
+    sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (kind <> 'appointment' OR (appointment_id IS NOT NULL AND lead_minutes IS NOT NULL)),
+    CHECK (kind = 'appointment' OR (dependent_id IS NOT NULL AND vaccine_code IS NOT NULL)),
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE CASCADE,
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE CASCADE
+);
+
+CREATE INDEX appointment_reminders_due ON appointment_reminders (send_at) WHERE status = 'pending';
+
+-- a vaccine reminder goes out once per dose and kind
+CREATE UNIQUE INDEX vaccine_reminders_once ON appointment_reminders (dependent_id, vaccine_code, kind) WHERE kind <> 'appointment';
+
+--patients waiting for a slot with one doctor, or with any doctor of a specialization, between two times
+CREATE TABLE waitlist_entries (
+    entry_id SERIAL PRIMARY KEY,
+    usertag VARCHAR(50) NOT NULL,
+    doctortag VARCHAR(50),
+    specialization VARCHAR(100),
+    dependent_id INTEGER,
+    earliest_at TIMESTAMPTZ NOT NULL,
+    latest_at TIMESTAMPTZ NOT NULL,
+    reason TEXT,
+    status VARCHAR(10) DEFAULT 'waiting' CHECK (status IN ('waiting', 'offered', 'booked', 'lapsed', 'expired', 'cancelled')),
+    queued_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, -- place in line, moves to the back when an offer is turned down
+    offered_doctortag VARCHAR(50),
+    offered_starts_at TIMESTAMPTZ,
+    hold_expires_at TIMESTAMPTZ,
+    appointment_id INTEGER,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (doctortag IS NOT NULL OR specialization IS NOT NULL),
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE,
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE CASCADE,
+    FOREIGN KEY (doctortag) REFERENCES doctors(doctortag) ON DELETE CASCADE,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE SET NULL
+);
+
+CREATE INDEX waitlist_entries_queue ON waitlist_entries (queued_at) WHERE status = 'waiting';
+
+--private calendar feed tokens, one per patient or doctor, rotating the token breaks the old subscription URL
+CREATE TABLE calendar_feeds (
+    feed_id SERIAL PRIMARY KEY,
+    owner_type VARCHAR(10) NOT NULL CHECK (owner_type IN ('patient', 'doctor')),
+    owner_tag VARCHAR(50) NOT NULL,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (owner_type, owner_tag)
+);
+
+--patient health record, one row per allergy, condition, medication, surgery, family history item or immunization.
+--usertag is the account holder, dependent_id is set when the record belongs to one of their dependents
+CREATE TABLE health_record_entries (
+    entry_id SERIAL PRIMARY KEY,
+    usertag VARCHAR(50) NOT NULL,
+    dependent_id INTEGER,
+    category VARCHAR(20) NOT NULL CHECK (category IN ('allergy', 'condition', 'medication', 'surgery', 'family_history', 'immunization')),
+    name VARCHAR(255) NOT NULL,
+    code VARCHAR(50), -- ICD-10, RxNorm or CVX code when known
+    status VARCHAR(20) DEFAULT 'active' CHECK (status IN ('active', 'inactive', 'resolved', 'entered_in_error')),
+    severity VARCHAR(10) CHECK (severity IN ('mild', 'moderate', 'severe', 'unknown')),
+    reaction TEXT,
+    dosage VARCHAR(100),
+    frequency VARCHAR(100),
+    relation VARCHAR(50), -- family history, e.g. mother
+    onset_date DATE, -- onset, start of a medication, date of surgery or of the vaccine dose
+    end_date DATE,
+    notes TEXT,
+    created_by_type VARCHAR(10) NOT NULL CHECK (created_by_type IN ('patient', 'doctor', 'hospital')),
+    created_by VARCHAR(50) NOT NULL, -- usertag, doctortag or hospital_id
+    updated_by_type VARCHAR(10) NOT NULL CHECK (updated_by_type IN ('patient', 'doctor', 'hospital')),
+    updated_by VARCHAR(50) NOT NULL,
+    external_id VARCHAR(150) UNIQUE, -- hospital/resource type/id of an imported FHIR resource, so a re-import is skipped
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE,
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE CASCADE
+);
+
+CREATE INDEX health_record_entries_subject ON health_record_entries (usertag, dependent_id);
+
+--every version of a health record entry with who wrote it, entries are never deleted, only marked entered_in_error
+CREATE TABLE health_record_history (
+    history_id SERIAL PRIMARY KEY,
+    entry_id INTEGER NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('created', 'updated', 'removed')),
+    changed_by_type VARCHAR(10) NOT NULL CHECK (changed_by_type IN ('patient', 'doctor', 'hospital')),
+    changed_by VARCHAR(50) NOT NULL,
+    appointment_id INTEGER, -- the visit a doctor edited the record from
+    snapshot JSONB NOT NULL,
+    changed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (entry_id) REFERENCES health_record_entries(entry_id) ON DELETE CASCADE,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE SET NULL
+);
+
+--height, weight and head circumference of a dependent, scored against the WHO growth standards when read
+CREATE TABLE growth_measurements (
+    measurement_id SERIAL PRIMARY KEY,
+    dependent_id INTEGER NOT NULL,
+    measured_on DATE NOT NULL,
+    weight_kg NUMERIC(5, 2),
+    height_cm NUMERIC(5, 1), -- lying length under 2 years, standing height after
+    head_circumference_cm NUMERIC(4, 1),
+    notes TEXT,
+    recorded_by_type VARCHAR(10) NOT NULL CHECK (recorded_by_type IN ('patient', 'doctor', 'hospital')),
+    recorded_by VARCHAR(50) NOT NULL,
+    appointment_id INTEGER,
+    external_id VARCHAR(150) UNIQUE, -- set for measurements imported from a hospital's FHIR Observation
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (weight_kg IS NOT NULL OR height_cm IS NOT NULL OR head_circumference_cm IS NOT NULL),
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE CASCADE,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE SET NULL
+);
+
+CREATE INDEX growth_measurements_dependent ON growth_measurements (dependent_id, measured_on);
+
+--vaccine doses given to a dependent, code is the dose in the configured immunization schedule
+CREATE TABLE immunization_doses (
+    dose_id SERIAL PRIMARY KEY,
+    dependent_id INTEGER NOT NULL,
+    code VARCHAR(20) NOT NULL,
+    administered_on DATE NOT NULL,
+    lot_number VARCHAR(50),
+    facility VARCHAR(150),
+    notes TEXT,
+    recorded_by_type VARCHAR(10) NOT NULL CHECK (recorded_by_type IN ('patient', 'doctor')),
+    recorded_by VARCHAR(50) NOT NULL,
+    appointment_id INTEGER,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (dependent_id, code),
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE CASCADE,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE SET NULL
+);
+
+--nutrition guidance generated for a dependent, kept with the inputs and engine that produced it so results
+--can be compared when the engine changes. A doctor approves it or replaces the items with their own
+CREATE TABLE nutrition_recommendations (
+    recommendation_id SERIAL PRIMARY KEY,
+    dependent_id INTEGER NOT NULL,
+    engine VARCHAR(100) NOT NULL,
+    engine_version VARCHAR(50) NOT NULL,
+    profile JSONB NOT NULL,
+    items JSONB NOT NULL,
+    status VARCHAR(20) DEFAULT 'pending_review' CHECK (status IN ('pending_review', 'approved', 'overridden')),
+    override_items JSONB,
+    review_note TEXT,
+    requested_by_type VARCHAR(10) NOT NULL CHECK (requested_by_type IN ('patient', 'doctor')),
+    requested_by VARCHAR(50) NOT NULL,
+    reviewed_by VARCHAR(50),
+    appointment_id INTEGER,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at TIMESTAMPTZ,
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE CASCADE,
+    FOREIGN KEY (reviewed_by) REFERENCES doctors(doctortag) ON DELETE SET NULL,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE SET NULL
+);
+
+CREATE INDEX nutrition_recommendations_dependent ON nutrition_recommendations (dependent_id, created_at);
+
+--API keys partner hospitals use for the FHIR endpoints, only a SHA-256 of the key is kept
+CREATE TABLE hospital_api_keys (
+    key_id SERIAL PRIMARY KEY,
+    hospital_id INTEGER NOT NULL,
+    key_prefix VARCHAR(12) NOT NULL, -- shown in listings so a key can be recognised
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_by VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    FOREIGN KEY (hospital_id) REFERENCES hospitals(hospital_id) ON DELETE CASCADE
+);
+
+--every FHIR read, export and import by a partner hospital
+CREATE TABLE fhir_access_logs (
+    log_id SERIAL PRIMARY KEY,
+    hospital_id INTEGER NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('read', 'export', 'import')),
+    patient_ref VARCHAR(80), -- FHIR Patient id, user-<usertag> or dependent-<id>
+    details JSONB,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (hospital_id) REFERENCES hospitals(hospital_id) ON DELETE CASCADE
+);
+
+--what a patient agreed to share and with whom. Booking an appointment grants its doctor treatment access for that visit,
+--every other grant is made by the patient and carries an end date. usertag is the account holder, who grants for their dependents too
+CREATE TABLE record_consents (
+    consent_id SERIAL PRIMARY KEY,
+    usertag VARCHAR(50) NOT NULL,
+    dependent_id INTEGER,
+    grantee_type VARCHAR(10) NOT NULL CHECK (grantee_type IN ('doctor', 'hospital')),
+    grantee VARCHAR(50) NOT NULL, -- doctortag or hospital_id
+    purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('treatment', 'referral', 'second_opinion', 'care_coordination')),
+    appointment_id INTEGER UNIQUE, -- set on the grant made by booking, it covers that appointment only
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE,
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE CASCADE,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE CASCADE
+);
+
+CREATE INDEX record_consents_grantee ON record_consents (grantee_type, grantee);
+
+--every time an admin opened a patient's clinical record or an appointment chat without consent and why, the patient can see these
+CREATE TABLE break_glass_access_log (
+    access_id SERIAL PRIMARY KEY,
+    admintag VARCHAR(50) NOT NULL,
+    usertag VARCHAR(50) NOT NULL,
+    dependent_id INTEGER,
+    appointment_id INTEGER, -- set when only one appointment's chat was opened
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (usertag) REFERENCES users(usertag) ON DELETE CASCADE,
+    FOREIGN KEY (dependent_id) REFERENCES dependents(dependent_id) ON DELETE SET NULL,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(appointment_id) ON DELETE SET NULL
+);
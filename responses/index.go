@@ -71,4 +71,5 @@ const (
 	TRANSFER_FAILED        = "transfer failed"
 	INVALID_TOKEN		   = "invalid or expired token"
 	LOGOUT_SUCCESSFUL      = "logout successful"
+	SMS_OTP_SENT           = "otp has been sent to your phone number"
 )
@@ -23,57 +23,88 @@ func AdminRoutes(app *fiber.App) {
 	api.Post("/verify-forgot-password-otp", roleMiddleware(Admin, God_eye), adminController.VerifyPwdOTP)
 	api.Post("/reset-password", roleMiddleware(Admin, God_eye), adminController.ResetPassword)
 	//dashboards
-	api.Get("/dashboard/summary", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchDashboardSummary)
-	api.Get("/analytics", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchAnalytics)
+	api.Get("/dashboard/summary", middleware.AdminProtected(Admin, God_eye), adminController.FetchDashboardSummary)
+	api.Get("/analytics", middleware.AdminProtected(Admin, God_eye), adminController.FetchAnalytics)
 	//appointments
-	api.Get("/appointments", roleMiddleware(Admin, God_eye), adminController.FetchAppointments)
-	api.Post("/appointments/:id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchAppointmentByID)
-	api.Patch("/appointments/:id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.UpdateAppointmentStatus)
-	api.Put("/appointments/:id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.UpdateAppointment)
+	api.Get("/appointments", middleware.AdminProtected(Admin, God_eye), adminController.FetchAppointments)
+	api.Post("/appointments/:id", middleware.AdminProtected(Admin, God_eye), adminController.FetchAppointmentByID)
+	api.Patch("/appointments/:id", middleware.AdminProtected(Admin, God_eye), adminController.UpdateAppointmentStatus)
+	api.Put("/appointments/:id", middleware.AdminProtected(Admin, God_eye), adminController.UpdateAppointment)
+	api.Get("/appointments/:id/messages", middleware.AdminProtected(Admin, God_eye), adminController.FetchAppointmentMessages) //break-glass, audited and shown to the patient, needs ?reason=
 	//doctors
-	api.Get("/doctors", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchDoctors)
-	api.Get("/doctors/:doctortag", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchDoctorByID)
-	api.Delete("/doctors/:doctortag", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.DeleteDoctor)
+	api.Get("/doctors", middleware.AdminProtected(Admin, God_eye), adminController.FetchDoctors)
+	api.Get("/doctors/:doctortag", middleware.AdminProtected(Admin, God_eye), adminController.FetchDoctorByID)
+	api.Delete("/doctors/:doctortag", middleware.AdminProtected(Admin, God_eye), adminController.DeleteDoctor)
+	api.Get("/doctors/:doctortag/schedule", middleware.AdminProtected(Admin, God_eye), ScheduleController.FetchSchedule)
+	api.Put("/doctors/:doctortag/schedule", middleware.AdminProtected(Admin, God_eye), ScheduleController.UpdateSchedule)
+	api.Post("/doctors/:doctortag/schedule/overrides", middleware.AdminProtected(Admin, God_eye), ScheduleController.AddOverride)
+	api.Delete("/doctors/:doctortag/schedule/overrides/:override_id", middleware.AdminProtected(Admin, God_eye), ScheduleController.DeleteOverride)
+	api.Post("/doctors/:doctortag/time-off", middleware.AdminProtected(Admin, God_eye), ScheduleController.AddTimeOff)
+	api.Delete("/doctors/:doctortag/time-off/:time_off_id", middleware.AdminProtected(Admin, God_eye), ScheduleController.DeleteTimeOff)
 	//patients
-	api.Get("/patients", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchPatients)
-	api.Get("/patients/:usertag", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchPatientByUsertag)
-	api.Delete("/patients/:usertag", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.DeletePatient)
-	api.Patch("/patients/:usertag", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.EditPatient)
+	api.Get("/patients", middleware.AdminProtected(Admin, God_eye), adminController.FetchPatients)
+	api.Get("/patients/:usertag", middleware.AdminProtected(Admin, God_eye), adminController.FetchPatientByUsertag)     //demographics only
+	api.Get("/patients/:usertag/record", middleware.AdminProtected(Admin, God_eye), adminController.FetchPatientRecord) //break-glass, audited and shown to the patient, needs ?reason=
+	api.Delete("/patients/:usertag", middleware.AdminProtected(Admin, God_eye), adminController.DeletePatient)
+	api.Patch("/patients/:usertag", middleware.AdminProtected(Admin, God_eye), adminController.EditPatient)
 	//pharmacy
-	api.Get("/pharmacy", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchPharmacy)
-	api.Get("/pharmacy/:pharmacy_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchPharmacyByID)
-	api.Post("/pharmacy", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.CreatePharmacy)
-	api.Delete("/pharmacy/:pharmacy_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.DeletePharmacy)
-	api.Patch("/pharmacy/:pharmacy_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.UpdatePharmacy)
+	api.Get("/pharmacy", middleware.AdminProtected(Admin, God_eye), adminController.FetchPharmacy)
+	api.Get("/pharmacy/:pharmacy_id", middleware.AdminProtected(Admin, God_eye), adminController.FetchPharmacyByID)
+	api.Post("/pharmacy", middleware.AdminProtected(Admin, God_eye), adminController.CreatePharmacy)
+	api.Delete("/pharmacy/:pharmacy_id", middleware.AdminProtected(Admin, God_eye), adminController.DeletePharmacy)
+	api.Patch("/pharmacy/:pharmacy_id", middleware.AdminProtected(Admin, God_eye), adminController.UpdatePharmacy)
 	//hospitals
-	api.Get("/hospitals", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchHospitals)
-	api.Get("/hospitals/:hospital_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchHospitalByID)
-	api.Post("/hospitals", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.CreateHospital)
-	api.Delete("/hospitals/:hospital_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.DeleteHospital)
-	api.Patch("/hospitals/:hospital_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.UpdateHospital)
+	api.Get("/hospitals", middleware.AdminProtected(Admin, God_eye), adminController.FetchHospitals)
+	api.Get("/hospitals/:hospital_id", middleware.AdminProtected(Admin, God_eye), adminController.FetchHospitalByID)
+	api.Post("/hospitals", middleware.AdminProtected(Admin, God_eye), adminController.CreateHospital)
+	api.Delete("/hospitals/:hospital_id", middleware.AdminProtected(Admin, God_eye), adminController.DeleteHospital)
+	api.Patch("/hospitals/:hospital_id", middleware.AdminProtected(Admin, God_eye), adminController.UpdateHospital)
+	api.Get("/hospitals/:hospital_id/api-keys", middleware.AdminProtected(Admin, God_eye), adminController.FetchHospitalAPIKeys)
+	api.Post("/hospitals/:hospital_id/api-keys", middleware.AdminProtected(Admin, God_eye), adminController.CreateHospitalAPIKey) //FHIR access, the key is shown once
+	api.Delete("/hospitals/:hospital_id/api-keys/:key_id", middleware.AdminProtected(Admin, God_eye), adminController.RevokeHospitalAPIKey)
 	//inventory
-	api.Get("/inventory", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchInventory)
-	api.Get("/inventory/:inventory_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchInventoryByID)
-	api.Post("/inventory", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.CreateInventory)
-	api.Delete("/inventory/:inventory_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.DeleteInventory)
-	api.Patch("/inventory/:inventory_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.UpdateInventory)
+	api.Get("/inventory", middleware.AdminProtected(Admin, God_eye), adminController.FetchInventory)
+	api.Get("/inventory/:inventory_id", middleware.AdminProtected(Admin, God_eye), adminController.FetchInventoryByID)
+	api.Post("/inventory", middleware.AdminProtected(Admin, God_eye), adminController.CreateInventory)
+	api.Delete("/inventory/:inventory_id", middleware.AdminProtected(Admin, God_eye), adminController.DeleteInventory)
+	api.Patch("/inventory/:inventory_id", middleware.AdminProtected(Admin, God_eye), adminController.UpdateInventory)
 	//orders
-	api.Get("/orders", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchOrders)
-	api.Get("/orders/:order_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchOrderByID)
-	api.Put("/orders/:order_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.UpdateOrder)
+	api.Get("/orders", middleware.AdminProtected(Admin, God_eye), adminController.FetchOrders)
+	api.Get("/orders/:order_id", middleware.AdminProtected(Admin, God_eye), adminController.FetchOrderByID)
+	api.Put("/orders/:order_id", middleware.AdminProtected(Admin, God_eye), adminController.UpdateOrder)
 	//test center
-	api.Get("/test-centers", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchTestCenters)
-	api.Get("/test-centers/:test_center_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchTestCenterByID)
-	api.Post("/test-centers", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.CreateTestCenter)
-	api.Delete("/test-centers/:test_center_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.DeleteCenter)
-	api.Patch("/test-centers/:test_center_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.UpdateTestCenter)
+	api.Get("/test-centers", middleware.AdminProtected(Admin, God_eye), adminController.FetchTestCenters)
+	api.Get("/test-centers/:test_center_id", middleware.AdminProtected(Admin, God_eye), adminController.FetchTestCenterByID)
+	api.Post("/test-centers", middleware.AdminProtected(Admin, God_eye), adminController.CreateTestCenter)
+	api.Delete("/test-centers/:test_center_id", middleware.AdminProtected(Admin, God_eye), adminController.DeleteCenter)
+	api.Patch("/test-centers/:test_center_id", middleware.AdminProtected(Admin, God_eye), adminController.UpdateTestCenter)
 	//reviews
-	api.Get("/reviews", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchReviews)
-	api.Get("/reviews/:review_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchReviewByID)
-	api.Delete("/reviews/:review_id", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.DeleteReview)
+	api.Get("/reviews", middleware.AdminProtected(Admin, God_eye), adminController.FetchReviews)
+	api.Get("/reviews/:review_id", middleware.AdminProtected(Admin, God_eye), adminController.FetchReviewByID)
+	api.Delete("/reviews/:review_id", middleware.AdminProtected(Admin, God_eye), adminController.DeleteReview)
+	//wallets
+	api.Get("/wallets/:usertag", middleware.AdminProtected(Admin, God_eye), adminController.FetchWallet)
+	api.Patch("/wallets/:usertag/status", middleware.AdminProtected(Admin, God_eye), adminController.UpdateWalletStatus)
+	api.Get("/wallets/:usertag/transactions", middleware.AdminProtected(Admin, God_eye), adminController.FetchLedger)
+	api.Post("/wallets/:usertag/adjustments", middleware.AdminProtected(Admin, God_eye), adminController.CreateWalletAdjustment)
+	api.Get("/wallet-topups/summary", middleware.AdminProtected(Admin, God_eye), adminController.FetchTopUpSummary)
+	api.Get("/wallet-adjustments", middleware.AdminProtected(Admin, God_eye), adminController.FetchWalletAdjustments)
+	api.Patch("/wallet-adjustments/:adjustment_id", middleware.AdminProtected(Admin, God_eye), adminController.DecideWalletAdjustment)
+	api.Get("/audit-logs", middleware.AdminProtected(Admin, God_eye), adminController.FetchAuditLogs)
+	//kyc review queue
+	api.Get("/kyc/documents", middleware.AdminProtected(Admin, God_eye), KycController.FetchKycDocuments)
+	api.Patch("/kyc/documents/:document_id", middleware.AdminProtected(Admin, God_eye), KycController.ReviewKycDocument)
+	//withdrawals held by the fraud rules
+	api.Get("/withdrawals/reviews", middleware.AdminProtected(Admin, God_eye), FraudController.FetchWithdrawalReviews)
+	api.Patch("/withdrawals/reviews/:review_id", middleware.AdminProtected(Admin, God_eye), FraudController.ReviewWithdrawal)
+	//subscription plans
+	api.Get("/subscription-plans", middleware.AdminProtected(Admin, God_eye), adminController.FetchSubscriptionPlans)
+	api.Post("/subscription-plans", middleware.AdminProtected(Admin, God_eye), adminController.CreateSubscriptionPlan)
+	api.Put("/subscription-plans/:plan_id", middleware.AdminProtected(Admin, God_eye), adminController.UpdateSubscriptionPlan)
+	api.Get("/subscriptions", middleware.AdminProtected(Admin, God_eye), adminController.FetchSubscriptions)
 	//admin profile
-	api.Get("/profile", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.FetchAdminProfile)
-	api.Patch("/profile", roleMiddleware(Admin, God_eye), middleware.JWTProtected(), adminController.UpdateAdminProfile)
+	api.Get("/profile", middleware.AdminProtected(Admin, God_eye), adminController.FetchAdminProfile)
+	api.Patch("/profile", middleware.AdminProtected(Admin, God_eye), adminController.UpdateAdminProfile)
 }
 
 func roleMiddleware(allowedRoles ...string) fiber.Handler {
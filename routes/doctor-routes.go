@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"telemed/controllers"
+	"telemed/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var doctorController controllers.DoctorController
+var doctorConsultationController controllers.ConsultationController
+var doctorChatController controllers.ChatController
+var doctorAttachmentController controllers.AttachmentController
+var visitNoteController controllers.VisitNoteController
+var doctorCalendarController controllers.CalendarController
+var healthRecordController controllers.HealthRecordController
+var growthController controllers.GrowthController
+var immunizationController controllers.ImmunizationController
+var nutritionController controllers.NutritionController
+var consentController controllers.ConsentController
+
+func DoctorRoutes(app *fiber.App) {
+	api := app.Group("/doctor")
+	api.Post("/login", doctorController.Login)
+	//appointments
+	api.Get("/appointments", middleware.DoctorProtected(), doctorController.FetchAppointments)
+	api.Get("/appointments/:id/history", middleware.DoctorProtected(), doctorController.FetchStatusHistory)
+	api.Post("/appointments/:id/accept", middleware.DoctorProtected(), doctorController.AcceptAppointment)
+	api.Post("/appointments/:id/decline", middleware.DoctorProtected(), doctorController.DeclineAppointment)
+	api.Post("/appointments/:id/propose", middleware.DoctorProtected(), doctorController.ProposeNewTime)
+	api.Post("/appointments/:id/complete", middleware.DoctorProtected(), doctorController.CompleteAppointment)
+	api.Post("/appointments/:id/no-show", middleware.DoctorProtected(), doctorController.MarkNoShow)
+	api.Post("/appointments/:id/cancel", middleware.DoctorProtected(), doctorController.CancelAppointment)
+	api.Post("/appointments/:id/follow-up", middleware.DoctorProtected(), doctorController.CreateFollowUp)
+	//video consultation
+	api.Post("/appointments/:id/session", middleware.DoctorProtected(), doctorConsultationController.DoctorJoinSession)
+	api.Get("/appointments/:id/session", middleware.DoctorProtected(), doctorConsultationController.DoctorFetchSession)
+	//chat
+	api.Get("/appointments/:id/messages", middleware.DoctorProtected(), doctorChatController.FetchMessages)
+	api.Post("/appointments/:id/messages", middleware.DoctorProtected(), doctorChatController.SendMessage)
+	api.Post("/appointments/:id/messages/read", middleware.DoctorProtected(), doctorChatController.MarkRead)
+	api.Post("/appointments/:id/chat/token", middleware.DoctorProtected(), doctorChatController.FetchToken)
+	//attachments
+	api.Post("/appointments/:id/attachments", middleware.DoctorProtected(), doctorAttachmentController.UploadAttachment)
+	api.Get("/appointments/:id/attachments", middleware.DoctorProtected(), doctorAttachmentController.FetchAttachments)
+	api.Get("/appointments/:id/attachments/:attachment_id", middleware.DoctorProtected(), doctorAttachmentController.FetchAttachment)
+	api.Delete("/appointments/:id/attachments/:attachment_id", middleware.DoctorProtected(), doctorAttachmentController.DeleteAttachment)
+	//visit notes, SOAP format
+	api.Get("/appointments/:id/notes", middleware.DoctorProtected(), visitNoteController.FetchNote)
+	api.Put("/appointments/:id/notes", middleware.DoctorProtected(), visitNoteController.SaveNote)
+	api.Post("/appointments/:id/notes/sign", middleware.DoctorProtected(), visitNoteController.SignNote)
+	api.Post("/appointments/:id/notes/addenda", middleware.DoctorProtected(), visitNoteController.AddAddendum)
+	//patient health record, open only while the appointment is confirmed and the patient's consent stands
+	api.Get("/appointments/:id/health-record", middleware.DoctorProtected(), healthRecordController.DoctorFetchRecord)
+	api.Post("/appointments/:id/health-record/entries", middleware.DoctorProtected(), healthRecordController.DoctorAddEntry)
+	api.Put("/appointments/:id/health-record/entries/:entry_id", middleware.DoctorProtected(), healthRecordController.DoctorUpdateEntry)
+	api.Delete("/appointments/:id/health-record/entries/:entry_id", middleware.DoctorProtected(), healthRecordController.DoctorRemoveEntry)
+	api.Get("/appointments/:id/health-record/entries/:entry_id/history", middleware.DoctorProtected(), healthRecordController.DoctorFetchEntryHistory)
+	api.Get("/appointments/:id/growth", middleware.DoctorProtected(), growthController.DoctorFetchChart) //only for appointments booked for a dependent
+	api.Post("/appointments/:id/growth", middleware.DoctorProtected(), growthController.DoctorAddMeasurement)
+	api.Delete("/appointments/:id/growth/:measurement_id", middleware.DoctorProtected(), growthController.DoctorRemoveMeasurement)
+	api.Get("/appointments/:id/immunizations", middleware.DoctorProtected(), immunizationController.DoctorFetchStatus)
+	api.Post("/appointments/:id/immunizations", middleware.DoctorProtected(), immunizationController.DoctorRecordDose) //doses given at the visit
+	api.Delete("/appointments/:id/immunizations/:dose_id", middleware.DoctorProtected(), immunizationController.DoctorRemoveDose)
+	api.Get("/appointments/:id/nutrition", middleware.DoctorProtected(), nutritionController.DoctorFetchHistory)
+	api.Post("/appointments/:id/nutrition", middleware.DoctorProtected(), nutritionController.DoctorGenerate)
+	api.Post("/appointments/:id/nutrition/:recommendation_id/review", middleware.DoctorProtected(), nutritionController.DoctorReview) //approve, or override with the doctor's own items
+	//records patients shared outside an appointment, until the date they chose
+	api.Get("/shared-records", middleware.DoctorProtected(), consentController.DoctorFetchSharedRecords)
+	api.Get("/shared-records/:consent_id", middleware.DoctorProtected(), consentController.DoctorFetchSharedRecord)
+	//calendar subscription, served from the same /calendar/ical URL as patients
+	api.Get("/calendar/feed", middleware.DoctorProtected(), doctorCalendarController.FetchFeed)
+	api.Post("/calendar/feed/rotate", middleware.DoctorProtected(), doctorCalendarController.RotateFeed)
+}
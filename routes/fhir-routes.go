@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"telemed/controllers"
+	"telemed/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var fhirController controllers.FHIRController
+
+// FHIRRoutes serves partner hospitals, authenticated with an API key issued from the admin hospital pages
+func FHIRRoutes(app *fiber.App) {
+	api := app.Group("/fhir", middleware.HospitalProtected())
+	api.Get("/Patient/:id/$everything", fhirController.FetchEverything) //full export as a searchset bundle
+	api.Get("/Patient/:id", fhirController.FetchPatient)
+	api.Get("/:type", fhirController.Search) //needs ?patient=
+	api.Post("/", fhirController.Import)     //batch, transaction or collection bundle
+}
@@ -9,6 +9,23 @@ import (
 
 var Controller controllers.Controller
 var WalletController controllers.WalletController
+var KycController controllers.KycController
+var FraudController controllers.FraudController
+var SubscriptionController controllers.SubscriptionController
+var ScheduleController controllers.ScheduleController
+var AppointmentController controllers.AppointmentController
+var ConsultationController controllers.ConsultationController
+var ChatController controllers.ChatController
+var AttachmentController controllers.AttachmentController
+var VisitNoteController controllers.VisitNoteController
+var WaitlistController controllers.WaitlistController
+var CalendarController controllers.CalendarController
+var DependentController controllers.DependentController
+var HealthRecordController controllers.HealthRecordController
+var GrowthController controllers.GrowthController
+var ImmunizationController controllers.ImmunizationController
+var NutritionController controllers.NutritionController
+var ConsentController controllers.ConsentController
 
 func Routes(app *fiber.App) {
 	//onboarding feature, put in oauth feature once the app has been deployed
@@ -18,10 +35,71 @@ func Routes(app *fiber.App) {
 	app.Post("/signup", Controller.Signup)
 	app.Post("/login", Controller.Login)
 	//dashboard , protected with jwt middleware
-	app.Get("/get-doctors", middleware.JWTProtected(), Controller.FetchDoctors) //fetching the doctors so as to book an appointment
-	app.Post("/book-appointment", middleware.JWTProtected(), Controller.BookAppointment)
+	app.Get("/get-doctors", middleware.JWTProtected(), Controller.FetchDoctors)                            //fetching the doctors so as to book an appointment
+	app.Get("/doctors/first-available", middleware.JWTProtected(), ScheduleController.FetchFirstAvailable) //booking calendar search by specialization and state
+	app.Get("/doctors/:doctortag/slots", middleware.JWTProtected(), ScheduleController.FetchOpenSlots)
+	app.Post("/book-appointment", middleware.JWTProtected(), Controller.BookAppointment) //dependent_id books for a child or family member
+	//dependents, cared for and billed under the guardian's account until they take over their own records
+	app.Post("/dependents", middleware.JWTProtected(), DependentController.AddDependent)
+	app.Get("/dependents", middleware.JWTProtected(), DependentController.FetchDependents)
+	app.Get("/dependents/transfers", middleware.JWTProtected(), DependentController.FetchIncomingTransfers) //handovers waiting for this account
+	app.Put("/dependents/:dependent_id", middleware.JWTProtected(), DependentController.UpdateDependent)
+	app.Post("/dependents/:dependent_id/transfer", middleware.JWTProtected(), DependentController.StartTransfer)
+	app.Delete("/dependents/:dependent_id/transfer", middleware.JWTProtected(), DependentController.CancelTransfer)
+	app.Post("/dependents/:dependent_id/transfer/accept", middleware.JWTProtected(), DependentController.AcceptTransfer) //called by the dependent's own account
+	//record sharing, booking grants the doctor access for that appointment, anything else is granted here until a date
+	app.Get("/consents", middleware.JWTProtected(), ConsentController.FetchConsents)
+	app.Post("/consents", middleware.JWTProtected(), ConsentController.GrantConsent)
+	app.Delete("/consents/:consent_id", middleware.JWTProtected(), ConsentController.RevokeConsent)
+	app.Get("/consents/break-glass", middleware.JWTProtected(), ConsentController.FetchBreakGlassLog)   //every time staff opened the record without consent
+	app.Get("/dependents/:dependent_id/growth", middleware.JWTProtected(), GrowthController.FetchChart) //WHO z-scores, percentile lines and flags
+	app.Post("/dependents/:dependent_id/growth", middleware.JWTProtected(), GrowthController.AddMeasurement)
+	app.Delete("/dependents/:dependent_id/growth/:measurement_id", middleware.JWTProtected(), GrowthController.RemoveMeasurement)
+	app.Get("/immunization-schedule", middleware.JWTProtected(), ImmunizationController.FetchSchedule)
+	app.Get("/dependents/:dependent_id/immunizations", middleware.JWTProtected(), ImmunizationController.FetchStatus) //each scheduled dose as given, upcoming, due, overdue or missed
+	app.Post("/dependents/:dependent_id/immunizations", middleware.JWTProtected(), ImmunizationController.RecordDose)
+	app.Delete("/dependents/:dependent_id/immunizations/:dose_id", middleware.JWTProtected(), ImmunizationController.RemoveDose)
+	app.Post("/dependents/:dependent_id/nutrition", middleware.JWTProtected(), NutritionController.Generate) //guidance from age, growth, allergies and conditions, reviewed by a doctor
+	app.Get("/dependents/:dependent_id/nutrition", middleware.JWTProtected(), NutritionController.FetchHistory)
+	//health record, ?dependent_id= reads a dependent's, every change is kept with who made it
+	app.Get("/health-record", middleware.JWTProtected(), HealthRecordController.FetchRecord)
+	app.Post("/health-record/entries", middleware.JWTProtected(), HealthRecordController.AddEntry)
+	app.Put("/health-record/entries/:entry_id", middleware.JWTProtected(), HealthRecordController.UpdateEntry)
+	app.Delete("/health-record/entries/:entry_id", middleware.JWTProtected(), HealthRecordController.RemoveEntry) //marked entered in error, never erased
+	app.Get("/health-record/entries/:entry_id/history", middleware.JWTProtected(), HealthRecordController.FetchEntryHistory)
+	//waitlist for fully booked doctors, a freed slot is held for the next patient in line
+	app.Post("/waitlist", middleware.JWTProtected(), WaitlistController.JoinWaitlist)
+	app.Get("/waitlist", middleware.JWTProtected(), WaitlistController.FetchWaitlist)
+	app.Post("/waitlist/:entry_id/accept", middleware.JWTProtected(), WaitlistController.AcceptOffer)
+	app.Post("/waitlist/:entry_id/decline", middleware.JWTProtected(), WaitlistController.DeclineOffer)
+	app.Delete("/waitlist/:entry_id", middleware.JWTProtected(), WaitlistController.LeaveWaitlist)
 	app.Get("/appointments", middleware.JWTProtected(), Controller.FetchAppointment)
-	//next endpoint after fetching appointments is to get on a video call to start the consultation
+	app.Get("/appointments/:id/cancellation", middleware.JWTProtected(), AppointmentController.FetchCancellationQuote) //what the patient gets back if they cancel now
+	app.Post("/appointments/:id/cancel", middleware.JWTProtected(), AppointmentController.CancelAppointment)
+	app.Patch("/appointments/:id/reschedule", middleware.JWTProtected(), AppointmentController.RescheduleAppointment)
+	app.Post("/appointments/:id/proposal", middleware.JWTProtected(), AppointmentController.RespondToProposal) //accept or decline a time the doctor proposed
+	app.Get("/appointments/:id/history", middleware.JWTProtected(), AppointmentController.FetchStatusHistory)
+	//video consultation, join hands out a room token for the signaling socket
+	app.Post("/appointments/:id/session", middleware.JWTProtected(), ConsultationController.JoinSession)
+	app.Get("/appointments/:id/session", middleware.JWTProtected(), ConsultationController.FetchSession)
+	app.Get("/consultations/ws", ConsultationController.SignalingUpgrade, ConsultationController.Signaling())
+	//chat with the doctor, open from booking until the follow-up window closes
+	app.Get("/appointments/:id/messages", middleware.JWTProtected(), ChatController.FetchMessages)
+	app.Post("/appointments/:id/messages", middleware.JWTProtected(), ChatController.SendMessage)
+	app.Post("/appointments/:id/messages/read", middleware.JWTProtected(), ChatController.MarkRead)
+	app.Post("/appointments/:id/chat/token", middleware.JWTProtected(), ChatController.FetchToken)
+	app.Get("/chat/ws", ChatController.SocketUpgrade, ChatController.Socket())
+	//lab results and images, upload right after booking or during follow-up
+	app.Post("/appointments/:id/attachments", middleware.JWTProtected(), AttachmentController.UploadAttachment) //multipart, field "file" and optional "category"
+	app.Get("/appointments/:id/attachments", middleware.JWTProtected(), AttachmentController.FetchAttachments)
+	app.Get("/appointments/:id/attachments/:attachment_id", middleware.JWTProtected(), AttachmentController.FetchAttachment)
+	app.Delete("/appointments/:id/attachments/:attachment_id", middleware.JWTProtected(), AttachmentController.DeleteAttachment)
+	app.Get("/files/:attachment_id", AttachmentController.Download)                                        //signed, expiring link from the endpoints above
+	app.Get("/appointments/:id/summary", middleware.JWTProtected(), VisitNoteController.FetchVisitSummary) //available once the doctor signs the notes
+	//calendar subscription, the feed URL carries a private token so calendar apps can poll it without logging in
+	app.Get("/calendar/feed", middleware.JWTProtected(), CalendarController.FetchFeed)
+	app.Post("/calendar/feed/rotate", middleware.JWTProtected(), CalendarController.RotateFeed) //old URL stops working
+	app.Get("/calendar/ical/:token", CalendarController.ServeFeed)
 	app.Post("rate-doctor", middleware.JWTProtected(), Controller.RateDoctor)
 	app.Get("/medications", middleware.JWTProtected(), Controller.FetchMedications)
 	app.Get("/pharmacies", middleware.JWTProtected(), Controller.FetchPharmacies)
@@ -30,7 +108,9 @@ func Routes(app *fiber.App) {
 	app.Patch("/cart/:product-id", middleware.JWTProtected(), Controller.UpdateCart)
 	app.Delete("/cart/:product-id", middleware.JWTProtected(), Controller.DeleteFromCart)
 	app.Get("/cart", middleware.JWTProtected(), Controller.FetchCart)
-	app.Get("/billing-details", middleware.JWTProtected(), Controller.FetchBillingDetails) //user clicks checkout button
+	app.Get("/billing-details", middleware.JWTProtected(), Controller.FetchBillingDetails)               //user clicks checkout button
+	app.Get("/checkout/summary", middleware.JWTProtected(), SubscriptionController.FetchCheckoutSummary) //cart total with the plan discount applied
+	app.Post("/checkout", middleware.JWTProtected(), SubscriptionController.Checkout)                    //pays the cart from the wallet at the discounted total
 	//wallet system (crucial for users to be able to pay for services and medications and top up or withdraw from their balance)
 	app.Get("/wallet", middleware.JWTProtected(), WalletController.FetchBalance)
 	app.Get("/wallet/banks", middleware.JWTProtected(), WalletController.FetchBanks)
@@ -38,8 +118,21 @@ func Routes(app *fiber.App) {
 	app.Post("/wallet/top-up", middleware.JWTProtected(), WalletController.TopUp)
 	app.Post("/wallet/withdraw", middleware.JWTProtected(), WalletController.Withdraw)
 	app.Get("/wallet/accounts", middleware.JWTProtected(), WalletController.FetchPayoutAccounts)
+	app.Get("/wallet/cards", middleware.JWTProtected(), SubscriptionController.FetchSavedCards)
 	app.Get("/payment/callback", WalletController.PaymentCallback) //paystack will redirect to this endpoint after payment
 	app.Post("/paystack/webhook", WalletController.PaystackWebhook)
+	//kyc verification, each tier raises the wallet limits
+	app.Get("/kyc", middleware.JWTProtected(), KycController.FetchKycStatus)
+	app.Post("/kyc/phone/send-otp", middleware.JWTProtected(), KycController.SendPhoneOTP)
+	app.Post("/kyc/phone/verify", middleware.JWTProtected(), KycController.VerifyPhone)
+	app.Post("/kyc/documents", middleware.JWTProtected(), KycController.SubmitDocument)
+	//health plans, billed monthly from the wallet or a saved card
+	app.Get("/subscriptions/plans", middleware.JWTProtected(), SubscriptionController.FetchPlans)
+	app.Post("/subscriptions", middleware.JWTProtected(), SubscriptionController.Subscribe)
+	app.Get("/subscriptions/me", middleware.JWTProtected(), SubscriptionController.FetchSubscription)
+	app.Patch("/subscriptions/me", middleware.JWTProtected(), SubscriptionController.ChangePlan)
+	app.Delete("/subscriptions/me", middleware.JWTProtected(), SubscriptionController.CancelSubscription)
+	app.Get("/subscriptions/invoices", middleware.JWTProtected(), SubscriptionController.FetchInvoices)
 	//profile management
 	app.Get("/profile", middleware.JWTProtected(), Controller.FetchProfile)
 	app.Patch("/profile", middleware.JWTProtected(), Controller.UpdateProfile)
@@ -5,11 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"telemed/config"
 	"telemed/models"
 	"telemed/responses"
 	"telemed/utils"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -52,9 +55,9 @@ func (AdminServer) Login(data models.Adminlogin) (any, error) {
 }
 
 func (AdminServer) VerifyOTP(data models.OTPVerify) (any, error) {
-	var dbOtp string
+	var dbOtp, role string
 	var otpExpiryTime time.Time
-	err := Db.QueryRow(Ctx, "SELECT otp, otp_expiry FROM admins WHERE admintag = $1", data.Usertag).Scan(&dbOtp, &otpExpiryTime)
+	err := Db.QueryRow(Ctx, "SELECT otp, otp_expiry, COALESCE(role, 'admin') FROM admins WHERE admintag = $1", data.Usertag).Scan(&dbOtp, &otpExpiryTime, &role)
 	if err != nil {
 		log.Println(err)
 		return nil, errors.New("invalid email or OTP")
@@ -74,7 +77,7 @@ func (AdminServer) VerifyOTP(data models.OTPVerify) (any, error) {
 		log.Println("Failed to clear OTP:", err)
 	}
 
-	token, err := utils.GenerateJWT(data.Usertag)
+	token, err := utils.GenerateAdminJWT(data.Usertag, role)
 	if err != nil {
 		log.Println("Failed to generate JWT token:", err)
 		return nil, errors.New(responses.SOMETHING_WRONG)
@@ -254,14 +257,14 @@ func (AdminServer) GetAppointments(data models.GetDataReq) (any, error) {
 	var sqlStatement string
 
 	if data.Search == "" {
-		sqlStatement = "SELECT appointment_id, patient_tag, doctor_tag, scheduled_at, reason, file_url, status, created_at FROM appointments"
+		sqlStatement = "SELECT appointment_id, patient_tag, doctor_tag, scheduled_at, status, created_at FROM appointments"
 		if data.Status != "" {
 			sqlStatement += fmt.Sprintf(" WHERE status = $%d", argIndex)
 			args = append(args, data.Status)
 			argIndex++
 		}
 	} else {
-		sqlStatement = fmt.Sprintf("SELECT appointment_id, patient_tag, doctor_tag, scheduled_at, reason, file_url, status, created_at FROM appointments WHERE (patient_tag ILIKE $%d OR doctor_tag ILIKE $%d OR reason ILIKE $%d)", argIndex, argIndex, argIndex)
+		sqlStatement = fmt.Sprintf("SELECT appointment_id, patient_tag, doctor_tag, scheduled_at, status, created_at FROM appointments WHERE (patient_tag ILIKE $%d OR doctor_tag ILIKE $%d)", argIndex, argIndex)
 		args = append(args, "%"+data.Search+"%")
 		argIndex++
 		if data.Status != "" {
@@ -283,7 +286,7 @@ func (AdminServer) GetAppointments(data models.GetDataReq) (any, error) {
 
 	for rows.Next() {
 		var appointment models.Appointment
-		if err := rows.Scan(&appointment.ID, &appointment.UserTag, &appointment.DoctorTag, &appointment.Scheduled_at, &appointment.Reason, &appointment.Fileurl, &appointment.Status, &appointment.Created_at); err != nil {
+		if err := rows.Scan(&appointment.ID, &appointment.UserTag, &appointment.DoctorTag, &appointment.Scheduled_at, &appointment.Status, &appointment.Created_at); err != nil {
 			log.Println("Failed to scan appointment:", err)
 			return nil, errors.New(responses.SOMETHING_WRONG)
 		}
@@ -302,7 +305,7 @@ func (AdminServer) GetAppointmentByID(payload models.AppointmentID) (any, error)
 	var data models.AppointmentIDResp
 
 	query := `
-		SELECT a.patient_tag, a.doctor_tag, a.scheduled_at, a.reason, a.file_url, a.status, a.created_at,
+		SELECT a.patient_tag, a.doctor_tag, a.scheduled_at, a.status, a.created_at,
 		       u.firstname, u.lastname, u.phone_no, u.gender, u.date_of_birth,
 		       d.fullname, d.price_per_session
 		FROM appointments a
@@ -315,8 +318,6 @@ func (AdminServer) GetAppointmentByID(payload models.AppointmentID) (any, error)
 		&data.UserTag,
 		&data.DoctorTag,
 		&data.Scheduled_At,
-		&data.Reason,
-		&data.File_URL,
 		&data.Status,
 		&data.Created_At,
 		&data.First_name,
@@ -352,7 +353,7 @@ func (AdminServer) GetDoctorByID(data models.Doctorreq) (any, error) {
 		d.yrs_of_experience,
 		d.price_per_session,
 		d.about,
-		d.availability,
+		COALESCE(d.slot_duration_minutes, 30),
 		d.profile_pic_url,
 		h.name AS hospital_affiliation
 	FROM doctors d
@@ -372,7 +373,7 @@ func (AdminServer) GetDoctorByID(data models.Doctorreq) (any, error) {
 		&doctor.YearsOfExperience,
 		&doctor.Price,
 		&doctor.About,
-		&doctor.Availability,
+		&doctor.SlotDuration,
 		&doctor.ProfilePicURL,
 		&doctor.HospitalAffiliation, // ← from hospitals.name
 	)
@@ -389,44 +390,87 @@ func (AdminServer) GetDoctorByID(data models.Doctorreq) (any, error) {
 }
 
 func (AdminServer) UpdateAppointmentStatus(payload models.UpdateAppointmentStatus) (any, error) {
-	switch payload.Status {
-	case "cancel":
-		_, err := Db.Exec(Ctx, "UPDATE appointments SET status = 'cancelled' WHERE appointment_id = $2", payload.Status, payload.Appointment_id)
-		if err != nil {
-			log.Println("Failed to update appointment status:", err)
-			return nil, errors.New(responses.SOMETHING_WRONG)
-		}
-		return map[string]string{"message": "Appointment cancelled successfully"}, nil
-	case "completed":
-		_, err := Db.Exec(Ctx, "UPDATE appointments SET status = 'completed' WHERE appointment_id = $2", payload.Status, payload.Appointment_id)
-		if err != nil {
-			log.Println("Failed to update appointment status:", err)
-			return nil, errors.New(responses.SOMETHING_WRONG)
-		}
-		return map[string]string{"message": "Appointment completed successfully"}, nil
-	case "pending":
-		_, err := Db.Exec(Ctx, "UPDATE appointments SET status = 'pending' WHERE appointment_id = $2", payload.Status, payload.Appointment_id)
-		if err != nil {
-			log.Println("Failed to update appointment status:", err)
-			return nil, errors.New(responses.SOMETHING_WRONG)
-		}
-		return map[string]string{"message": "Appointment status updated to pending"}, nil
-	default:
-		return nil, errors.New("invalid appointment status")
+	appointmentID, err := strconv.Atoi(payload.Appointment_id)
+	if err != nil {
+		return nil, errors.New("invalid appointment id")
+	}
+	status := payload.Status
+	if status == "cancel" {
+		status = "cancelled"
+	}
+
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	a, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	from := a.status
+	refund, err := transitionAppointment(tx, &a, status, ActorAdmin, payload.Admintag, payload.Note)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing appointment status update:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
 	}
+
+	announceTransition(a, from, ActorAdmin, payload.Note, refund)
+	return map[string]interface{}{"status": a.status, "refund_amount": refund}, nil
 }
 
 func (a *AdminServer) RescheduleAppointment(data models.RescheduleAppointmentReq) (any, error) {
-	_, err := time.Parse(time.RFC3339, data.NewScheduledAt)
+	newTime, err := time.Parse(time.RFC3339, data.NewScheduledAt)
+	if err != nil {
+		return nil, errors.New("invalid datetime format")
+	}
+	appointmentID, err := strconv.Atoi(data.Appointment_id)
 	if err != nil {
-		return errors.New("invalid datetime format"), nil
+		return nil, errors.New("invalid appointment id")
+	}
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	var doctortag, usertag string
+	err = tx.QueryRow(Ctx, `SELECT doctor_tag, patient_tag FROM appointments WHERE appointment_id = $1 FOR UPDATE`, appointmentID).Scan(&doctortag, &usertag)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("appointment not found")
+		}
+		log.Println("Error fetching appointment for reschedule:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
 	}
-	query := `UPDATE appointments SET scheduled_at = $1 WHERE appointment_id = $2`
-	_, err = Db.Exec(Ctx, query, data.NewScheduledAt, data.Appointment_id)
+	// move the reservation, the old slot is freed before the new one is taken
+	if err := releaseSlot(tx, appointmentID); err != nil {
+		return nil, err
+	}
+	if err := reserveSlot(tx, doctortag, newTime, appointmentID); err != nil {
+		return nil, err
+	}
+	query := `UPDATE appointments SET scheduled_at = $1, ical_sequence = ical_sequence + 1 WHERE appointment_id = $2`
+	_, err = tx.Exec(Ctx, query, newTime, appointmentID)
 	if err != nil {
 		log.Println("Error updating appointment schedule:", err)
 		return nil, errors.New(responses.SOMETHING_WRONG)
 	}
+	if err := syncReminders(tx, appointmentID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing appointment reschedule:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	notifyPatientWithInvite(usertag, appointmentID, "Appointment rescheduled",
+		"Your appointment has been moved to "+newTime.In(userLocation(Db, usertag)).Format("Mon 2 Jan 15:04 MST")+" by our support team.")
+	inviteDoctor(doctortag, appointmentID, "Appointment rescheduled",
+		"An appointment has been moved to "+newTime.In(doctorLocation(Db, doctortag)).Format("Mon 2 Jan 15:04 MST")+" by our support team.")
 
 	return map[string]string{"message": "Appointment rescheduled successfully"}, nil
 }
@@ -516,27 +560,21 @@ func (AdminServer) GetPatients(data models.GetDataReq) (any, error) {
 	return patients, nil
 }
 
+// GetPatientByUsertag returns demographics only, the clinical record needs break-glass access
 func (AdminServer) GetPatientByUsertag(data models.PatientIdReq) (any, error) {
 	var patient models.PatientIdResp
-	var firstname, lastname string
-
-	query1 := `select u.usertag, u.firstname, u.lastname, u.phone_no, u.gender, u.date_of_birth , ap.doctor_tag, ap.reason, ap.file_url, ap.status
-				from users AS u
-				inner join appointments AS ap
-				on u.usertag = ap.patient_tag
-				where usertag = $1 `
-	err := Db.QueryRow(Ctx, query1, data.Usertag).Scan(&patient.UserTag, &firstname, &lastname, &patient.Phone_No, &patient.Gender, &patient.Dob, &patient.Attending_Doctor, &patient.Reason, &patient.File_URL, &patient.Status)
+	err := Db.QueryRow(Ctx,
+		`SELECT usertag, CONCAT_WS(' ', firstname, lastname), COALESCE(email, ''), COALESCE(phone_no, ''), COALESCE(gender, ''), date_of_birth, COALESCE(state, '')
+		 FROM users WHERE usertag = $1`, data.Usertag).
+		Scan(&patient.UserTag, &patient.Name, &patient.Email, &patient.Phone_No, &patient.Gender, &patient.Dob, &patient.State)
 	if err != nil {
-		log.Println("Failed to fetch patient:", err)
-		if err.Error() == "no rows in result set" {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, errors.New("patient not found")
 		}
+		log.Println("Failed to fetch patient:", err)
 		return nil, errors.New(responses.SOMETHING_WRONG)
 	}
-	patient.Name = firstname + " " + lastname
-
 	return patient, nil
-
 }
 
 func (AdminServer) DeletePatient(data models.PatientIdReq) error {
@@ -656,9 +694,9 @@ func (AdminServer) GetHospitals(data models.GetDataReq) (any, error) {
 	var sqlStatement string
 
 	if data.Search == "" {
-		sqlStatement = "SELECT hospital_id, hospital_name, address, country, state, about, picture_url FROM hospitals"
+		sqlStatement = "SELECT hospital_id, hospital_name, address, country, state, about, picture_url, COALESCE(time_zone, '') FROM hospitals"
 	} else {
-		sqlStatement = fmt.Sprintf("SELECT hospital_id, hospital_name, address, country, state, about, picture_url FROM hospitals WHERE (hospital_name ILIKE $%d OR address ILIKE $%d OR country ILIKE $%d OR state ILIKE $%d OR about ILIKE $%d)", argIndex, argIndex, argIndex, argIndex, argIndex)
+		sqlStatement = fmt.Sprintf("SELECT hospital_id, hospital_name, address, country, state, about, picture_url, COALESCE(time_zone, '') FROM hospitals WHERE (hospital_name ILIKE $%d OR address ILIKE $%d OR country ILIKE $%d OR state ILIKE $%d OR about ILIKE $%d)", argIndex, argIndex, argIndex, argIndex, argIndex)
 		args = append(args, "%"+data.Search+"%")
 		argIndex++
 	}
@@ -673,7 +711,7 @@ func (AdminServer) GetHospitals(data models.GetDataReq) (any, error) {
 
 	for rows.Next() {
 		var hospital models.Hospital
-		if err := rows.Scan(&hospital.HospitalID, &hospital.HospitalName, &hospital.Address, &hospital.Country, &hospital.State, &hospital.About, &hospital.Picture_url); err != nil {
+		if err := rows.Scan(&hospital.HospitalID, &hospital.HospitalName, &hospital.Address, &hospital.Country, &hospital.State, &hospital.About, &hospital.Picture_url, &hospital.TimeZone); err != nil {
 			log.Println("Failed to scan hospital:", err)
 			return nil, errors.New(responses.SOMETHING_WRONG)
 		}
@@ -690,8 +728,11 @@ func (AdminServer) GetHospitals(data models.GetDataReq) (any, error) {
 
 func (AdminServer) CreateHospital(data models.Hospital) (any, error) {
 	data.HospitalID = utils.GenerateUUID(data.HospitalName)
-	query := `INSERT INTO hospitals (hospital_id, hospital_name, address, country, state, about, picture_url) VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := Db.Exec(Ctx, query, data.HospitalID, data.HospitalName, data.Address, data.Country, data.State, data.About, data.Picture_url)
+	if data.TimeZone == "" {
+		data.TimeZone = config.DefaultTimeZone
+	}
+	query := `INSERT INTO hospitals (hospital_id, hospital_name, address, country, state, about, picture_url, time_zone) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := Db.Exec(Ctx, query, data.HospitalID, data.HospitalName, data.Address, data.Country, data.State, data.About, data.Picture_url, data.TimeZone)
 	if err != nil {
 		log.Println("Failed to create hospital:", err)
 		return nil, errors.New(responses.SOMETHING_WRONG)
@@ -711,8 +752,8 @@ func (AdminServer) DeleteHospital(hospitalID string) error {
 
 func (AdminServer) GetHospitalByID(hospitalID string) (any, error) {
 	var hospital models.Hospital
-	err := Db.QueryRow(Ctx, "SELECT hospital_id, hospital_name, address, country, state, about, picture_url FROM hospitals WHERE hospital_id = $1", hospitalID).
-		Scan(&hospital.HospitalID, &hospital.HospitalName, &hospital.Address, &hospital.Country, &hospital.State, &hospital.About, &hospital.Picture_url)
+	err := Db.QueryRow(Ctx, "SELECT hospital_id, hospital_name, address, country, state, about, picture_url, COALESCE(time_zone, '') FROM hospitals WHERE hospital_id = $1", hospitalID).
+		Scan(&hospital.HospitalID, &hospital.HospitalName, &hospital.Address, &hospital.Country, &hospital.State, &hospital.About, &hospital.Picture_url, &hospital.TimeZone)
 	if err != nil {
 		log.Println("Failed to fetch hospital by ID:", err)
 		if err.Error() == "no rows in result set" {
@@ -725,8 +766,8 @@ func (AdminServer) GetHospitalByID(hospitalID string) (any, error) {
 }
 
 func (AdminServer) UpdateHospital(payload models.Hospital) (any, error) {
-	query := `UPDATE hospitals SET hospital_name = $1, address = $2, country = $3, state = $4, about = $5, picture_url = $6 WHERE hospital_id = $7`
-	_, err := Db.Exec(Ctx, query, payload.HospitalName, payload.Address, payload.Country, payload.State, payload.About, payload.Picture_url, payload.HospitalID)
+	query := `UPDATE hospitals SET hospital_name = $1, address = $2, country = $3, state = $4, about = $5, picture_url = $6, time_zone = COALESCE(NULLIF($7, ''), time_zone) WHERE hospital_id = $8`
+	_, err := Db.Exec(Ctx, query, payload.HospitalName, payload.Address, payload.Country, payload.State, payload.About, payload.Picture_url, payload.TimeZone, payload.HospitalID)
 	if err != nil {
 		log.Println("Failed to update hospital:", err)
 		return nil, errors.New(responses.SOMETHING_WRONG)
@@ -0,0 +1,294 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func (AdminServer) GetWallet(usertag string) (any, error) {
+	var wallet models.AdminWalletResp
+	err := Db.QueryRow(Ctx,
+		`SELECT w.usertag, w.balance, COALESCE(w.pending_balance, 0), w.wallet_status, COALESCE(w.status_reason, ''), COALESCE(u.kyc_tier, 1)
+		 FROM wallets w
+		 JOIN users u ON u.usertag = w.usertag
+		 WHERE w.usertag = $1`, usertag).
+		Scan(&wallet.Usertag, &wallet.Balance, &wallet.PendingBalance, &wallet.WalletStatus, &wallet.StatusReason, &wallet.KycTier)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("wallet not found")
+		}
+		log.Println("Failed to fetch wallet:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return wallet, nil
+}
+
+func (AdminServer) UpdateWalletStatus(data models.WalletStatusReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	var previous string
+	err = tx.QueryRow(Ctx, `SELECT wallet_status FROM wallets WHERE usertag = $1 FOR UPDATE`, data.Usertag).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("wallet not found")
+		}
+		log.Println("Failed to fetch wallet status:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if previous == data.Status {
+		return nil, errors.New("wallet is already " + data.Status)
+	}
+	_, err = tx.Exec(Ctx, `UPDATE wallets SET wallet_status = $1, status_reason = $2 WHERE usertag = $3`, data.Status, data.Reason, data.Usertag)
+	if err != nil {
+		log.Println("Failed to update wallet status:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	err = recordAudit(tx, data.AdminTag, "wallet.status", "wallet", data.Usertag, map[string]any{
+		"from":   previous,
+		"to":     data.Status,
+		"reason": data.Reason,
+	})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing wallet status change:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]string{"message": "Wallet status changed to " + data.Status}, nil
+}
+
+func (AdminServer) GetLedger(data models.LedgerReq) (any, error) {
+	var ledger []models.WalletTransaction
+	offset := data.Limit*data.Page - data.Limit
+	rows, err := Db.Query(Ctx,
+		`SELECT transaction_id, usertag, amount, transaction_type, COALESCE(transaction_reference, ''), COALESCE(narration, ''), status, created_at
+		 FROM wallet_transactions WHERE usertag = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`,
+		data.Usertag, data.Limit, offset)
+	if err != nil {
+		log.Println("Failed to fetch wallet ledger:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var txn models.WalletTransaction
+		if err := rows.Scan(&txn.TransactionID, &txn.Usertag, &txn.Amount, &txn.TransactionType, &txn.TransactionReference, &txn.Narration, &txn.Status, &txn.Created_at); err != nil {
+			log.Println("Failed to scan wallet transaction:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		ledger = append(ledger, txn)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over wallet ledger:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return ledger, nil
+}
+
+func (AdminServer) CreateWalletAdjustment(data models.WalletAdjustmentReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	var adjustmentID int
+	err = tx.QueryRow(Ctx,
+		`INSERT INTO wallet_adjustments (usertag, adjustment_type, amount, reason, status, requested_by)
+		 VALUES ($1, $2, $3, $4, 'pending_approval', $5) RETURNING adjustment_id`,
+		data.Usertag, data.AdjustmentType, data.Amount, data.Reason, data.AdminTag).Scan(&adjustmentID)
+	if err != nil {
+		log.Println("Failed to create wallet adjustment:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	err = recordAudit(tx, data.AdminTag, "wallet.adjustment.request", "wallet_adjustment", fmt.Sprint(adjustmentID), map[string]any{
+		"usertag": data.Usertag,
+		"type":    data.AdjustmentType,
+		"amount":  data.Amount,
+		"reason":  data.Reason,
+	})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	// small adjustments are applied straight away, larger ones wait for a second admin
+	if data.Amount <= config.AdjustmentApprovalThreshold {
+		reference, err := applyWalletAdjustment(tx, fmt.Sprint(adjustmentID), data.AdminTag)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(Ctx); err != nil {
+			log.Println("Error committing wallet adjustment:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		return map[string]interface{}{
+			"message":       "Adjustment applied",
+			"adjustment_id": adjustmentID,
+			"reference":     reference,
+		}, nil
+	}
+
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing wallet adjustment:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]interface{}{
+		"message":       fmt.Sprintf("Adjustments above %.2f need approval from another admin", config.AdjustmentApprovalThreshold),
+		"adjustment_id": adjustmentID,
+	}, nil
+}
+
+func (AdminServer) GetWalletAdjustments(data models.GetDataReq) (any, error) {
+	var adjustments []models.WalletAdjustment
+	var args []any
+	argIndex := 1
+	offset := data.Limit*data.Page - data.Limit
+
+	sqlStatement := `SELECT adjustment_id, usertag, adjustment_type, amount, reason, status, requested_by, COALESCE(approved_by, ''),
+		COALESCE(transaction_reference, ''), created_at, decided_at FROM wallet_adjustments`
+	if data.Status != "" {
+		sqlStatement += fmt.Sprintf(" WHERE status = $%d", argIndex)
+		args = append(args, data.Status)
+		argIndex++
+	}
+	sqlStatement += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, data.Limit, offset)
+
+	rows, err := Db.Query(Ctx, sqlStatement, args...)
+	if err != nil {
+		log.Println("Failed to fetch wallet adjustments:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var adj models.WalletAdjustment
+		if err := rows.Scan(&adj.AdjustmentID, &adj.Usertag, &adj.AdjustmentType, &adj.Amount, &adj.Reason, &adj.Status, &adj.RequestedBy,
+			&adj.ApprovedBy, &adj.TransactionReference, &adj.Created_at, &adj.DecidedAt); err != nil {
+			log.Println("Failed to scan wallet adjustment:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		adjustments = append(adjustments, adj)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over wallet adjustments:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return adjustments, nil
+}
+
+func (AdminServer) DecideWalletAdjustment(data models.DecideAdjustmentReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	var status, requestedBy string
+	err = tx.QueryRow(Ctx, `SELECT status, requested_by FROM wallet_adjustments WHERE adjustment_id = $1 FOR UPDATE`, data.AdjustmentID).
+		Scan(&status, &requestedBy)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("adjustment not found")
+		}
+		log.Println("Failed to fetch wallet adjustment:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if status != "pending_approval" {
+		return nil, errors.New("adjustment has already been decided")
+	}
+	if requestedBy == data.AdminTag {
+		return nil, errors.New("adjustment must be approved by a different admin")
+	}
+
+	var res map[string]string
+	if data.Decision == "reject" {
+		_, err = tx.Exec(Ctx, `UPDATE wallet_adjustments SET status = 'rejected', approved_by = $1, decided_at = NOW() WHERE adjustment_id = $2`,
+			data.AdminTag, data.AdjustmentID)
+		if err != nil {
+			log.Println("Failed to reject wallet adjustment:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		res = map[string]string{"message": "Adjustment rejected"}
+	} else {
+		reference, err := applyWalletAdjustment(tx, data.AdjustmentID, data.AdminTag)
+		if err != nil {
+			return nil, err
+		}
+		res = map[string]string{"message": "Adjustment approved and applied", "reference": reference}
+	}
+	err = recordAudit(tx, data.AdminTag, "wallet.adjustment."+data.Decision, "wallet_adjustment", data.AdjustmentID, map[string]any{
+		"requested_by": requestedBy,
+		"note":         data.Note,
+	})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing wallet adjustment decision:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return res, nil
+}
+
+// applyWalletAdjustment moves the money for an adjustment and writes it to the ledger
+func applyWalletAdjustment(tx pgx.Tx, adjustmentID, approvedBy string) (string, error) {
+	var usertag, adjustmentType, reason string
+	var amount float64
+	err := tx.QueryRow(Ctx, `SELECT usertag, adjustment_type, amount, reason FROM wallet_adjustments WHERE adjustment_id = $1`, adjustmentID).
+		Scan(&usertag, &adjustmentType, &amount, &reason)
+	if err != nil {
+		log.Println("Failed to fetch wallet adjustment for apply:", err)
+		return "", errors.New(responses.SOMETHING_WRONG)
+	}
+
+	var balance float64
+	err = tx.QueryRow(Ctx, `SELECT balance FROM wallets WHERE usertag=$1 FOR UPDATE`, usertag).Scan(&balance)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", errors.New("wallet not found")
+		}
+		log.Println("Failed to lock wallet for adjustment:", err)
+		return "", errors.New(responses.SOMETHING_WRONG)
+	}
+	delta := amount
+	if adjustmentType == "debit" {
+		if balance < amount {
+			return "", errors.New("insufficient wallet balance for debit adjustment")
+		}
+		delta = -amount
+	}
+	_, err = tx.Exec(Ctx, `UPDATE wallets SET balance = balance + $1 WHERE usertag=$2`, delta, usertag)
+	if err != nil {
+		log.Println("Failed to apply wallet adjustment:", err)
+		return "", errors.New(responses.SOMETHING_WRONG)
+	}
+
+	reference := fmt.Sprintf("adjustment_%s_%d", adjustmentID, time.Now().Unix())
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO wallet_transactions (usertag, amount, transaction_type, transaction_reference, status, created_at, narration)
+		 VALUES ($1, $2, $3, $4, 'success', $5, $6)`,
+		usertag, amount, adjustmentType, reference, time.Now(), "Manual adjustment: "+reason)
+	if err != nil {
+		log.Println("Failed to record wallet adjustment transaction:", err)
+		return "", errors.New(responses.SOMETHING_WRONG)
+	}
+	_, err = tx.Exec(Ctx,
+		`UPDATE wallet_adjustments SET status = 'applied', approved_by = $1, transaction_reference = $2, decided_at = NOW() WHERE adjustment_id = $3`,
+		approvedBy, reference, adjustmentID)
+	if err != nil {
+		log.Println("Failed to mark wallet adjustment applied:", err)
+		return "", errors.New(responses.SOMETHING_WRONG)
+	}
+	return reference, nil
+}
@@ -0,0 +1,342 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type AppointmentServer struct{}
+
+type appointmentRecord struct {
+	id               int
+	patientTag       string
+	doctorTag        string
+	scheduledAt      time.Time
+	status           string
+	amount           float64
+	paymentReference string
+	rescheduleCount  int
+	proposedAt       *time.Time
+	followUpOf       *int
+	followUpFee      float64
+	dependentID      *int
+}
+
+// lockAppointment loads an appointment, inside a transaction the row stays locked until it ends
+func lockAppointment(q querier, appointmentID int) (appointmentRecord, error) {
+	a := appointmentRecord{id: appointmentID}
+	err := q.QueryRow(Ctx,
+		`SELECT patient_tag, doctor_tag, scheduled_at, status, COALESCE(amount, 0), COALESCE(payment_reference, ''), COALESCE(reschedule_count, 0),
+		 proposed_at, follow_up_of, COALESCE(follow_up_fee, 0), dependent_id FROM appointments WHERE appointment_id = $1 FOR UPDATE`, appointmentID).
+		Scan(&a.patientTag, &a.doctorTag, &a.scheduledAt, &a.status, &a.amount, &a.paymentReference, &a.rescheduleCount, &a.proposedAt,
+			&a.followUpOf, &a.followUpFee, &a.dependentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return a, errors.New("appointment not found")
+		}
+		log.Println("Failed to lock appointment:", err)
+		return a, errors.New(responses.SOMETHING_WRONG)
+	}
+	return a, nil
+}
+
+// cancellationQuote applies the refund policy to an appointment at the given moment
+func cancellationQuote(a appointmentRecord, now time.Time) models.CancellationQuote {
+	quote := models.CancellationQuote{AppointmentID: a.id, AmountPaid: a.amount}
+	hoursLeft := a.scheduledAt.Sub(now).Hours()
+	switch {
+	case a.status == "pending":
+		quote.RefundPercent = 100
+		quote.Policy = "the doctor has not confirmed yet, so the full fee is refunded"
+	case hoursLeft >= float64(config.CancelFullRefundHours):
+		quote.RefundPercent = 100
+		quote.Policy = fmt.Sprintf("cancelled at least %d hours ahead, so the full fee is refunded", config.CancelFullRefundHours)
+	case hoursLeft >= float64(config.CancelPartialRefundHours):
+		quote.RefundPercent = config.CancelPartialRefundPercent
+		quote.Policy = fmt.Sprintf("cancelled less than %d hours ahead, so %d%% of the fee is refunded", config.CancelFullRefundHours, config.CancelPartialRefundPercent)
+	default:
+		quote.Policy = fmt.Sprintf("cancelled less than %d hours ahead, so the fee is not refunded", config.CancelPartialRefundHours)
+	}
+	quote.RefundAmount = math.Round(a.amount*float64(quote.RefundPercent)) / 100
+	quote.CanReschedule = hoursLeft >= float64(config.PatientRescheduleMinHours) && a.rescheduleCount < config.PatientMaxReschedules
+	return quote
+}
+
+// refundAppointmentPayment returns a percentage of an appointment fee to the patient from the platform's hold on
+// it. Consultations paid from a subscription are handed back to the plan instead when the refund is in full
+func refundAppointmentPayment(tx pgx.Tx, a appointmentRecord, percent int, narration string) (float64, string, error) {
+	if percent <= 0 {
+		return 0, "", nil
+	}
+	if strings.HasPrefix(a.paymentReference, "subscription_") {
+		if percent < 100 {
+			return 0, "", nil
+		}
+		subscriptionID, err := strconv.Atoi(strings.TrimPrefix(a.paymentReference, "subscription_"))
+		if err != nil {
+			return 0, "", nil
+		}
+		_, err = tx.Exec(Ctx,
+			`UPDATE subscriptions SET consultations_used = GREATEST(consultations_used - 1, 0) WHERE subscription_id = $1`, subscriptionID)
+		if err != nil {
+			log.Println("Failed to return subscription consultation:", err)
+			return 0, "", errors.New(responses.SOMETHING_WRONG)
+		}
+		return 0, a.paymentReference, nil
+	}
+	amount := math.Round(a.amount*float64(percent)) / 100
+	if amount <= 0 {
+		return 0, "", nil
+	}
+
+	// doctors have no wallet, the fee is held by the platform so the refund is paid from there and never
+	// depends on a doctor balance. Unlike a transfer it skips checkReceiverBalance: it returns the patient's own
+	// payment, and refusing it at the maximum balance would leave their money with the platform and the
+	// cancellation stuck
+	reference := fmt.Sprintf("refund_%d_%d", a.id, time.Now().Unix())
+	res, err := tx.Exec(Ctx, `UPDATE wallets SET balance = balance + $1 WHERE usertag = $2`, amount, a.patientTag)
+	if err != nil {
+		log.Println("Failed to credit patient for appointment refund:", err)
+		return 0, "", errors.New(responses.SOMETHING_WRONG)
+	}
+	if res.RowsAffected() == 0 {
+		log.Println("No wallet to refund appointment", a.id, "to for", a.patientTag)
+		return 0, "", errors.New("refund could not be processed as your wallet was not found, please contact support")
+	}
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO wallet_transactions (usertag, amount, transaction_type, transaction_reference, status, created_at, narration)
+		 VALUES ($1, $2, 'credit', $3, 'completed', $4, $5)`,
+		a.patientTag, amount, reference, time.Now(), narration)
+	if err != nil {
+		log.Println("Failed to record appointment refund:", err)
+		return 0, "", errors.New(responses.SOMETHING_WRONG)
+	}
+	return amount, reference, nil
+}
+
+func (AppointmentServer) GetCancellationQuote(usertag string, appointmentID int) (any, error) {
+	a, err := lockAppointment(Db, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if a.patientTag != usertag {
+		return nil, errors.New("appointment not found")
+	}
+	return cancellationQuote(a, time.Now()), nil
+}
+
+func (AppointmentServer) CancelAppointment(data models.CancelAppointmentReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	a, err := lockAppointment(tx, data.AppointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if a.patientTag != data.Usertag {
+		return nil, errors.New("appointment not found")
+	}
+	if !a.scheduledAt.After(time.Now()) {
+		return nil, errors.New("this appointment has already started")
+	}
+
+	quote := cancellationQuote(a, time.Now())
+	from := a.status
+	refund, err := transitionAppointment(tx, &a, "cancelled", ActorPatient, data.Usertag, data.Reason)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing appointment cancellation:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	announceTransition(a, from, ActorPatient, data.Reason, refund)
+	quote.RefundAmount = refund
+	return quote, nil
+}
+
+func (AppointmentServer) RescheduleAppointment(data models.PatientRescheduleReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	a, err := lockAppointment(tx, data.AppointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if a.patientTag != data.Usertag {
+		return nil, errors.New("appointment not found")
+	}
+	if a.status != "pending" && a.status != "confirmed" {
+		return nil, fmt.Errorf("a %s appointment cannot be rescheduled", a.status)
+	}
+	if a.scheduledAt.Sub(time.Now()) < time.Duration(config.PatientRescheduleMinHours)*time.Hour {
+		return nil, fmt.Errorf("appointments can only be rescheduled at least %d hours ahead", config.PatientRescheduleMinHours)
+	}
+	if a.rescheduleCount >= config.PatientMaxReschedules {
+		return nil, fmt.Errorf("an appointment can only be rescheduled %d times", config.PatientMaxReschedules)
+	}
+
+	if err := releaseSlot(tx, a.id); err != nil {
+		return nil, err
+	}
+	if err := reserveSlot(tx, a.doctorTag, data.NewScheduledAt, a.id); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(Ctx, `UPDATE appointments SET scheduled_at = $1, reschedule_count = reschedule_count + 1 WHERE appointment_id = $2`,
+		data.NewScheduledAt, a.id)
+	if err != nil {
+		log.Println("Failed to reschedule appointment:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	// a moved appointment goes back to pending so the doctor confirms the new time
+	from := a.status
+	note := "rescheduled from " + a.scheduledAt.Format(time.RFC3339)
+	if _, err := transitionAppointment(tx, &a, "pending", ActorPatient, data.Usertag, note); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing appointment reschedule:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	a.scheduledAt = data.NewScheduledAt
+	announceTransition(a, from, ActorPatient, note, 0)
+	return map[string]interface{}{
+		"message":          "Appointment rescheduled, waiting for the doctor to confirm",
+		"new_scheduled_at": data.NewScheduledAt.In(userLocation(Db, data.Usertag)),
+		"reschedules_left": config.PatientMaxReschedules - a.rescheduleCount - 1,
+	}, nil
+}
+
+// RespondToProposal lets the patient take or turn down the new time or follow-up a doctor proposed; turning it
+// down cancels the appointment with a full refund
+func (AppointmentServer) RespondToProposal(data models.ProposalResponseReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	a, err := lockAppointment(tx, data.AppointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if a.patientTag != data.Usertag {
+		return nil, errors.New("appointment not found")
+	}
+	if a.status != "proposed" || a.proposedAt == nil {
+		return nil, errors.New("there is no proposed time to respond to")
+	}
+
+	from := a.status
+	var refund float64
+	if data.Accept {
+		// a follow-up the doctor booked is only paid for once the patient takes it
+		if a.followUpOf != nil && a.paymentReference == "" && a.followUpFee > 0 {
+			var price float64
+			if err := tx.QueryRow(Ctx, `SELECT COALESCE(price_per_session, 0) FROM doctors WHERE doctortag = $1`, a.doctorTag).Scan(&price); err != nil {
+				log.Println("Failed to fetch doctor price:", err)
+				return nil, errors.New(responses.SOMETHING_WRONG)
+			}
+			ref, paid, err := payForAppointment(tx, a.patientTag, a.doctorTag, a.followUpFee, a.followUpFee >= price)
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.Exec(Ctx, `UPDATE appointments SET amount = $1, payment_reference = $2 WHERE appointment_id = $3`, paid, ref, a.id)
+			if err != nil {
+				log.Println("Failed to record follow-up payment:", err)
+				return nil, errors.New(responses.SOMETHING_WRONG)
+			}
+			a.amount, a.paymentReference = paid, ref
+		}
+		// the proposed slot was reserved when the doctor offered it, the original one is given up now. A follow-up
+		// was only ever booked at the proposed time
+		if !a.scheduledAt.Equal(*a.proposedAt) {
+			if err := releaseSlotAt(tx, a.id, a.scheduledAt); err != nil {
+				return nil, err
+			}
+		}
+		_, err = tx.Exec(Ctx, `UPDATE appointments SET scheduled_at = proposed_at, proposed_at = NULL WHERE appointment_id = $1`, a.id)
+		if err != nil {
+			log.Println("Failed to accept proposed time:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		a.scheduledAt = *a.proposedAt
+		if _, err := transitionAppointment(tx, &a, "confirmed", ActorPatient, data.Usertag, "accepted the proposed time"); err != nil {
+			return nil, err
+		}
+		// taking a follow-up is the patient's booking, it shares the record the same way
+		if err := grantAppointmentConsent(tx, a.id); err != nil {
+			return nil, err
+		}
+	} else {
+		refund, err = transitionAppointment(tx, &a, "cancelled", ActorPatient, data.Usertag, "declined the proposed time")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing proposal response:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	announceTransition(a, from, ActorPatient, "", refund)
+	return map[string]interface{}{
+		"status":        a.status,
+		"scheduled_at":  a.scheduledAt.In(userLocation(Db, data.Usertag)),
+		"refund_amount": refund,
+	}, nil
+}
+
+// getStatusHistory lists an appointment's status changes for the given patient or doctor
+func getStatusHistory(appointmentID int, column, tag string) (any, error) {
+	var owner string
+	err := Db.QueryRow(Ctx, `SELECT `+column+` FROM appointments WHERE appointment_id = $1`, appointmentID).Scan(&owner)
+	if err != nil || owner != tag {
+		return nil, errors.New("appointment not found")
+	}
+
+	var history []models.AppointmentStatusChange
+	rows, err := Db.Query(Ctx,
+		`SELECT COALESCE(from_status, ''), to_status, changed_by_type, COALESCE(note, ''), COALESCE(refund_amount, 0), created_at
+		 FROM appointment_status_history WHERE appointment_id = $1 ORDER BY created_at ASC`, appointmentID)
+	if err != nil {
+		log.Println("Failed to fetch appointment history:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var change models.AppointmentStatusChange
+		if err := rows.Scan(&change.FromStatus, &change.ToStatus, &change.ChangedBy, &change.Note, &change.RefundAmount, &change.Created_at); err != nil {
+			log.Println("Failed to scan appointment history:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		history = append(history, change)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over appointment history:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return history, nil
+}
+
+func (AppointmentServer) GetStatusHistory(usertag string, appointmentID int) (any, error) {
+	return getStatusHistory(appointmentID, "patient_tag", usertag)
+}
@@ -0,0 +1,42 @@
+package servers
+
+import (
+	"telemed/config"
+	"testing"
+	"time"
+)
+
+func TestCancellationQuote(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	in := func(hours int) time.Time { return now.Add(time.Duration(hours) * time.Hour) }
+	full, partial := config.CancelFullRefundHours, config.CancelPartialRefundHours
+	tests := []struct {
+		name          string
+		a             appointmentRecord
+		percent       int
+		amount        float64
+		canReschedule bool
+	}{
+		{"unconfirmed is always in full", appointmentRecord{status: "pending", amount: 5000, scheduledAt: in(1)}, 100, 5000, false},
+		{"right at the full refund cutoff", appointmentRecord{status: "confirmed", amount: 5000, scheduledAt: in(full)}, 100, 5000, true},
+		{"inside the partial window", appointmentRecord{status: "confirmed", amount: 5000, scheduledAt: in(full - 1)},
+			config.CancelPartialRefundPercent, 5000 * float64(config.CancelPartialRefundPercent) / 100, true},
+		{"right at the partial cutoff", appointmentRecord{status: "confirmed", amount: 5000, scheduledAt: in(partial)},
+			config.CancelPartialRefundPercent, 5000 * float64(config.CancelPartialRefundPercent) / 100, partial >= config.PatientRescheduleMinHours},
+		{"too late for a refund", appointmentRecord{status: "confirmed", amount: 5000, scheduledAt: in(partial - 1)}, 0, 0, false},
+		{"out of reschedules", appointmentRecord{status: "confirmed", amount: 5000, scheduledAt: in(full), rescheduleCount: config.PatientMaxReschedules}, 100, 5000, false},
+		{"paid by the plan", appointmentRecord{status: "confirmed", amount: 0, scheduledAt: in(full)}, 100, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := cancellationQuote(tt.a, now)
+			if q.RefundPercent != tt.percent || q.RefundAmount != tt.amount || q.CanReschedule != tt.canReschedule {
+				t.Errorf("quote = %d%% %.2f reschedule %v, want %d%% %.2f reschedule %v",
+					q.RefundPercent, q.RefundAmount, q.CanReschedule, tt.percent, tt.amount, tt.canReschedule)
+			}
+			if q.Policy == "" {
+				t.Error("quote has no policy text")
+			}
+		})
+	}
+}
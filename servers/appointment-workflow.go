@@ -0,0 +1,235 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"telemed/config"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	ActorPatient = "patient"
+	ActorDoctor  = "doctor"
+	ActorAdmin   = "admin"
+	ActorSystem  = "system"
+	// ActorHospital is a partner hospital writing through the FHIR import
+	ActorHospital = "hospital"
+)
+
+// appointmentTransitions lists, for each status, the statuses it can move to and who may move it there.
+// pending to pending is a reschedule
+var appointmentTransitions = map[string]map[string][]string{
+	"pending": {
+		"confirmed": {ActorDoctor, ActorAdmin},
+		"declined":  {ActorDoctor, ActorAdmin},
+		"proposed":  {ActorDoctor},
+		"pending":   {ActorPatient, ActorAdmin},
+		"cancelled": {ActorPatient, ActorAdmin},
+		"expired":   {ActorSystem},
+	},
+	"proposed": {
+		"confirmed": {ActorPatient},
+		"cancelled": {ActorPatient, ActorAdmin},
+		"expired":   {ActorSystem},
+	},
+	"confirmed": {
+		"completed": {ActorDoctor, ActorAdmin},
+		"no_show":   {ActorDoctor, ActorAdmin},
+		"pending":   {ActorPatient, ActorAdmin},
+		"cancelled": {ActorPatient, ActorDoctor, ActorAdmin},
+	},
+}
+
+// refundPercent is how much of the fee goes back to the patient when an appointment lands in a status
+func refundPercent(a appointmentRecord, to, actorType string) int {
+	switch to {
+	case "declined", "expired":
+		return 100
+	case "cancelled":
+		// the patient only pays the late cancellation fee when they are the reason the appointment fell through
+		if actorType == ActorPatient && a.status != "proposed" {
+			return cancellationQuote(a, time.Now()).RefundPercent
+		}
+		return 100
+	}
+	return 0
+}
+
+// transitionAppointment moves an appointment to a new status, applies the refund and slot release the new status
+// calls for, replans its reminders and records the change in the status history. The caller commits and then calls announceTransition
+func transitionAppointment(tx pgx.Tx, a *appointmentRecord, to, actorType, actor, note string) (float64, error) {
+	if !slices.Contains(appointmentTransitions[a.status][to], actorType) {
+		return 0, fmt.Errorf("a %s appointment cannot be moved to %s", a.status, to)
+	}
+
+	percent := refundPercent(*a, to, actorType)
+	refund, _, err := refundAppointmentPayment(tx, *a, percent, "Appointment refund: "+to)
+	if err != nil {
+		return 0, err
+	}
+
+	switch to {
+	case "cancelled", "declined", "expired":
+		_, err = tx.Exec(Ctx,
+			`UPDATE appointments SET status = $1, status_changed_at = NOW(), cancelled_by = $2, cancellation_reason = $3, refund_amount = $4,
+			 cancelled_at = NOW(), proposed_at = NULL, ical_sequence = ical_sequence + 1 WHERE appointment_id = $5`, to, actorType, note, refund, a.id)
+		if err == nil {
+			err = releaseSlot(tx, a.id)
+		}
+	default:
+		_, err = tx.Exec(Ctx, `UPDATE appointments SET status = $1, status_changed_at = NOW(), ical_sequence = ical_sequence + 1 WHERE appointment_id = $2`, to, a.id)
+	}
+	if err != nil {
+		log.Println("Failed to update appointment status:", err)
+		return 0, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := syncReminders(tx, a.id); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO appointment_status_history (appointment_id, from_status, to_status, changed_by_type, changed_by, note, refund_amount)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`, a.id, a.status, to, actorType, actor, note, refund)
+	if err != nil {
+		log.Println("Failed to record appointment status history:", err)
+		return 0, errors.New(responses.SOMETHING_WRONG)
+	}
+	a.status = to
+	return refund, nil
+}
+
+// announceTransition tells the other side of the appointment about a status change once it is committed
+func announceTransition(a appointmentRecord, from, actorType, note string, refund float64) {
+	// cancellations, reschedules and proposals can all free a slot someone on the waitlist wants
+	wakeWaitlist()
+	at := a.scheduledAt
+	if a.status == "proposed" && a.proposedAt != nil {
+		at = *a.proposedAt
+	}
+	patientTime := at.In(userLocation(Db, a.patientTag)).Format("Mon 2 Jan 15:04 MST")
+	doctorTime := at.In(doctorLocation(Db, a.doctorTag)).Format("Mon 2 Jan 15:04 MST")
+	refundNote := ""
+	if refund > 0 {
+		refundNote = fmt.Sprintf(" %.2f has been refunded to your wallet.", refund)
+	}
+	reason := ""
+	if note != "" {
+		reason = " Reason: " + note
+	}
+
+	// every change that confirms, moves or removes the event also goes out as a calendar invite to both sides
+	switch a.status {
+	case "confirmed":
+		if from == "proposed" {
+			notifyDoctor(a.doctorTag, "New time accepted", "The patient accepted your proposed time of "+doctorTime)
+			inviteDoctor(a.doctorTag, a.id, "New time accepted", "The patient accepted your proposed time of "+doctorTime)
+			invitePatient(a.patientTag, a.id, "Appointment confirmed", "Your appointment on "+patientTime+" is confirmed.")
+		} else {
+			notifyPatientWithInvite(a.patientTag, a.id, "Appointment confirmed", "Your appointment on "+patientTime+" has been confirmed by the doctor.")
+			inviteDoctor(a.doctorTag, a.id, "Appointment confirmed", "You confirmed the appointment on "+doctorTime+".")
+		}
+	case "declined":
+		notifyPatientWithInvite(a.patientTag, a.id, "Appointment declined", "The doctor could not take your appointment on "+patientTime+"."+reason+refundNote)
+		inviteDoctor(a.doctorTag, a.id, "Appointment declined", "You declined the appointment on "+doctorTime+".")
+	case "proposed":
+		notifyPatient(a.patientTag, "New time proposed", "The doctor proposed a new time for your appointment: "+patientTime+". Please accept or decline it."+reason)
+	case "expired":
+		notifyPatientWithInvite(a.patientTag, a.id, "Appointment expired", "Your appointment on "+patientTime+" was not confirmed in time."+refundNote)
+		inviteDoctor(a.doctorTag, a.id, "Appointment expired", "The appointment on "+doctorTime+" expired before it was confirmed.")
+	case "no_show":
+		notifyPatient(a.patientTag, "Missed appointment", "You were marked as absent for your appointment on "+patientTime+".")
+	case "completed":
+		notifyPatient(a.patientTag, "Consultation completed", "Your consultation is complete, you can now rate your doctor.")
+	case "pending":
+		notifyDoctor(a.doctorTag, "Appointment rescheduled", "The patient moved their appointment to "+doctorTime+", please confirm it.")
+		inviteDoctor(a.doctorTag, a.id, "Appointment rescheduled", "The patient moved their appointment to "+doctorTime+", please confirm it.")
+		invitePatient(a.patientTag, a.id, "Appointment rescheduled", "Your appointment has moved to "+patientTime+" and is waiting for the doctor to confirm it.")
+	case "cancelled":
+		if actorType == ActorPatient {
+			notifyDoctor(a.doctorTag, "Appointment cancelled", "Your appointment on "+doctorTime+" was cancelled by the patient."+reason)
+			inviteDoctor(a.doctorTag, a.id, "Appointment cancelled", "Your appointment on "+doctorTime+" was cancelled by the patient."+reason)
+			invitePatient(a.patientTag, a.id, "Appointment cancelled", "You cancelled your appointment on "+patientTime+"."+refundNote)
+		} else {
+			notifyPatientWithInvite(a.patientTag, a.id, "Appointment cancelled", "Your appointment on "+patientTime+" was cancelled."+reason+refundNote)
+			inviteDoctor(a.doctorTag, a.id, "Appointment cancelled", "The appointment on "+doctorTime+" was cancelled."+reason)
+		}
+	}
+}
+
+// StartAppointmentExpiryJob expires bookings the doctor or patient never answered
+func StartAppointmentExpiryJob() {
+	ticker := time.NewTicker(time.Duration(config.AppointmentExpiryIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		expired, err := ExpireUnconfirmedAppointments()
+		if err != nil {
+			log.Println("Appointment expiry job failed:", err)
+		} else if expired > 0 {
+			log.Println("Appointment expiry job expired", expired, "appointments")
+		}
+		<-ticker.C
+	}
+}
+
+// ExpireUnconfirmedAppointments expires pending or proposed appointments that have waited too long for an answer
+// or whose time has already come, refunding the patient in full
+func ExpireUnconfirmedAppointments() (int, error) {
+	rows, err := Db.Query(Ctx,
+		`SELECT appointment_id FROM appointments
+		 WHERE status IN ('pending', 'proposed')
+		 AND (status_changed_at < NOW() - make_interval(hours => $1) OR scheduled_at <= NOW())
+		 ORDER BY scheduled_at ASC LIMIT 100`, config.AppointmentConfirmHours)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		if err := expireAppointment(id); err != nil {
+			log.Println("Failed to expire appointment", id, ":", err)
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func expireAppointment(appointmentID int) error {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(Ctx)
+	a, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		return err
+	}
+	from := a.status
+	refund, err := transitionAppointment(tx, &a, "expired", ActorSystem, "", "no response before the deadline")
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		return err
+	}
+	announceTransition(a, from, ActorSystem, "", refund)
+	return nil
+}
@@ -0,0 +1,72 @@
+package servers
+
+import (
+	"slices"
+	"telemed/config"
+	"testing"
+	"time"
+)
+
+func TestAppointmentTransitions(t *testing.T) {
+	tests := []struct {
+		from, to, actor string
+		allowed         bool
+	}{
+		{"pending", "confirmed", ActorDoctor, true},
+		{"pending", "confirmed", ActorPatient, false},
+		{"pending", "proposed", ActorDoctor, true},
+		{"pending", "proposed", ActorAdmin, false},
+		{"pending", "pending", ActorPatient, true},
+		{"pending", "expired", ActorSystem, true},
+		{"pending", "expired", ActorAdmin, false},
+		{"proposed", "confirmed", ActorPatient, true},
+		{"proposed", "confirmed", ActorDoctor, false},
+		{"proposed", "cancelled", ActorDoctor, false},
+		{"confirmed", "completed", ActorDoctor, true},
+		{"confirmed", "completed", ActorPatient, false},
+		{"confirmed", "cancelled", ActorDoctor, true},
+		{"confirmed", "declined", ActorDoctor, false},
+		{"confirmed", "expired", ActorSystem, false},
+		// finished appointments go nowhere
+		{"completed", "cancelled", ActorAdmin, false},
+		{"cancelled", "pending", ActorPatient, false},
+		{"no_show", "completed", ActorDoctor, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to+" by "+tt.actor, func(t *testing.T) {
+			if got := slices.Contains(appointmentTransitions[tt.from][tt.to], tt.actor); got != tt.allowed {
+				t.Errorf("allowed = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRefundPercent(t *testing.T) {
+	soon := time.Now().Add(time.Duration(config.CancelPartialRefundHours-1) * time.Hour)
+	later := time.Now().Add(time.Duration(config.CancelFullRefundHours+1) * time.Hour)
+	tests := []struct {
+		name  string
+		a     appointmentRecord
+		to    string
+		actor string
+		want  int
+	}{
+		{"declined by the doctor", appointmentRecord{status: "pending", scheduledAt: soon}, "declined", ActorDoctor, 100},
+		{"expired unanswered", appointmentRecord{status: "pending", scheduledAt: soon}, "expired", ActorSystem, 100},
+		{"doctor cancels late", appointmentRecord{status: "confirmed", scheduledAt: soon}, "cancelled", ActorDoctor, 100},
+		{"admin cancels late", appointmentRecord{status: "confirmed", scheduledAt: soon}, "cancelled", ActorAdmin, 100},
+		{"patient turns down a proposal", appointmentRecord{status: "proposed", scheduledAt: soon}, "cancelled", ActorPatient, 100},
+		{"patient cancels unconfirmed", appointmentRecord{status: "pending", scheduledAt: soon}, "cancelled", ActorPatient, 100},
+		{"patient cancels confirmed early", appointmentRecord{status: "confirmed", scheduledAt: later}, "cancelled", ActorPatient, 100},
+		{"patient cancels confirmed late", appointmentRecord{status: "confirmed", scheduledAt: soon}, "cancelled", ActorPatient, 0},
+		{"completed keeps the fee", appointmentRecord{status: "confirmed", scheduledAt: soon}, "completed", ActorDoctor, 0},
+		{"no show keeps the fee", appointmentRecord{status: "confirmed", scheduledAt: soon}, "no_show", ActorDoctor, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refundPercent(tt.a, tt.to, tt.actor); got != tt.want {
+				t.Errorf("refundPercent = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package servers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/storage"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+type AttachmentServer struct{}
+
+// Storage is where attachment files go, set up in main
+var Storage storage.Backend
+
+var attachmentCategories = []string{"lab_result", "image", "document", "other"}
+
+const attachmentColumns = `attachment_id, appointment_id, uploaded_by_type, uploaded_by, category, storage_key, file_name, content_type, size_bytes, created_at`
+
+func scanAttachment(row pgx.Row) (models.Attachment, string, error) {
+	var a models.Attachment
+	var key string
+	err := row.Scan(&a.AttachmentID, &a.AppointmentID, &a.UploadedByType, &a.UploadedBy, &a.Category, &key, &a.FileName,
+		&a.ContentType, &a.SizeBytes, &a.Created_at)
+	return a, key, err
+}
+
+// signDownload ties a download link to one attachment and its expiry time
+func signDownload(attachmentID int, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(config.JwtSecret))
+	fmt.Fprintf(mac, "attachment:%d:%d", attachmentID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// withDownloadURL fills in a link that expires after the configured TTL, straight from the bucket when the
+// backend can presign and through the app otherwise
+func withDownloadURL(a *models.Attachment, key string) error {
+	ttl := time.Duration(config.AttachmentURLMinutes) * time.Minute
+	a.URLExpiresAt = time.Now().Add(ttl)
+	url, err := Storage.PresignGet(Ctx, key, a.FileName, ttl)
+	if err != nil {
+		return err
+	}
+	if url == "" {
+		expires := a.URLExpiresAt.Unix()
+		url = fmt.Sprintf("/files/%d?expires=%d&sig=%s", a.AttachmentID, expires, signDownload(a.AttachmentID, expires))
+	}
+	a.DownloadURL = url
+	return nil
+}
+
+// UploadAttachment stores a file shared on an appointment. The type is sniffed from the content rather than
+// trusted from the client
+func (AttachmentServer) UploadAttachment(appointmentID int, role, tag, category string, file *multipart.FileHeader) (any, error) {
+	if category == "" {
+		category = "other"
+	}
+	if !slices.Contains(attachmentCategories, category) {
+		return nil, errors.New("category must be one of " + strings.Join(attachmentCategories, ", "))
+	}
+	if file.Size <= 0 {
+		return nil, errors.New("file is empty")
+	}
+	if file.Size > int64(config.AttachmentMaxBytes) {
+		return nil, fmt.Errorf("files are limited to %d MB", config.AttachmentMaxBytes/(1024*1024))
+	}
+	open, err := appointmentAccess(appointmentID, role, tag)
+	if err != nil {
+		return nil, err
+	}
+	if !open {
+		return nil, errors.New("files can no longer be added to this appointment")
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		log.Println("Failed to open uploaded file:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		log.Println("Failed to read uploaded file:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	head = head[:n]
+	contentType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	if !slices.Contains(strings.Split(config.AttachmentAllowedTypes, ","), contentType) {
+		return nil, fmt.Errorf("%s files are not accepted", contentType)
+	}
+
+	key := fmt.Sprintf("appointments/%d/%s%s", appointmentID, uuid.NewString(), strings.ToLower(filepath.Ext(file.Filename)))
+	if err := Storage.Put(Ctx, key, io.MultiReader(bytes.NewReader(head), f), file.Size, contentType); err != nil {
+		log.Println("Failed to store attachment:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	name := filepath.Base(file.Filename)
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	a, _, err := scanAttachment(Db.QueryRow(Ctx,
+		`INSERT INTO appointment_attachments (appointment_id, uploaded_by_type, uploaded_by, category, storage_key, file_name, content_type, size_bytes)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING `+attachmentColumns,
+		appointmentID, role, tag, category, key, name, contentType, file.Size))
+	if err != nil {
+		log.Println("Failed to save attachment:", err)
+		if err := Storage.Delete(Ctx, key); err != nil {
+			log.Println("Failed to remove orphaned attachment:", err)
+		}
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := withDownloadURL(&a, key); err != nil {
+		log.Println("Failed to sign attachment url:", err)
+	}
+	return a, nil
+}
+
+func (AttachmentServer) GetAttachments(appointmentID int, role, tag string) (any, error) {
+	if _, err := appointmentAccess(appointmentID, role, tag); err != nil {
+		return nil, err
+	}
+	if role == ActorDoctor {
+		if err := doctorAppointmentConsent(tag, appointmentID); err != nil {
+			return nil, err
+		}
+	}
+	var attachments []models.Attachment
+	rows, err := Db.Query(Ctx, `SELECT `+attachmentColumns+` FROM appointment_attachments WHERE appointment_id = $1 ORDER BY created_at ASC`, appointmentID)
+	if err != nil {
+		log.Println("Failed to fetch attachments:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, key, err := scanAttachment(rows)
+		if err != nil {
+			log.Println("Failed to scan attachment:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		if err := withDownloadURL(&a, key); err != nil {
+			log.Println("Failed to sign attachment url:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		attachments = append(attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over attachments:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return attachments, nil
+}
+
+func fetchAttachment(appointmentID, attachmentID int) (models.Attachment, string, error) {
+	a, key, err := scanAttachment(Db.QueryRow(Ctx,
+		`SELECT `+attachmentColumns+` FROM appointment_attachments WHERE attachment_id = $1 AND appointment_id = $2`, attachmentID, appointmentID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return a, "", errors.New("attachment not found")
+		}
+		log.Println("Failed to fetch attachment:", err)
+		return a, "", errors.New(responses.SOMETHING_WRONG)
+	}
+	return a, key, nil
+}
+
+// GetAttachment hands out a fresh download link for one file
+func (AttachmentServer) GetAttachment(appointmentID, attachmentID int, role, tag string) (any, error) {
+	if _, err := appointmentAccess(appointmentID, role, tag); err != nil {
+		return nil, err
+	}
+	if role == ActorDoctor {
+		if err := doctorAppointmentConsent(tag, appointmentID); err != nil {
+			return nil, err
+		}
+	}
+	a, key, err := fetchAttachment(appointmentID, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := withDownloadURL(&a, key); err != nil {
+		log.Println("Failed to sign attachment url:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return a, nil
+}
+
+// DeleteAttachment removes a file, only the person who uploaded it can and only while the appointment is open
+func (AttachmentServer) DeleteAttachment(appointmentID, attachmentID int, role, tag string) (any, error) {
+	open, err := appointmentAccess(appointmentID, role, tag)
+	if err != nil {
+		return nil, err
+	}
+	a, key, err := fetchAttachment(appointmentID, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if a.UploadedByType != role || a.UploadedBy != tag {
+		return nil, errors.New("only the uploader can remove this file")
+	}
+	if !open {
+		return nil, errors.New("files can no longer be removed from this appointment")
+	}
+	if _, err := Db.Exec(Ctx, `DELETE FROM appointment_attachments WHERE attachment_id = $1`, attachmentID); err != nil {
+		log.Println("Failed to delete attachment:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := Storage.Delete(Ctx, key); err != nil {
+		log.Println("Failed to remove attachment file:", err)
+	}
+	return map[string]int{"attachment_id": attachmentID}, nil
+}
+
+// OpenDownload checks a link made by withDownloadURL and opens the file behind it
+func (AttachmentServer) OpenDownload(attachmentID int, expires int64, sig string) (models.Attachment, io.ReadCloser, error) {
+	var a models.Attachment
+	if time.Now().Unix() > expires {
+		return a, nil, errors.New("this link has expired")
+	}
+	if !hmac.Equal([]byte(sig), []byte(signDownload(attachmentID, expires))) {
+		return a, nil, errors.New("invalid download link")
+	}
+	a, key, err := scanAttachment(Db.QueryRow(Ctx, `SELECT `+attachmentColumns+` FROM appointment_attachments WHERE attachment_id = $1`, attachmentID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return a, nil, errors.New("attachment not found")
+		}
+		log.Println("Failed to fetch attachment:", err)
+		return a, nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	file, err := Storage.Open(Ctx, key)
+	if err != nil {
+		log.Println("Failed to open attachment file:", err)
+		return a, nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return a, file, nil
+}
@@ -0,0 +1,63 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"telemed/models"
+	"telemed/responses"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// recordAudit writes an admin action to the audit trail inside the same transaction as the action itself
+func recordAudit(tx pgx.Tx, admintag, action, targetType, targetID string, details map[string]any) error {
+	payload, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO admin_audit_logs (admintag, action, target_type, target_id, details) VALUES ($1, $2, $3, $4, $5)`,
+		admintag, action, targetType, targetID, payload)
+	if err != nil {
+		log.Println("Failed to record audit log:", err)
+	}
+	return err
+}
+
+func (AdminServer) GetAuditLogs(data models.GetDataReq) (any, error) {
+	var logs []models.AuditLog
+	var args []any
+	argIndex := 1
+	offset := data.Limit*data.Page - data.Limit
+
+	sqlStatement := "SELECT log_id, admintag, action, COALESCE(target_type, ''), COALESCE(target_id, ''), COALESCE(details, '{}'), created_at FROM admin_audit_logs"
+	if data.Search != "" {
+		sqlStatement += fmt.Sprintf(" WHERE (admintag ILIKE $%d OR action ILIKE $%d OR target_id ILIKE $%d)", argIndex, argIndex, argIndex)
+		args = append(args, "%"+data.Search+"%")
+		argIndex++
+	}
+	sqlStatement += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, data.Limit, offset)
+
+	rows, err := Db.Query(Ctx, sqlStatement, args...)
+	if err != nil {
+		log.Println("Failed to fetch audit logs:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := rows.Scan(&entry.LogID, &entry.AdminTag, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.Details, &entry.Created_at); err != nil {
+			log.Println("Failed to scan audit log:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		logs = append(logs, entry)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over audit logs:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return logs, nil
+}
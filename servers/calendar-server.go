@@ -0,0 +1,221 @@
+package servers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type CalendarServer struct{}
+
+// calendarStatus maps appointment statuses onto the three an iCalendar event can have
+func calendarStatus(status string) string {
+	switch status {
+	case "pending", "proposed":
+		return "TENTATIVE"
+	case "cancelled", "declined", "expired":
+		return "CANCELLED"
+	}
+	return "CONFIRMED"
+}
+
+// appointmentEvents loads appointments as calendar events seen from one side, the patient gets the doctor's
+// name and the doctor the patient's. The booking reason stays out since calendars are often shared or synced
+// to third parties
+func appointmentEvents(viewer, where string, args ...any) ([]models.CalendarEvent, error) {
+	rows, err := Db.Query(Ctx,
+		`SELECT a.appointment_id, a.ical_sequence, a.scheduled_at, COALESCE(d.slot_duration_minutes, 30), a.status,
+		 COALESCE(d.fullname, ''), CONCAT(u.firstname, ' ', u.lastname), COALESCE(dp.firstname || ' ' || dp.lastname, '')
+		 FROM appointments a JOIN doctors d ON d.doctortag = a.doctor_tag JOIN users u ON u.usertag = a.patient_tag
+		 LEFT JOIN dependents dp ON dp.dependent_id = a.dependent_id
+		 WHERE `+where+` ORDER BY a.scheduled_at`, args...)
+	if err != nil {
+		log.Println("Failed to fetch calendar appointments:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+
+	var events []models.CalendarEvent
+	for rows.Next() {
+		var (
+			id, sequence, minutes                          int
+			start                                          time.Time
+			status, doctorName, patientName, dependentName string
+		)
+		if err := rows.Scan(&id, &sequence, &start, &minutes, &status, &doctorName, &patientName, &dependentName); err != nil {
+			log.Println("Failed to scan calendar appointment:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		event := models.CalendarEvent{
+			UID:      fmt.Sprintf("appointment-%d@%s", id, config.CalendarUIDDomain),
+			Sequence: sequence,
+			Start:    start,
+			End:      start.Add(time.Duration(minutes) * time.Minute),
+			Status:   calendarStatus(status),
+		}
+		if viewer == ActorDoctor {
+			if dependentName != "" {
+				patientName = dependentName
+			}
+			event.Summary = "Consultation with " + patientName
+			event.Description = fmt.Sprintf("Appointment #%d, open it in the Telemed doctor app to start the call.", id)
+		} else {
+			event.Summary = "Consultation with Dr " + doctorName
+			if dependentName != "" {
+				event.Summary += " for " + dependentName
+			}
+			event.Description = fmt.Sprintf("Appointment #%d, join the call from the Telemed app.", id)
+		}
+		if status == "pending" || status == "proposed" {
+			event.Summary += " (awaiting confirmation)"
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over calendar appointments:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return events, nil
+}
+
+// emailInvite emails one side the appointment as an iCalendar invite addressed to them, so their calendar app
+// adds, moves or removes it. The email goes out in the background and failures are logged like any other
+// notification
+func emailInvite(viewer string, to models.CalendarAttendee, appointmentID int, subject, body string) {
+	events, err := appointmentEvents(viewer, "a.appointment_id = $1", appointmentID)
+	if err != nil || len(events) == 0 {
+		return
+	}
+	method := "REQUEST"
+	if events[0].Status == "CANCELLED" {
+		method = "CANCEL"
+	}
+	events[0].Attendees = []models.CalendarAttendee{to}
+	invite := utils.BuildCalendar(method, "", events)
+	go func() {
+		err := utils.SendEmailWithAttachment(to.Email, subject, body, "appointment.ics", "text/calendar; charset=UTF-8; method="+method, invite)
+		if err != nil {
+			log.Println("Failed to send calendar invite:", err)
+		}
+	}()
+}
+
+// notifyPatientWithInvite is notifyPatient with the appointment's calendar invite attached to the email
+func notifyPatientWithInvite(usertag string, appointmentID int, title, body string) {
+	notify(RecipientUser, usertag, title, body)
+	invitePatient(usertag, appointmentID, title, body)
+}
+
+// invitePatient only emails the invite, for changes the patient made themselves and needs no notification for
+func invitePatient(usertag string, appointmentID int, subject, body string) {
+	var to models.CalendarAttendee
+	err := Db.QueryRow(Ctx, `SELECT COALESCE(email, ''), TRIM(COALESCE(firstname, '') || ' ' || COALESCE(lastname, '')) FROM users WHERE usertag = $1`, usertag).
+		Scan(&to.Email, &to.Name)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Println("Failed to fetch user email:", err)
+		}
+		return
+	}
+	if to.Email != "" {
+		emailInvite(ActorPatient, to, appointmentID, subject, body)
+	}
+}
+
+// inviteDoctor emails the doctor the calendar invite on top of their usual notification, when they have an email
+func inviteDoctor(doctortag string, appointmentID int, subject, body string) {
+	var to models.CalendarAttendee
+	err := Db.QueryRow(Ctx, `SELECT COALESCE(email, ''), COALESCE(fullname, '') FROM doctors WHERE doctortag = $1`, doctortag).
+		Scan(&to.Email, &to.Name)
+	if err != nil {
+		log.Println("Failed to fetch doctor email:", err)
+		return
+	}
+	if to.Email != "" {
+		emailInvite(ActorDoctor, to, appointmentID, subject, body)
+	}
+}
+
+func calendarFeedURL(token string) string {
+	return strings.TrimSuffix(config.PublicBaseURL, "/") + "/calendar/ical/" + token + ".ics"
+}
+
+func newFeedToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetFeed returns the owner's private feed URL, creating it the first time
+func (s CalendarServer) GetFeed(ownerType, ownerTag string) (any, error) {
+	var feed models.CalendarFeedResp
+	var token string
+	err := Db.QueryRow(Ctx, `SELECT token, created_at FROM calendar_feeds WHERE owner_type = $1 AND owner_tag = $2`, ownerType, ownerTag).
+		Scan(&token, &feed.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.RotateFeed(ownerType, ownerTag)
+	}
+	if err != nil {
+		log.Println("Failed to fetch calendar feed:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	feed.URL = calendarFeedURL(token)
+	return feed, nil
+}
+
+// RotateFeed issues a new feed token, calendars still subscribed with the old URL stop receiving updates
+func (CalendarServer) RotateFeed(ownerType, ownerTag string) (any, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		log.Println("Failed to generate calendar feed token:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	var feed models.CalendarFeedResp
+	err = Db.QueryRow(Ctx,
+		`INSERT INTO calendar_feeds (owner_type, owner_tag, token) VALUES ($1, $2, $3)
+		 ON CONFLICT (owner_type, owner_tag) DO UPDATE SET token = EXCLUDED.token, created_at = NOW()
+		 RETURNING created_at`, ownerType, ownerTag, token).Scan(&feed.CreatedAt)
+	if err != nil {
+		log.Println("Failed to save calendar feed:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	feed.URL = calendarFeedURL(token)
+	return feed, nil
+}
+
+// RenderFeed builds the subscription calendar behind a feed token: open appointments plus recent completed
+// ones. Cancelled appointments are left out so subscribed calendars drop them on their next refresh
+func (CalendarServer) RenderFeed(token string) ([]byte, error) {
+	var ownerType, ownerTag string
+	err := Db.QueryRow(Ctx, `SELECT owner_type, owner_tag FROM calendar_feeds WHERE token = $1`, token).Scan(&ownerType, &ownerTag)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("calendar feed not found")
+		}
+		log.Println("Failed to fetch calendar feed:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	column := "a.patient_tag"
+	if ownerType == ActorDoctor {
+		column = "a.doctor_tag"
+	}
+	events, err := appointmentEvents(ownerType,
+		column+` = $1 AND a.status IN ('pending', 'proposed', 'confirmed', 'completed')
+		 AND a.scheduled_at >= NOW() - make_interval(days => $2)`, ownerTag, config.CalendarFeedPastDays)
+	if err != nil {
+		return nil, err
+	}
+	return utils.BuildCalendar("", "Telemed appointments", events), nil
+}
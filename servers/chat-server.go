@@ -0,0 +1,297 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/utils"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/jackc/pgx/v4"
+)
+
+type ChatServer struct{}
+
+// chatRooms holds every open chat socket per appointment with the role behind it; like the call rooms they are
+// per instance
+var (
+	chatMu    sync.Mutex
+	chatRooms = map[int]map[*signalPeer]string{}
+)
+
+// appointmentAccess checks tag is the appointment's patient or doctor and reports whether the appointment still
+// takes new messages and files: it closes when the appointment falls through or the follow-up window has passed
+func appointmentAccess(appointmentID int, role, tag string) (bool, error) {
+	var patientTag, doctorTag, status string
+	var scheduledAt time.Time
+	err := Db.QueryRow(Ctx, `SELECT patient_tag, doctor_tag, status, scheduled_at FROM appointments WHERE appointment_id = $1`, appointmentID).
+		Scan(&patientTag, &doctorTag, &status, &scheduledAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, errors.New("appointment not found")
+		}
+		log.Println("Failed to fetch appointment for chat:", err)
+		return false, errors.New(responses.SOMETHING_WRONG)
+	}
+	if (role == ActorPatient && patientTag != tag) || (role == ActorDoctor && doctorTag != tag) {
+		return false, errors.New("appointment not found")
+	}
+	switch status {
+	case "cancelled", "declined", "expired":
+		return false, nil
+	}
+	return time.Now().Before(scheduledAt.AddDate(0, 0, config.ChatFollowUpDays)), nil
+}
+
+// chatAccess is appointmentAccess for reading the conversation: the transcript is part of what the patient shared,
+// so a doctor also needs the patient's grant on the appointment, the same as for its attachments
+func chatAccess(appointmentID int, role, tag string) (bool, error) {
+	open, err := appointmentAccess(appointmentID, role, tag)
+	if err != nil {
+		return false, err
+	}
+	if role == ActorDoctor {
+		if err := doctorAppointmentConsent(tag, appointmentID); err != nil {
+			return false, err
+		}
+	}
+	return open, nil
+}
+
+func (ChatServer) GetToken(appointmentID int, role, tag string) (any, error) {
+	if _, err := chatAccess(appointmentID, role, tag); err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(time.Duration(config.RoomTokenMinutes) * time.Minute)
+	token, err := utils.GenerateRoomToken(models.RoomClaims{Kind: "chat", AppointmentID: appointmentID, Role: role, Tag: tag}, expiresAt)
+	if err != nil {
+		log.Println("Failed to generate chat token:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return models.ChatTokenResp{Token: token, ExpiresAt: expiresAt, SocketURL: "/chat/ws?token=" + token}, nil
+}
+
+func fetchMessages(appointmentID int, data models.GetDataReq) (any, error) {
+	var messages []models.ChatMessage
+	offset := data.Limit*data.Page - data.Limit
+	rows, err := Db.Query(Ctx,
+		`SELECT m.message_id, m.appointment_id, m.sender_type, m.sender_tag, COALESCE(m.body, ''), m.attachment_id,
+		 COALESCE(f.file_name, ''), COALESCE(f.content_type, ''), m.read_at, m.created_at
+		 FROM appointment_messages m LEFT JOIN appointment_attachments f ON f.attachment_id = m.attachment_id
+		 WHERE m.appointment_id = $1 ORDER BY m.message_id DESC LIMIT $2 OFFSET $3`,
+		appointmentID, data.Limit, offset)
+	if err != nil {
+		log.Println("Failed to fetch messages:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m models.ChatMessage
+		if err := rows.Scan(&m.MessageID, &m.AppointmentID, &m.SenderType, &m.SenderTag, &m.Body, &m.AttachmentID,
+			&m.AttachmentName, &m.AttachmentType, &m.ReadAt, &m.Created_at); err != nil {
+			log.Println("Failed to scan message:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over messages:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return messages, nil
+}
+
+// GetMessages returns the newest messages first, page through for older ones
+func (ChatServer) GetMessages(appointmentID int, role, tag string, data models.GetDataReq) (any, error) {
+	if _, err := chatAccess(appointmentID, role, tag); err != nil {
+		return nil, err
+	}
+	return fetchMessages(appointmentID, data)
+}
+
+func (ChatServer) SendMessage(appointmentID int, role, tag string, data models.SendMessageReq) (any, error) {
+	return sendChatMessage(appointmentID, role, tag, data)
+}
+
+func sendChatMessage(appointmentID int, role, tag string, data models.SendMessageReq) (*models.ChatMessage, error) {
+	data.Body = strings.TrimSpace(data.Body)
+	if data.Body == "" && data.AttachmentID == nil {
+		return nil, errors.New("message cannot be empty")
+	}
+	if len(data.Body) > config.ChatMaxMessageLength {
+		return nil, fmt.Errorf("messages are limited to %d characters", config.ChatMaxMessageLength)
+	}
+	open, err := appointmentAccess(appointmentID, role, tag)
+	if err != nil {
+		return nil, err
+	}
+	if !open {
+		return nil, errors.New("this conversation is closed")
+	}
+
+	m := models.ChatMessage{AppointmentID: appointmentID, SenderType: role, SenderTag: tag, Body: data.Body, AttachmentID: data.AttachmentID}
+	if data.AttachmentID != nil {
+		// only files shared on this appointment can be attached, never a link from elsewhere
+		err = Db.QueryRow(Ctx, `SELECT file_name, content_type FROM appointment_attachments WHERE attachment_id = $1 AND appointment_id = $2`,
+			*data.AttachmentID, appointmentID).Scan(&m.AttachmentName, &m.AttachmentType)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, errors.New("attachment not found on this appointment")
+			}
+			log.Println("Failed to fetch chat attachment:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	err = Db.QueryRow(Ctx,
+		`INSERT INTO appointment_messages (appointment_id, sender_type, sender_tag, body, attachment_id)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), $5) RETURNING message_id, created_at`,
+		appointmentID, role, tag, m.Body, m.AttachmentID).Scan(&m.MessageID, &m.Created_at)
+	if err != nil {
+		log.Println("Failed to save message:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	if !broadcastChat(appointmentID, models.ChatEvent{Type: "message", Message: &m}, otherRole(role)) {
+		notifyChatRecipient(appointmentID, role)
+	}
+	return &m, nil
+}
+
+// notifyChatRecipient leaves an in-app notification when the other party is not in the chat
+func notifyChatRecipient(appointmentID int, senderRole string) {
+	var patientTag, doctorTag string
+	if err := Db.QueryRow(Ctx, `SELECT patient_tag, doctor_tag FROM appointments WHERE appointment_id = $1`, appointmentID).
+		Scan(&patientTag, &doctorTag); err != nil {
+		log.Println("Failed to fetch chat recipient:", err)
+		return
+	}
+	if senderRole == ActorPatient {
+		notify(RecipientDoctor, doctorTag, "New message", fmt.Sprintf("Your patient sent a message about appointment #%d.", appointmentID))
+	} else {
+		notify(RecipientUser, patientTag, "New message", "Your doctor sent you a message.")
+	}
+}
+
+// MarkRead records that role has read everything the other party sent up to and including message upTo
+func (ChatServer) MarkRead(appointmentID int, role, tag string, upTo int) (any, error) {
+	if err := markChatRead(appointmentID, role, tag, upTo); err != nil {
+		return nil, err
+	}
+	return map[string]int{"up_to": upTo}, nil
+}
+
+func markChatRead(appointmentID int, role, tag string, upTo int) error {
+	if upTo <= 0 {
+		return errors.New("up_to must be a message id")
+	}
+	if _, err := appointmentAccess(appointmentID, role, tag); err != nil {
+		return err
+	}
+	res, err := Db.Exec(Ctx,
+		`UPDATE appointment_messages SET read_at = NOW()
+		 WHERE appointment_id = $1 AND sender_type <> $2 AND message_id <= $3 AND read_at IS NULL`, appointmentID, role, upTo)
+	if err != nil {
+		log.Println("Failed to mark messages read:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if res.RowsAffected() > 0 {
+		broadcastChat(appointmentID, models.ChatEvent{Type: "read", From: role, UpTo: upTo}, "")
+	}
+	return nil
+}
+
+// broadcastChat pushes an event to everyone connected to the appointment's chat and reports whether anyone
+// with the role watch was connected
+func broadcastChat(appointmentID int, event models.ChatEvent, watch string) bool {
+	chatMu.Lock()
+	var peers []*signalPeer
+	seen := false
+	for peer, role := range chatRooms[appointmentID] {
+		peers = append(peers, peer)
+		if role == watch {
+			seen = true
+		}
+	}
+	chatMu.Unlock()
+	for _, peer := range peers {
+		peer.send(event)
+	}
+	return seen
+}
+
+// ServeChat keeps a chat socket open, saving and fanning out messages and read receipts, until it closes.
+// Both parties may have several devices connected at once
+func ServeChat(conn *websocket.Conn, room models.RoomClaims) {
+	me := &signalPeer{conn: conn}
+	conn.SetReadLimit(64 * 1024)
+	// the token outlives a revoked grant, so access is checked again before joining the room
+	if _, err := chatAccess(room.AppointmentID, room.Role, room.Tag); err != nil {
+		me.send(models.ChatEvent{Type: "error", Error: err.Error()})
+		return
+	}
+
+	chatMu.Lock()
+	if chatRooms[room.AppointmentID] == nil {
+		chatRooms[room.AppointmentID] = map[*signalPeer]string{}
+	}
+	chatRooms[room.AppointmentID][me] = room.Role
+	chatMu.Unlock()
+
+	defer func() {
+		chatMu.Lock()
+		delete(chatRooms[room.AppointmentID], me)
+		if len(chatRooms[room.AppointmentID]) == 0 {
+			delete(chatRooms, room.AppointmentID)
+		}
+		chatMu.Unlock()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var frame models.ChatFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			me.send(models.ChatEvent{Type: "error", Error: "invalid message"})
+			continue
+		}
+		switch frame.Type {
+		case "message":
+			_, err = sendChatMessage(room.AppointmentID, room.Role, room.Tag, frame.SendMessageReq)
+		case "read":
+			err = markChatRead(room.AppointmentID, room.Role, room.Tag, frame.UpTo)
+		default:
+			err = errors.New("unknown message type")
+		}
+		if err != nil {
+			me.send(models.ChatEvent{Type: "error", Error: err.Error()})
+		}
+	}
+}
+
+// GetAppointmentMessages gives an admin read-only access to an appointment's chat. The transcript is clinical data,
+// so it goes through break-glass: the reason is logged, audited and shown to the patient
+func (AdminServer) GetAppointmentMessages(admintag string, appointmentID int, reason string, data models.GetDataReq) (any, error) {
+	var s recordSubject
+	err := Db.QueryRow(Ctx, `SELECT patient_tag, dependent_id FROM appointments WHERE appointment_id = $1`, appointmentID).
+		Scan(&s.usertag, &s.dependentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("appointment not found")
+		}
+		log.Println("Failed to fetch appointment for chat access:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := logBreakGlass(admintag, s, &appointmentID, strings.TrimSpace(reason), "appointment chat"); err != nil {
+		return nil, err
+	}
+	return fetchMessages(appointmentID, data)
+}
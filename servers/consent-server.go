@@ -0,0 +1,339 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type ConsentServer struct{}
+
+var consentPurposes = []string{"treatment", "referral", "second_opinion", "care_coordination"}
+
+// activeConsent is the condition a record_consents row c must meet to count
+const activeConsent = `c.revoked_at IS NULL AND (c.expires_at IS NULL OR c.expires_at > NOW())`
+
+// hasConsent reports whether the subject has an active grant to the grantee. A grant made by booking only covers its own
+// appointment, so appointmentID is the visit the grantee is reading from, nil outside one
+func hasConsent(q querier, s recordSubject, granteeType, grantee string, appointmentID *int) (bool, error) {
+	var ok bool
+	err := q.QueryRow(Ctx,
+		`SELECT EXISTS (SELECT 1 FROM record_consents c WHERE c.usertag = $1 AND c.dependent_id IS NOT DISTINCT FROM $2
+		 AND c.grantee_type = $3 AND c.grantee = $4 AND (c.appointment_id IS NULL OR c.appointment_id = $5) AND `+activeConsent+`)`,
+		s.usertag, s.dependentID, granteeType, grantee, appointmentID).Scan(&ok)
+	if err != nil {
+		log.Println("Failed to check consent:", err)
+		return false, errors.New(responses.SOMETHING_WRONG)
+	}
+	return ok, nil
+}
+
+// doctorAppointmentConsent checks the doctor on an appointment may still read what the patient shared on it
+func doctorAppointmentConsent(doctortag string, appointmentID int) error {
+	var s recordSubject
+	err := Db.QueryRow(Ctx, `SELECT patient_tag, dependent_id FROM appointments WHERE appointment_id = $1 AND doctor_tag = $2`,
+		appointmentID, doctortag).Scan(&s.usertag, &s.dependentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("appointment not found")
+		}
+		log.Println("Failed to fetch appointment for consent:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	ok, err := hasConsent(Db, s, ActorDoctor, doctortag, &appointmentID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("the patient has withdrawn access to their records for this appointment")
+	}
+	return nil
+}
+
+// BackfillAppointmentConsents gives appointments booked before consent records existed the grant booking now makes.
+// It runs at startup and only adds what is missing, so a grant the patient since revoked is left alone
+func BackfillAppointmentConsents() {
+	tag, err := Db.Exec(Ctx,
+		`INSERT INTO record_consents (usertag, dependent_id, grantee_type, grantee, purpose, appointment_id)
+		 SELECT patient_tag, dependent_id, 'doctor', doctor_tag, 'treatment', appointment_id FROM appointments
+		 WHERE status IN ('pending', 'proposed', 'confirmed', 'completed')
+		 ON CONFLICT (appointment_id) DO NOTHING`)
+	if err != nil {
+		log.Println("Failed to backfill appointment consents:", err)
+		return
+	}
+	if tag.RowsAffected() > 0 {
+		log.Printf("Backfilled %d appointment consents", tag.RowsAffected())
+	}
+}
+
+// grantAppointmentConsent records the treatment grant a patient gives by booking. A grant the patient revoked
+// stays revoked, a reschedule does not bring it back
+func grantAppointmentConsent(tx pgx.Tx, appointmentID int) error {
+	_, err := tx.Exec(Ctx,
+		`INSERT INTO record_consents (usertag, dependent_id, grantee_type, grantee, purpose, appointment_id)
+		 SELECT patient_tag, dependent_id, 'doctor', doctor_tag, 'treatment', appointment_id FROM appointments WHERE appointment_id = $1
+		 ON CONFLICT (appointment_id) DO NOTHING`, appointmentID)
+	if err != nil {
+		log.Println("Failed to record appointment consent:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	return nil
+}
+
+const consentColumns = `c.consent_id, c.dependent_id, COALESCE(dep.firstname || ' ' || dep.lastname, u.firstname || ' ' || u.lastname, ''), c.grantee_type, c.grantee,
+	COALESCE(d.fullname, h.name, ''), c.purpose, c.appointment_id, c.expires_at, c.revoked_at, ` + activeConsent + `, c.created_at`
+
+const consentJoins = ` FROM record_consents c
+	JOIN users u ON u.usertag = c.usertag
+	LEFT JOIN dependents dep ON dep.dependent_id = c.dependent_id
+	LEFT JOIN doctors d ON c.grantee_type = 'doctor' AND d.doctortag = c.grantee
+	LEFT JOIN hospitals h ON c.grantee_type = 'hospital' AND h.hospital_id::text = c.grantee`
+
+func scanConsent(row pgx.Row) (models.Consent, error) {
+	var c models.Consent
+	err := row.Scan(&c.ConsentID, &c.DependentID, &c.PatientName, &c.GranteeType, &c.Grantee, &c.GranteeName, &c.Purpose,
+		&c.AppointmentID, &c.ExpiresAt, &c.RevokedAt, &c.Active, &c.Created_at)
+	return c, err
+}
+
+func queryConsents(query string, args ...any) ([]models.Consent, error) {
+	consents := []models.Consent{}
+	rows, err := Db.Query(Ctx, query, args...)
+	if err != nil {
+		log.Println("Failed to fetch consents:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c, err := scanConsent(rows)
+		if err != nil {
+			log.Println("Failed to scan consent:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		consents = append(consents, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over consents:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return consents, nil
+}
+
+// GrantConsent shares the user's or a dependent's record with a doctor or hospital for a purpose, until the end of a date
+func (ConsentServer) GrantConsent(data models.ConsentReq) (any, error) {
+	if data.DependentID != nil {
+		if err := checkDependent(Db, data.Usertag, *data.DependentID); err != nil {
+			return nil, err
+		}
+	}
+	if !slices.Contains(consentPurposes, data.Purpose) {
+		return nil, fmt.Errorf("purpose must be one of %s", strings.Join(consentPurposes, ", "))
+	}
+	until, err := time.ParseInLocation("2006-01-02", data.ExpiresAt, userLocation(Db, data.Usertag))
+	if err != nil {
+		return nil, errors.New("expires_at must be in YYYY-MM-DD format")
+	}
+	expiresAt := until.AddDate(0, 0, 1)
+	if !expiresAt.After(time.Now()) || expiresAt.After(time.Now().AddDate(0, 0, config.ConsentMaxDays+1)) {
+		return nil, fmt.Errorf("expires_at must be between today and %d days from now", config.ConsentMaxDays)
+	}
+
+	var exists bool
+	switch data.GranteeType {
+	case ActorDoctor:
+		err = Db.QueryRow(Ctx, `SELECT EXISTS (SELECT 1 FROM doctors WHERE doctortag = $1)`, data.Grantee).Scan(&exists)
+	case ActorHospital:
+		hospitalID, convErr := strconv.Atoi(data.Grantee)
+		if convErr != nil {
+			return nil, errors.New("hospital not found")
+		}
+		err = Db.QueryRow(Ctx, `SELECT EXISTS (SELECT 1 FROM hospitals WHERE hospital_id = $1)`, hospitalID).Scan(&exists)
+	default:
+		return nil, errors.New("grantee_type must be doctor or hospital")
+	}
+	if err != nil {
+		log.Println("Failed to check consent grantee:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s not found", data.GranteeType)
+	}
+
+	var consentID int
+	err = Db.QueryRow(Ctx,
+		`INSERT INTO record_consents (usertag, dependent_id, grantee_type, grantee, purpose, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING consent_id`,
+		data.Usertag, data.DependentID, data.GranteeType, data.Grantee, data.Purpose, expiresAt).Scan(&consentID)
+	if err != nil {
+		log.Println("Failed to save consent:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	consents, err := queryConsents(`SELECT `+consentColumns+consentJoins+` WHERE c.consent_id = $1`, consentID)
+	if err != nil || len(consents) == 0 {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if data.GranteeType == ActorDoctor {
+		notifyDoctor(data.Grantee, "Health record shared with you",
+			"A patient shared their health record with you until "+data.ExpiresAt+". You can open it under shared records.")
+	}
+	return consents[0], nil
+}
+
+// GetConsents lists every grant on the user's and their dependents' records, revoked and expired ones included
+func (ConsentServer) GetConsents(usertag string) (any, error) {
+	return queryConsents(`SELECT `+consentColumns+consentJoins+` WHERE c.usertag = $1 ORDER BY c.created_at DESC`, usertag)
+}
+
+// RevokeConsent ends a grant straight away, a doctor or hospital loses access on their next read
+func (ConsentServer) RevokeConsent(usertag string, consentID int) (any, error) {
+	var granteeType, grantee string
+	err := Db.QueryRow(Ctx,
+		`UPDATE record_consents c SET revoked_at = NOW() WHERE c.consent_id = $1 AND c.usertag = $2 AND `+activeConsent+`
+		 RETURNING c.grantee_type, c.grantee`, consentID, usertag).Scan(&granteeType, &grantee)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("consent not found or no longer active")
+		}
+		log.Println("Failed to revoke consent:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if granteeType == ActorDoctor {
+		notifyDoctor(grantee, "Health record access withdrawn", "A patient has withdrawn your access to their health record.")
+	}
+	return map[string]string{"message": "Consent revoked"}, nil
+}
+
+// GetBreakGlassLog shows the user every time an admin opened their or their dependents' record without consent
+func (ConsentServer) GetBreakGlassLog(usertag string) (any, error) {
+	accesses := []models.BreakGlassAccess{}
+	rows, err := Db.Query(Ctx,
+		`SELECT access_id, admintag, dependent_id, appointment_id, reason, created_at FROM break_glass_access_log WHERE usertag = $1
+		 ORDER BY created_at DESC`, usertag)
+	if err != nil {
+		log.Println("Failed to fetch break-glass log:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.BreakGlassAccess
+		if err := rows.Scan(&a.AccessID, &a.Admintag, &a.DependentID, &a.AppointmentID, &a.Reason, &a.Created_at); err != nil {
+			log.Println("Failed to scan break-glass access:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		accesses = append(accesses, a)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over break-glass log:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return accesses, nil
+}
+
+// GetSharedRecords lists the active grants patients made to the doctor outside an appointment
+func (ConsentServer) GetSharedRecords(doctortag string) (any, error) {
+	return queryConsents(`SELECT `+consentColumns+consentJoins+`
+		 WHERE c.grantee_type = 'doctor' AND c.grantee = $1 AND c.appointment_id IS NULL AND `+activeConsent+` ORDER BY c.expires_at`, doctortag)
+}
+
+// GetSharedRecord opens the health record a patient shared with the doctor through a grant
+func (ConsentServer) GetSharedRecord(doctortag string, consentID int) (any, error) {
+	var s recordSubject
+	err := Db.QueryRow(Ctx,
+		`SELECT c.usertag, c.dependent_id FROM record_consents c WHERE c.consent_id = $1 AND c.grantee_type = 'doctor' AND c.grantee = $2
+		 AND c.appointment_id IS NULL AND `+activeConsent, consentID, doctortag).Scan(&s.usertag, &s.dependentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("shared record not found or access has ended")
+		}
+		log.Println("Failed to fetch shared record consent:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return getRecord(s)
+}
+
+// logBreakGlass records an admin opening clinical data without consent: the reason goes to the patient-visible log
+// and the audit trail, and the patient is told straight away. appointmentID is set when only one visit was opened
+func logBreakGlass(admintag string, s recordSubject, appointmentID *int, reason, what string) error {
+	if len(reason) < config.BreakGlassMinReason {
+		return fmt.Errorf("a justification of at least %d characters is required to open a patient's clinical data", config.BreakGlassMinReason)
+	}
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO break_glass_access_log (admintag, usertag, dependent_id, appointment_id, reason) VALUES ($1, $2, $3, $4, $5)`,
+		admintag, s.usertag, s.dependentID, appointmentID, reason)
+	if err != nil {
+		log.Println("Failed to log break-glass access:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := recordAudit(tx, admintag, "break_glass", "patient", s.usertag,
+		map[string]any{"dependent_id": s.dependentID, "appointment_id": appointmentID, "opened": what, "reason": reason}); err != nil {
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing break-glass access:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	notifyPatient(s.usertag, "Your health data was opened by our staff",
+		"An administrator opened your "+what+" for this reason: "+reason+". You can see every such access in your sharing settings.")
+	return nil
+}
+
+// BreakGlass opens a patient's clinical record for an admin without consent, see logBreakGlass
+func (s AdminServer) BreakGlass(data models.BreakGlassReq) (any, error) {
+	data.Reason = strings.TrimSpace(data.Reason)
+	if len(data.Reason) < config.BreakGlassMinReason {
+		return nil, fmt.Errorf("a justification of at least %d characters is required to open a patient's clinical data", config.BreakGlassMinReason)
+	}
+	patient, err := s.GetPatientByUsertag(models.PatientIdReq{Usertag: data.Usertag})
+	if err != nil {
+		return nil, err
+	}
+	if data.DependentID != nil {
+		if err := checkDependent(Db, data.Usertag, *data.DependentID); err != nil {
+			return nil, err
+		}
+	}
+	if err := logBreakGlass(data.Admintag, recordSubject{usertag: data.Usertag, dependentID: data.DependentID}, nil, data.Reason, "clinical record"); err != nil {
+		return nil, err
+	}
+
+	record := models.BreakGlassRecord{Patient: patient.(models.PatientIdResp), Appointments: []models.BreakGlassAppointment{}}
+	rows, err := Db.Query(Ctx,
+		`SELECT appointment_id, doctor_tag, scheduled_at, COALESCE(reason, ''), COALESCE(file_url, ''), status FROM appointments
+		 WHERE patient_tag = $1 AND dependent_id IS NOT DISTINCT FROM $2 ORDER BY scheduled_at DESC`, data.Usertag, data.DependentID)
+	if err != nil {
+		log.Println("Failed to fetch appointments for break-glass:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.BreakGlassAppointment
+		if err := rows.Scan(&a.AppointmentID, &a.DoctorTag, &a.ScheduledAt, &a.Reason, &a.FileURL, &a.Status); err != nil {
+			log.Println("Failed to scan appointment:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		record.Appointments = append(record.Appointments, a)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over appointments:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if record.HealthRecord, err = getRecord(recordSubject{usertag: data.Usertag, dependentID: data.DependentID}); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
@@ -0,0 +1,60 @@
+package servers
+
+import (
+	"log"
+	"telemed/config"
+	"time"
+)
+
+// StartConsultationExpiryJob periodically ends sessions whose join window has closed
+func StartConsultationExpiryJob() {
+	ticker := time.NewTicker(time.Duration(config.ConsultationExpiryIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		expired, err := ExpireStaleSessions()
+		if err != nil {
+			log.Println("Consultation expiry job failed:", err)
+		} else if expired > 0 {
+			log.Println("Consultation expiry job ended", expired, "sessions")
+		}
+		<-ticker.C
+	}
+}
+
+// ExpireStaleSessions ends sessions still waiting or active after the appointment's slot plus the grace period,
+// counting any running period up to the close of the window, and drops whoever is still connected
+func ExpireStaleSessions() (int, error) {
+	rows, err := Db.Query(Ctx,
+		`WITH stale AS (
+			SELECT s.session_id, a.scheduled_at + make_interval(mins => COALESCE(d.slot_duration_minutes, 30) + $1) AS closes_at
+			FROM consultation_sessions s
+			JOIN appointments a ON a.appointment_id = s.appointment_id
+			JOIN doctors d ON d.doctortag = a.doctor_tag
+			WHERE s.status <> 'ended'
+		 )
+		 UPDATE consultation_sessions s SET status = 'ended',
+		 duration_seconds = duration_seconds + COALESCE(GREATEST(EXTRACT(EPOCH FROM LEAST(NOW(), stale.closes_at) - s.active_since)::INTEGER, 0), 0),
+		 active_since = NULL, ended_at = NOW(), ended_by = $2
+		 FROM stale WHERE s.session_id = stale.session_id AND stale.closes_at < NOW()
+		 RETURNING s.session_id`, config.ConsultationJoinGraceMinutes, ActorSystem)
+	if err != nil {
+		return 0, err
+	}
+	var sessions []int
+	for rows.Next() {
+		var sessionID int
+		if err := rows.Scan(&sessionID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		sessions = append(sessions, sessionID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, sessionID := range sessions {
+		closeRoom(sessionID)
+	}
+	return len(sessions), nil
+}
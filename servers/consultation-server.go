@@ -0,0 +1,129 @@
+package servers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type ConsultationServer struct{}
+
+// iceServers is handed to both browsers so they can reach each other, TURN is only listed when configured
+func iceServers() []models.IceServer {
+	var servers []models.IceServer
+	if config.StunServers != "" {
+		servers = append(servers, models.IceServer{URLs: strings.Split(config.StunServers, ",")})
+	}
+	if config.TurnURL != "" {
+		servers = append(servers, models.IceServer{
+			URLs:       []string{config.TurnURL},
+			Username:   config.TurnUsername,
+			Credential: config.TurnCredential,
+		})
+	}
+	return servers
+}
+
+// consultationWindow is when an appointment's call can be joined and the doctor can open the patient's record:
+// from a little before the appointment until its slot plus the grace period has passed
+func consultationWindow(scheduledAt time.Time, slotMinutes int) (time.Time, time.Time) {
+	opens := scheduledAt.Add(-time.Duration(config.ConsultationJoinEarlyMinutes) * time.Minute)
+	closes := scheduledAt.Add(time.Duration(slotMinutes+config.ConsultationJoinGraceMinutes) * time.Minute)
+	return opens, closes
+}
+
+// JoinSession checks the caller is the appointment's patient or doctor and that the call is open, then opens
+// or reuses the appointment's session and issues a room token for the signaling socket
+func (ConsultationServer) JoinSession(appointmentID int, role, tag string) (any, error) {
+	var patientTag, doctorTag, status string
+	var scheduledAt time.Time
+	var slotMinutes int
+	err := Db.QueryRow(Ctx,
+		`SELECT a.patient_tag, a.doctor_tag, a.status, a.scheduled_at, COALESCE(d.slot_duration_minutes, 30)
+		 FROM appointments a JOIN doctors d ON a.doctor_tag = d.doctortag WHERE a.appointment_id = $1`, appointmentID).
+		Scan(&patientTag, &doctorTag, &status, &scheduledAt, &slotMinutes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("appointment not found")
+		}
+		log.Println("Failed to fetch appointment for consultation:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if (role == ActorPatient && patientTag != tag) || (role == ActorDoctor && doctorTag != tag) {
+		return nil, errors.New("appointment not found")
+	}
+	if status != "confirmed" {
+		return nil, errors.New("only confirmed appointments can be joined")
+	}
+
+	now := time.Now()
+	opens, closes := consultationWindow(scheduledAt, slotMinutes)
+	if now.Before(opens) {
+		return nil, errors.New("the consultation room is not open yet")
+	}
+	if now.After(closes) {
+		return nil, errors.New("the consultation window has closed")
+	}
+
+	var sessionID int
+	var sessionStatus string
+	err = Db.QueryRow(Ctx,
+		`INSERT INTO consultation_sessions (appointment_id) VALUES ($1)
+		 ON CONFLICT (appointment_id) DO UPDATE SET appointment_id = EXCLUDED.appointment_id
+		 RETURNING session_id, status`, appointmentID).Scan(&sessionID, &sessionStatus)
+	if err != nil {
+		log.Println("Failed to open consultation session:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if sessionStatus == "ended" {
+		return nil, errors.New("this consultation has already ended")
+	}
+
+	expiresAt := now.Add(time.Duration(config.RoomTokenMinutes) * time.Minute)
+	token, err := utils.GenerateRoomToken(models.RoomClaims{
+		Kind:          "call",
+		SessionID:     sessionID,
+		AppointmentID: appointmentID,
+		Role:          role,
+		Tag:           tag,
+	}, expiresAt)
+	if err != nil {
+		log.Println("Failed to generate room token:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return models.SessionJoinResp{
+		SessionID:    sessionID,
+		Role:         role,
+		Token:        token,
+		ExpiresAt:    expiresAt,
+		SignalingURL: "/consultations/ws?token=" + token,
+		IceServers:   iceServers(),
+	}, nil
+}
+
+// GetSession shows the appointment's call record to its patient (column patient_tag) or doctor (doctor_tag)
+func (ConsultationServer) GetSession(appointmentID int, column, tag string) (any, error) {
+	var session models.ConsultationSession
+	err := Db.QueryRow(Ctx,
+		`SELECT s.session_id, s.appointment_id, s.status, s.patient_joined_at, s.doctor_joined_at, s.started_at, s.ended_at,
+		 COALESCE(s.ended_by, ''), s.duration_seconds
+		 FROM consultation_sessions s JOIN appointments a ON s.appointment_id = a.appointment_id
+		 WHERE s.appointment_id = $1 AND a.`+column+` = $2`, appointmentID, tag).
+		Scan(&session.SessionID, &session.AppointmentID, &session.Status, &session.PatientJoinedAt, &session.DoctorJoinedAt,
+			&session.StartedAt, &session.EndedAt, &session.EndedBy, &session.DurationSeconds)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("no consultation has been started for this appointment")
+		}
+		log.Println("Failed to fetch consultation session:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return session, nil
+}
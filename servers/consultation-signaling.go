@@ -0,0 +1,196 @@
+package servers
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"telemed/models"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+// signaling messages a peer may send, everything but hangup is relayed untouched to the other party
+var relayedSignals = map[string]bool{"offer": true, "answer": true, "ice-candidate": true}
+
+type signalPeer struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (p *signalPeer) send(msg any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.conn.WriteJSON(msg); err != nil {
+		log.Println("Failed to write socket message:", err)
+	}
+}
+
+// signalRooms holds the connected peers of each session by role. Rooms live in memory, so every socket for a
+// session has to reach the same instance
+var (
+	signalMu    sync.Mutex
+	signalRooms = map[int]map[string]*signalPeer{}
+)
+
+func otherRole(role string) string {
+	if role == ActorDoctor {
+		return ActorPatient
+	}
+	return ActorDoctor
+}
+
+// ServeSignaling relays SDP offers/answers and ICE candidates between the patient and doctor of a session and
+// records when the call starts and ends. It returns when the socket closes
+func ServeSignaling(conn *websocket.Conn, room models.RoomClaims) {
+	me := &signalPeer{conn: conn}
+	conn.SetReadLimit(64 * 1024)
+	// a room token outlives the join check by a few minutes, the session may have ended since
+	if sessionEnded(room.SessionID) {
+		me.send(models.SignalMessage{Type: "ended"})
+		return
+	}
+
+	signalMu.Lock()
+	peers := signalRooms[room.SessionID]
+	if peers == nil {
+		peers = map[string]*signalPeer{}
+		signalRooms[room.SessionID] = peers
+	}
+	// a second tab or a reconnect takes over from the old socket
+	if old := peers[room.Role]; old != nil {
+		old.send(models.SignalMessage{Type: "replaced"})
+		old.conn.Close()
+	}
+	peers[room.Role] = me
+	other := peers[otherRole(room.Role)]
+	signalMu.Unlock()
+
+	recordSessionJoin(room)
+	if other != nil {
+		markSessionActive(room.SessionID)
+		other.send(models.SignalMessage{Type: "peer-joined", From: room.Role})
+		me.send(models.SignalMessage{Type: "peer-joined", From: otherRole(room.Role)})
+	} else {
+		me.send(models.SignalMessage{Type: "waiting"})
+	}
+
+	hungUp := false
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var msg models.SignalMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			me.send(models.SignalMessage{Type: "error", Payload: json.RawMessage(`"invalid message"`)})
+			continue
+		}
+		if msg.Type == "hangup" {
+			hungUp = true
+			break
+		}
+		if !relayedSignals[msg.Type] {
+			me.send(models.SignalMessage{Type: "error", Payload: json.RawMessage(`"unknown message type"`)})
+			continue
+		}
+		msg.From = room.Role
+		signalMu.Lock()
+		other = peers[otherRole(room.Role)]
+		signalMu.Unlock()
+		if other != nil {
+			other.send(msg)
+		}
+	}
+
+	signalMu.Lock()
+	replaced := peers[room.Role] != me
+	if !replaced {
+		delete(peers, room.Role)
+	}
+	other = peers[otherRole(room.Role)]
+	if len(peers) == 0 {
+		delete(signalRooms, room.SessionID)
+	}
+	signalMu.Unlock()
+	if replaced {
+		return
+	}
+
+	// only the doctor ends the consultation, a patient hanging up can still rejoin within the window
+	ended := hungUp && room.Role == ActorDoctor
+	closeSessionPeriod(room.SessionID, other != nil, ended, room.Role)
+	if other != nil {
+		if ended {
+			other.send(models.SignalMessage{Type: "ended", From: room.Role})
+			other.conn.Close()
+		} else {
+			other.send(models.SignalMessage{Type: "peer-left", From: room.Role})
+		}
+	}
+}
+
+func recordSessionJoin(room models.RoomClaims) {
+	column := "patient_joined_at"
+	if room.Role == ActorDoctor {
+		column = "doctor_joined_at"
+	}
+	_, err := Db.Exec(Ctx, `UPDATE consultation_sessions SET `+column+` = COALESCE(`+column+`, NOW()) WHERE session_id = $1`, room.SessionID)
+	if err != nil {
+		log.Println("Failed to record consultation join:", err)
+	}
+}
+
+// markSessionActive starts the clock once both parties are connected, a reconnect keeps the running period
+func markSessionActive(sessionID int) {
+	_, err := Db.Exec(Ctx,
+		`UPDATE consultation_sessions SET status = 'active', started_at = COALESCE(started_at, NOW()), active_since = COALESCE(active_since, NOW())
+		 WHERE session_id = $1 AND status <> 'ended'`, sessionID)
+	if err != nil {
+		log.Println("Failed to mark consultation active:", err)
+	}
+}
+
+func sessionEnded(sessionID int) bool {
+	var status string
+	err := Db.QueryRow(Ctx, `SELECT status FROM consultation_sessions WHERE session_id = $1`, sessionID).Scan(&status)
+	if err != nil {
+		log.Println("Failed to check consultation status:", err)
+		return true
+	}
+	return status == "ended"
+}
+
+// closeRoom tells whoever is still connected that the session is over and drops their sockets
+func closeRoom(sessionID int) {
+	var connected []*signalPeer
+	signalMu.Lock()
+	for _, peer := range signalRooms[sessionID] {
+		connected = append(connected, peer)
+	}
+	signalMu.Unlock()
+	for _, peer := range connected {
+		peer.send(models.SignalMessage{Type: "ended"})
+		peer.conn.Close()
+	}
+}
+
+// closeSessionPeriod adds the time both parties were connected to the duration when one of them leaves, and
+// ends the session when the doctor hangs up; ended_at is only set then
+func closeSessionPeriod(sessionID int, wasActive, ended bool, role string) {
+	status := "waiting"
+	if ended {
+		status = "ended"
+	} else if !wasActive {
+		// nobody was talking, nothing to add to the duration
+		return
+	}
+	_, err := Db.Exec(Ctx,
+		`UPDATE consultation_sessions SET status = $1,
+		 duration_seconds = duration_seconds + COALESCE(EXTRACT(EPOCH FROM NOW() - active_since)::INTEGER, 0),
+		 active_since = NULL, ended_at = CASE WHEN $1 = 'ended' THEN NOW() ELSE ended_at END,
+		 ended_by = CASE WHEN $1 = 'ended' THEN $2 ELSE ended_by END
+		 WHERE session_id = $3 AND status <> 'ended'`, status, role, sessionID)
+	if err != nil {
+		log.Println("Failed to close consultation period:", err)
+	}
+}
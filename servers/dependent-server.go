@@ -0,0 +1,330 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type DependentServer struct{}
+
+var dependentRelationships = []string{"child", "spouse", "parent", "sibling", "ward", "other"}
+
+func validateDependent(data models.DependentReq) (time.Time, error) {
+	data.Firstname, data.Lastname = strings.TrimSpace(data.Firstname), strings.TrimSpace(data.Lastname)
+	if data.Firstname == "" || data.Lastname == "" {
+		return time.Time{}, errors.New("firstname and lastname are required")
+	}
+	dob, err := time.Parse("2006-01-02", data.DateOfBirth)
+	if err != nil {
+		return time.Time{}, errors.New("date_of_birth must be in YYYY-MM-DD format")
+	}
+	if dob.After(time.Now()) {
+		return time.Time{}, errors.New("date_of_birth cannot be in the future")
+	}
+	if !slices.Contains(dependentRelationships, data.Relationship) {
+		return time.Time{}, fmt.Errorf("relationship must be one of %s", strings.Join(dependentRelationships, ", "))
+	}
+	return dob, nil
+}
+
+// checkDependent makes sure the dependent belongs to the guardian and can still be booked for
+func checkDependent(q querier, guardianTag string, dependentID int) error {
+	var status string
+	err := q.QueryRow(Ctx, `SELECT status FROM dependents WHERE dependent_id = $1 AND guardian_tag = $2`, dependentID, guardianTag).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("dependent not found")
+		}
+		log.Println("Failed to fetch dependent:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if status != "active" {
+		return errors.New("this dependent is being moved to their own account")
+	}
+	return nil
+}
+
+// checkDependentRecords lets the owner of a dependent's profile at the records only kept for dependents:
+// immunizations, growth and nutrition. That is the guardian while the profile is theirs, and after a handover the
+// account it was handed to, as those records stay on the profile rather than moving
+func checkDependentRecords(q querier, usertag string, dependentID int) error {
+	var status string
+	err := q.QueryRow(Ctx,
+		`SELECT status FROM dependents WHERE dependent_id = $1
+		 AND ((status = 'transferred' AND transfer_to = $2) OR (status <> 'transferred' AND guardian_tag = $2))`,
+		dependentID, usertag).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("dependent not found")
+		}
+		log.Println("Failed to fetch dependent:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if status == "transfer_pending" {
+		return errors.New("this dependent is being moved to their own account")
+	}
+	return nil
+}
+
+// transferredProfile is the dependent profile that was handed over to usertag, nil if they never were one
+func transferredProfile(q querier, usertag string) (*int, error) {
+	var dependentID int
+	err := q.QueryRow(Ctx,
+		`SELECT dependent_id FROM dependents WHERE transfer_to = $1 AND status = 'transferred' ORDER BY transferred_at DESC LIMIT 1`,
+		usertag).Scan(&dependentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		log.Println("Failed to fetch transferred dependent profile:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return &dependentID, nil
+}
+
+func (DependentServer) AddDependent(data models.DependentReq) (any, error) {
+	dob, err := validateDependent(data)
+	if err != nil {
+		return nil, err
+	}
+	var dependentID int
+	err = Db.QueryRow(Ctx,
+		`INSERT INTO dependents (guardian_tag, firstname, lastname, date_of_birth, gender, relationship)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING dependent_id`,
+		data.Usertag, strings.TrimSpace(data.Firstname), strings.TrimSpace(data.Lastname), dob, data.Gender, data.Relationship).Scan(&dependentID)
+	if err != nil {
+		log.Println("Failed to add dependent:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]interface{}{"dependent_id": dependentID}, nil
+}
+
+func (DependentServer) GetDependents(usertag string) (any, error) {
+	dependents := []models.Dependent{}
+	rows, err := Db.Query(Ctx,
+		`SELECT dependent_id, firstname, lastname, date_of_birth, COALESCE(gender, ''), relationship, status, created_at
+		 FROM dependents WHERE guardian_tag = $1 AND status <> 'transferred' ORDER BY date_of_birth`, usertag)
+	if err != nil {
+		log.Println("Failed to fetch dependents:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d models.Dependent
+		if err := rows.Scan(&d.DependentID, &d.Firstname, &d.Lastname, &d.DateOfBirth, &d.Gender, &d.Relationship, &d.Status, &d.Created_at); err != nil {
+			log.Println("Failed to scan dependent:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		dependents = append(dependents, d)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over dependents:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return dependents, nil
+}
+
+func (DependentServer) UpdateDependent(data models.DependentReq) (any, error) {
+	dob, err := validateDependent(data)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := Db.Exec(Ctx,
+		`UPDATE dependents SET firstname = $1, lastname = $2, date_of_birth = $3, gender = $4, relationship = $5
+		 WHERE dependent_id = $6 AND guardian_tag = $7 AND status = 'active'`,
+		strings.TrimSpace(data.Firstname), strings.TrimSpace(data.Lastname), dob, data.Gender, data.Relationship, data.DependentID, data.Usertag)
+	if err != nil {
+		log.Println("Failed to update dependent:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("dependent not found")
+	}
+	return map[string]string{"message": "Dependent updated"}, nil
+}
+
+// dependentHasOpenCare blocks a handover while the guardian still has money or a place in line tied to the
+// dependent, refunds of open bookings must go back to the wallet that paid
+func dependentHasOpenCare(q querier, dependentID int) error {
+	var open bool
+	err := q.QueryRow(Ctx,
+		`SELECT EXISTS (SELECT 1 FROM appointments WHERE dependent_id = $1 AND status IN ('pending', 'proposed', 'confirmed'))
+		 OR EXISTS (SELECT 1 FROM waitlist_entries WHERE dependent_id = $1 AND status IN ('waiting', 'offered'))`, dependentID).Scan(&open)
+	if err != nil {
+		log.Println("Failed to check dependent bookings:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if open {
+		return errors.New("finish or cancel the dependent's open appointments and waitlist entries first")
+	}
+	return nil
+}
+
+func ageOn(dob, at time.Time) int {
+	age := at.Year() - dob.Year()
+	if at.Month() < dob.Month() || (at.Month() == dob.Month() && at.Day() < dob.Day()) {
+		age--
+	}
+	return age
+}
+
+// StartTransfer offers an adult dependent's records to their own account, which has to accept the handover
+func (DependentServer) StartTransfer(data models.DependentTransferReq) (any, error) {
+	var dob time.Time
+	var status string
+	err := Db.QueryRow(Ctx, `SELECT date_of_birth, status FROM dependents WHERE dependent_id = $1 AND guardian_tag = $2`,
+		data.DependentID, data.Usertag).Scan(&dob, &status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("dependent not found")
+		}
+		log.Println("Failed to fetch dependent:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if status == "transferred" {
+		return nil, errors.New("this dependent already has their own account")
+	}
+	if ageOn(dob, time.Now()) < config.DependentAdultAge {
+		return nil, fmt.Errorf("dependents can move to their own account from age %d", config.DependentAdultAge)
+	}
+	if err := dependentHasOpenCare(Db, data.DependentID); err != nil {
+		return nil, err
+	}
+
+	var recipient string
+	err = Db.QueryRow(Ctx, `SELECT usertag FROM users WHERE LOWER(email) = LOWER($1)`, strings.TrimSpace(data.Email)).Scan(&recipient)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("no account uses this email, the dependent has to sign up first")
+		}
+		log.Println("Failed to find transfer account:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if recipient == data.Usertag {
+		return nil, errors.New("a dependent cannot be moved to the guardian's own account")
+	}
+	_, err = Db.Exec(Ctx, `UPDATE dependents SET status = 'transfer_pending', transfer_to = $1 WHERE dependent_id = $2`, recipient, data.DependentID)
+	if err != nil {
+		log.Println("Failed to start dependent transfer:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	notifyPatient(recipient, "Your health records are ready to move",
+		"Your guardian wants to hand your appointments and records over to this account. Accept the transfer in the app to take them over.")
+	return map[string]string{"message": "Transfer started, it completes once the dependent accepts it from their account"}, nil
+}
+
+// CancelTransfer takes back a handover the dependent has not accepted yet
+func (DependentServer) CancelTransfer(usertag string, dependentID int) (any, error) {
+	tag, err := Db.Exec(Ctx,
+		`UPDATE dependents SET status = 'active', transfer_to = NULL
+		 WHERE dependent_id = $1 AND guardian_tag = $2 AND status = 'transfer_pending'`, dependentID, usertag)
+	if err != nil {
+		log.Println("Failed to cancel dependent transfer:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("there is no pending transfer for this dependent")
+	}
+	return map[string]string{"message": "Transfer cancelled"}, nil
+}
+
+// GetIncomingTransfers lists handovers waiting for this account to accept them
+func (DependentServer) GetIncomingTransfers(usertag string) (any, error) {
+	transfers := []models.DependentTransfer{}
+	rows, err := Db.Query(Ctx,
+		`SELECT d.dependent_id, d.firstname, d.lastname, d.date_of_birth, CONCAT(u.firstname, ' ', u.lastname)
+		 FROM dependents d JOIN users u ON u.usertag = d.guardian_tag
+		 WHERE d.transfer_to = $1 AND d.status = 'transfer_pending'`, usertag)
+	if err != nil {
+		log.Println("Failed to fetch dependent transfers:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t models.DependentTransfer
+		if err := rows.Scan(&t.DependentID, &t.Firstname, &t.Lastname, &t.DateOfBirth, &t.GuardianName); err != nil {
+			log.Println("Failed to scan dependent transfer:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		transfers = append(transfers, t)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over dependent transfers:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return transfers, nil
+}
+
+// AcceptTransfer moves the dependent's appointments, prescriptions, health record and waitlist history to their
+// own account. The guardian loses access to them, payments already made stay in the guardian's wallet history
+func (DependentServer) AcceptTransfer(usertag string, dependentID int) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	var guardianTag string
+	var dob time.Time
+	var userDob *time.Time
+	err = tx.QueryRow(Ctx,
+		`SELECT d.guardian_tag, d.date_of_birth, u.date_of_birth FROM dependents d JOIN users u ON u.usertag = d.transfer_to
+		 WHERE d.dependent_id = $1 AND d.transfer_to = $2 AND d.status = 'transfer_pending' FOR UPDATE OF d`, dependentID, usertag).
+		Scan(&guardianTag, &dob, &userDob)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("there is no pending transfer for this account")
+		}
+		log.Println("Failed to fetch dependent transfer:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if userDob != nil && !userDob.Equal(dob) {
+		return nil, errors.New("the date of birth on this account does not match the dependent's")
+	}
+	if err := dependentHasOpenCare(tx, dependentID); err != nil {
+		return nil, err
+	}
+
+	moves := []string{
+		`UPDATE appointments SET patient_tag = $1, dependent_id = NULL WHERE dependent_id = $2`,
+		`UPDATE prescriptions SET usertag = $1, dependent_id = NULL WHERE dependent_id = $2`,
+		`UPDATE waitlist_entries SET usertag = $1, dependent_id = NULL WHERE dependent_id = $2`,
+		`UPDATE health_record_entries SET usertag = $1, dependent_id = NULL WHERE dependent_id = $2`,
+		// what the guardian shared ends with the handover, the new account holder decides from here
+		`UPDATE record_consents SET usertag = $1, dependent_id = NULL, revoked_at = COALESCE(revoked_at, NOW()) WHERE dependent_id = $2`,
+		// immunization doses, growth measurements and nutrition recommendations are only kept for dependents, they
+		// stay on the profile and this re-links it to the new account holder (see checkDependentRecords)
+		`UPDATE dependents SET status = 'transferred', transferred_at = NOW() WHERE dependent_id = $2 AND transfer_to = $1`,
+	}
+	for _, query := range moves {
+		if _, err := tx.Exec(Ctx, query, usertag, dependentID); err != nil {
+			log.Println("Failed to transfer dependent records:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	// vaccine reminders were for the guardian
+	_, err = tx.Exec(Ctx, `UPDATE appointment_reminders SET status = 'cancelled' WHERE dependent_id = $1 AND status = 'pending'`, dependentID)
+	if err != nil {
+		log.Println("Failed to cancel vaccine reminders of transferred dependent:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing dependent transfer:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	notifyPatient(guardianTag, "Dependent moved to their own account",
+		"The records you kept for your dependent now live in their own account and no longer show in yours.")
+	return map[string]interface{}{
+		"message":      "Transfer complete, the records are now in your account",
+		"dependent_id": dependentID, // immunization, growth and nutrition history stays under this id
+	}, nil
+}
@@ -0,0 +1,264 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type DoctorServer struct{}
+
+func (DoctorServer) Login(data models.DoctorLoginReq) (any, error) {
+	var hash, doctortag string
+	err := Db.QueryRow(Ctx, "SELECT password, doctortag FROM doctors WHERE email = $1", data.Email).Scan(&hash, &doctortag)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New(responses.ACCOUNT_NON_EXISTENT)
+	}
+
+	if !utils.VerifyPassword(data.Password, hash) {
+		log.Println("Invalid password for doctor login")
+		return nil, errors.New(responses.INVALID_PASSWORD)
+	}
+	token, err := utils.GenerateDoctorJWT(doctortag)
+	if err != nil {
+		log.Println("Failed to generate JWT token:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]string{"doctortag": doctortag, "token": token}, nil
+}
+
+func (DoctorServer) GetAppointments(doctortag string, data models.GetDataReq) (any, error) {
+	var appointments []models.DoctorAppointment
+	offset := data.Limit*data.Page - data.Limit
+	args := []any{doctortag}
+	argIndex := 2
+
+	sqlStatement := `SELECT a.appointment_id, a.patient_tag, COALESCE(dp.firstname || ' ' || dp.lastname, CONCAT(u.firstname, ' ', u.lastname)),
+		a.dependent_id, CASE WHEN a.dependent_id IS NULL THEN '' ELSE CONCAT(u.firstname, ' ', u.lastname) END,
+		a.scheduled_at, a.proposed_at, a.follow_up_of, COALESCE(a.reason, ''), a.status, a.created_at
+		FROM appointments a JOIN users u ON a.patient_tag = u.usertag LEFT JOIN dependents dp ON dp.dependent_id = a.dependent_id
+		WHERE a.doctor_tag = $1`
+	if data.Status != "" {
+		sqlStatement += fmt.Sprintf(" AND a.status = $%d", argIndex)
+		args = append(args, data.Status)
+		argIndex++
+	}
+	sqlStatement += fmt.Sprintf(" ORDER BY a.scheduled_at ASC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, data.Limit, offset)
+
+	rows, err := Db.Query(Ctx, sqlStatement, args...)
+	if err != nil {
+		log.Println("Failed to fetch doctor appointments:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+
+	loc := doctorLocation(Db, doctortag)
+	for rows.Next() {
+		var appointment models.DoctorAppointment
+		if err := rows.Scan(&appointment.AppointmentID, &appointment.PatientTag, &appointment.PatientName, &appointment.DependentID,
+			&appointment.GuardianName, &appointment.Scheduled_at, &appointment.ProposedAt, &appointment.FollowUpOf, &appointment.Reason, &appointment.Status, &appointment.Created_at); err != nil {
+			log.Println("Failed to scan doctor appointment:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		appointment.Scheduled_at = appointment.Scheduled_at.In(loc)
+		if appointment.ProposedAt != nil {
+			proposed := appointment.ProposedAt.In(loc)
+			appointment.ProposedAt = &proposed
+		}
+		appointments = append(appointments, appointment)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over doctor appointments:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return appointments, nil
+}
+
+// doctorTransition locks one of the doctor's appointments, lets prepare adjust it inside the transaction and
+// then moves it to the new status
+func doctorTransition(data models.DoctorActionReq, to string, prepare func(tx pgx.Tx, a *appointmentRecord) error) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	a, err := lockAppointment(tx, data.AppointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if a.doctorTag != data.Doctortag {
+		return nil, errors.New("appointment not found")
+	}
+	if prepare != nil {
+		if err := prepare(tx, &a); err != nil {
+			return nil, err
+		}
+	}
+
+	from := a.status
+	refund, err := transitionAppointment(tx, &a, to, ActorDoctor, data.Doctortag, data.Note)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing doctor appointment action:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	announceTransition(a, from, ActorDoctor, data.Note, refund)
+	return map[string]interface{}{"appointment_id": a.id, "status": a.status}, nil
+}
+
+// attendedCheck stops an appointment being closed out before it has started
+func attendedCheck(tx pgx.Tx, a *appointmentRecord) error {
+	if time.Now().Before(a.scheduledAt) {
+		return errors.New("the appointment has not started yet")
+	}
+	return nil
+}
+
+func (DoctorServer) AcceptAppointment(data models.DoctorActionReq) (any, error) {
+	return doctorTransition(data, "confirmed", nil)
+}
+
+func (DoctorServer) DeclineAppointment(data models.DoctorActionReq) (any, error) {
+	return doctorTransition(data, "declined", nil)
+}
+
+// ProposeNewTime holds the proposed slot for the patient alongside the original one, the appointment keeps
+// its old time and slot until the patient accepts
+func (DoctorServer) ProposeNewTime(data models.DoctorActionReq) (any, error) {
+	return doctorTransition(data, "proposed", func(tx pgx.Tx, a *appointmentRecord) error {
+		if a.status != "pending" {
+			return fmt.Errorf("a %s appointment cannot be moved to proposed", a.status)
+		}
+		if err := reserveSlot(tx, a.doctorTag, data.NewScheduledAt, a.id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(Ctx, `UPDATE appointments SET proposed_at = $1 WHERE appointment_id = $2`, data.NewScheduledAt, a.id)
+		if err != nil {
+			log.Println("Failed to save proposed time:", err)
+			return errors.New(responses.SOMETHING_WRONG)
+		}
+		a.proposedAt = &data.NewScheduledAt
+		return nil
+	})
+}
+
+func (DoctorServer) CompleteAppointment(data models.DoctorActionReq) (any, error) {
+	return doctorTransition(data, "completed", attendedCheck)
+}
+
+func (DoctorServer) MarkNoShow(data models.DoctorActionReq) (any, error) {
+	return doctorTransition(data, "no_show", attendedCheck)
+}
+
+func (DoctorServer) CancelAppointment(data models.DoctorActionReq) (any, error) {
+	return doctorTransition(data, "cancelled", nil)
+}
+
+func (DoctorServer) GetStatusHistory(doctortag string, appointmentID int) (any, error) {
+	return getStatusHistory(appointmentID, "doctor_tag", doctortag)
+}
+
+// CreateFollowUp books a follow-up from a completed visit at a discount, or free. It goes to the patient as a
+// proposal holding the slot and is paid for when they accept
+func (DoctorServer) CreateFollowUp(data models.FollowUpReq) (any, error) {
+	if data.DiscountPercent < 0 || data.DiscountPercent > 100 {
+		return nil, errors.New("discount_percent must be between 0 and 100")
+	}
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	original, err := lockAppointment(tx, data.AppointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if original.doctorTag != data.Doctortag {
+		return nil, errors.New("appointment not found")
+	}
+	if original.status != "completed" {
+		return nil, errors.New("follow-ups can only be booked from a completed visit")
+	}
+	if !data.ScheduledAt.After(time.Now()) {
+		return nil, errors.New("follow-up time must be in the future")
+	}
+	if data.ScheduledAt.After(original.scheduledAt.AddDate(0, 0, config.FollowUpWindowDays)) {
+		return nil, fmt.Errorf("follow-ups must be within %d days of the original visit", config.FollowUpWindowDays)
+	}
+	var open int
+	err = tx.QueryRow(Ctx,
+		`SELECT COUNT(*) FROM appointments WHERE follow_up_of = $1 AND status IN ('pending', 'proposed', 'confirmed')`, original.id).Scan(&open)
+	if err != nil {
+		log.Println("Failed to check follow-ups:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if open > 0 {
+		return nil, errors.New("this visit already has an open follow-up")
+	}
+	if err := checkBookingLimits(tx, original.patientTag, data.Doctortag, original.dependentID); err != nil {
+		return nil, err
+	}
+
+	var price float64
+	if err := tx.QueryRow(Ctx, `SELECT COALESCE(price_per_session, 0) FROM doctors WHERE doctortag = $1`, data.Doctortag).Scan(&price); err != nil {
+		log.Println("Failed to fetch doctor price:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	fee := math.Round(price*float64(100-data.DiscountPercent)) / 100
+	if data.Reason == "" {
+		data.Reason = fmt.Sprintf("Follow-up of appointment #%d", original.id)
+	}
+
+	var appointmentID int
+	err = tx.QueryRow(Ctx,
+		`INSERT INTO appointments (patient_tag, doctor_tag, scheduled_at, proposed_at, reason, status, follow_up_of, follow_up_fee, amount, dependent_id)
+		 VALUES ($1, $2, $3, $3, $4, 'proposed', $5, $6, 0, $7) RETURNING appointment_id`,
+		original.patientTag, data.Doctortag, data.ScheduledAt, data.Reason, original.id, fee, original.dependentID).Scan(&appointmentID)
+	if err != nil {
+		log.Println("Failed to create follow-up:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := reserveSlot(tx, data.Doctortag, data.ScheduledAt, appointmentID); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO appointment_status_history (appointment_id, to_status, changed_by_type, changed_by, note)
+		 VALUES ($1, 'proposed', $2, $3, $4)`, appointmentID, ActorDoctor, data.Doctortag, fmt.Sprintf("follow-up of appointment #%d", original.id))
+	if err != nil {
+		log.Println("Failed to record appointment status history:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing follow-up:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	priceNote := "It is free of charge."
+	if fee > 0 {
+		priceNote = fmt.Sprintf("The fee is %.2f.", fee)
+	}
+	at := data.ScheduledAt.In(userLocation(Db, original.patientTag)).Format("Mon 2 Jan 15:04 MST")
+	notifyPatientWithInvite(original.patientTag, appointmentID, "Follow-up suggested",
+		"Your doctor booked a follow-up consultation for "+at+". "+priceNote+" Please accept or decline it in the app.")
+	return map[string]interface{}{
+		"appointment_id": appointmentID,
+		"follow_up_of":   original.id,
+		"status":         "proposed",
+		"fee":            fee,
+	}, nil
+}
@@ -0,0 +1,468 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"telemed/config"
+	"telemed/fhir"
+	"telemed/growth"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// fhirImport is one bundle entry mapped onto our records, either a health record entry or a growth measurement.
+// Entries that only needed checking, like the Patient, carry neither
+type fhirImport struct {
+	index        int
+	resourceType string
+	patient      fhirPatient
+	record       *models.HealthRecordEntryReq
+	measurement  *models.GrowthMeasurementReq
+	externalID   *string
+	response     fhir.BundleResponse
+}
+
+func importIssue(index int, code, message string) fhir.Issue {
+	return fhir.Issue{Severity: fhir.IssueSeverityError, Code: code, Diagnostics: message, Expression: []string{fmt.Sprintf("Bundle.entry[%d]", index)}}
+}
+
+// issuedByUs reports whether a resource carries one of our own identifiers, it came from our export and is
+// already in our records
+func issuedByUs(identifiers []fhir.Identifier) bool {
+	return slices.ContainsFunc(identifiers, func(id fhir.Identifier) bool { return strings.HasPrefix(id.System, config.FHIRIdentifierBase+"/") })
+}
+
+// ourPatientRef reads a Patient resource's id in our scheme, from its id or from one of our identifiers
+func ourPatientRef(header fhir.ResourceHeader) string {
+	for _, id := range header.Identifier {
+		switch id.System {
+		case config.FHIRIdentifierBase + "/usertag":
+			return "user-" + id.Value
+		case config.FHIRIdentifierBase + "/dependent":
+			return "dependent-" + id.Value
+		}
+	}
+	if strings.HasPrefix(header.ID, "user-") || strings.HasPrefix(header.ID, "dependent-") {
+		return header.ID
+	}
+	return ""
+}
+
+// fhirDate takes the date part of a FHIR date or dateTime
+func fhirDate(value string) string {
+	if len(value) >= 10 {
+		return value[:10]
+	}
+	return value
+}
+
+func annotationText(notes []fhir.Annotation) string {
+	var parts []string
+	for _, n := range notes {
+		if t := strings.TrimSpace(n.Text); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// recordCode keeps a code only when it fits the column, the name still carries the meaning
+func recordCode(concept *fhir.CodeableConcept) string {
+	if code := concept.CodeIn(""); len(code) <= 50 {
+		return code
+	}
+	return ""
+}
+
+func allergyEntry(raw json.RawMessage) (models.HealthRecordEntryReq, fhir.Reference, error) {
+	var res fhir.AllergyIntolerance
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return models.HealthRecordEntryReq{}, res.Patient, errors.New("AllergyIntolerance is not valid JSON for the resource")
+	}
+	switch res.VerificationStatus.CodeIn(fhir.AllergyVerification) {
+	case "entered-in-error", "refuted":
+		return models.HealthRecordEntryReq{}, res.Patient, errors.New("refuted or entered-in-error allergies are not imported")
+	}
+	data := models.HealthRecordEntryReq{
+		Category:  "allergy",
+		Name:      res.Code.Label(),
+		Code:      recordCode(res.Code),
+		Status:    res.ClinicalStatus.CodeIn(fhir.AllergyClinicalStatus),
+		OnsetDate: fhirDate(res.OnsetDateTime),
+		Notes:     annotationText(res.Note),
+	}
+	if data.Name == "" {
+		return data, res.Patient, errors.New("AllergyIntolerance.code needs a text or display naming the substance")
+	}
+	var reactions []string
+	for _, r := range res.Reaction {
+		for _, m := range r.Manifestation {
+			if label := m.Label(); label != "" {
+				reactions = append(reactions, label)
+			}
+		}
+		if data.Severity == "" {
+			data.Severity = r.Severity
+		}
+	}
+	data.Reaction = strings.Join(reactions, ", ")
+	return data, res.Patient, nil
+}
+
+func medicationEntry(raw json.RawMessage) (models.HealthRecordEntryReq, fhir.Reference, error) {
+	var res fhir.MedicationRequest
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return models.HealthRecordEntryReq{}, res.Subject, errors.New("MedicationRequest is not valid JSON for the resource")
+	}
+	data := models.HealthRecordEntryReq{
+		Category:  "medication",
+		Name:      res.MedicationCodeableConcept.Label(),
+		Code:      recordCode(res.MedicationCodeableConcept),
+		OnsetDate: fhirDate(res.AuthoredOn),
+		Notes:     annotationText(res.Note),
+	}
+	if data.Name == "" {
+		return data, res.Subject, errors.New("MedicationRequest.medicationCodeableConcept needs a text or display, medication references are not supported")
+	}
+	switch res.Status {
+	case "entered-in-error":
+		return data, res.Subject, errors.New("entered-in-error medication requests are not imported")
+	case "stopped", "cancelled":
+		data.Status = "inactive"
+	case "completed":
+		data.Status = "resolved"
+	default:
+		data.Status = "active"
+	}
+	if len(res.DosageInstruction) > 0 {
+		dosage := strings.TrimSpace(res.DosageInstruction[0].Text)
+		if len(dosage) <= 100 {
+			data.Dosage = dosage
+		} else {
+			data.Notes = strings.TrimSpace(dosage + "\n" + data.Notes)
+		}
+	}
+	if res.Requester != nil && res.Requester.Display != "" {
+		data.Notes = strings.TrimSpace(data.Notes + "\nPrescribed by " + res.Requester.Display)
+	}
+	return data, res.Subject, nil
+}
+
+// observationUnits converts the units hospitals commonly send into the ones growth measurements are kept in
+var observationUnits = map[string]float64{"kg": 1, "g": 0.001, "[lb_av]": 0.45359237, "cm": 1, "m": 100, "mm": 0.1, "[in_i]": 2.54}
+
+// growthLOINC maps the LOINC codes we accept onto growth indicators, length and height share one
+var growthLOINC = map[string]string{
+	"29463-7": growth.Weight, "3141-9": growth.Weight,
+	"8302-2": growth.Height, "8306-3": growth.Height,
+	"9843-4": growth.Head, "8287-5": growth.Head,
+}
+
+func observationMeasurement(raw json.RawMessage) (models.GrowthMeasurementReq, fhir.Reference, error) {
+	var res fhir.Observation
+	var data models.GrowthMeasurementReq
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return data, res.Subject, errors.New("Observation is not valid JSON for the resource")
+	}
+	indicator := growthLOINC[res.Code.CodeIn(fhir.LOINC)]
+	if indicator == "" {
+		return data, res.Subject, errors.New("only body weight, height or length and head circumference Observations (by LOINC code) are imported")
+	}
+	if !slices.Contains([]string{"final", "amended", "corrected"}, res.Status) {
+		return data, res.Subject, errors.New("only final, amended or corrected Observations are imported")
+	}
+	if res.ValueQuantity == nil || res.ValueQuantity.Value == nil {
+		return data, res.Subject, errors.New("Observation.valueQuantity with a value is required")
+	}
+	unit := res.ValueQuantity.Code
+	if unit == "" {
+		unit = res.ValueQuantity.Unit
+	}
+	factor, ok := observationUnits[unit]
+	if !ok || (indicator == growth.Weight) != slices.Contains([]string{"kg", "g", "[lb_av]"}, unit) {
+		return data, res.Subject, fmt.Errorf("unit %q is not supported for this measurement", unit)
+	}
+	value := *res.ValueQuantity.Value * factor
+	switch indicator {
+	case growth.Weight:
+		data.WeightKg = &value
+	case growth.Height:
+		data.HeightCm = &value
+	case growth.Head:
+		data.HeadCircumferenceCm = &value
+	}
+	data.MeasuredOn = fhirDate(res.EffectiveDateTime)
+	data.Notes = annotationText(res.Note)
+	return data, res.Subject, nil
+}
+
+// Import maps a batch, transaction or collection bundle from a partner hospital into our records. Allergies and
+// medications become health record entries and growth Observations become measurements, all marked as written by
+// the hospital. Each entry gets its own response, a transaction is saved only when every entry is valid
+func (FHIRServer) Import(hospitalID int, body []byte) (int, []byte, error) {
+	var bundle fhir.Bundle
+	if err := json.Unmarshal(body, &bundle); err != nil || bundle.ResourceType != "Bundle" {
+		return 400, nil, errors.New("the request body must be a FHIR Bundle")
+	}
+	if !slices.Contains([]string{"batch", "transaction", "collection"}, bundle.Type) {
+		return 400, nil, errors.New("Bundle.type must be batch, transaction or collection")
+	}
+
+	// Patients in the bundle are matched first so other entries can point at them by fullUrl
+	patientRefs := map[string]string{}
+	headers := make([]fhir.ResourceHeader, len(bundle.Entry))
+	for i, entry := range bundle.Entry {
+		json.Unmarshal(entry.Resource, &headers[i])
+		if headers[i].ResourceType == "Patient" {
+			if ref := ourPatientRef(headers[i]); ref != "" && entry.FullURL != "" {
+				patientRefs[entry.FullURL] = ref
+			}
+		}
+	}
+	patients := map[string]fhirPatient{}
+	resolve := func(reference string) (fhirPatient, error) {
+		ref, ok := patientRefs[reference]
+		if !ok {
+			ref = strings.TrimPrefix(reference, "Patient/")
+		}
+		if p, ok := patients[ref]; ok {
+			return p, nil
+		}
+		p, err := hospitalPatient(Db, hospitalID, ref)
+		if err != nil {
+			return p, err
+		}
+		patients[ref] = p
+		return p, nil
+	}
+
+	imports := make([]fhirImport, len(bundle.Entry))
+	var issues []fhir.Issue
+	for i, entry := range bundle.Entry {
+		imp := &imports[i]
+		imp.index, imp.resourceType = i, headers[i].ResourceType
+		fail := func(code, message string) {
+			issue := importIssue(i, code, message)
+			issues = append(issues, issue)
+			imp.response = fhir.BundleResponse{Status: "400 Bad Request", Outcome: fhir.Outcome(issue)}
+		}
+
+		var subject fhir.Reference
+		var err error
+		switch imp.resourceType {
+		case "Patient":
+			ref := ourPatientRef(headers[i])
+			if ref == "" {
+				fail(fhir.IssueCodeNotFound, "Patient must carry the id or identifier from our export, new patients are not created by import")
+				continue
+			}
+			if imp.patient, err = resolve(ref); err != nil {
+				fail(fhir.IssueCodeNotFound, err.Error())
+				continue
+			}
+			imp.response = fhir.BundleResponse{Status: "200 OK", Location: "Patient/" + ref}
+			continue
+		case "AllergyIntolerance", "MedicationRequest":
+			var data models.HealthRecordEntryReq
+			if imp.resourceType == "AllergyIntolerance" {
+				data, subject, err = allergyEntry(entry.Resource)
+			} else {
+				data, subject, err = medicationEntry(entry.Resource)
+			}
+			if err != nil {
+				fail(fhir.IssueCodeInvalid, err.Error())
+				continue
+			}
+			if _, _, err := validateRecordEntry(&data); err != nil {
+				fail(fhir.IssueCodeInvalid, err.Error())
+				continue
+			}
+			imp.record = &data
+		case "Observation":
+			data, ref, err := observationMeasurement(entry.Resource)
+			if err != nil {
+				fail(fhir.IssueCodeInvalid, err.Error())
+				continue
+			}
+			subject, imp.measurement = ref, &data
+		case "Appointment":
+			fail(fhir.IssueCodeNotSupported, "appointments are booked through the app and cannot be imported")
+			continue
+		case "Practitioner":
+			fail(fhir.IssueCodeNotSupported, "practitioners are managed by our administrators and cannot be imported")
+			continue
+		default:
+			fail(fhir.IssueCodeNotSupported, fmt.Sprintf("resource type %q is not accepted", imp.resourceType))
+			continue
+		}
+
+		if issuedByUs(headers[i].Identifier) {
+			imp.record, imp.measurement = nil, nil
+			imp.response = fhir.BundleResponse{Status: "200 OK", Outcome: fhir.Outcome(fhir.Issue{Severity: fhir.IssueSeverityInfo,
+				Code: fhir.IssueCodeInformational, Diagnostics: "this resource came from our export and is already in our records"})}
+			continue
+		}
+		if subject.Reference == "" {
+			fail(fhir.IssueCodeInvalid, "the resource must reference the Patient it belongs to")
+			continue
+		}
+		if imp.patient, err = resolve(subject.Reference); err != nil {
+			fail(fhir.IssueCodeNotFound, err.Error())
+			continue
+		}
+		if imp.measurement != nil {
+			if imp.patient.dependentID == nil {
+				fail(fhir.IssueCodeNotSupported, "growth Observations are only kept for dependents")
+				continue
+			}
+			var dob time.Time
+			if err := Db.QueryRow(Ctx, `SELECT date_of_birth FROM dependents WHERE dependent_id = $1`, *imp.patient.dependentID).Scan(&dob); err != nil {
+				log.Println("Failed to fetch dependent date of birth:", err)
+				return 500, nil, errors.New(responses.SOMETHING_WRONG)
+			}
+			imp.measurement.DependentID = *imp.patient.dependentID
+			if _, err := validateMeasurement(*imp.measurement, dob); err != nil {
+				fail(fhir.IssueCodeInvalid, err.Error())
+				continue
+			}
+		}
+		if headers[i].ID != "" {
+			externalID := fmt.Sprintf("%d/%s/%s", hospitalID, imp.resourceType, headers[i].ID)
+			imp.externalID = &externalID
+		}
+	}
+
+	if bundle.Type == "transaction" && len(issues) > 0 {
+		outcome, _ := json.Marshal(fhir.Outcome(issues...))
+		return 400, outcome, nil
+	}
+	if err := applyImports(hospitalID, imports, bundle.Type == "transaction"); err != nil {
+		return 500, nil, err
+	}
+
+	created := map[string]int{}
+	response := fhir.Bundle{ResourceType: "Bundle", Type: "batch-response", Timestamp: time.Now().UTC().Format(time.RFC3339), Entry: []fhir.BundleEntry{}}
+	if bundle.Type == "transaction" {
+		response.Type = "transaction-response"
+	}
+	for _, imp := range imports {
+		r := imp.response
+		response.Entry = append(response.Entry, fhir.BundleEntry{Response: &r})
+		if strings.HasPrefix(r.Status, "201") {
+			created[imp.patient.ref]++
+		}
+	}
+	for ref, n := range created {
+		logFHIRAccess(hospitalID, "import", ref, map[string]any{"created": n})
+	}
+	out, err := json.Marshal(response)
+	return 200, out, err
+}
+
+// applyImports saves the valid entries, in one database transaction for a FHIR transaction and one per entry
+// otherwise so a failing entry does not hold the others back
+func applyImports(hospitalID int, imports []fhirImport, atomic bool) error {
+	editor := recordEditor{actorType: ActorHospital, tag: strconv.Itoa(hospitalID)}
+	var shared pgx.Tx
+	if atomic {
+		tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+		if err != nil {
+			return errors.New(responses.SOMETHING_WRONG)
+		}
+		defer tx.Rollback(Ctx)
+		shared = tx
+	}
+	for i := range imports {
+		imp := &imports[i]
+		if imp.record == nil && imp.measurement == nil {
+			continue
+		}
+		tx := shared
+		if !atomic {
+			var err error
+			if tx, err = Db.BeginTx(Ctx, pgx.TxOptions{}); err != nil {
+				return errors.New(responses.SOMETHING_WRONG)
+			}
+		}
+		err := applyImport(tx, editor, imp)
+		if !atomic {
+			if err == nil {
+				err = tx.Commit(Ctx)
+			}
+			tx.Rollback(Ctx)
+			if err != nil {
+				log.Println("Failed to import FHIR resource:", err)
+				imp.response = fhir.BundleResponse{Status: "500 Internal Server Error",
+					Outcome: fhir.Outcome(importIssue(imp.index, fhir.IssueCodeProcessing, responses.SOMETHING_WRONG))}
+			}
+			continue
+		}
+		if err != nil {
+			log.Println("Failed to import FHIR transaction:", err)
+			return errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	if atomic {
+		if err := shared.Commit(Ctx); err != nil {
+			log.Println("Error committing FHIR transaction:", err)
+			return errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	return nil
+}
+
+func applyImport(tx pgx.Tx, editor recordEditor, imp *fhirImport) error {
+	var id int
+	var err error
+	var location string
+	if imp.record != nil {
+		data := imp.record
+		onset, end, _ := validateRecordEntry(data)
+		err = tx.QueryRow(Ctx,
+			`INSERT INTO health_record_entries (usertag, dependent_id, category, name, code, status, severity, reaction, dosage,
+			 onset_date, end_date, notes, created_by_type, created_by, updated_by_type, updated_by, external_id)
+			 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10, $11, NULLIF($12, ''),
+			 $13, $14, $13, $14, $15) ON CONFLICT (external_id) DO NOTHING RETURNING entry_id`,
+			imp.patient.usertag, imp.patient.dependentID, data.Category, data.Name, data.Code, data.Status, data.Severity, data.Reaction,
+			data.Dosage, onset, end, data.Notes, editor.actorType, editor.tag, imp.externalID).Scan(&id)
+		if err == nil {
+			if _, err = recordHistory(tx, id, "created", editor); err != nil {
+				return err
+			}
+		}
+		location = fmt.Sprintf("%s/record-%d", imp.resourceType, id)
+	} else {
+		m := imp.measurement
+		measuredOn, _ := time.Parse("2006-01-02", m.MeasuredOn)
+		err = tx.QueryRow(Ctx,
+			`INSERT INTO growth_measurements (dependent_id, measured_on, weight_kg, height_cm, head_circumference_cm, notes,
+			 recorded_by_type, recorded_by, external_id) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9)
+			 ON CONFLICT (external_id) DO NOTHING RETURNING measurement_id`,
+			m.DependentID, measuredOn, m.WeightKg, m.HeightCm, m.HeadCircumferenceCm, m.Notes, editor.actorType, editor.tag, imp.externalID).Scan(&id)
+		indicator := growth.Weight
+		if m.HeightCm != nil {
+			indicator = growth.Height
+		} else if m.HeadCircumferenceCm != nil {
+			indicator = growth.Head
+		}
+		location = fmt.Sprintf("Observation/growth-%d-%s", id, indicator)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		imp.response = fhir.BundleResponse{Status: "200 OK", Outcome: fhir.Outcome(fhir.Issue{Severity: fhir.IssueSeverityInfo,
+			Code: fhir.IssueCodeDuplicate, Diagnostics: "already imported from this hospital"})}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	imp.response = fhir.BundleResponse{Status: "201 Created", Location: location}
+	return nil
+}
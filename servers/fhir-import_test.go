@@ -0,0 +1,188 @@
+package servers
+
+import (
+	"encoding/json"
+	"strings"
+	"telemed/config"
+	"telemed/fhir"
+	"telemed/models"
+	"testing"
+)
+
+func TestOurPatientRef(t *testing.T) {
+	base := config.FHIRIdentifierBase
+	tests := []struct {
+		name   string
+		header fhir.ResourceHeader
+		want   string
+	}{
+		{"usertag identifier", fhir.ResourceHeader{ID: "abc", Identifier: []fhir.Identifier{{System: base + "/usertag", Value: "jdoe"}}}, "user-jdoe"},
+		{"dependent identifier", fhir.ResourceHeader{Identifier: []fhir.Identifier{{System: "urn:other", Value: "x"}, {System: base + "/dependent", Value: "12"}}}, "dependent-12"},
+		{"our id", fhir.ResourceHeader{ID: "dependent-4"}, "dependent-4"},
+		{"foreign id", fhir.ResourceHeader{ID: "patient-4", Identifier: []fhir.Identifier{{System: "urn:mrn", Value: "4"}}}, ""},
+		{"empty", fhir.ResourceHeader{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ourPatientRef(tt.header); got != tt.want {
+				t.Errorf("ourPatientRef = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssuedByUs(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []fhir.Identifier
+		want bool
+	}{
+		{"ours", []fhir.Identifier{{System: "urn:mrn"}, {System: config.FHIRIdentifierBase + "/health-record"}}, true},
+		{"base without a path", []fhir.Identifier{{System: config.FHIRIdentifierBase}}, false},
+		{"foreign", []fhir.Identifier{{System: "urn:mrn"}}, false},
+		{"none", nil, false},
+	}
+	for _, tt := range tests {
+		if got := issuedByUs(tt.ids); got != tt.want {
+			t.Errorf("%s: issuedByUs = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAllergyEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want models.HealthRecordEntryReq
+		err  string
+	}{
+		{
+			name: "full allergy",
+			raw: `{"resourceType":"AllergyIntolerance","patient":{"reference":"Patient/user-jdoe"},
+				"clinicalStatus":{"coding":[{"system":"` + fhir.AllergyClinicalStatus + `","code":"active"}]},
+				"code":{"coding":[{"system":"http://snomed.info/sct","code":"91936005","display":"Penicillin"}]},
+				"onsetDateTime":"2019-03-04T10:00:00Z","note":[{"text":" rash as a child "},{"text":""}],
+				"reaction":[{"severity":"moderate","manifestation":[{"text":"Hives"},{"coding":[{"display":"Itching"}]}]},{"severity":"severe","manifestation":[{"text":"Swelling"}]}]}`,
+			want: models.HealthRecordEntryReq{Category: "allergy", Name: "Penicillin", Code: "91936005", Status: "active", OnsetDate: "2019-03-04",
+				Notes: "rash as a child", Severity: "moderate", Reaction: "Hives, Itching, Swelling"},
+		},
+		{
+			name: "refuted",
+			raw:  `{"verificationStatus":{"coding":[{"system":"` + fhir.AllergyVerification + `","code":"refuted"}]},"code":{"text":"Peanut"}}`,
+			err:  "refuted",
+		},
+		{name: "no name", raw: `{"code":{"coding":[{"code":"91936005"}]}}`, err: "needs a text or display"},
+		{name: "not json", raw: `{"code":`, err: "not valid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := allergyEntry(json.RawMessage(tt.raw))
+			checkImportErr(t, err, tt.err)
+			if tt.err == "" && got != tt.want {
+				t.Errorf("allergyEntry = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMedicationEntry(t *testing.T) {
+	long := strings.Repeat("x", 101)
+	tests := []struct {
+		name string
+		raw  string
+		want models.HealthRecordEntryReq
+		err  string
+	}{
+		{
+			name: "active prescription",
+			raw: `{"status":"active","subject":{"reference":"Patient/user-jdoe"},"authoredOn":"2024-01-02",
+				"medicationCodeableConcept":{"text":"Amoxicillin 500mg","coding":[{"code":"723"}]},
+				"dosageInstruction":[{"text":"1 capsule three times daily"}],"requester":{"display":"Dr Ade"}}`,
+			want: models.HealthRecordEntryReq{Category: "medication", Name: "Amoxicillin 500mg", Code: "723", Status: "active", OnsetDate: "2024-01-02",
+				Dosage: "1 capsule three times daily", Notes: "Prescribed by Dr Ade"},
+		},
+		{
+			name: "long dosage moves to notes",
+			raw:  `{"status":"stopped","medicationCodeableConcept":{"text":"Ibuprofen"},"dosageInstruction":[{"text":"` + long + `"}],"note":[{"text":"GI upset"}]}`,
+			want: models.HealthRecordEntryReq{Category: "medication", Name: "Ibuprofen", Status: "inactive", Notes: long + "\nGI upset"},
+		},
+		{
+			name: "completed",
+			raw:  `{"status":"completed","medicationCodeableConcept":{"text":"Ibuprofen"}}`,
+			want: models.HealthRecordEntryReq{Category: "medication", Name: "Ibuprofen", Status: "resolved"},
+		},
+		{name: "entered in error", raw: `{"status":"entered-in-error","medicationCodeableConcept":{"text":"Ibuprofen"}}`, err: "entered-in-error"},
+		{name: "medication reference only", raw: `{"status":"active"}`, err: "medication references are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := medicationEntry(json.RawMessage(tt.raw))
+			checkImportErr(t, err, tt.err)
+			if tt.err == "" && got != tt.want {
+				t.Errorf("medicationEntry = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObservationMeasurement(t *testing.T) {
+	observation := func(code, status, quantity string) string {
+		return `{"status":"` + status + `","subject":{"reference":"Patient/dependent-3"},"effectiveDateTime":"2025-06-01T09:30:00+01:00",
+			"code":{"coding":[{"system":"` + fhir.LOINC + `","code":"` + code + `"}]}` + quantity + `}`
+	}
+	tests := []struct {
+		name   string
+		raw    string
+		weight float64
+		height float64
+		head   float64
+		err    string
+	}{
+		{name: "weight in grams", raw: observation("29463-7", "final", `,"valueQuantity":{"value":7250,"code":"g"}`), weight: 7.25},
+		{name: "weight in pounds by unit", raw: observation("3141-9", "amended", `,"valueQuantity":{"value":10,"unit":"[lb_av]"}`), weight: 4.5359237},
+		{name: "length in metres", raw: observation("8306-3", "final", `,"valueQuantity":{"value":0.68,"code":"m"}`), height: 68},
+		{name: "head in mm", raw: observation("9843-4", "corrected", `,"valueQuantity":{"value":425,"code":"mm"}`), head: 42.5},
+		{name: "weight in cm", raw: observation("29463-7", "final", `,"valueQuantity":{"value":7,"code":"cm"}`), err: `unit "cm" is not supported`},
+		{name: "height in kg", raw: observation("8302-2", "final", `,"valueQuantity":{"value":7,"code":"kg"}`), err: `unit "kg" is not supported`},
+		{name: "unknown unit", raw: observation("8302-2", "final", `,"valueQuantity":{"value":7,"code":"ft"}`), err: `unit "ft" is not supported`},
+		{name: "other loinc", raw: observation("8867-4", "final", `,"valueQuantity":{"value":80,"code":"/min"}`), err: "only body weight"},
+		{name: "preliminary", raw: observation("29463-7", "preliminary", `,"valueQuantity":{"value":7,"code":"kg"}`), err: "only final"},
+		{name: "no value", raw: observation("29463-7", "final", `,"valueQuantity":{"code":"kg"}`), err: "valueQuantity with a value"},
+	}
+	value := func(v *float64) float64 {
+		if v == nil {
+			return 0
+		}
+		return *v
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ref, err := observationMeasurement(json.RawMessage(tt.raw))
+			checkImportErr(t, err, tt.err)
+			if tt.err != "" {
+				return
+			}
+			if !closeTo(value(got.WeightKg), tt.weight) || !closeTo(value(got.HeightCm), tt.height) || !closeTo(value(got.HeadCircumferenceCm), tt.head) {
+				t.Errorf("measurement = %v kg %v cm %v cm, want %v kg %v cm %v cm",
+					value(got.WeightKg), value(got.HeightCm), value(got.HeadCircumferenceCm), tt.weight, tt.height, tt.head)
+			}
+			if got.MeasuredOn != "2025-06-01" || ref.Reference != "Patient/dependent-3" {
+				t.Errorf("measured on %q for %q", got.MeasuredOn, ref.Reference)
+			}
+		})
+	}
+}
+
+func checkImportErr(t *testing.T, err error, want string) {
+	t.Helper()
+	if want == "" && err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+		t.Fatalf("err = %v, want one containing %q", err, want)
+	}
+}
+
+func closeTo(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
@@ -0,0 +1,602 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"telemed/config"
+	"telemed/fhir"
+	"telemed/growth"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type FHIRServer struct{}
+
+// fhirPatient is a FHIR Patient id resolved to our records, user-<usertag> for an account holder and
+// dependent-<id> for a dependent, whose records sit under the guardian's usertag
+type fhirPatient struct {
+	ref  string
+	name string
+	recordSubject
+}
+
+// fhirResourceTypes are the resources exposed per patient, in the order $everything lists them
+var fhirResourceTypes = []string{"Patient", "Practitioner", "Appointment", "MedicationRequest", "Observation", "AllergyIntolerance"}
+
+func fhirBaseURL() string {
+	return strings.TrimSuffix(config.PublicBaseURL, "/") + "/fhir"
+}
+
+func fhirIdentifier(kind, value string) []fhir.Identifier {
+	return []fhir.Identifier{{System: config.FHIRIdentifierBase + "/" + kind, Value: value}}
+}
+
+func fhirGender(gender string) string {
+	if sex := growth.NormalizeSex(gender); sex != "" {
+		return sex
+	}
+	if strings.TrimSpace(gender) == "" {
+		return "unknown"
+	}
+	return "other"
+}
+
+// hospitalPatient resolves a Patient id for a partner hospital. A hospital only reaches patients who have an active
+// consent shared with it, anyone else is reported as not found
+func hospitalPatient(q querier, hospitalID int, ref string) (fhirPatient, error) {
+	p := fhirPatient{ref: ref}
+	var err error
+	switch {
+	case strings.HasPrefix(ref, "user-"):
+		p.usertag = strings.TrimPrefix(ref, "user-")
+		err = q.QueryRow(Ctx, `SELECT CONCAT(firstname, ' ', lastname) FROM users WHERE usertag = $1`, p.usertag).Scan(&p.name)
+	case strings.HasPrefix(ref, "dependent-"):
+		id, convErr := strconv.Atoi(strings.TrimPrefix(ref, "dependent-"))
+		if convErr != nil {
+			return p, errors.New("patient not found")
+		}
+		p.dependentID = &id
+		err = q.QueryRow(Ctx,
+			`SELECT guardian_tag, CONCAT(firstname, ' ', lastname) FROM dependents WHERE dependent_id = $1 AND status <> 'transferred'`, id).
+			Scan(&p.usertag, &p.name)
+	default:
+		return p, errors.New("patient not found")
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return p, errors.New("patient not found")
+		}
+		log.Println("Failed to fetch FHIR patient:", err)
+		return p, errors.New(responses.SOMETHING_WRONG)
+	}
+	ok, err := hasConsent(q, recordSubject{usertag: p.usertag, dependentID: p.dependentID}, ActorHospital, strconv.Itoa(hospitalID), nil)
+	if err != nil {
+		return p, err
+	}
+	if !ok {
+		return p, errors.New("patient not found")
+	}
+	return p, nil
+}
+
+func logFHIRAccess(hospitalID int, action, patientRef string, details map[string]any) {
+	payload, _ := json.Marshal(details)
+	_, err := Db.Exec(Ctx, `INSERT INTO fhir_access_logs (hospital_id, action, patient_ref, details) VALUES ($1, $2, $3, $4)`,
+		hospitalID, action, patientRef, payload)
+	if err != nil {
+		log.Println("Failed to log FHIR access:", err)
+	}
+}
+
+func (p fhirPatient) reference() fhir.Reference {
+	return fhir.Reference{Reference: "Patient/" + p.ref, Display: p.name}
+}
+
+func practitionerReference(doctortag, name string) fhir.Reference {
+	return fhir.Reference{Reference: "Practitioner/doctor-" + doctortag, Display: name}
+}
+
+func patientResource(p fhirPatient) (fhir.Patient, error) {
+	res := fhir.Patient{ResourceType: "Patient", ID: p.ref}
+	var firstname, lastname, gender string
+	var dob *time.Time
+	if p.dependentID != nil {
+		var guardianName string
+		err := Db.QueryRow(Ctx,
+			`SELECT d.firstname, d.lastname, COALESCE(d.gender, ''), d.date_of_birth, CONCAT(u.firstname, ' ', u.lastname)
+			 FROM dependents d JOIN users u ON u.usertag = d.guardian_tag WHERE d.dependent_id = $1`, *p.dependentID).
+			Scan(&firstname, &lastname, &gender, &dob, &guardianName)
+		if err != nil {
+			log.Println("Failed to fetch dependent for FHIR:", err)
+			return res, errors.New(responses.SOMETHING_WRONG)
+		}
+		res.Identifier = fhirIdentifier("dependent", strconv.Itoa(*p.dependentID))
+		res.Contact = []fhir.PatientContact{{
+			Relationship: []fhir.CodeableConcept{{Text: "guardian"}},
+			Name:         &fhir.HumanName{Text: guardianName},
+		}}
+	} else {
+		var email, phone, state string
+		err := Db.QueryRow(Ctx,
+			`SELECT COALESCE(firstname, ''), COALESCE(lastname, ''), COALESCE(gender, ''), date_of_birth, COALESCE(email, ''),
+			 COALESCE(phone_no, ''), COALESCE(state, '') FROM users WHERE usertag = $1`, p.usertag).
+			Scan(&firstname, &lastname, &gender, &dob, &email, &phone, &state)
+		if err != nil {
+			log.Println("Failed to fetch user for FHIR:", err)
+			return res, errors.New(responses.SOMETHING_WRONG)
+		}
+		res.Identifier = fhirIdentifier("usertag", p.usertag)
+		if email != "" {
+			res.Telecom = append(res.Telecom, fhir.ContactPoint{System: "email", Value: email})
+		}
+		if phone != "" {
+			res.Telecom = append(res.Telecom, fhir.ContactPoint{System: "phone", Value: phone})
+		}
+		if state != "" {
+			res.Address = []fhir.Address{{State: state}}
+		}
+	}
+	res.Name = []fhir.HumanName{{Family: lastname, Given: []string{firstname}}}
+	res.Gender = fhirGender(gender)
+	if dob != nil {
+		res.BirthDate = dob.Format("2006-01-02")
+	}
+	return res, nil
+}
+
+func fhirAppointmentStatus(status string) string {
+	switch status {
+	case "pending", "proposed":
+		return status
+	case "confirmed":
+		return "booked"
+	case "completed":
+		return "fulfilled"
+	case "no_show":
+		return "noshow"
+	}
+	return "cancelled"
+}
+
+func appointmentResources(p fhirPatient, doctors map[string]string) ([]any, error) {
+	rows, err := Db.Query(Ctx,
+		`SELECT a.appointment_id, a.doctor_tag, COALESCE(d.fullname, ''), a.scheduled_at, COALESCE(d.slot_duration_minutes, 30),
+		 a.status, COALESCE(a.reason, ''), a.created_at
+		 FROM appointments a JOIN doctors d ON d.doctortag = a.doctor_tag
+		 WHERE a.patient_tag = $1 AND a.dependent_id IS NOT DISTINCT FROM $2 ORDER BY a.scheduled_at`, p.usertag, p.dependentID)
+	if err != nil {
+		log.Println("Failed to fetch appointments for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	var out []any
+	for rows.Next() {
+		var id, minutes int
+		var doctortag, doctorName, status, reason string
+		var start *time.Time
+		var created time.Time
+		if err := rows.Scan(&id, &doctortag, &doctorName, &start, &minutes, &status, &reason, &created); err != nil {
+			log.Println("Failed to scan appointment for FHIR:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		doctors[doctortag] = doctorName
+		res := fhir.Appointment{
+			ResourceType: "Appointment",
+			ID:           fmt.Sprintf("appointment-%d", id),
+			Identifier:   fhirIdentifier("appointment", strconv.Itoa(id)),
+			Status:       fhirAppointmentStatus(status),
+			Created:      created.UTC().Format(time.RFC3339),
+			Participant: []fhir.AppointmentParticipant{
+				{Actor: p.reference(), Status: "accepted"},
+				{Actor: practitionerReference(doctortag, doctorName), Status: "accepted"},
+			},
+		}
+		if start != nil {
+			res.Start = start.UTC().Format(time.RFC3339)
+			res.End = start.Add(time.Duration(minutes) * time.Minute).UTC().Format(time.RFC3339)
+			res.MinutesDuration = minutes
+		}
+		if reason != "" {
+			res.ReasonCode = []fhir.CodeableConcept{{Text: reason}}
+		}
+		out = append(out, res)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over appointments for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return out, nil
+}
+
+// fhirMedicationStatus maps health record statuses onto MedicationRequest's
+func fhirMedicationStatus(status string) string {
+	switch status {
+	case "inactive":
+		return "stopped"
+	case "resolved":
+		return "completed"
+	}
+	return "active"
+}
+
+// medicationResources lists prescriptions our doctors wrote as orders, and medications on the health record
+// as reported plans
+func medicationResources(p fhirPatient, doctors map[string]string) ([]any, error) {
+	rows, err := Db.Query(Ctx,
+		`SELECT pr.id, COALESCE(pr.prescription, ''), COALESCE(pr.doctor_notes, ''), COALESCE(pr.doctortag, ''), COALESCE(d.fullname, ''),
+		 pr.prescription_date FROM prescriptions pr LEFT JOIN doctors d ON d.doctortag = pr.doctortag
+		 WHERE pr.usertag = $1 AND pr.dependent_id IS NOT DISTINCT FROM $2 ORDER BY pr.id`, p.usertag, p.dependentID)
+	if err != nil {
+		log.Println("Failed to fetch prescriptions for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	var out []any
+	for rows.Next() {
+		var id int
+		var prescription, notes, doctortag, doctorName string
+		var date *time.Time
+		if err := rows.Scan(&id, &prescription, &notes, &doctortag, &doctorName, &date); err != nil {
+			log.Println("Failed to scan prescription for FHIR:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		res := fhir.MedicationRequest{
+			ResourceType:              "MedicationRequest",
+			ID:                        fmt.Sprintf("prescription-%d", id),
+			Identifier:                fhirIdentifier("prescription", strconv.Itoa(id)),
+			Status:                    "unknown",
+			Intent:                    "order",
+			MedicationCodeableConcept: &fhir.CodeableConcept{Text: prescription},
+			Subject:                   p.reference(),
+		}
+		if doctortag != "" {
+			doctors[doctortag] = doctorName
+			ref := practitionerReference(doctortag, doctorName)
+			res.Requester = &ref
+		}
+		if date != nil {
+			res.AuthoredOn = date.Format("2006-01-02")
+		}
+		if notes != "" {
+			res.Note = []fhir.Annotation{{Text: notes}}
+		}
+		out = append(out, res)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over prescriptions for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	entries, err := recordEntriesFor(p, "medication")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		res := fhir.MedicationRequest{
+			ResourceType:              "MedicationRequest",
+			ID:                        fmt.Sprintf("record-%d", e.EntryID),
+			Identifier:                fhirIdentifier("record", strconv.Itoa(e.EntryID)),
+			Status:                    fhirMedicationStatus(e.Status),
+			Intent:                    "plan",
+			ReportedBoolean:           e.CreatedByType == ActorPatient,
+			MedicationCodeableConcept: &fhir.CodeableConcept{Text: e.Name},
+			Subject:                   p.reference(),
+		}
+		if e.Code != "" {
+			res.MedicationCodeableConcept.Coding = []fhir.Coding{{Code: e.Code, Display: e.Name}}
+		}
+		if dosage := strings.TrimSpace(e.Dosage + " " + e.Frequency); dosage != "" {
+			res.DosageInstruction = []fhir.Dosage{{Text: dosage}}
+		}
+		if e.OnsetDate != nil {
+			res.AuthoredOn = e.OnsetDate.Format("2006-01-02")
+		}
+		if e.Notes != "" {
+			res.Note = []fhir.Annotation{{Text: e.Notes}}
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+func recordEntriesFor(p fhirPatient, category string) ([]models.HealthRecordEntry, error) {
+	rows, err := Db.Query(Ctx,
+		`SELECT `+recordEntryColumns+` FROM health_record_entries
+		 WHERE usertag = $1 AND dependent_id IS NOT DISTINCT FROM $2 AND category = $3 AND status <> 'entered_in_error' ORDER BY entry_id`,
+		p.usertag, p.dependentID, category)
+	if err != nil {
+		log.Println("Failed to fetch health record for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	var entries []models.HealthRecordEntry
+	for rows.Next() {
+		e, err := scanRecordEntry(rows)
+		if err != nil {
+			log.Println("Failed to scan health record entry for FHIR:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over health record for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return entries, nil
+}
+
+func allergyResources(p fhirPatient) ([]any, error) {
+	entries, err := recordEntriesFor(p, "allergy")
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, e := range entries {
+		// entries a patient typed in themselves are unconfirmed until a clinician records or edits them
+		verification := "confirmed"
+		if e.CreatedByType == ActorPatient && e.UpdatedByType == ActorPatient {
+			verification = "unconfirmed"
+		}
+		res := fhir.AllergyIntolerance{
+			ResourceType:       "AllergyIntolerance",
+			ID:                 fmt.Sprintf("record-%d", e.EntryID),
+			Identifier:         fhirIdentifier("record", strconv.Itoa(e.EntryID)),
+			ClinicalStatus:     &fhir.CodeableConcept{Coding: []fhir.Coding{{System: fhir.AllergyClinicalStatus, Code: e.Status}}},
+			VerificationStatus: &fhir.CodeableConcept{Coding: []fhir.Coding{{System: fhir.AllergyVerification, Code: verification}}},
+			Code:               &fhir.CodeableConcept{Text: e.Name},
+			Patient:            p.reference(),
+			RecordedDate:       e.Created_at.UTC().Format(time.RFC3339),
+		}
+		if e.Code != "" {
+			res.Code.Coding = []fhir.Coding{{Code: e.Code, Display: e.Name}}
+		}
+		if e.OnsetDate != nil {
+			res.OnsetDateTime = e.OnsetDate.Format("2006-01-02")
+		}
+		if e.Reaction != "" || (e.Severity != "" && e.Severity != "unknown") {
+			reaction := fhir.AllergyReaction{Manifestation: []fhir.CodeableConcept{{Text: e.Reaction}}}
+			if e.Severity != "unknown" {
+				reaction.Severity = e.Severity
+			}
+			res.Reaction = []fhir.AllergyReaction{reaction}
+		}
+		if e.Notes != "" {
+			res.Note = []fhir.Annotation{{Text: e.Notes}}
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+// growthObservationCodes are the LOINC codes growth measurements are exchanged under
+var growthObservationCodes = map[string]fhir.Coding{
+	growth.Weight: {System: fhir.LOINC, Code: "29463-7", Display: "Body weight"},
+	growth.Height: {System: fhir.LOINC, Code: "8302-2", Display: "Body height"},
+	growth.Head:   {System: fhir.LOINC, Code: "9843-4", Display: "Head Occipital-frontal circumference"},
+}
+
+// observationResources exports growth measurements, which are only kept for dependents. An account that was
+// once a dependent exports the ones on the profile handed over to it
+func observationResources(p fhirPatient, doctors map[string]string) ([]any, error) {
+	dependentID := p.dependentID
+	if dependentID == nil {
+		profile, err := transferredProfile(Db, p.usertag)
+		if err != nil || profile == nil {
+			return nil, err
+		}
+		dependentID = profile
+	}
+	rows, err := Db.Query(Ctx,
+		`SELECT g.measurement_id, g.measured_on, g.weight_kg::float8, g.height_cm::float8, g.head_circumference_cm::float8,
+		 COALESCE(g.notes, ''), g.recorded_by_type, g.recorded_by, COALESCE(d.fullname, '')
+		 FROM growth_measurements g LEFT JOIN doctors d ON g.recorded_by_type = 'doctor' AND d.doctortag = g.recorded_by
+		 WHERE g.dependent_id = $1 ORDER BY g.measured_on, g.measurement_id`, *dependentID)
+	if err != nil {
+		log.Println("Failed to fetch growth measurements for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	var out []any
+	for rows.Next() {
+		var id int
+		var measuredOn time.Time
+		var weight, height, head *float64
+		var notes, recordedByType, recordedBy, doctorName string
+		if err := rows.Scan(&id, &measuredOn, &weight, &height, &head, &notes, &recordedByType, &recordedBy, &doctorName); err != nil {
+			log.Println("Failed to scan growth measurement for FHIR:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		values := []struct {
+			indicator string
+			value     *float64
+			unit      string
+		}{{growth.Weight, weight, "kg"}, {growth.Height, height, "cm"}, {growth.Head, head, "cm"}}
+		for _, v := range values {
+			if v.value == nil {
+				continue
+			}
+			res := fhir.Observation{
+				ResourceType:      "Observation",
+				ID:                fmt.Sprintf("growth-%d-%s", id, v.indicator),
+				Identifier:        fhirIdentifier("growth", fmt.Sprintf("%d-%s", id, v.indicator)),
+				Status:            "final",
+				Category:          []fhir.CodeableConcept{{Coding: []fhir.Coding{{System: fhir.ObservationCategory, Code: "vital-signs"}}}},
+				Code:              fhir.CodeableConcept{Coding: []fhir.Coding{growthObservationCodes[v.indicator]}, Text: growthObservationCodes[v.indicator].Display},
+				Subject:           p.reference(),
+				EffectiveDateTime: measuredOn.Format("2006-01-02"),
+				ValueQuantity:     &fhir.Quantity{Value: v.value, Unit: v.unit, System: fhir.UCUM, Code: v.unit},
+			}
+			if recordedByType == ActorDoctor {
+				doctors[recordedBy] = doctorName
+				res.Performer = []fhir.Reference{practitionerReference(recordedBy, doctorName)}
+			}
+			if notes != "" {
+				res.Note = []fhir.Annotation{{Text: notes}}
+			}
+			out = append(out, res)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over growth measurements for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return out, nil
+}
+
+func practitionerResources(doctortags []string) ([]any, error) {
+	if len(doctortags) == 0 {
+		return nil, nil
+	}
+	rows, err := Db.Query(Ctx,
+		`SELECT doctortag, COALESCE(fullname, ''), COALESCE(email, ''), COALESCE(gender, ''), COALESCE(specialization, '')
+		 FROM doctors WHERE doctortag = ANY($1) ORDER BY doctortag`, doctortags)
+	if err != nil {
+		log.Println("Failed to fetch doctors for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	var out []any
+	for rows.Next() {
+		var doctortag, name, email, gender, specialization string
+		if err := rows.Scan(&doctortag, &name, &email, &gender, &specialization); err != nil {
+			log.Println("Failed to scan doctor for FHIR:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		res := fhir.Practitioner{
+			ResourceType: "Practitioner",
+			ID:           "doctor-" + doctortag,
+			Identifier:   fhirIdentifier("doctortag", doctortag),
+			Name:         []fhir.HumanName{{Text: name}},
+			Gender:       fhirGender(gender),
+		}
+		if email != "" {
+			res.Telecom = []fhir.ContactPoint{{System: "email", Value: email}}
+		}
+		if specialization != "" {
+			res.Qualification = []fhir.Qualification{{Code: fhir.CodeableConcept{Text: specialization}}}
+		}
+		out = append(out, res)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over doctors for FHIR:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return out, nil
+}
+
+// patientResources builds the patient's resources of the wanted types, Practitioners are the doctors the
+// other resources point at
+func patientResources(p fhirPatient, wanted []string) ([]any, error) {
+	doctors := map[string]string{}
+	byType := map[string][]any{}
+	patient, err := patientResource(p)
+	if err != nil {
+		return nil, err
+	}
+	byType["Patient"] = []any{patient}
+	if byType["Appointment"], err = appointmentResources(p, doctors); err != nil {
+		return nil, err
+	}
+	if byType["MedicationRequest"], err = medicationResources(p, doctors); err != nil {
+		return nil, err
+	}
+	if byType["Observation"], err = observationResources(p, doctors); err != nil {
+		return nil, err
+	}
+	if byType["AllergyIntolerance"], err = allergyResources(p); err != nil {
+		return nil, err
+	}
+	if slices.Contains(wanted, "Practitioner") {
+		tags := make([]string, 0, len(doctors))
+		for tag := range doctors {
+			tags = append(tags, tag)
+		}
+		if byType["Practitioner"], err = practitionerResources(tags); err != nil {
+			return nil, err
+		}
+	}
+	var out []any
+	for _, t := range fhirResourceTypes {
+		if slices.Contains(wanted, t) {
+			out = append(out, byType[t]...)
+		}
+	}
+	return out, nil
+}
+
+func searchBundle(resources []any) ([]byte, error) {
+	total := len(resources)
+	bundle := fhir.Bundle{
+		ResourceType: "Bundle",
+		Type:         "searchset",
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		Total:        &total,
+		Entry:        []fhir.BundleEntry{},
+	}
+	for _, r := range resources {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		var header fhir.ResourceHeader
+		json.Unmarshal(raw, &header)
+		bundle.Entry = append(bundle.Entry, fhir.BundleEntry{FullURL: fhirBaseURL() + "/" + header.ResourceType + "/" + header.ID, Resource: raw})
+	}
+	return json.Marshal(bundle)
+}
+
+// GetPatient returns a single Patient resource
+func (FHIRServer) GetPatient(hospitalID int, ref string) ([]byte, error) {
+	p, err := hospitalPatient(Db, hospitalID, ref)
+	if err != nil {
+		return nil, err
+	}
+	patient, err := patientResource(p)
+	if err != nil {
+		return nil, err
+	}
+	logFHIRAccess(hospitalID, "read", ref, map[string]any{"resource_type": "Patient"})
+	return json.Marshal(patient)
+}
+
+// Everything is the Patient $everything operation, every resource we hold for the patient in one searchset bundle
+func (FHIRServer) Everything(hospitalID int, ref string) ([]byte, error) {
+	p, err := hospitalPatient(Db, hospitalID, ref)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := patientResources(p, fhirResourceTypes)
+	if err != nil {
+		return nil, err
+	}
+	logFHIRAccess(hospitalID, "export", ref, map[string]any{"resources": len(resources)})
+	return searchBundle(resources)
+}
+
+// Search returns one resource type for a patient, as GET /fhir/<type>?patient=<id>
+func (FHIRServer) Search(hospitalID int, resourceType, ref string) ([]byte, error) {
+	if !slices.Contains(fhirResourceTypes, resourceType) {
+		return nil, fmt.Errorf("resource type %s is not supported", resourceType)
+	}
+	if ref == "" {
+		return nil, errors.New("the patient search parameter is required")
+	}
+	p, err := hospitalPatient(Db, hospitalID, strings.TrimPrefix(ref, "Patient/"))
+	if err != nil {
+		return nil, err
+	}
+	resources, err := patientResources(p, []string{resourceType})
+	if err != nil {
+		return nil, err
+	}
+	logFHIRAccess(hospitalID, "read", p.ref, map[string]any{"resource_type": resourceType, "resources": len(resources)})
+	return searchBundle(resources)
+}
@@ -0,0 +1,324 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type FraudServer struct{}
+
+const (
+	RiskAllow  = "allow"
+	RiskReview = "review"
+	RiskBlock  = "block"
+)
+
+// withdrawalSignals is what the withdrawal rules look at, gathered by scoreWithdrawal
+type withdrawalSignals struct {
+	accountAge   time.Duration // age of the payout account
+	recentTopUps float64       // top-ups credited within the top-up window
+	hourlyCount  int           // withdrawals in the last hour
+	hourlyTotal  float64
+	dailyLimit   float64
+	failedPins   int // failed pin attempts in the last 24 hours
+}
+
+// scoreWithdrawal gathers the withdrawal signals and scores them. Withdraw calls it inside its transaction after
+// locking the wallet, so withdrawals made in parallel count towards each other's velocity
+func scoreWithdrawal(q querier, usertag, recipientCode string, amount float64) (models.RiskAssessment, error) {
+	var signals withdrawalSignals
+
+	var accountCreatedAt time.Time
+	err := q.QueryRow(Ctx, `SELECT created_at FROM payout_accounts WHERE usertag=$1 AND recipient_code=$2 AND is_active=true`,
+		usertag, recipientCode).Scan(&accountCreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.RiskAssessment{}, errors.New("payout account not found")
+		}
+		log.Println("Error fetching payout account for risk scoring:", err)
+		return models.RiskAssessment{}, errors.New(responses.SOMETHING_WRONG)
+	}
+	signals.accountAge = time.Since(accountCreatedAt)
+
+	// a top-up counts from when it was credited, not from when it was started
+	err = q.QueryRow(Ctx,
+		`SELECT COALESCE(SUM(amount), 0) FROM wallet_transactions
+		 WHERE usertag=$1 AND transaction_type='credit' AND status='success' AND transaction_reference LIKE 'wallet\_topup\_%'
+		 AND credited_at >= NOW() - make_interval(mins => $2)`,
+		usertag, config.FraudTopUpWindowMinutes).Scan(&signals.recentTopUps)
+	if err != nil {
+		log.Println("Error summing recent top-ups for risk scoring:", err)
+		return models.RiskAssessment{}, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	err = q.QueryRow(Ctx,
+		`SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM wallet_transactions
+		 WHERE usertag=$1 AND transaction_type='debit' AND transaction_reference LIKE 'wallet\_withdrawal\_%'
+		 AND status NOT IN ('failed', 'reversed') AND created_at >= NOW() - INTERVAL '1 hour'`,
+		usertag).Scan(&signals.hourlyCount, &signals.hourlyTotal)
+	if err != nil {
+		log.Println("Error counting recent withdrawals for risk scoring:", err)
+		return models.RiskAssessment{}, errors.New(responses.SOMETHING_WRONG)
+	}
+	limits, err := fetchTierLimits(q, usertag)
+	if err != nil {
+		return models.RiskAssessment{}, err
+	}
+	signals.dailyLimit = limits.DailyLimit
+
+	err = q.QueryRow(Ctx, `SELECT COUNT(*) FROM failed_pin_attempts WHERE usertag=$1 AND created_at >= NOW() - INTERVAL '24 hours'`,
+		usertag).Scan(&signals.failedPins)
+	if err != nil {
+		log.Println("Error counting failed pin attempts for risk scoring:", err)
+		return models.RiskAssessment{}, errors.New(responses.SOMETHING_WRONG)
+	}
+	return assessWithdrawal(signals, amount), nil
+}
+
+// assessWithdrawal runs the withdrawal rules and returns the combined score and the decision it maps to
+func assessWithdrawal(signals withdrawalSignals, amount float64) models.RiskAssessment {
+	var assessment models.RiskAssessment
+
+	// rule 1: payout account created recently
+	if signals.accountAge < time.Duration(config.FraudNewAccountHours)*time.Hour {
+		assessment.Score += 40
+		assessment.Reasons = append(assessment.Reasons, fmt.Sprintf("payout account created %d minutes ago", int(signals.accountAge.Minutes())))
+	}
+
+	// rule 2: withdrawing most of a top-up that only just landed
+	if signals.recentTopUps > 0 && amount >= signals.recentTopUps*0.5 {
+		assessment.Score += 30
+		assessment.Reasons = append(assessment.Reasons, fmt.Sprintf("withdrawing %.2f shortly after topping up %.2f", amount, signals.recentTopUps))
+	}
+
+	// rule 3: amount and count velocity over the last hour
+	if signals.hourlyCount >= config.FraudHourlyWithdrawalLimit {
+		assessment.Score += 20
+		assessment.Reasons = append(assessment.Reasons, fmt.Sprintf("%d withdrawals in the last hour", signals.hourlyCount))
+	}
+	if signals.hourlyTotal+amount > signals.dailyLimit*0.8 {
+		assessment.Score += 20
+		assessment.Reasons = append(assessment.Reasons, "hourly withdrawals close to the daily limit")
+	}
+
+	// rule 4: failed pin history
+	if signals.failedPins >= config.FraudMaxFailedPins {
+		assessment.Score += 30
+		assessment.Reasons = append(assessment.Reasons, fmt.Sprintf("%d failed pin attempts in 24h", signals.failedPins))
+	}
+
+	switch {
+	case assessment.Score >= config.FraudBlockScore:
+		assessment.Decision = RiskBlock
+	case assessment.Score >= config.FraudReviewScore:
+		assessment.Decision = RiskReview
+	default:
+		assessment.Decision = RiskAllow
+	}
+	return assessment
+}
+
+func recordFailedPin(usertag string) {
+	_, err := Db.Exec(Ctx, `INSERT INTO failed_pin_attempts (usertag) VALUES ($1)`, usertag)
+	if err != nil {
+		log.Println("Failed to record failed pin attempt:", err)
+	}
+}
+
+func recordWithdrawalReview(tx pgx.Tx, data models.WithdrawReq, reference string, assessment models.RiskAssessment, status string) error {
+	reasons, err := json.Marshal(assessment.Reasons)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO withdrawal_reviews (usertag, transaction_reference, recipient_code, amount, risk_score, reasons, decision, status)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		data.Usertag, reference, data.RecipientCode, data.Amount, assessment.Score, reasons, assessment.Decision, status)
+	return err
+}
+
+func (FraudServer) GetWithdrawalReviews(data models.GetDataReq) (any, error) {
+	var reviews []models.WithdrawalReview
+	var args []any
+	argIndex := 1
+	offset := data.Limit*data.Page - data.Limit
+
+	sqlStatement := `SELECT review_id, usertag, COALESCE(transaction_reference, ''), recipient_code, amount, risk_score, reasons, decision, status,
+		COALESCE(reviewed_by, ''), COALESCE(review_note, ''), reviewed_at, created_at FROM withdrawal_reviews`
+	if data.Status != "" {
+		sqlStatement += fmt.Sprintf(" WHERE status = $%d", argIndex)
+		args = append(args, data.Status)
+		argIndex++
+	}
+	sqlStatement += fmt.Sprintf(" ORDER BY created_at ASC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, data.Limit, offset)
+
+	rows, err := Db.Query(Ctx, sqlStatement, args...)
+	if err != nil {
+		log.Println("Failed to fetch withdrawal reviews:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var review models.WithdrawalReview
+		var reasons []byte
+		if err := rows.Scan(&review.ReviewID, &review.Usertag, &review.TransactionReference, &review.RecipientCode, &review.Amount,
+			&review.RiskScore, &reasons, &review.Decision, &review.Status, &review.ReviewedBy, &review.ReviewNote, &review.ReviewedAt, &review.Created_at); err != nil {
+			log.Println("Failed to scan withdrawal review:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		if len(reasons) > 0 {
+			_ = json.Unmarshal(reasons, &review.Reasons)
+		}
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over withdrawal reviews:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return reviews, nil
+}
+
+func (FraudServer) ReviewWithdrawal(data models.ReviewWithdrawalReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	var withdrawal models.WithdrawReq
+	var reference, status string
+	err = tx.QueryRow(Ctx,
+		`SELECT usertag, recipient_code, amount, transaction_reference, status FROM withdrawal_reviews WHERE review_id = $1 FOR UPDATE`,
+		data.ReviewID).Scan(&withdrawal.Usertag, &withdrawal.RecipientCode, &withdrawal.Amount, &reference, &status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("withdrawal review not found")
+		}
+		log.Println("Error fetching withdrawal review:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if status != "pending" {
+		return nil, errors.New("withdrawal has already been reviewed")
+	}
+
+	newStatus := "approved"
+	if data.Decision == "reject" {
+		newStatus = "rejected"
+	}
+	_, err = tx.Exec(Ctx,
+		`UPDATE withdrawal_reviews SET status = $1, reviewed_by = $2, review_note = $3, reviewed_at = NOW() WHERE review_id = $4`,
+		newStatus, data.AdminTag, data.ReviewNote, data.ReviewID)
+	if err != nil {
+		log.Println("Failed to update withdrawal review:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	err = recordAudit(tx, data.AdminTag, "withdrawal."+data.Decision, "withdrawal_review", data.ReviewID, map[string]any{
+		"usertag":   withdrawal.Usertag,
+		"amount":    withdrawal.Amount,
+		"reference": reference,
+		"note":      data.ReviewNote,
+	})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	if newStatus == "rejected" {
+		// release the reserved funds back to the available balance
+		_, err = tx.Exec(Ctx, `UPDATE wallet_transactions SET status='failed' WHERE transaction_reference=$1`, reference)
+		if err != nil {
+			log.Println("Failed to fail held withdrawal:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		_, err = tx.Exec(Ctx,
+			`UPDATE wallets SET balance = balance + $1, pending_balance = pending_balance - $1 WHERE usertag=$2`,
+			withdrawal.Amount, withdrawal.Usertag)
+		if err != nil {
+			log.Println("Failed to release held withdrawal funds:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+	} else {
+		_, err = tx.Exec(Ctx, `UPDATE wallet_transactions SET status='initiated' WHERE transaction_reference=$1`, reference)
+		if err != nil {
+			log.Println("Failed to release held withdrawal:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing withdrawal review:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	if newStatus == "rejected" {
+		return map[string]string{"message": "Withdrawal rejected and funds returned to wallet"}, nil
+	}
+	if err := dispatchWithdrawal(withdrawal, reference); err != nil {
+		return nil, errors.New("transfer could not be initiated, the withdrawal is marked failed and the funds returned to the wallet")
+	}
+	return map[string]string{"message": "Withdrawal approved and transfer initiated", "reference": reference}, nil
+}
+
+// dispatchWithdrawal sends reserved funds to the payout account through Paystack. If the transfer cannot be
+// started the reservation is reversed, so the funds never sit in pending_balance with nothing sending them
+func dispatchWithdrawal(data models.WithdrawReq, reference string) error {
+	transferCode, err := utils.InitiateTransferWithRetry(data, reference, 3)
+	if err != nil {
+		log.Println("Error initiating transfer after retries:", err)
+		if err := reverseWithdrawal(data, reference); err != nil {
+			return err
+		}
+		return errors.New("could not initiate transfer, the funds have been returned to your wallet, please try again later")
+	}
+	_, err = Db.Exec(Ctx,
+		`UPDATE wallet_transactions SET transfer_code=$1, status='pending' WHERE transaction_reference=$2`,
+		transferCode, reference)
+	if err != nil {
+		log.Println("Error updating wallet transaction with transfer code:", err)
+	}
+	return nil
+}
+
+// reverseWithdrawal returns the reserved funds of a withdrawal that never reached Paystack and marks it failed,
+// an approved review is marked failed too so admins can see the transfer did not go out
+func reverseWithdrawal(data models.WithdrawReq, reference string) error {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	res, err := tx.Exec(Ctx, `UPDATE wallet_transactions SET status='failed' WHERE transaction_reference=$1 AND status='initiated'`, reference)
+	if err != nil {
+		log.Println("Failed to fail undispatched withdrawal:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if res.RowsAffected() == 0 {
+		return nil
+	}
+	_, err = tx.Exec(Ctx,
+		`UPDATE wallets SET balance = balance + $1, pending_balance = pending_balance - $1 WHERE usertag=$2`, data.Amount, data.Usertag)
+	if err != nil {
+		log.Println("Failed to release undispatched withdrawal funds:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	_, err = tx.Exec(Ctx, `UPDATE withdrawal_reviews SET status='failed' WHERE transaction_reference=$1 AND status='approved'`, reference)
+	if err != nil {
+		log.Println("Failed to mark withdrawal review failed:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing withdrawal reversal:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	notifyPatient(data.Usertag, "Withdrawal failed", "We could not send your withdrawal to your bank, the funds are back in your wallet.")
+	return nil
+}
@@ -0,0 +1,62 @@
+package servers
+
+import (
+	"telemed/config"
+	"testing"
+	"time"
+)
+
+func TestAssessWithdrawal(t *testing.T) {
+	// an old account with no recent activity scores nothing
+	calm := withdrawalSignals{accountAge: 30 * 24 * time.Hour, dailyLimit: 200000}
+	with := func(change func(*withdrawalSignals)) withdrawalSignals {
+		s := calm
+		change(&s)
+		return s
+	}
+	newAccount := func(s *withdrawalSignals) {
+		s.accountAge = time.Duration(config.FraudNewAccountHours)*time.Hour - time.Minute
+	}
+	tests := []struct {
+		name     string
+		signals  withdrawalSignals
+		amount   float64
+		score    int
+		decision string
+	}{
+		{"nothing unusual", calm, 10000, 0, RiskAllow},
+		{"new payout account", with(newAccount), 10000, 40, RiskReview},
+		{"account just past the new window", with(func(s *withdrawalSignals) {
+			s.accountAge = time.Duration(config.FraudNewAccountHours) * time.Hour
+		}), 10000, 0, RiskAllow},
+		{"half of a fresh top-up", with(func(s *withdrawalSignals) { s.recentTopUps = 20000 }), 10000, 30, RiskAllow},
+		{"small part of a fresh top-up", with(func(s *withdrawalSignals) { s.recentTopUps = 20000 }), 9999, 0, RiskAllow},
+		{"too many withdrawals this hour", with(func(s *withdrawalSignals) {
+			s.hourlyCount = config.FraudHourlyWithdrawalLimit
+		}), 10000, 20, RiskAllow},
+		{"hourly total near the daily limit", with(func(s *withdrawalSignals) { s.hourlyTotal = 150000 }), 10001, 20, RiskAllow},
+		{"failed pins", with(func(s *withdrawalSignals) { s.failedPins = config.FraudMaxFailedPins }), 10000, 30, RiskAllow},
+		{"new account draining a top-up", with(func(s *withdrawalSignals) {
+			newAccount(s)
+			s.recentTopUps = 20000
+		}), 20000, 70, RiskReview},
+		{"everything at once", with(func(s *withdrawalSignals) {
+			newAccount(s)
+			s.recentTopUps = 20000
+			s.hourlyCount = config.FraudHourlyWithdrawalLimit
+			s.hourlyTotal = 150000
+			s.failedPins = config.FraudMaxFailedPins
+		}), 20000, 140, RiskBlock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := assessWithdrawal(tt.signals, tt.amount)
+			if got.Score != tt.score || got.Decision != tt.decision {
+				t.Errorf("assessWithdrawal = %d %s %v, want %d %s", got.Score, got.Decision, got.Reasons, tt.score, tt.decision)
+			}
+			if got.Score > 0 && len(got.Reasons) == 0 {
+				t.Error("a scored withdrawal has no reasons")
+			}
+		})
+	}
+}
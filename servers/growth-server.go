@@ -0,0 +1,274 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"telemed/config"
+	"telemed/growth"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+)
+
+type GrowthServer struct{}
+
+func validateMeasurement(data models.GrowthMeasurementReq, dob time.Time) (time.Time, error) {
+	measuredOn, err := time.Parse("2006-01-02", data.MeasuredOn)
+	if err != nil {
+		return measuredOn, errors.New("measured_on must be in YYYY-MM-DD format")
+	}
+	if measuredOn.Before(dob) || measuredOn.After(time.Now()) {
+		return measuredOn, errors.New("measured_on must be between the date of birth and today")
+	}
+	if data.WeightKg == nil && data.HeightCm == nil && data.HeadCircumferenceCm == nil {
+		return measuredOn, errors.New("record at least one of weight_kg, height_cm or head_circumference_cm")
+	}
+	limits := []struct {
+		value    *float64
+		name     string
+		min, max float64
+	}{
+		{data.WeightKg, "weight_kg", 0.3, 200},
+		{data.HeightCm, "height_cm", 25, 230},
+		{data.HeadCircumferenceCm, "head_circumference_cm", 20, 70},
+	}
+	for _, l := range limits {
+		if l.value != nil && (*l.value < l.min || *l.value > l.max) {
+			return measuredOn, fmt.Errorf("%s must be between %g and %g", l.name, l.min, l.max)
+		}
+	}
+	return measuredOn, nil
+}
+
+func (s GrowthServer) AddMeasurement(actorType, actorTag string, appointmentID *int, data models.GrowthMeasurementReq) (any, error) {
+	var dob time.Time
+	if err := Db.QueryRow(Ctx, `SELECT date_of_birth FROM dependents WHERE dependent_id = $1`, data.DependentID).Scan(&dob); err != nil {
+		log.Println("Failed to fetch dependent date of birth:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	measuredOn, err := validateMeasurement(data, dob)
+	if err != nil {
+		return nil, err
+	}
+	_, err = Db.Exec(Ctx,
+		`INSERT INTO growth_measurements (dependent_id, measured_on, weight_kg, height_cm, head_circumference_cm, notes,
+		 recorded_by_type, recorded_by, appointment_id) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9)`,
+		data.DependentID, measuredOn, data.WeightKg, data.HeightCm, data.HeadCircumferenceCm, data.Notes, actorType, actorTag, appointmentID)
+	if err != nil {
+		log.Println("Failed to save growth measurement:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return s.GetChart(data.DependentID)
+}
+
+// RemoveMeasurement deletes a measurement entered by mistake, only whoever recorded it can remove it
+func (s GrowthServer) RemoveMeasurement(actorType, actorTag string, dependentID, measurementID int) (any, error) {
+	tag, err := Db.Exec(Ctx,
+		`DELETE FROM growth_measurements WHERE measurement_id = $1 AND dependent_id = $2 AND recorded_by_type = $3 AND recorded_by = $4`,
+		measurementID, dependentID, actorType, actorTag)
+	if err != nil {
+		log.Println("Failed to delete growth measurement:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("measurement not found")
+	}
+	return s.GetChart(dependentID)
+}
+
+func scoreGrowth(indicator, sex string, ageMonths float64, value *float64) *models.GrowthScore {
+	if value == nil {
+		return nil
+	}
+	score := &models.GrowthScore{Value: *value}
+	if z, ok := growth.ZScore(indicator, sex, ageMonths, *value); ok {
+		z = math.Round(z*100) / 100
+		percentile := math.Round(growth.Percentile(z)*10) / 10
+		score.ZScore, score.Percentile = &z, &percentile
+	}
+	return score
+}
+
+// growthChart scores every measurement of a dependent and flags readings and trends a doctor should look at
+func growthChart(dependentID int) (models.GrowthChart, error) {
+	chart := models.GrowthChart{
+		DependentID:  dependentID,
+		Measurements: []models.GrowthMeasurement{},
+		Series:       map[string][]models.GrowthPoint{},
+		Reference:    map[string][]growth.ReferencePoint{},
+		Flags:        []models.GrowthFlag{},
+	}
+	var gender string
+	err := Db.QueryRow(Ctx, `SELECT CONCAT(firstname, ' ', lastname), date_of_birth, COALESCE(gender, '') FROM dependents WHERE dependent_id = $1`,
+		dependentID).Scan(&chart.Name, &chart.DateOfBirth, &gender)
+	if err != nil {
+		log.Println("Failed to fetch dependent for growth chart:", err)
+		return chart, errors.New(responses.SOMETHING_WRONG)
+	}
+	chart.Sex = growth.NormalizeSex(gender)
+
+	rows, err := Db.Query(Ctx,
+		`SELECT measurement_id, measured_on, weight_kg::float8, height_cm::float8, head_circumference_cm::float8, COALESCE(notes, ''),
+		 recorded_by_type, recorded_by, appointment_id FROM growth_measurements WHERE dependent_id = $1 ORDER BY measured_on, measurement_id`,
+		dependentID)
+	if err != nil {
+		log.Println("Failed to fetch growth measurements:", err)
+		return chart, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m models.GrowthMeasurement
+		var weight, height, head *float64
+		if err := rows.Scan(&m.MeasurementID, &m.MeasuredOn, &weight, &height, &head, &m.Notes, &m.RecordedByType, &m.RecordedBy,
+			&m.AppointmentID); err != nil {
+			log.Println("Failed to scan growth measurement:", err)
+			return chart, errors.New(responses.SOMETHING_WRONG)
+		}
+		m.AgeDays = int(m.MeasuredOn.Sub(chart.DateOfBirth).Hours() / 24)
+		m.AgeMonths = math.Round(float64(m.AgeDays)/growth.DaysPerMonth*100) / 100
+		ageMonths := float64(m.AgeDays) / growth.DaysPerMonth
+		m.Weight = scoreGrowth(growth.Weight, chart.Sex, ageMonths, weight)
+		m.Height = scoreGrowth(growth.Height, chart.Sex, ageMonths, height)
+		m.Head = scoreGrowth(growth.Head, chart.Sex, ageMonths, head)
+		if weight != nil && height != nil {
+			bmi := math.Round(*weight/math.Pow(*height/100, 2)*100) / 100
+			m.BMI = scoreGrowth(growth.BMI, chart.Sex, ageMonths, &bmi)
+		}
+		chart.Measurements = append(chart.Measurements, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over growth measurements:", err)
+		return chart, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	for _, indicator := range growth.Indicators {
+		series := []models.GrowthPoint{}
+		for _, m := range chart.Measurements {
+			if score := measurementScore(m, indicator); score != nil {
+				series = append(series, models.GrowthPoint{MeasuredOn: m.MeasuredOn, AgeMonths: m.AgeMonths, GrowthScore: *score})
+			}
+		}
+		chart.Series[indicator] = series
+		chart.Flags = append(chart.Flags, growthFlags(indicator, series)...)
+		if chart.Sex != "" {
+			chart.Reference[indicator] = growth.ReferenceCurve(indicator, chart.Sex)
+		}
+	}
+	return chart, nil
+}
+
+func (GrowthServer) GetChart(dependentID int) (any, error) {
+	return growthChart(dependentID)
+}
+
+func measurementScore(m models.GrowthMeasurement, indicator string) *models.GrowthScore {
+	switch indicator {
+	case growth.Weight:
+		return m.Weight
+	case growth.Height:
+		return m.Height
+	case growth.Head:
+		return m.Head
+	case growth.BMI:
+		return m.BMI
+	}
+	return nil
+}
+
+// growthThresholds are the WHO cut-offs for children under five, checked from the most serious down
+var growthThresholds = map[string][]struct {
+	below bool
+	z     float64
+	kind  string
+	text  string
+}{
+	growth.Weight: {{true, -3, "severely_underweight", "Weight is far below the expected range for age"},
+		{true, -2, "underweight", "Weight is below the expected range for age"}},
+	growth.Height: {{true, -3, "severely_stunted", "Height is far below the expected range for age"},
+		{true, -2, "stunted", "Height is below the expected range for age"}},
+	growth.Head: {{true, -2, "small_head", "Head circumference is below the expected range for age"},
+		{false, 2, "large_head", "Head circumference is above the expected range for age"}},
+	growth.BMI: {{true, -3, "severely_wasted", "BMI is far below the expected range, a sign of severe wasting"},
+		{true, -2, "wasted", "BMI is below the expected range, a sign of wasting"},
+		{false, 3, "obese", "BMI is in the obese range for age"},
+		{false, 2, "overweight", "BMI is in the overweight range for age"}},
+}
+
+func growthFlags(indicator string, series []models.GrowthPoint) []models.GrowthFlag {
+	var flags []models.GrowthFlag
+	for i, p := range series {
+		if p.ZScore == nil {
+			continue
+		}
+		for _, t := range growthThresholds[indicator] {
+			if (t.below && *p.ZScore < t.z) || (!t.below && *p.ZScore > t.z) {
+				flags = append(flags, models.GrowthFlag{MeasuredOn: p.MeasuredOn, Indicator: indicator, Kind: t.kind,
+					Message: fmt.Sprintf("%s (z-score %.2f)", t.text, *p.ZScore)})
+				break
+			}
+		}
+		if i == 0 {
+			continue
+		}
+		prev := series[i-1]
+		if indicator == growth.Weight && p.Value < prev.Value {
+			flags = append(flags, models.GrowthFlag{MeasuredOn: p.MeasuredOn, Indicator: indicator, Kind: "weight_loss",
+				Message: fmt.Sprintf("Weight fell from %.2f kg to %.2f kg since %s", prev.Value, p.Value, prev.MeasuredOn.Format("2 Jan 2006"))})
+		}
+		// a child dropping across percentile lines is a concern even while still inside the normal range
+		if (indicator == growth.Weight || indicator == growth.Height) && prev.ZScore != nil && *prev.ZScore-*p.ZScore >= config.GrowthZDropAlert {
+			flags = append(flags, models.GrowthFlag{MeasuredOn: p.MeasuredOn, Indicator: indicator, Kind: "crossing_percentiles",
+				Message: fmt.Sprintf("Dropped from the %.0fth to the %.0fth percentile since %s", *prev.Percentile, *p.Percentile,
+					prev.MeasuredOn.Format("2 Jan 2006"))})
+		}
+	}
+	return flags
+}
+
+func (s GrowthServer) GetGuardianChart(usertag string, dependentID int) (any, error) {
+	if err := checkDependentRecords(Db, usertag, dependentID); err != nil {
+		return nil, err
+	}
+	return s.GetChart(dependentID)
+}
+
+func (s GrowthServer) AddGuardianMeasurement(usertag string, data models.GrowthMeasurementReq) (any, error) {
+	if err := checkDependentRecords(Db, usertag, data.DependentID); err != nil {
+		return nil, err
+	}
+	return s.AddMeasurement(ActorPatient, usertag, nil, data)
+}
+
+func (s GrowthServer) RemoveGuardianMeasurement(usertag string, dependentID, measurementID int) (any, error) {
+	if err := checkDependentRecords(Db, usertag, dependentID); err != nil {
+		return nil, err
+	}
+	return s.RemoveMeasurement(ActorPatient, usertag, dependentID, measurementID)
+}
+
+func (s GrowthServer) GetDoctorChart(doctortag string, appointmentID int) (any, error) {
+	dependentID, err := doctorDependentSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetChart(dependentID)
+}
+
+func (s GrowthServer) AddDoctorMeasurement(doctortag string, appointmentID int, data models.GrowthMeasurementReq) (any, error) {
+	dependentID, err := doctorDependentSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	data.DependentID = dependentID
+	return s.AddMeasurement(ActorDoctor, doctortag, &appointmentID, data)
+}
+
+func (s GrowthServer) RemoveDoctorMeasurement(doctortag string, appointmentID, measurementID int) (any, error) {
+	dependentID, err := doctorDependentSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.RemoveMeasurement(ActorDoctor, doctortag, dependentID, measurementID)
+}
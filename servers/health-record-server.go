@@ -0,0 +1,457 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type HealthRecordServer struct{}
+
+var recordCategories = []string{"allergy", "condition", "medication", "surgery", "family_history", "immunization"}
+var recordStatuses = []string{"active", "inactive", "resolved"}
+var allergySeverities = []string{"mild", "moderate", "severe", "unknown"}
+
+// recordSubject is whose health record is read or written: an account holder or one of their dependents
+type recordSubject struct {
+	usertag     string
+	dependentID *int
+}
+
+// recordEditor is who made a change, doctors always edit from a visit
+type recordEditor struct {
+	actorType     string
+	tag           string
+	appointmentID *int
+}
+
+const recordEntryColumns = `entry_id, category, name, COALESCE(code, ''), status, COALESCE(severity, ''), COALESCE(reaction, ''),
+	COALESCE(dosage, ''), COALESCE(frequency, ''), COALESCE(relation, ''), onset_date, end_date, COALESCE(notes, ''),
+	created_by_type, created_by, updated_by_type, updated_by, created_at, updated_at`
+
+func scanRecordEntry(row pgx.Row) (models.HealthRecordEntry, error) {
+	var e models.HealthRecordEntry
+	err := row.Scan(&e.EntryID, &e.Category, &e.Name, &e.Code, &e.Status, &e.Severity, &e.Reaction, &e.Dosage, &e.Frequency,
+		&e.Relation, &e.OnsetDate, &e.EndDate, &e.Notes, &e.CreatedByType, &e.CreatedBy, &e.UpdatedByType, &e.UpdatedBy,
+		&e.Created_at, &e.Updated_at)
+	return e, err
+}
+
+func patientRecordSubject(usertag string, dependentID *int) (recordSubject, error) {
+	if dependentID != nil {
+		if err := checkDependent(Db, usertag, *dependentID); err != nil {
+			return recordSubject{}, err
+		}
+	}
+	return recordSubject{usertag: usertag, dependentID: dependentID}, nil
+}
+
+// patientEntrySubject finds whose record an entry is in, as long as it is the user's or one of their dependents'
+func patientEntrySubject(usertag string, entryID int) (recordSubject, error) {
+	s := recordSubject{usertag: usertag}
+	err := Db.QueryRow(Ctx, `SELECT dependent_id FROM health_record_entries WHERE entry_id = $1 AND usertag = $2`, entryID, usertag).
+		Scan(&s.dependentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s, errors.New("record entry not found")
+		}
+		log.Println("Failed to fetch health record entry:", err)
+		return s, errors.New(responses.SOMETHING_WRONG)
+	}
+	return s, nil
+}
+
+// doctorRecordSubject opens the record of the patient on an appointment, from when its call can be joined until
+// the write-up window after it closes, and only while the patient has not withdrawn the consent they gave by
+// booking it
+func doctorRecordSubject(doctortag string, appointmentID int) (recordSubject, error) {
+	var s recordSubject
+	var status string
+	var scheduledAt time.Time
+	var slotMinutes int
+	err := Db.QueryRow(Ctx,
+		`SELECT a.patient_tag, a.dependent_id, a.status, a.scheduled_at, COALESCE(d.slot_duration_minutes, 30)
+		 FROM appointments a JOIN doctors d ON a.doctor_tag = d.doctortag WHERE a.appointment_id = $1 AND a.doctor_tag = $2`,
+		appointmentID, doctortag).Scan(&s.usertag, &s.dependentID, &status, &scheduledAt, &slotMinutes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s, errors.New("appointment not found")
+		}
+		log.Println("Failed to fetch appointment for health record:", err)
+		return s, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := recordAccessOpen(status, scheduledAt, slotMinutes, time.Now()); err != nil {
+		return s, err
+	}
+	ok, err := hasConsent(Db, s, ActorDoctor, doctortag, &appointmentID)
+	if err != nil {
+		return s, err
+	}
+	if !ok {
+		return s, errors.New("the patient has withdrawn access to their records for this appointment")
+	}
+	return s, nil
+}
+
+// recordAccessOpen is the time check of doctorRecordSubject. A confirmed appointment opens with its call, and it
+// or the completed visit stays open for RecordWriteUpHours after the call window so doses, measurements and
+// reviews can be recorded after the patient hangs up
+func recordAccessOpen(status string, scheduledAt time.Time, slotMinutes int, now time.Time) error {
+	if status != "confirmed" && status != "completed" {
+		return errors.New("the health record is only available for a confirmed or completed appointment with the patient")
+	}
+	opens, closes := consultationWindow(scheduledAt, slotMinutes)
+	closes = closes.Add(time.Duration(config.RecordWriteUpHours) * time.Hour)
+	if now.Before(opens) || now.After(closes) {
+		return errors.New("the health record is only available from the time of the appointment until it has been written up")
+	}
+	return nil
+}
+
+// doctorDependentSubject is doctorRecordSubject for records kept only for children and other dependents. For an
+// account that was once a dependent it is the profile that was handed over to it
+func doctorDependentSubject(doctortag string, appointmentID int) (int, error) {
+	s, err := doctorRecordSubject(doctortag, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+	if s.dependentID == nil {
+		profile, err := transferredProfile(Db, s.usertag)
+		if err != nil {
+			return 0, err
+		}
+		if profile == nil {
+			return 0, errors.New("this appointment is for an adult account, this record is only kept for dependents")
+		}
+		return *profile, nil
+	}
+	return *s.dependentID, nil
+}
+
+func parseRecordDate(value, field string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be in YYYY-MM-DD format", field)
+	}
+	return &date, nil
+}
+
+func validateRecordEntry(data *models.HealthRecordEntryReq) (*time.Time, *time.Time, error) {
+	data.Name = strings.TrimSpace(data.Name)
+	if !slices.Contains(recordCategories, data.Category) {
+		return nil, nil, fmt.Errorf("category must be one of %s", strings.Join(recordCategories, ", "))
+	}
+	if data.Name == "" || len(data.Name) > 255 {
+		return nil, nil, errors.New("name is required and can be at most 255 characters")
+	}
+	if data.Status == "" {
+		data.Status = "active"
+	}
+	if !slices.Contains(recordStatuses, data.Status) {
+		return nil, nil, fmt.Errorf("status must be one of %s", strings.Join(recordStatuses, ", "))
+	}
+	if data.Category == "allergy" {
+		if data.Severity == "" {
+			data.Severity = "unknown"
+		}
+		if !slices.Contains(allergySeverities, data.Severity) {
+			return nil, nil, fmt.Errorf("severity must be one of %s", strings.Join(allergySeverities, ", "))
+		}
+	} else {
+		data.Severity = ""
+	}
+	if data.Category == "family_history" && strings.TrimSpace(data.Relation) == "" {
+		return nil, nil, errors.New("relation is required for family history")
+	}
+
+	onset, err := parseRecordDate(data.OnsetDate, "onset_date")
+	if err != nil {
+		return nil, nil, err
+	}
+	end, err := parseRecordDate(data.EndDate, "end_date")
+	if err != nil {
+		return nil, nil, err
+	}
+	if onset == nil && (data.Category == "surgery" || data.Category == "immunization") {
+		return nil, nil, errors.New("onset_date is required, it is the date of the surgery or vaccine dose")
+	}
+	if onset != nil && onset.After(time.Now()) && data.Category != "medication" {
+		return nil, nil, errors.New("onset_date cannot be in the future")
+	}
+	if onset != nil && end != nil && end.Before(*onset) {
+		return nil, nil, errors.New("end_date cannot be before onset_date")
+	}
+	return onset, end, nil
+}
+
+func getRecord(s recordSubject) (any, error) {
+	record := models.HealthRecord{
+		Allergies: []models.HealthRecordEntry{}, Conditions: []models.HealthRecordEntry{}, Medications: []models.HealthRecordEntry{},
+		Surgeries: []models.HealthRecordEntry{}, FamilyHistory: []models.HealthRecordEntry{}, Immunizations: []models.HealthRecordEntry{},
+	}
+	var err error
+	if s.dependentID != nil {
+		err = Db.QueryRow(Ctx,
+			`SELECT CONCAT(firstname, ' ', lastname), date_of_birth, COALESCE(gender, '') FROM dependents WHERE dependent_id = $1`,
+			*s.dependentID).Scan(&record.PatientName, &record.DateOfBirth, &record.Gender)
+	} else {
+		err = Db.QueryRow(Ctx,
+			`SELECT CONCAT(firstname, ' ', lastname), date_of_birth, COALESCE(gender, '') FROM users WHERE usertag = $1`,
+			s.usertag).Scan(&record.PatientName, &record.DateOfBirth, &record.Gender)
+	}
+	if err != nil {
+		log.Println("Failed to fetch health record demographics:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	rows, err := Db.Query(Ctx,
+		`SELECT `+recordEntryColumns+` FROM health_record_entries
+		 WHERE usertag = $1 AND dependent_id IS NOT DISTINCT FROM $2 AND status <> 'entered_in_error'
+		 ORDER BY status = 'active' DESC, onset_date DESC NULLS LAST, entry_id DESC`, s.usertag, s.dependentID)
+	if err != nil {
+		log.Println("Failed to fetch health record:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanRecordEntry(rows)
+		if err != nil {
+			log.Println("Failed to scan health record entry:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		switch e.Category {
+		case "allergy":
+			record.Allergies = append(record.Allergies, e)
+		case "condition":
+			record.Conditions = append(record.Conditions, e)
+		case "medication":
+			record.Medications = append(record.Medications, e)
+		case "surgery":
+			record.Surgeries = append(record.Surgeries, e)
+		case "family_history":
+			record.FamilyHistory = append(record.FamilyHistory, e)
+		case "immunization":
+			record.Immunizations = append(record.Immunizations, e)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over health record:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return record, nil
+}
+
+// recordHistory stores the entry as it is after a change, together with who made it
+func recordHistory(tx pgx.Tx, entryID int, action string, editor recordEditor) (models.HealthRecordEntry, error) {
+	entry, err := scanRecordEntry(tx.QueryRow(Ctx, `SELECT `+recordEntryColumns+` FROM health_record_entries WHERE entry_id = $1`, entryID))
+	if err != nil {
+		log.Println("Failed to reload health record entry:", err)
+		return entry, errors.New(responses.SOMETHING_WRONG)
+	}
+	snapshot, _ := json.Marshal(entry)
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO health_record_history (entry_id, action, changed_by_type, changed_by, appointment_id, snapshot)
+		 VALUES ($1, $2, $3, $4, $5, $6)`, entryID, action, editor.actorType, editor.tag, editor.appointmentID, snapshot)
+	if err != nil {
+		log.Println("Failed to record health record history:", err)
+		return entry, errors.New(responses.SOMETHING_WRONG)
+	}
+	return entry, nil
+}
+
+func saveRecordEntry(s recordSubject, editor recordEditor, data models.HealthRecordEntryReq) (any, error) {
+	onset, end, err := validateRecordEntry(&data)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	action := "updated"
+	if data.EntryID == 0 {
+		action = "created"
+		err = tx.QueryRow(Ctx,
+			`INSERT INTO health_record_entries (usertag, dependent_id, category, name, code, status, severity, reaction, dosage, frequency,
+			 relation, onset_date, end_date, notes, created_by_type, created_by, updated_by_type, updated_by)
+			 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''),
+			 NULLIF($11, ''), $12, $13, NULLIF($14, ''), $15, $16, $15, $16) RETURNING entry_id`,
+			s.usertag, s.dependentID, data.Category, data.Name, data.Code, data.Status, data.Severity, data.Reaction, data.Dosage,
+			data.Frequency, data.Relation, onset, end, data.Notes, editor.actorType, editor.tag).Scan(&data.EntryID)
+		if err != nil {
+			log.Println("Failed to add health record entry:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+	} else {
+		// the category is fixed once written, a wrong one is removed and entered again
+		tag, err := tx.Exec(Ctx,
+			`UPDATE health_record_entries SET name = $1, code = NULLIF($2, ''), status = $3, severity = NULLIF($4, ''),
+			 reaction = NULLIF($5, ''), dosage = NULLIF($6, ''), frequency = NULLIF($7, ''), relation = NULLIF($8, ''),
+			 onset_date = $9, end_date = $10, notes = NULLIF($11, ''), updated_by_type = $12, updated_by = $13, updated_at = NOW()
+			 WHERE entry_id = $14 AND usertag = $15 AND dependent_id IS NOT DISTINCT FROM $16 AND category = $17
+			 AND status <> 'entered_in_error'`,
+			data.Name, data.Code, data.Status, data.Severity, data.Reaction, data.Dosage, data.Frequency, data.Relation, onset, end,
+			data.Notes, editor.actorType, editor.tag, data.EntryID, s.usertag, s.dependentID, data.Category)
+		if err != nil {
+			log.Println("Failed to update health record entry:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, errors.New("record entry not found")
+		}
+	}
+
+	entry, err := recordHistory(tx, data.EntryID, action, editor)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing health record entry:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return entry, nil
+}
+
+// removeRecordEntry marks an entry as entered in error, it stays in the history for provenance
+func removeRecordEntry(s recordSubject, editor recordEditor, entryID int) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	tag, err := tx.Exec(Ctx,
+		`UPDATE health_record_entries SET status = 'entered_in_error', updated_by_type = $1, updated_by = $2, updated_at = NOW()
+		 WHERE entry_id = $3 AND usertag = $4 AND dependent_id IS NOT DISTINCT FROM $5 AND status <> 'entered_in_error'`,
+		editor.actorType, editor.tag, entryID, s.usertag, s.dependentID)
+	if err != nil {
+		log.Println("Failed to remove health record entry:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("record entry not found")
+	}
+	if _, err := recordHistory(tx, entryID, "removed", editor); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing health record removal:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]string{"message": "Record entry removed"}, nil
+}
+
+func getRecordEntryHistory(s recordSubject, entryID int) (any, error) {
+	changes := []models.HealthRecordChange{}
+	rows, err := Db.Query(Ctx,
+		`SELECT h.action, h.changed_by_type, h.changed_by, h.appointment_id, h.snapshot, h.changed_at
+		 FROM health_record_history h JOIN health_record_entries e ON e.entry_id = h.entry_id
+		 WHERE h.entry_id = $1 AND e.usertag = $2 AND e.dependent_id IS NOT DISTINCT FROM $3 ORDER BY h.changed_at, h.history_id`,
+		entryID, s.usertag, s.dependentID)
+	if err != nil {
+		log.Println("Failed to fetch health record history:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c models.HealthRecordChange
+		var snapshot []byte
+		if err := rows.Scan(&c.Action, &c.ChangedByType, &c.ChangedBy, &c.AppointmentID, &snapshot, &c.ChangedAt); err != nil {
+			log.Println("Failed to scan health record history:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		c.Snapshot = snapshot
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over health record history:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if len(changes) == 0 {
+		return nil, errors.New("record entry not found")
+	}
+	return changes, nil
+}
+
+func (HealthRecordServer) GetPatientRecord(usertag string, dependentID *int) (any, error) {
+	s, err := patientRecordSubject(usertag, dependentID)
+	if err != nil {
+		return nil, err
+	}
+	return getRecord(s)
+}
+
+func (HealthRecordServer) SavePatientEntry(usertag string, data models.HealthRecordEntryReq) (any, error) {
+	var s recordSubject
+	var err error
+	if data.EntryID == 0 {
+		s, err = patientRecordSubject(usertag, data.DependentID)
+	} else {
+		s, err = patientEntrySubject(usertag, data.EntryID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return saveRecordEntry(s, recordEditor{actorType: ActorPatient, tag: usertag}, data)
+}
+
+func (HealthRecordServer) RemovePatientEntry(usertag string, entryID int) (any, error) {
+	s, err := patientEntrySubject(usertag, entryID)
+	if err != nil {
+		return nil, err
+	}
+	return removeRecordEntry(s, recordEditor{actorType: ActorPatient, tag: usertag}, entryID)
+}
+
+func (HealthRecordServer) GetPatientEntryHistory(usertag string, entryID int) (any, error) {
+	s, err := patientEntrySubject(usertag, entryID)
+	if err != nil {
+		return nil, err
+	}
+	return getRecordEntryHistory(s, entryID)
+}
+
+func (HealthRecordServer) GetDoctorRecord(doctortag string, appointmentID int) (any, error) {
+	s, err := doctorRecordSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return getRecord(s)
+}
+
+func (HealthRecordServer) SaveDoctorEntry(doctortag string, appointmentID int, data models.HealthRecordEntryReq) (any, error) {
+	s, err := doctorRecordSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return saveRecordEntry(s, recordEditor{actorType: ActorDoctor, tag: doctortag, appointmentID: &appointmentID}, data)
+}
+
+func (HealthRecordServer) RemoveDoctorEntry(doctortag string, appointmentID, entryID int) (any, error) {
+	s, err := doctorRecordSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return removeRecordEntry(s, recordEditor{actorType: ActorDoctor, tag: doctortag, appointmentID: &appointmentID}, entryID)
+}
+
+func (HealthRecordServer) GetDoctorEntryHistory(doctortag string, appointmentID, entryID int) (any, error) {
+	s, err := doctorRecordSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return getRecordEntryHistory(s, entryID)
+}
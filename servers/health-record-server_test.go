@@ -0,0 +1,39 @@
+package servers
+
+import (
+	"telemed/config"
+	"testing"
+	"time"
+)
+
+func TestRecordAccessOpen(t *testing.T) {
+	scheduledAt := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+	_, callCloses := consultationWindow(scheduledAt, 30)
+	writeUpEnds := callCloses.Add(time.Duration(config.RecordWriteUpHours) * time.Hour)
+	early := time.Duration(config.ConsultationJoinEarlyMinutes) * time.Minute
+	tests := []struct {
+		name   string
+		status string
+		now    time.Time
+		ok     bool
+	}{
+		{"confirmed before the call opens", "confirmed", scheduledAt.Add(-early - time.Minute), false},
+		{"confirmed as the call opens", "confirmed", scheduledAt.Add(-early), true},
+		{"confirmed during the call", "confirmed", scheduledAt.Add(10 * time.Minute), true},
+		{"confirmed after the call closes", "confirmed", callCloses.Add(time.Hour), true},
+		{"completed while writing up", "completed", callCloses.Add(time.Hour), true},
+		{"completed at the end of the write-up", "completed", writeUpEnds, true},
+		{"completed after the write-up", "completed", writeUpEnds.Add(time.Minute), false},
+		{"pending", "pending", scheduledAt, false},
+		{"cancelled", "cancelled", scheduledAt, false},
+		{"no show", "no_show", callCloses.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := recordAccessOpen(tt.status, scheduledAt, 30, tt.now)
+			if (err == nil) != tt.ok {
+				t.Errorf("recordAccessOpen(%s) = %v, want ok %v", tt.status, err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package servers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"telemed/models"
+	"telemed/responses"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const hospitalKeyPrefix = "hk_"
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateHospitalAPIKey issues a FHIR API key for a partner hospital
+func (AdminServer) CreateHospitalAPIKey(admintag string, hospitalID int) (any, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Println("Failed to generate hospital API key:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	key := hospitalKeyPrefix + hex.EncodeToString(b)
+
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	var exists bool
+	if err := tx.QueryRow(Ctx, `SELECT EXISTS (SELECT 1 FROM hospitals WHERE hospital_id = $1)`, hospitalID).Scan(&exists); err != nil {
+		log.Println("Failed to check hospital:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if !exists {
+		return nil, errors.New("hospital not found")
+	}
+	res := models.NewHospitalAPIKey{Key: key}
+	err = tx.QueryRow(Ctx,
+		`INSERT INTO hospital_api_keys (hospital_id, key_prefix, key_hash, created_by) VALUES ($1, $2, $3, $4)
+		 RETURNING key_id, hospital_id, key_prefix, created_by, created_at`, hospitalID, key[:10], hashAPIKey(key), admintag).
+		Scan(&res.KeyID, &res.HospitalID, &res.KeyPrefix, &res.CreatedBy, &res.Created_at)
+	if err != nil {
+		log.Println("Failed to save hospital API key:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	err = recordAudit(tx, admintag, "hospital.api_key.create", "hospital", strconv.Itoa(hospitalID), map[string]any{
+		"key_id": res.KeyID, "key_prefix": res.KeyPrefix,
+	})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing hospital API key:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return res, nil
+}
+
+func (AdminServer) GetHospitalAPIKeys(hospitalID int) (any, error) {
+	keys := []models.HospitalAPIKey{}
+	rows, err := Db.Query(Ctx,
+		`SELECT key_id, hospital_id, key_prefix, created_by, created_at, last_used_at, revoked_at FROM hospital_api_keys
+		 WHERE hospital_id = $1 ORDER BY created_at DESC`, hospitalID)
+	if err != nil {
+		log.Println("Failed to fetch hospital API keys:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k models.HospitalAPIKey
+		if err := rows.Scan(&k.KeyID, &k.HospitalID, &k.KeyPrefix, &k.CreatedBy, &k.Created_at, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			log.Println("Failed to scan hospital API key:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over hospital API keys:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return keys, nil
+}
+
+func (AdminServer) RevokeHospitalAPIKey(admintag string, hospitalID, keyID int) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	tag, err := tx.Exec(Ctx,
+		`UPDATE hospital_api_keys SET revoked_at = NOW() WHERE key_id = $1 AND hospital_id = $2 AND revoked_at IS NULL`, keyID, hospitalID)
+	if err != nil {
+		log.Println("Failed to revoke hospital API key:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("API key not found or already revoked")
+	}
+	if err := recordAudit(tx, admintag, "hospital.api_key.revoke", "hospital", strconv.Itoa(hospitalID), map[string]any{"key_id": keyID}); err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing hospital API key revocation:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]string{"message": fmt.Sprintf("API key %d revoked", keyID)}, nil
+}
+
+// HospitalForAPIKey resolves the hospital behind a live API key, for the FHIR middleware
+func HospitalForAPIKey(key string) (int, error) {
+	var hospitalID int
+	err := Db.QueryRow(Ctx,
+		`UPDATE hospital_api_keys SET last_used_at = NOW() WHERE key_hash = $1 AND revoked_at IS NULL RETURNING hospital_id`,
+		hashAPIKey(key)).Scan(&hospitalID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, errors.New("invalid or revoked API key")
+		}
+		log.Println("Failed to check hospital API key:", err)
+		return 0, errors.New(responses.SOMETHING_WRONG)
+	}
+	return hospitalID, nil
+}
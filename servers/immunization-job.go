@@ -0,0 +1,198 @@
+package servers
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"telemed/config"
+	"telemed/growth"
+	"telemed/immunization"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// immunizationChaseDays is how long after its due date a missing dose is still chased. Older gaps are left to
+// the schedule view and the doctor, a guardian adding an older child should not get a list of infant doses
+const immunizationChaseDays = 365
+
+// StartImmunizationReminderJob queues reminders of vaccines coming due and of doses running late. They go out
+// through the reminder job like appointment reminders, and each dose and kind is queued only once, so a reminder
+// goes out once across restarts and instances
+func StartImmunizationReminderJob() {
+	ticker := time.NewTicker(time.Duration(config.ImmunizationIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		queued, err := QueueImmunizationReminders()
+		if err != nil {
+			log.Println("Immunization reminder job failed:", err)
+		} else if queued > 0 {
+			log.Println("Immunization reminder job queued", queued, "reminders")
+		}
+		<-ticker.C
+	}
+}
+
+type dueVaccine struct {
+	code, kind string
+}
+
+// dueVaccineReminders picks the doses a guardian should hear about today, at most one reminder per dose and kind
+func dueVaccineReminders(dob time.Time, sex string, given []string, on time.Time) []dueVaccine {
+	var due []dueVaccine
+	for _, dose := range immunizationSchedule.Doses {
+		if !dose.AppliesTo(sex) || slices.Contains(given, dose.Code) {
+			continue
+		}
+		dueOn := dose.DueOn(dob)
+		if on.After(dueOn.AddDate(0, 0, immunizationChaseDays)) {
+			continue
+		}
+		switch doseStatus(dose, dob, on) {
+		case "overdue":
+			due = append(due, dueVaccine{dose.Code, "overdue"})
+		case "due":
+			due = append(due, dueVaccine{dose.Code, "due"})
+		case "upcoming":
+			if !on.Before(dueOn.AddDate(0, 0, -config.ImmunizationReminderLeadDays)) {
+				due = append(due, dueVaccine{dose.Code, "due"})
+			}
+		}
+	}
+	return due
+}
+
+// vaccineLine names a dose and its due date in a reminder
+func vaccineLine(dose immunization.Dose, dob time.Time) string {
+	return fmt.Sprintf("%s dose %d (due %s)", dose.Vaccine, dose.DoseNumber, dose.DueOn(dob).Format("2 Jan 2006"))
+}
+
+// QueueImmunizationReminders checks every active dependent young enough to have doses left to chase and queues a
+// reminder to the guardian for each dose that should be mentioned today and hasn't been before
+func QueueImmunizationReminders() (int, error) {
+	oldest := 0
+	for _, dose := range immunizationSchedule.Doses {
+		oldest = max(oldest, dose.AgeDays+immunizationChaseDays)
+	}
+	rows, err := Db.Query(Ctx,
+		`SELECT d.dependent_id, d.guardian_tag, d.date_of_birth, COALESCE(d.gender, ''),
+		 COALESCE(array_agg(i.code) FILTER (WHERE i.code IS NOT NULL), '{}')
+		 FROM dependents d LEFT JOIN immunization_doses i ON i.dependent_id = d.dependent_id
+		 WHERE d.status = 'active' AND d.date_of_birth > CURRENT_DATE - $1::INTEGER
+		 GROUP BY d.dependent_id`, oldest)
+	if err != nil {
+		return 0, err
+	}
+	type child struct {
+		id            int
+		guardian, sex string
+		dob           time.Time
+		given         []string
+	}
+	var children []child
+	for rows.Next() {
+		var c child
+		var gender string
+		if err := rows.Scan(&c.id, &c.guardian, &c.dob, &gender, &c.given); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		c.sex = growth.NormalizeSex(gender)
+		children = append(children, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	queued, on := 0, today()
+	for _, c := range children {
+		reminders := dueVaccineReminders(c.dob, c.sex, c.given, on)
+		if len(reminders) == 0 {
+			continue
+		}
+		codes, kinds := make([]string, len(reminders)), make([]string, len(reminders))
+		for i, r := range reminders {
+			codes[i], kinds[i] = r.code, "vaccine_"+r.kind
+		}
+		tag, err := Db.Exec(Ctx,
+			`INSERT INTO appointment_reminders (kind, dependent_id, vaccine_code, recipient_type, recipient_tag, send_at)
+			 SELECT r.kind, $1, r.code, 'user', $4, NOW() FROM unnest($2::TEXT[], $3::TEXT[]) AS r(code, kind)
+			 ON CONFLICT (dependent_id, vaccine_code, kind) WHERE kind <> 'appointment' DO NOTHING`, c.id, codes, kinds, c.guardian)
+		if err != nil {
+			return queued, err
+		}
+		queued += int(tag.RowsAffected())
+	}
+	return queued, nil
+}
+
+// vaccineReminder sends the guardian one notification for every vaccine reminder of the child that is due, so
+// doses queued together arrive together. Reminders for a dose recorded since, or for a child no longer in the
+// guardian's care, are skipped
+func vaccineReminder(tx pgx.Tx, r dueReminder) (func(), error) {
+	var name, guardianTag, status, gender string
+	var dob time.Time
+	var given []string
+	err := tx.QueryRow(Ctx,
+		`SELECT d.firstname, d.guardian_tag, d.status, d.date_of_birth, COALESCE(d.gender, ''),
+		 COALESCE((SELECT array_agg(i.code) FROM immunization_doses i WHERE i.dependent_id = d.dependent_id), '{}')
+		 FROM dependents d WHERE d.dependent_id = $1`, r.dependentID).
+		Scan(&name, &guardianTag, &status, &dob, &gender, &given)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(Ctx,
+		`SELECT reminder_id, kind, vaccine_code FROM appointment_reminders
+		 WHERE dependent_id = $1 AND recipient_tag = $2 AND kind <> 'appointment' AND status = 'pending' AND send_at <= NOW()
+		 ORDER BY send_at, reminder_id FOR UPDATE SKIP LOCKED`, r.dependentID, r.recipientTag)
+	if err != nil {
+		return nil, err
+	}
+	var ids, sent []int
+	var dueLines, lateLines []string
+	for rows.Next() {
+		var id int
+		var kind, code string
+		if err := rows.Scan(&id, &kind, &code); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		dose, ok := immunizationSchedule.Find(code)
+		if !ok || status != "active" || guardianTag != r.recipientTag || slices.Contains(given, code) {
+			continue
+		}
+		sent = append(sent, id)
+		if kind == "vaccine_overdue" {
+			lateLines = append(lateLines, vaccineLine(dose, dob))
+		} else {
+			dueLines = append(dueLines, vaccineLine(dose, dob))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(Ctx,
+		`UPDATE appointment_reminders SET status = CASE WHEN reminder_id = ANY($1) THEN 'sent' ELSE 'skipped' END, sent_at = NOW()
+		 WHERE reminder_id = ANY($2)`, sent, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(sent) == 0 {
+		return nil, nil
+	}
+
+	var body strings.Builder
+	if len(dueLines) > 0 {
+		fmt.Fprintf(&body, "Due soon for %s: %s. ", name, strings.Join(dueLines, ", "))
+	}
+	if len(lateLines) > 0 {
+		fmt.Fprintf(&body, "Overdue for %s: %s. ", name, strings.Join(lateLines, ", "))
+	}
+	body.WriteString("Record doses already given in the app so we stop reminding you.")
+	return func() { notifyPatient(r.recipientTag, "Vaccination reminder for "+name, body.String()) }, nil
+}
@@ -0,0 +1,199 @@
+package servers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"telemed/config"
+	"telemed/growth"
+	"telemed/immunization"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+)
+
+type ImmunizationServer struct{}
+
+var immunizationSchedule = loadImmunizationSchedule()
+
+func loadImmunizationSchedule() immunization.Schedule {
+	schedule, err := immunization.Load(config.ImmunizationSchedule)
+	if err != nil {
+		log.Fatal("Failed to load immunization schedule: ", err)
+	}
+	return schedule
+}
+
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// doseStatus places a scheduled dose that has not been given relative to the date
+func doseStatus(dose immunization.Dose, dob, on time.Time) string {
+	due := dose.DueOn(dob)
+	switch last := dose.LastOn(dob); {
+	case last != nil && on.After(*last):
+		return "missed"
+	case on.Before(due):
+		return "upcoming"
+	case on.After(due.AddDate(0, 0, config.ImmunizationOverdueDays)):
+		return "overdue"
+	}
+	return "due"
+}
+
+func (ImmunizationServer) GetSchedule() (any, error) {
+	return immunizationSchedule, nil
+}
+
+// GetStatus lays the schedule over a dependent's date of birth and the doses recorded so far
+func (ImmunizationServer) GetStatus(dependentID int) (any, error) {
+	status := models.ImmunizationStatus{DependentID: dependentID, Schedule: immunizationSchedule.Name, Items: []models.ImmunizationItem{}}
+	var gender string
+	err := Db.QueryRow(Ctx, `SELECT CONCAT(firstname, ' ', lastname), date_of_birth, COALESCE(gender, '') FROM dependents WHERE dependent_id = $1`,
+		dependentID).Scan(&status.Name, &status.DateOfBirth, &gender)
+	if err != nil {
+		log.Println("Failed to fetch dependent for immunizations:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	rows, err := Db.Query(Ctx,
+		`SELECT dose_id, code, administered_on, COALESCE(lot_number, ''), COALESCE(facility, ''), COALESCE(notes, ''),
+		 recorded_by_type, recorded_by, appointment_id, created_at FROM immunization_doses WHERE dependent_id = $1`, dependentID)
+	if err != nil {
+		log.Println("Failed to fetch immunization doses:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	given := map[string]*models.ImmunizationDose{}
+	for rows.Next() {
+		var d models.ImmunizationDose
+		if err := rows.Scan(&d.DoseID, &d.Code, &d.AdministeredOn, &d.LotNumber, &d.Facility, &d.Notes, &d.RecordedByType,
+			&d.RecordedBy, &d.AppointmentID, &d.Created_at); err != nil {
+			log.Println("Failed to scan immunization dose:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		given[d.Code] = &d
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over immunization doses:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	sex, on := growth.NormalizeSex(gender), today()
+	for _, dose := range immunizationSchedule.Doses {
+		if !dose.AppliesTo(sex) && given[dose.Code] == nil {
+			continue
+		}
+		item := models.ImmunizationItem{
+			Code:       dose.Code,
+			Vaccine:    dose.Vaccine,
+			DoseNumber: dose.DoseNumber,
+			DueOn:      dose.DueOn(status.DateOfBirth),
+			LastOn:     dose.LastOn(status.DateOfBirth),
+			Notes:      dose.Notes,
+			Status:     "given",
+			Given:      given[dose.Code],
+		}
+		if item.Given == nil {
+			item.Status = doseStatus(dose, status.DateOfBirth, on)
+		}
+		status.Items = append(status.Items, item)
+	}
+	return status, nil
+}
+
+func (s ImmunizationServer) RecordDose(actorType, actorTag string, appointmentID *int, data models.ImmunizationDoseReq) (any, error) {
+	dose, ok := immunizationSchedule.Find(data.Code)
+	if !ok {
+		return nil, errors.New("code is not a dose in the immunization schedule")
+	}
+	administeredOn, err := time.Parse("2006-01-02", data.AdministeredOn)
+	if err != nil {
+		return nil, errors.New("administered_on must be in YYYY-MM-DD format")
+	}
+	var dob time.Time
+	if err := Db.QueryRow(Ctx, `SELECT date_of_birth FROM dependents WHERE dependent_id = $1`, data.DependentID).Scan(&dob); err != nil {
+		log.Println("Failed to fetch dependent date of birth:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if administeredOn.Before(dob) || administeredOn.After(time.Now()) {
+		return nil, errors.New("administered_on must be between the date of birth and today")
+	}
+	tag, err := Db.Exec(Ctx,
+		`INSERT INTO immunization_doses (dependent_id, code, administered_on, lot_number, facility, notes, recorded_by_type, recorded_by, appointment_id)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9) ON CONFLICT (dependent_id, code) DO NOTHING`,
+		data.DependentID, dose.Code, administeredOn, strings.TrimSpace(data.LotNumber), strings.TrimSpace(data.Facility), data.Notes,
+		actorType, actorTag, appointmentID)
+	if err != nil {
+		log.Println("Failed to save immunization dose:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("this dose is already recorded, remove the existing entry to correct it")
+	}
+	return s.GetStatus(data.DependentID)
+}
+
+// RemoveDose deletes a dose recorded by mistake, only whoever recorded it can remove it
+func (s ImmunizationServer) RemoveDose(actorType, actorTag string, dependentID, doseID int) (any, error) {
+	tag, err := Db.Exec(Ctx,
+		`DELETE FROM immunization_doses WHERE dose_id = $1 AND dependent_id = $2 AND recorded_by_type = $3 AND recorded_by = $4`,
+		doseID, dependentID, actorType, actorTag)
+	if err != nil {
+		log.Println("Failed to delete immunization dose:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("dose not found")
+	}
+	return s.GetStatus(dependentID)
+}
+
+func (s ImmunizationServer) GetGuardianStatus(usertag string, dependentID int) (any, error) {
+	if err := checkDependentRecords(Db, usertag, dependentID); err != nil {
+		return nil, err
+	}
+	return s.GetStatus(dependentID)
+}
+
+func (s ImmunizationServer) RecordGuardianDose(usertag string, data models.ImmunizationDoseReq) (any, error) {
+	if err := checkDependentRecords(Db, usertag, data.DependentID); err != nil {
+		return nil, err
+	}
+	return s.RecordDose(ActorPatient, usertag, nil, data)
+}
+
+func (s ImmunizationServer) RemoveGuardianDose(usertag string, dependentID, doseID int) (any, error) {
+	if err := checkDependentRecords(Db, usertag, dependentID); err != nil {
+		return nil, err
+	}
+	return s.RemoveDose(ActorPatient, usertag, dependentID, doseID)
+}
+
+func (s ImmunizationServer) GetDoctorStatus(doctortag string, appointmentID int) (any, error) {
+	dependentID, err := doctorDependentSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStatus(dependentID)
+}
+
+// RecordDoctorDose records a dose given at the visit, linked to the appointment
+func (s ImmunizationServer) RecordDoctorDose(doctortag string, appointmentID int, data models.ImmunizationDoseReq) (any, error) {
+	dependentID, err := doctorDependentSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	data.DependentID = dependentID
+	return s.RecordDose(ActorDoctor, doctortag, &appointmentID, data)
+}
+
+func (s ImmunizationServer) RemoveDoctorDose(doctortag string, appointmentID, doseID int) (any, error) {
+	dependentID, err := doctorDependentSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.RemoveDose(ActorDoctor, doctortag, dependentID, doseID)
+}
@@ -0,0 +1,36 @@
+package servers
+
+import (
+	"telemed/config"
+	"telemed/immunization"
+	"testing"
+	"time"
+)
+
+func TestDoseStatus(t *testing.T) {
+	dob := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return dob.AddDate(0, 0, n) }
+	penta := immunization.Dose{Code: "PENTA1", AgeDays: 42}
+	birthDose := immunization.Dose{Code: "OPV0", AgeDays: 0, MaxAgeDays: 14}
+	overdue := config.ImmunizationOverdueDays
+	tests := []struct {
+		name string
+		dose immunization.Dose
+		on   time.Time
+		want string
+	}{
+		{"before it falls due", penta, day(41), "upcoming"},
+		{"on the due date", penta, day(42), "due"},
+		{"last day before overdue", penta, day(42 + overdue), "due"},
+		{"after the overdue grace", penta, day(43 + overdue), "overdue"},
+		{"birth dose on the last day", birthDose, day(14), "due"},
+		{"birth dose past its upper age", birthDose, day(15), "missed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := doseStatus(tt.dose, dob, tt.on); got != tt.want {
+				t.Errorf("doseStatus = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
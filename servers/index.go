@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"telemed/config"
 	"telemed/models"
 	"telemed/responses"
 	"telemed/utils"
@@ -165,12 +167,6 @@ func (UserServer) GetDoctors() (any, error) {
 }
 
 func (UserServer) BookAppointment(data models.BookAppointment) (interface{}, error) {
-	var (
-		count         int
-		appointmentID int
-		availability  []string
-		resp          models.BookAppointmentResp
-	)
 	// Start a transaction
 	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
 	if err != nil {
@@ -178,59 +174,73 @@ func (UserServer) BookAppointment(data models.BookAppointment) (interface{}, err
 	}
 	defer tx.Rollback(Ctx)
 
-	// Check existing appointment
-	err = tx.QueryRow(Ctx,
-		`SELECT COUNT(*) FROM appointments 
-		 WHERE patient_tag = $1 AND status IN ('pending','confirmed')`,
-		data.Usertag).Scan(&count)
-	if err != nil {
-		return nil, errors.New(responses.SOMETHING_WRONG)
-	}
-	if count > 0 {
-		return nil, errors.New("you already have an open appointment")
-	}
-
-	// Handle payment via wallet
-	ref, err := walletServer.InitiateTransfer(tx, data.Usertag, data.Doctortag, data.Amount, "Appointment payment")
+	resp, err := createBooking(tx, data)
 	if err != nil {
+		if errors.Is(err, ErrSlotTaken) {
+			return nil, errors.New("time slot not available, you can join the waitlist for this doctor")
+		}
 		return nil, err
 	}
 
-	// Check doctor availability
-	err = tx.QueryRow(Ctx,
-		`SELECT availability FROM doctors WHERE doctortag=$1 FOR UPDATE`,
-		data.Doctortag).Scan(&availability)
-	if err != nil {
+	// Commit transaction
+	if err := tx.Commit(Ctx); err != nil {
 		return nil, errors.New(responses.SOMETHING_WRONG)
 	}
+	announceBooking(data, resp)
+	return resp, nil
+}
+
+// announceBooking sends both sides the calendar invite for a new booking, waiting for the doctor to confirm it
+func announceBooking(data models.BookAppointment, resp models.BookAppointmentResp) {
+	appointmentID, _ := strconv.Atoi(resp.AppointmentID)
+	patientTime := data.Scheduled_at.In(userLocation(Db, data.Usertag)).Format("Mon 2 Jan 15:04 MST")
+	doctorTime := data.Scheduled_at.In(doctorLocation(Db, data.Doctortag)).Format("Mon 2 Jan 15:04 MST")
+	notifyPatientWithInvite(data.Usertag, appointmentID, "Appointment booked",
+		"Your appointment on "+patientTime+" is booked and waiting for the doctor to confirm it.")
+	inviteDoctor(data.Doctortag, appointmentID, "New appointment", "A patient booked "+doctorTime+", please confirm it.")
+}
 
-	requestedTime := data.Scheduled_at.Format(time.RFC3339)
-	timeAvailable := false
-	for _, slot := range availability {
-		if slot == requestedTime {
-			timeAvailable = true
-			break
+// createBooking pays for and books an appointment inside the caller's transaction
+func createBooking(tx pgx.Tx, data models.BookAppointment) (models.BookAppointmentResp, error) {
+	var (
+		appointmentID int
+		resp          models.BookAppointmentResp
+	)
+
+	// A dependent is booked under the guardian, who pays
+	if data.DependentID != nil {
+		if err := checkDependent(tx, data.Usertag, *data.DependentID); err != nil {
+			return resp, err
 		}
 	}
-	if !timeAvailable {
-		return nil, errors.New("time slot not available")
+
+	// Check the patient's open appointment limits
+	if err := checkBookingLimits(tx, data.Usertag, data.Doctortag, data.DependentID); err != nil {
+		return resp, err
+	}
+
+	ref, paid, err := payForAppointment(tx, data.Usertag, data.Doctortag, data.Amount, true)
+	if err != nil {
+		return resp, err
 	}
 
 	// Insert appointment
 	err = tx.QueryRow(Ctx,
-		`INSERT INTO appointments (patient_tag, doctor_tag, scheduled_at, reason, status, payment_reference)
-		 VALUES ($1,$2,$3,$4,'pending',$5) RETURNING appointment_id`,
-		data.Usertag, data.Doctortag, data.Scheduled_at, data.Reason, ref).Scan(&appointmentID)
+		`INSERT INTO appointments (patient_tag, doctor_tag, scheduled_at, reason, status, payment_reference, amount, dependent_id)
+		 VALUES ($1,$2,$3,$4,'pending',$5,$6,$7) RETURNING appointment_id`,
+		data.Usertag, data.Doctortag, data.Scheduled_at, data.Reason, ref, paid, data.DependentID).Scan(&appointmentID)
 	if err != nil {
-		return nil, errors.New(responses.SOMETHING_WRONG)
+		return resp, errors.New(responses.SOMETHING_WRONG)
 	}
 
-	// Update doctor availability
-	_, err = tx.Exec(Ctx,
-		`UPDATE doctors SET availability = array_remove(availability,$1) WHERE doctortag=$2`,
-		requestedTime, data.Doctortag)
-	if err != nil {
-		return nil, errors.New(responses.SOMETHING_WRONG)
+	// Reserve the slot, fails if it is not in the doctor's schedule or someone else took it
+	if err := reserveSlot(tx, data.Doctortag, data.Scheduled_at, appointmentID); err != nil {
+		return resp, err
+	}
+
+	// Booking shares the patient's record with the doctor for this appointment, the patient can revoke it
+	if err := grantAppointmentConsent(tx, appointmentID); err != nil {
+		return resp, err
 	}
 
 	// Doctor details
@@ -240,37 +250,84 @@ func (UserServer) BookAppointment(data models.BookAppointment) (interface{}, err
 		data.Doctortag).
 		Scan(&resp.Fullname, &resp.Specialization, &resp.Doctor_photo_url)
 	if err != nil {
-		return nil, errors.New(responses.SOMETHING_WRONG)
-	}
-
-	// Commit transaction
-	if err := tx.Commit(Ctx); err != nil {
-		return nil, errors.New(responses.SOMETHING_WRONG)
+		return resp, errors.New(responses.SOMETHING_WRONG)
 	}
 
 	// Response
 	resp.AppointmentID = fmt.Sprintf("%d", appointmentID)
 	resp.Doctortag = data.Doctortag
-	resp.Scheduled_at = data.Scheduled_at
+	resp.Scheduled_at = data.Scheduled_at.In(userLocation(tx, data.Usertag))
 
 	return resp, nil
 }
 
+// checkBookingLimits replaces the old one-open-appointment rule: a patient can hold several open appointments,
+// but only a few with the same doctor. The guardian and each of their dependents have their own limits. The
+// account row is locked first so concurrent bookings are counted one after another
+func checkBookingLimits(tx pgx.Tx, usertag, doctortag string, dependentID *int) error {
+	_, err := tx.Exec(Ctx, `SELECT usertag FROM users WHERE usertag = $1 FOR UPDATE`, usertag)
+	if err != nil {
+		log.Println("Failed to lock patient for booking limits:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	var total, withDoctor int
+	err = tx.QueryRow(Ctx,
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE doctor_tag = $2) FROM appointments
+		 WHERE patient_tag = $1 AND dependent_id IS NOT DISTINCT FROM $3 AND status IN ('pending', 'proposed', 'confirmed')`,
+		usertag, doctortag, dependentID).Scan(&total, &withDoctor)
+	if err != nil {
+		log.Println("Failed to count open appointments:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if withDoctor >= config.MaxOpenAppointmentsPerDoctor {
+		return errors.New("you already have an open appointment with this doctor")
+	}
+	if total >= config.MaxOpenAppointments {
+		return fmt.Errorf("you can have at most %d open appointments", config.MaxOpenAppointments)
+	}
+	return nil
+}
+
+// payForAppointment uses a consultation from the patient's plan if one is left, otherwise pays the doctor from
+// the wallet. Only full-price visits may use the plan, a discounted follow-up is cheaper paid as it is. It
+// returns the payment reference and what was actually charged
+func payForAppointment(tx pgx.Tx, usertag, doctortag string, amount float64, fullPrice bool) (string, float64, error) {
+	if fullPrice {
+		subscriptionID, covered, err := consumeConsultation(tx, usertag)
+		if err != nil {
+			return "", 0, err
+		}
+		if covered {
+			return fmt.Sprintf("subscription_%d", subscriptionID), 0, nil
+		}
+	}
+	ref, err := transferFunds(tx, "appointment", "payment", usertag, doctortag, amount, "Appointment payment")
+	if err != nil {
+		return "", 0, err
+	}
+	return ref, amount, nil
+}
 
 func (UserServer) GetAppointments(usertag string) (any, error) {
 	var resp []models.GetAppointmentsResp
-	rows, err := Db.Query(Ctx, "SELECT appointment_id, patient_tag, doctor_tag, scheduled_at, reason, status FROM appointments WHERE patient_tag = $1 ORDER BY created_at DESC", usertag)
+	rows, err := Db.Query(Ctx, `SELECT a.appointment_id, a.patient_tag, a.doctor_tag, a.scheduled_at, a.reason, a.status, a.follow_up_of,
+		a.dependent_id, COALESCE(dp.firstname || ' ' || dp.lastname, '')
+		FROM appointments a LEFT JOIN dependents dp ON dp.dependent_id = a.dependent_id
+		WHERE a.patient_tag = $1 ORDER BY a.created_at DESC`, usertag)
 	if err != nil {
 		log.Println("Failed to fetch appointments:", err)
 		return nil, errors.New(responses.SOMETHING_WRONG)
 	}
 	defer rows.Close()
+	loc := userLocation(Db, usertag)
 	for rows.Next() {
 		var appointment models.GetAppointmentsResp
-		if err := rows.Scan(&appointment.AppointmentID, &appointment.PatientTag, &appointment.DoctorTag, &appointment.Scheduled_at, &appointment.Reason, &appointment.Status); err != nil {
+		if err := rows.Scan(&appointment.AppointmentID, &appointment.PatientTag, &appointment.DoctorTag, &appointment.Scheduled_at, &appointment.Reason, &appointment.Status, &appointment.FollowUpOf,
+			&appointment.DependentID, &appointment.DependentName); err != nil {
 			log.Println("Failed to scan appointment:", err)
 			return nil, errors.New(responses.SOMETHING_WRONG)
 		}
+		appointment.Scheduled_at = appointment.Scheduled_at.In(loc)
 		resp = append(resp, appointment)
 	}
 	if err := rows.Err(); err != nil {
@@ -281,8 +338,8 @@ func (UserServer) GetAppointments(usertag string) (any, error) {
 }
 
 func (UserServer) RateDoctor(data models.RateDoctor) (any, error) {
-	err := Db.QueryRow(Ctx,`INSERT INTO reviews (user_tag, doctor_tag, star_rating, review, status)
-		 VALUES ($1, $2, $3, $4, 'pending')`,data.Usertag, data.Doctortag, data.Rating, data.Review)
+	err := Db.QueryRow(Ctx, `INSERT INTO reviews (user_tag, doctor_tag, star_rating, review, status)
+		 VALUES ($1, $2, $3, $4, 'pending')`, data.Usertag, data.Doctortag, data.Rating, data.Review)
 	if err != nil {
 		log.Printf("Failed to insert into reviews: %v", err)
 		return nil, errors.New(responses.SOMETHING_WRONG)
@@ -526,10 +583,9 @@ func (UserServer) GetBillingDetails(Usertag string) (any, error) {
 	return resp, nil
 }
 
-
 func (UserServer) GetProfile(Usertag string) (any, error) {
 	var resp models.UserProfile
-	query := `SELECT usertag, firstname, lastname, email, phone_no, gender, date_of_birth, photo_url FROM users WHERE usertag = $1` 
+	query := `SELECT usertag, firstname, lastname, email, phone_no, gender, date_of_birth, photo_url, COALESCE(time_zone, '') FROM users WHERE usertag = $1`
 	err := Db.QueryRow(Ctx, query, Usertag).Scan(
 		&resp.Usertag,
 		&resp.Firstname,
@@ -538,7 +594,8 @@ func (UserServer) GetProfile(Usertag string) (any, error) {
 		&resp.Phone_no,
 		&resp.Gender,
 		&resp.Dob,
-		&resp.Photo_url)
+		&resp.Photo_url,
+		&resp.TimeZone)
 	if err != nil {
 		log.Println("Failed to fetch user profile for user: ", Usertag, err)
 		return nil, errors.New(responses.SOMETHING_WRONG)
@@ -562,6 +619,7 @@ func (UserServer) UpdateProfile(data models.UserProfile) (any, error) {
 		{data.Gender, "gender"},
 		{data.Dob, "date_of_birth"},
 		{data.Photo_url, "photo_url"},
+		{data.TimeZone, "time_zone"},
 	}
 	// Loop through updates and add only non-empty fields
 	for _, u := range updates {
@@ -619,7 +677,6 @@ func (UserServer) SendChangePasswordOTP(usertag string) (any, error) {
 	return usertag, nil
 }
 
-
 func (UserServer) ChangePassword(data models.ChangePasswordReq) (any, error) {
 	var hash string
 	err := Db.QueryRow(Ctx, "SELECT password FROM users WHERE usertag = $1", data.Usertag).Scan(&hash)
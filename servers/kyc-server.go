@@ -0,0 +1,345 @@
+package servers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type KycServer struct{}
+
+const (
+	KycTierEmail    = 1
+	KycTierPhone    = 2
+	KycTierIdentity = 3
+)
+
+// querier is satisfied by both the pool and a pgx.Tx so checks can run inside or outside a transaction
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+func fetchTierLimits(q querier, usertag string) (models.KycTierLimit, error) {
+	var limits models.KycTierLimit
+	err := q.QueryRow(Ctx,
+		`SELECT l.tier, l.name, l.single_transaction_limit, l.daily_limit, l.max_balance
+		 FROM users u
+		 JOIN kyc_tier_limits l ON l.tier = COALESCE(u.kyc_tier, 1)
+		 WHERE u.usertag = $1`, usertag).
+		Scan(&limits.Tier, &limits.Name, &limits.SingleTransactionLimit, &limits.DailyLimit, &limits.MaxBalance)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return limits, errors.New("user not found")
+		}
+		log.Println("Error fetching kyc tier limits:", err)
+		return limits, errors.New(responses.SOMETHING_WRONG)
+	}
+	return limits, nil
+}
+
+// dailyTotal sums today's credits or debits. Only transfers to other wallets and withdrawals count as debits,
+// paying for appointments, plans and orders is not held to the daily limit
+func dailyTotal(q querier, usertag, transactionType string) (float64, error) {
+	var total float64
+	query := `SELECT COALESCE(SUM(amount), 0) FROM wallet_transactions
+		 WHERE usertag = $1 AND transaction_type = $2
+		 AND status NOT IN ('failed', 'reversed', 'expired')
+		 AND created_at >= date_trunc('day', NOW())`
+	if transactionType == "debit" {
+		query += ` AND (transaction_reference LIKE 'txn\_%' OR transaction_reference LIKE 'wallet\_withdrawal\_%')`
+	}
+	err := q.QueryRow(Ctx, query, usertag, transactionType).Scan(&total)
+	if err != nil {
+		log.Println("Error summing daily wallet transactions:", err)
+		return 0, errors.New(responses.SOMETHING_WRONG)
+	}
+	return total, nil
+}
+
+// checkKycLimits enforces the per-tier single transaction, daily and balance limits for a wallet movement. A
+// "payment" for something on the platform is only held to the single transaction limit. Callers that move money
+// run it inside their transaction after locking the wallet row, so two requests can't both pass on the same total
+func checkKycLimits(q querier, usertag, transactionType string, amount float64) error {
+	limits, err := fetchTierLimits(q, usertag)
+	if err != nil {
+		return err
+	}
+	var total, held float64
+	if transactionType != "payment" {
+		if total, err = dailyTotal(q, usertag, transactionType); err != nil {
+			return err
+		}
+	}
+	if transactionType == "credit" {
+		// top-ups still awaiting payment count towards the balance, they land on it once paid
+		err = q.QueryRow(Ctx,
+			`SELECT w.balance + COALESCE((SELECT SUM(amount) FROM wallet_transactions
+				WHERE usertag = w.usertag AND transaction_type = 'credit' AND status = 'pending'), 0)
+			 FROM wallets w WHERE w.usertag = $1`, usertag).Scan(&held)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.New("wallet not found")
+			}
+			log.Println("Error fetching wallet balance for limit check:", err)
+			return errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	return exceedsKycLimits(limits, transactionType, amount, total, held)
+}
+
+// exceedsKycLimits checks amount against the tier given what already moved today and, for a credit, what the
+// wallet holds including pending top-ups
+func exceedsKycLimits(limits models.KycTierLimit, transactionType string, amount, total, held float64) error {
+	if amount > limits.SingleTransactionLimit {
+		return fmt.Errorf("amount exceeds your single transaction limit of %.2f, upgrade your verification level to increase it", limits.SingleTransactionLimit)
+	}
+	if transactionType == "payment" {
+		return nil
+	}
+	if total+amount > limits.DailyLimit {
+		return fmt.Errorf("amount exceeds your daily limit of %.2f, you have %.2f left for today", limits.DailyLimit, max(limits.DailyLimit-total, 0))
+	}
+	if transactionType == "credit" && held+amount > limits.MaxBalance {
+		return fmt.Errorf("this would take your wallet above the maximum balance of %.2f for your verification level", limits.MaxBalance)
+	}
+	return nil
+}
+
+// checkReceiverBalance locks the receiving wallet of a transfer and keeps it under its tier's maximum balance.
+// Receivers without a wallet, doctors, leave the funds with the platform and have nothing to check
+func checkReceiverBalance(tx pgx.Tx, usertag string, amount float64) error {
+	var balance float64
+	err := tx.QueryRow(Ctx, `SELECT balance FROM wallets WHERE usertag=$1 FOR UPDATE`, usertag).Scan(&balance)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		log.Println("Error locking receiver wallet:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	limits, err := fetchTierLimits(tx, usertag)
+	if err != nil {
+		return err
+	}
+	if balance+amount > limits.MaxBalance {
+		return errors.New("the recipient's wallet cannot receive this amount, it would go above their maximum balance")
+	}
+	return nil
+}
+
+func (KycServer) GetKycStatus(usertag string) (any, error) {
+	var resp models.KycStatusResp
+	limits, err := fetchTierLimits(Db, usertag)
+	if err != nil {
+		return nil, err
+	}
+	err = Db.QueryRow(Ctx, `SELECT COALESCE(phone_verified, false) FROM users WHERE usertag = $1`, usertag).Scan(&resp.PhoneVerified)
+	if err != nil {
+		log.Println("Error fetching phone verification status:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if resp.CreditedToday, err = dailyTotal(Db, usertag, "credit"); err != nil {
+		return nil, err
+	}
+	if resp.DebitedToday, err = dailyTotal(Db, usertag, "debit"); err != nil {
+		return nil, err
+	}
+	err = Db.QueryRow(Ctx, `SELECT COUNT(*) FROM kyc_documents WHERE usertag = $1 AND status = 'pending'`, usertag).Scan(&resp.PendingReviews)
+	if err != nil {
+		log.Println("Error counting pending kyc documents:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	resp.Usertag = usertag
+	resp.Tier = limits.Tier
+	resp.Limits = limits
+	return resp, nil
+}
+
+func (KycServer) SendPhoneOTP(usertag string) (any, error) {
+	var phoneNo sql.NullString
+	var verified bool
+	err := Db.QueryRow(Ctx, "SELECT phone_no, COALESCE(phone_verified, false) FROM users WHERE usertag = $1", usertag).Scan(&phoneNo, &verified)
+	if err != nil {
+		log.Println("Error fetching phone number:", err)
+		return nil, errors.New(responses.USER_NON_EXISTENT)
+	}
+	if verified {
+		return nil, errors.New("phone number already verified")
+	}
+	if !phoneNo.Valid || phoneNo.String == "" {
+		return nil, errors.New("add a phone number to your profile first")
+	}
+	otp, err := utils.GenerateOTP()
+	if err != nil {
+		log.Println("Failed to generate OTP:", err)
+		return nil, errors.New("failed to generate OTP")
+	}
+	_, err = Db.Exec(Ctx, "UPDATE users SET otp = $1, otp_expiry = NOW()+ INTERVAL '5 minutes' WHERE usertag = $2", otp, usertag)
+	if err != nil {
+		log.Println("failed to save OTP", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err = utils.SendSMSOTP(phoneNo.String, otp); err != nil {
+		log.Println("Failed to send OTP sms:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return usertag, nil
+}
+
+func (KycServer) VerifyPhone(data models.VerifyPhoneReq) (any, error) {
+	var dbOtp sql.NullString
+	var otpExpiryTime sql.NullTime
+	err := Db.QueryRow(Ctx, "SELECT otp, otp_expiry FROM users WHERE usertag = $1", data.Usertag).Scan(&dbOtp, &otpExpiryTime)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("invalid OTP")
+	}
+	if !dbOtp.Valid || data.OTP != dbOtp.String {
+		return nil, errors.New("invalid OTP")
+	}
+	if !otpExpiryTime.Valid || time.Now().After(otpExpiryTime.Time) {
+		return nil, errors.New("OTP has expired")
+	}
+	_, err = Db.Exec(Ctx,
+		`UPDATE users SET otp = NULL, otp_expiry = NULL, phone_verified = true, kyc_tier = GREATEST(COALESCE(kyc_tier, 1), $1)
+		 WHERE usertag = $2`, KycTierPhone, data.Usertag)
+	if err != nil {
+		log.Println("Failed to mark phone as verified:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]interface{}{
+		"message": "phone number verified successfully",
+	}, nil
+}
+
+func (KycServer) SubmitDocument(data models.KycDocumentReq) (any, error) {
+	var tier, pending int
+	err := Db.QueryRow(Ctx, "SELECT COALESCE(kyc_tier, 1) FROM users WHERE usertag = $1", data.Usertag).Scan(&tier)
+	if err != nil {
+		log.Println("Error fetching kyc tier:", err)
+		return nil, errors.New(responses.USER_NON_EXISTENT)
+	}
+	if tier >= KycTierIdentity {
+		return nil, errors.New("your identity has already been verified")
+	}
+	if tier < KycTierPhone {
+		return nil, errors.New("verify your phone number before submitting an identity document")
+	}
+	err = Db.QueryRow(Ctx, "SELECT COUNT(*) FROM kyc_documents WHERE usertag = $1 AND status = 'pending'", data.Usertag).Scan(&pending)
+	if err != nil {
+		log.Println("Error counting pending kyc documents:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if pending > 0 {
+		return nil, errors.New("you already have a document awaiting review")
+	}
+	var documentID int
+	err = Db.QueryRow(Ctx,
+		`INSERT INTO kyc_documents (usertag, document_type, document_number, document_url, status)
+		 VALUES ($1, $2, $3, $4, 'pending') RETURNING document_id`,
+		data.Usertag, data.DocumentType, data.DocumentNumber, data.DocumentURL).Scan(&documentID)
+	if err != nil {
+		log.Println("Failed to save kyc document:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]interface{}{
+		"message":     "document submitted for review",
+		"document_id": documentID,
+	}, nil
+}
+
+func (KycServer) GetKycDocuments(data models.GetDataReq) (any, error) {
+	var documents []models.KycDocument
+	var args []any
+	argIndex := 1
+	offset := data.Limit*data.Page - data.Limit
+
+	sqlStatement := `SELECT document_id, usertag, document_type, document_number, COALESCE(document_url, ''), status,
+		COALESCE(review_note, ''), COALESCE(reviewed_by, ''), reviewed_at, created_at FROM kyc_documents`
+	if data.Status != "" {
+		sqlStatement += fmt.Sprintf(" WHERE status = $%d", argIndex)
+		args = append(args, data.Status)
+		argIndex++
+	}
+	// oldest first so the review queue is worked in submission order
+	sqlStatement += fmt.Sprintf(" ORDER BY created_at ASC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, data.Limit, offset)
+
+	rows, err := Db.Query(Ctx, sqlStatement, args...)
+	if err != nil {
+		log.Println("Failed to fetch kyc documents:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var doc models.KycDocument
+		if err := rows.Scan(&doc.DocumentID, &doc.Usertag, &doc.DocumentType, &doc.DocumentNumber, &doc.DocumentURL, &doc.Status,
+			&doc.ReviewNote, &doc.ReviewedBy, &doc.ReviewedAt, &doc.Created_at); err != nil {
+			log.Println("Failed to scan kyc document:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over kyc documents:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return documents, nil
+}
+
+func (KycServer) ReviewKycDocument(data models.ReviewKycDocumentReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	var usertag, status string
+	err = tx.QueryRow(Ctx, `SELECT usertag, status FROM kyc_documents WHERE document_id = $1 FOR UPDATE`, data.DocumentID).Scan(&usertag, &status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("document not found")
+		}
+		log.Println("Error fetching kyc document:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if status != "pending" {
+		return nil, errors.New("document has already been reviewed")
+	}
+	_, err = tx.Exec(Ctx,
+		`UPDATE kyc_documents SET status = $1, review_note = $2, reviewed_by = $3, reviewed_at = NOW() WHERE document_id = $4`,
+		data.Status, data.ReviewNote, data.AdminTag, data.DocumentID)
+	if err != nil {
+		log.Println("Failed to update kyc document:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if data.Status == "approved" {
+		_, err = tx.Exec(Ctx, `UPDATE users SET kyc_tier = $1 WHERE usertag = $2`, KycTierIdentity, usertag)
+		if err != nil {
+			log.Println("Failed to upgrade kyc tier:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	err = recordAudit(tx, data.AdminTag, "kyc.review", "kyc_document", data.DocumentID, map[string]any{
+		"usertag": usertag,
+		"status":  data.Status,
+		"note":    data.ReviewNote,
+	})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing kyc review:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]string{"message": "Document " + data.Status + " successfully"}, nil
+}
@@ -0,0 +1,38 @@
+package servers
+
+import (
+	"telemed/models"
+	"testing"
+)
+
+func TestExceedsKycLimits(t *testing.T) {
+	limits := models.KycTierLimit{Tier: KycTierPhone, SingleTransactionLimit: 50000, DailyLimit: 200000, MaxBalance: 300000}
+	tests := []struct {
+		name            string
+		transactionType string
+		amount          float64
+		total           float64
+		held            float64
+		ok              bool
+	}{
+		{"payment at the single limit", "payment", 50000, 0, 0, true},
+		{"payment over the single limit", "payment", 50000.01, 0, 0, false},
+		{"payment ignores the daily total", "payment", 10000, 500000, 0, true},
+		{"debit filling the daily limit", "debit", 50000, 150000, 0, true},
+		{"debit over the daily limit", "debit", 50000, 150000.01, 0, false},
+		{"debit ignores the balance", "debit", 10000, 0, 1000000, true},
+		{"credit up to the max balance", "credit", 50000, 0, 250000, true},
+		{"credit over the max balance", "credit", 50000, 0, 250000.01, false},
+		{"credit over the daily limit", "credit", 10000, 195000, 0, false},
+		{"credit over the single limit", "credit", 60000, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exceedsKycLimits(limits, tt.transactionType, tt.amount, tt.total, tt.held)
+			if (err == nil) != tt.ok {
+				t.Errorf("exceedsKycLimits(%s, %.2f, total %.2f, held %.2f) = %v, want ok %v",
+					tt.transactionType, tt.amount, tt.total, tt.held, err, tt.ok)
+			}
+		})
+	}
+}
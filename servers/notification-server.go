@@ -0,0 +1,67 @@
+package servers
+
+import (
+	"errors"
+	"log"
+	"telemed/utils"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	RecipientUser   = "user"
+	RecipientDoctor = "doctor"
+)
+
+// notify stores an in-app notification, failures are logged so they never undo the action that caused them
+func notify(recipientType, recipientTag, title, body string) {
+	_, err := Db.Exec(Ctx,
+		`INSERT INTO notifications (recipient_type, recipient_tag, title, body) VALUES ($1, $2, $3, $4)`,
+		recipientType, recipientTag, title, body)
+	if err != nil {
+		log.Println("Failed to save notification:", err)
+	}
+}
+
+// notifyDoctor sends an in-app notification and an SMS to the doctor's phone
+func notifyDoctor(doctortag, title, body string) {
+	notify(RecipientDoctor, doctortag, title, body)
+	var phone string
+	if err := Db.QueryRow(Ctx, `SELECT COALESCE(phone_number, '') FROM doctors WHERE doctortag = $1`, doctortag).Scan(&phone); err != nil {
+		log.Println("Failed to fetch doctor phone number:", err)
+		return
+	}
+	if phone == "" {
+		return
+	}
+	if err := utils.SendSMS(phone, title+": "+body); err != nil {
+		log.Println("Failed to send doctor sms:", err)
+	}
+}
+
+// notifyPatient sends an in-app notification and an email to the patient
+func notifyPatient(usertag, title, body string) {
+	notify(RecipientUser, usertag, title, body)
+	emailUser(usertag, title, body)
+}
+
+func emailUser(usertag, subject, body string) {
+	email := userEmail(usertag)
+	if email == "" {
+		return
+	}
+	if err := utils.SendEmail(email, subject, body); err != nil {
+		log.Println("Failed to send email:", err)
+	}
+}
+
+func userEmail(usertag string) string {
+	var email string
+	if err := Db.QueryRow(Ctx, `SELECT email FROM users WHERE usertag = $1`, usertag).Scan(&email); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Println("Failed to fetch user email:", err)
+		}
+		return ""
+	}
+	return email
+}
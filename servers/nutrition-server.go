@@ -0,0 +1,269 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"telemed/config"
+	"telemed/growth"
+	"telemed/models"
+	"telemed/nutrition"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type NutritionServer struct{}
+
+// nutritionEngine produces the guidance, any nutrition.Engine can replace the rule engine here
+var nutritionEngine nutrition.Engine = loadNutritionEngine()
+
+func loadNutritionEngine() nutrition.Engine {
+	engine, err := nutrition.LoadRules(config.NutritionRules)
+	if err != nil {
+		log.Fatal("Failed to load nutrition rules: ", err)
+	}
+	return engine
+}
+
+// nutritionGrowthMaxAge is how old the latest growth measurement can be and still shape the guidance
+const nutritionGrowthMaxAge = 180 * 24 * time.Hour
+
+func zScoreOf(score *models.GrowthScore) *float64 {
+	if score == nil {
+		return nil
+	}
+	return score.ZScore
+}
+
+// nutritionProfile gathers what the engine looks at: age, the latest recent growth scores and their flags,
+// and the allergies and conditions active on the health record, which after a handover is the new account's
+func nutritionProfile(dependentID int) (nutrition.Profile, error) {
+	chart, err := growthChart(dependentID)
+	if err != nil {
+		return nutrition.Profile{}, err
+	}
+	p := nutrition.Profile{
+		AgeMonths:   math.Round(time.Since(chart.DateOfBirth).Hours()/24/growth.DaysPerMonth*100) / 100,
+		Sex:         chart.Sex,
+		GrowthFlags: []string{},
+		Allergies:   []string{},
+		Conditions:  []string{},
+	}
+	if n := len(chart.Measurements); n > 0 && time.Since(chart.Measurements[n-1].MeasuredOn) <= nutritionGrowthMaxAge {
+		latest := chart.Measurements[n-1]
+		p.WeightZ, p.HeightZ, p.BMIZ = zScoreOf(latest.Weight), zScoreOf(latest.Height), zScoreOf(latest.BMI)
+		for _, f := range chart.Flags {
+			if f.MeasuredOn.Equal(latest.MeasuredOn) && !slices.Contains(p.GrowthFlags, f.Kind) {
+				p.GrowthFlags = append(p.GrowthFlags, f.Kind)
+			}
+		}
+	}
+
+	rows, err := Db.Query(Ctx,
+		`SELECT category, name FROM health_record_entries
+		 WHERE (dependent_id = $1 OR (dependent_id IS NULL AND usertag = (SELECT transfer_to FROM dependents WHERE dependent_id = $1 AND status = 'transferred')))
+		 AND category IN ('allergy', 'condition') AND status = 'active' ORDER BY entry_id`, dependentID)
+	if err != nil {
+		log.Println("Failed to fetch health record for nutrition:", err)
+		return p, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var category, name string
+		if err := rows.Scan(&category, &name); err != nil {
+			log.Println("Failed to scan health record entry:", err)
+			return p, errors.New(responses.SOMETHING_WRONG)
+		}
+		if category == "allergy" {
+			p.Allergies = append(p.Allergies, name)
+		} else {
+			p.Conditions = append(p.Conditions, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over health record entries:", err)
+		return p, errors.New(responses.SOMETHING_WRONG)
+	}
+	return p, nil
+}
+
+func scanNutritionRecommendation(row pgx.Row) (models.NutritionRecommendation, error) {
+	var r models.NutritionRecommendation
+	var profile, items, overrideItems []byte
+	err := row.Scan(&r.RecommendationID, &r.DependentID, &r.Engine, &r.EngineVersion, &profile, &items, &r.Status, &overrideItems,
+		&r.ReviewNote, &r.ReviewedBy, &r.RequestedByType, &r.RequestedBy, &r.AppointmentID, &r.Created_at, &r.ReviewedAt)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(profile, &r.Profile); err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(items, &r.Items); err != nil {
+		return r, err
+	}
+	if overrideItems != nil {
+		if err := json.Unmarshal(overrideItems, &r.OverrideItems); err != nil {
+			return r, err
+		}
+	}
+	r.Effective = r.Items
+	if r.Status == "overridden" {
+		r.Effective = r.OverrideItems
+	}
+	return r, nil
+}
+
+const nutritionColumns = `recommendation_id, dependent_id, engine, engine_version, profile, items, status, override_items,
+	COALESCE(review_note, ''), COALESCE(reviewed_by, ''), requested_by_type, requested_by, appointment_id, created_at, reviewed_at`
+
+// Generate runs the engine on the dependent's current profile and keeps the result with its inputs
+func (NutritionServer) Generate(actorType, actorTag string, appointmentID *int, dependentID int) (any, error) {
+	profile, err := nutritionProfile(dependentID)
+	if err != nil {
+		return nil, err
+	}
+	items := nutritionEngine.Recommend(profile)
+	profileJSON, _ := json.Marshal(profile)
+	itemsJSON, _ := json.Marshal(items)
+	r, err := scanNutritionRecommendation(Db.QueryRow(Ctx,
+		`INSERT INTO nutrition_recommendations (dependent_id, engine, engine_version, profile, items, requested_by_type, requested_by, appointment_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING `+nutritionColumns,
+		dependentID, nutritionEngine.Name(), nutritionEngine.Version(), profileJSON, itemsJSON, actorType, actorTag, appointmentID))
+	if err != nil {
+		log.Println("Failed to save nutrition recommendation:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return r, nil
+}
+
+// GetHistory lists every set of guidance generated for the dependent, newest first
+func (NutritionServer) GetHistory(dependentID int) (any, error) {
+	history := []models.NutritionRecommendation{}
+	rows, err := Db.Query(Ctx,
+		`SELECT `+nutritionColumns+` FROM nutrition_recommendations WHERE dependent_id = $1 ORDER BY created_at DESC`, dependentID)
+	if err != nil {
+		log.Println("Failed to fetch nutrition recommendations:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r, err := scanNutritionRecommendation(rows)
+		if err != nil {
+			log.Println("Failed to scan nutrition recommendation:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		history = append(history, r)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over nutrition recommendations:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return history, nil
+}
+
+func validateNutritionItems(items []nutrition.Recommendation) ([]nutrition.Recommendation, error) {
+	if len(items) == 0 {
+		return nil, errors.New("an override needs at least one item")
+	}
+	for i := range items {
+		items[i].Title, items[i].Advice = strings.TrimSpace(items[i].Title), strings.TrimSpace(items[i].Advice)
+		if items[i].Title == "" || items[i].Advice == "" {
+			return nil, errors.New("every item needs a title and advice")
+		}
+		if !slices.Contains(nutrition.Categories, items[i].Category) {
+			return nil, fmt.Errorf("category must be one of %s", strings.Join(nutrition.Categories, ", "))
+		}
+		if items[i].Priority == 0 {
+			items[i].Priority = 2
+		}
+		if items[i].Priority < 1 || items[i].Priority > 3 {
+			return nil, errors.New("priority must be 1, 2 or 3")
+		}
+		if items[i].RuleID == "" {
+			items[i].RuleID = "doctor"
+		}
+	}
+	return items, nil
+}
+
+// Review lets the doctor seeing the dependent approve the generated guidance or replace it with their own
+func (NutritionServer) Review(doctortag string, appointmentID, recommendationID int, data models.NutritionReviewReq) (any, error) {
+	dependentID, err := doctorDependentSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	var status string
+	var overrideJSON []byte
+	switch data.Action {
+	case "approve":
+		status = "approved"
+	case "override":
+		status = "overridden"
+		items, err := validateNutritionItems(data.Items)
+		if err != nil {
+			return nil, err
+		}
+		overrideJSON, _ = json.Marshal(items)
+	default:
+		return nil, errors.New("action must be approve or override")
+	}
+	r, err := scanNutritionRecommendation(Db.QueryRow(Ctx,
+		`UPDATE nutrition_recommendations SET status = $1, override_items = $2, review_note = NULLIF($3, ''), reviewed_by = $4, reviewed_at = NOW()
+		 WHERE recommendation_id = $5 AND dependent_id = $6 AND status = 'pending_review' RETURNING `+nutritionColumns,
+		status, overrideJSON, strings.TrimSpace(data.Note), doctortag, recommendationID, dependentID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("recommendation not found or already reviewed")
+		}
+		log.Println("Failed to review nutrition recommendation:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	var guardianTag, name string
+	err = Db.QueryRow(Ctx,
+		`SELECT CASE WHEN status = 'transferred' THEN transfer_to ELSE guardian_tag END, firstname FROM dependents WHERE dependent_id = $1`,
+		dependentID).Scan(&guardianTag, &name)
+	if err != nil {
+		log.Println("Failed to fetch guardian for nutrition review:", err)
+	} else {
+		notifyPatient(guardianTag, "Nutrition guidance reviewed",
+			fmt.Sprintf("A doctor has reviewed the nutrition guidance for %s. Open the app to see the advice to follow.", name))
+	}
+	return r, nil
+}
+
+func (s NutritionServer) GenerateForGuardian(usertag string, dependentID int) (any, error) {
+	if err := checkDependentRecords(Db, usertag, dependentID); err != nil {
+		return nil, err
+	}
+	return s.Generate(ActorPatient, usertag, nil, dependentID)
+}
+
+func (s NutritionServer) GetGuardianHistory(usertag string, dependentID int) (any, error) {
+	if err := checkDependentRecords(Db, usertag, dependentID); err != nil {
+		return nil, err
+	}
+	return s.GetHistory(dependentID)
+}
+
+func (s NutritionServer) GenerateForDoctor(doctortag string, appointmentID int) (any, error) {
+	dependentID, err := doctorDependentSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Generate(ActorDoctor, doctortag, &appointmentID, dependentID)
+}
+
+func (s NutritionServer) GetDoctorHistory(doctortag string, appointmentID int) (any, error) {
+	dependentID, err := doctorDependentSubject(doctortag, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetHistory(dependentID)
+}
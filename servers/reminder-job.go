@@ -0,0 +1,226 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"telemed/config"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// reminderLeads parses REMINDER_LEAD_MINUTES, anything that is not a positive number is ignored
+func reminderLeads() []int {
+	var leads []int
+	for _, part := range strings.Split(config.ReminderLeadMinutes, ",") {
+		minutes, err := strconv.Atoi(strings.TrimSpace(part))
+		if err == nil && minutes > 0 {
+			leads = append(leads, minutes)
+		}
+	}
+	return leads
+}
+
+// syncReminders drops the appointment's unsent reminders and, if it is confirmed, plans new ones from its
+// current time. Call it in the same transaction as any change to the status or time
+func syncReminders(tx pgx.Tx, appointmentID int) error {
+	_, err := tx.Exec(Ctx, `UPDATE appointment_reminders SET status = 'cancelled' WHERE appointment_id = $1 AND status = 'pending'`, appointmentID)
+	if err != nil {
+		log.Println("Failed to cancel reminders:", err)
+		return errors.New("failed to update reminders")
+	}
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO appointment_reminders (appointment_id, recipient_type, recipient_tag, lead_minutes, send_at)
+		 SELECT a.appointment_id, r.recipient_type, CASE r.recipient_type WHEN 'user' THEN a.patient_tag ELSE a.doctor_tag END,
+		 l.minutes, a.scheduled_at - make_interval(mins => l.minutes)
+		 FROM appointments a
+		 CROSS JOIN unnest($2::INTEGER[]) AS l(minutes)
+		 CROSS JOIN (VALUES ('user'), ('doctor')) AS r(recipient_type)
+		 WHERE a.appointment_id = $1 AND a.status = 'confirmed' AND a.scheduled_at - make_interval(mins => l.minutes) > NOW()`,
+		appointmentID, reminderLeads())
+	if err != nil {
+		log.Println("Failed to schedule reminders:", err)
+		return errors.New("failed to update reminders")
+	}
+	return nil
+}
+
+// StartReminderJob plans reminders for confirmed appointments that have none yet, then sends due reminders of
+// every kind on every tick. Reminders are rows, so a restart only delays them
+func StartReminderJob() {
+	if err := backfillReminders(); err != nil {
+		log.Println("Failed to backfill reminders:", err)
+	}
+	ticker := time.NewTicker(time.Duration(config.ReminderIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		sent, err := SendDueReminders()
+		if err != nil {
+			log.Println("Reminder job failed:", err)
+		} else if sent > 0 {
+			log.Println("Reminder job sent", sent, "reminders")
+		}
+		<-ticker.C
+	}
+}
+
+func backfillReminders() error {
+	rows, err := Db.Query(Ctx,
+		`SELECT appointment_id FROM appointments a WHERE status = 'confirmed' AND scheduled_at > NOW()
+		 AND NOT EXISTS (SELECT 1 FROM appointment_reminders r WHERE r.appointment_id = a.appointment_id)`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+		if err != nil {
+			return err
+		}
+		if err := syncReminders(tx, id); err != nil {
+			tx.Rollback(Ctx)
+			return err
+		}
+		if err := tx.Commit(Ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendDueReminders sends reminders whose time has come one at a time, locking each row so several instances
+// can run the job without sending twice
+func SendDueReminders() (int, error) {
+	sent := 0
+	for i := 0; i < 100; i++ {
+		done, err := sendNextReminder()
+		if err != nil {
+			return sent, err
+		}
+		if !done {
+			break
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// dueReminder is a pending reminder row the sender has locked
+type dueReminder struct {
+	reminderID    int
+	kind          string
+	appointmentID *int
+	dependentID   *int
+	recipientType string
+	recipientTag  string
+}
+
+func sendNextReminder() (bool, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(Ctx)
+
+	var r dueReminder
+	err = tx.QueryRow(Ctx,
+		`SELECT reminder_id, kind, appointment_id, dependent_id, recipient_type, recipient_tag FROM appointment_reminders
+		 WHERE status = 'pending' AND send_at <= NOW()
+		 ORDER BY send_at ASC LIMIT 1 FOR UPDATE SKIP LOCKED`).
+		Scan(&r.reminderID, &r.kind, &r.appointmentID, &r.dependentID, &r.recipientType, &r.recipientTag)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// each kind marks its rows sent or skipped and hands back the notification to send once that is committed
+	var notify func()
+	if r.kind == "appointment" {
+		notify, err = appointmentReminder(tx, r)
+	} else {
+		notify, err = vaccineReminder(tx, r)
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		return false, err
+	}
+	if notify != nil {
+		notify()
+	}
+	return true, nil
+}
+
+func appointmentReminder(tx pgx.Tx, r dueReminder) (func(), error) {
+	var status, patientName, doctorName string
+	var scheduledAt time.Time
+	err := tx.QueryRow(Ctx,
+		`SELECT a.status, a.scheduled_at, CONCAT(u.firstname, ' ', u.lastname), COALESCE(d.fullname, '')
+		 FROM appointments a
+		 JOIN users u ON a.patient_tag = u.usertag
+		 JOIN doctors d ON a.doctor_tag = d.doctortag
+		 WHERE a.appointment_id = $1`, r.appointmentID).
+		Scan(&status, &scheduledAt, &patientName, &doctorName)
+	if err != nil {
+		return nil, err
+	}
+
+	// a reminder held up past the start of the appointment, or for one that changed, is no longer useful
+	outcome := "sent"
+	if status != "confirmed" || !scheduledAt.After(time.Now()) {
+		outcome = "skipped"
+	}
+	if _, err := tx.Exec(Ctx, `UPDATE appointment_reminders SET status = $1, sent_at = NOW() WHERE reminder_id = $2`, outcome, r.reminderID); err != nil {
+		return nil, err
+	}
+	if outcome != "sent" {
+		return nil, nil
+	}
+
+	return func() {
+		until := reminderLead(time.Until(scheduledAt))
+		if r.recipientType == RecipientDoctor {
+			at := scheduledAt.In(doctorLocation(Db, r.recipientTag)).Format("Mon 2 Jan 15:04 MST")
+			notifyDoctor(r.recipientTag, "Upcoming consultation",
+				fmt.Sprintf("Your consultation with %s starts in %s (%s).", patientName, until, at))
+		} else {
+			at := scheduledAt.In(userLocation(Db, r.recipientTag)).Format("Mon 2 Jan 15:04 MST")
+			notifyPatient(r.recipientTag, "Upcoming consultation",
+				fmt.Sprintf("Your consultation with %s starts in %s (%s). You can join from the app a few minutes before.", doctorName, until, at))
+		}
+	}, nil
+}
+
+// reminderLead words the time left, rounded to what a person would say
+func reminderLead(d time.Duration) string {
+	switch {
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Round(time.Hour).Hours()))
+	case d >= 90*time.Minute:
+		return "2 hours"
+	case d >= 55*time.Minute:
+		return "1 hour"
+	case d >= 2*time.Minute:
+		return fmt.Sprintf("%d minutes", int(d.Round(time.Minute).Minutes()))
+	default:
+		return "a minute"
+	}
+}
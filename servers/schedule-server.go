@@ -0,0 +1,634 @@
+package servers
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type ScheduleServer struct{}
+
+// ErrSlotTaken is returned by reserveSlot when the time is outside the schedule or already taken
+var ErrSlotTaken = errors.New("time slot not available")
+
+// clockOn places an "HH:MM" clock time on the given day
+func clockOn(day time.Time, clock string, loc *time.Location) (time.Time, bool) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, loc), true
+}
+
+func overlaps(start, end, otherStart, otherEnd time.Time) bool {
+	return start.Before(otherEnd) && otherStart.Before(end)
+}
+
+// generateSlots expands a doctor's weekly hours, overrides, breaks and time off into bookable slots
+// starting in [from, to). Days are walked in the doctor's zone and each window is built from its wall clock
+// times, so a 09:00 start stays 09:00 local across DST changes even though its UTC offset moves
+func generateSlots(schedule models.DoctorSchedule, from, to time.Time, loc *time.Location) []models.Slot {
+	var slots []models.Slot
+	duration := time.Duration(schedule.SlotDurationMinutes) * time.Minute
+	if duration <= 0 {
+		return slots
+	}
+	overrides := make(map[string]models.ScheduleOverride)
+	for _, override := range schedule.Overrides {
+		overrides[override.Date] = override
+	}
+
+	local := from.In(loc)
+	for day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		var windows, breaks []models.WorkingHours
+		if override, ok := overrides[day.Format("2006-01-02")]; ok {
+			if override.StartTime != "" {
+				windows = append(windows, models.WorkingHours{StartTime: override.StartTime, EndTime: override.EndTime})
+			}
+		} else {
+			for _, hours := range schedule.WorkingHours {
+				if hours.DayOfWeek == int(day.Weekday()) {
+					windows = append(windows, hours)
+				}
+			}
+			for _, b := range schedule.Breaks {
+				if b.DayOfWeek == int(day.Weekday()) {
+					breaks = append(breaks, b)
+				}
+			}
+		}
+
+		for _, window := range windows {
+			windowStart, ok := clockOn(day, window.StartTime, loc)
+			if !ok {
+				continue
+			}
+			windowEnd, ok := clockOn(day, window.EndTime, loc)
+			if !ok {
+				continue
+			}
+		slotLoop:
+			for start := windowStart; !start.Add(duration).After(windowEnd); start = start.Add(duration) {
+				end := start.Add(duration)
+				if start.Before(from) || !start.Before(to) {
+					continue
+				}
+				for _, b := range breaks {
+					breakStart, ok1 := clockOn(day, b.StartTime, loc)
+					breakEnd, ok2 := clockOn(day, b.EndTime, loc)
+					if ok1 && ok2 && overlaps(start, end, breakStart, breakEnd) {
+						continue slotLoop
+					}
+				}
+				for _, off := range schedule.TimeOff {
+					if overlaps(start, end, off.StartsAt, off.EndsAt) {
+						continue slotLoop
+					}
+				}
+				slots = append(slots, models.Slot{StartsAt: start, EndsAt: end})
+			}
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].StartsAt.Before(slots[j].StartsAt) })
+	return slots
+}
+
+// scanWindows reads doctortag, day_of_week, start and end rows into each doctor's schedule
+func scanWindows(q querier, query string, doctortags []string, into func(*models.DoctorSchedule) *[]models.WorkingHours, schedules map[string]*models.DoctorSchedule) error {
+	rows, err := q.Query(Ctx, query, doctortags)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var doctortag string
+		var window models.WorkingHours
+		if err := rows.Scan(&doctortag, &window.DayOfWeek, &window.StartTime, &window.EndTime); err != nil {
+			return err
+		}
+		windows := into(schedules[doctortag])
+		*windows = append(*windows, window)
+	}
+	return rows.Err()
+}
+
+// loadSchedule reads everything needed to generate a doctor's slots
+func loadSchedule(q querier, doctortag string) (models.DoctorSchedule, error) {
+	schedules, err := loadSchedules(q, []string{doctortag})
+	if err != nil {
+		return models.DoctorSchedule{Doctortag: doctortag}, err
+	}
+	schedule, ok := schedules[doctortag]
+	if !ok {
+		return models.DoctorSchedule{Doctortag: doctortag}, errors.New("doctor not found")
+	}
+	return *schedule, nil
+}
+
+// loadSchedules reads the schedules of several doctors with one query per table, doctors that don't exist are
+// left out of the map
+func loadSchedules(q querier, doctortags []string) (map[string]*models.DoctorSchedule, error) {
+	schedules := make(map[string]*models.DoctorSchedule, len(doctortags))
+	rows, err := q.Query(Ctx,
+		`SELECT d.doctortag, COALESCE(d.slot_duration_minutes, 30), COALESCE(d.time_zone, h.time_zone, '')
+		 FROM doctors d LEFT JOIN hospitals h ON h.hospital_id = d.hospital_id WHERE d.doctortag = ANY($1)`, doctortags)
+	if err != nil {
+		log.Println("Failed to fetch doctor slot duration:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	for rows.Next() {
+		schedule := &models.DoctorSchedule{}
+		if err := rows.Scan(&schedule.Doctortag, &schedule.SlotDurationMinutes, &schedule.TimeZone); err != nil {
+			rows.Close()
+			log.Println("Failed to scan doctor slot duration:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		schedules[schedule.Doctortag] = schedule
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over doctors:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if len(schedules) == 0 {
+		return schedules, nil
+	}
+
+	err = scanWindows(q,
+		`SELECT doctortag, day_of_week, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI') FROM doctor_working_hours
+		 WHERE doctortag = ANY($1) ORDER BY doctortag, day_of_week, start_time`, doctortags,
+		func(schedule *models.DoctorSchedule) *[]models.WorkingHours { return &schedule.WorkingHours }, schedules)
+	if err != nil {
+		log.Println("Failed to fetch doctor working hours:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	err = scanWindows(q,
+		`SELECT doctortag, day_of_week, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI') FROM doctor_breaks
+		 WHERE doctortag = ANY($1) ORDER BY doctortag, day_of_week, start_time`, doctortags,
+		func(schedule *models.DoctorSchedule) *[]models.WorkingHours { return &schedule.Breaks }, schedules)
+	if err != nil {
+		log.Println("Failed to fetch doctor breaks:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	rows, err = q.Query(Ctx,
+		`SELECT doctortag, override_id, to_char(override_date, 'YYYY-MM-DD'), COALESCE(to_char(start_time, 'HH24:MI'), ''), COALESCE(to_char(end_time, 'HH24:MI'), '')
+		 FROM doctor_schedule_overrides WHERE doctortag = ANY($1) AND override_date >= CURRENT_DATE - 1 ORDER BY doctortag, override_date`, doctortags)
+	if err != nil {
+		log.Println("Failed to fetch schedule overrides:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	for rows.Next() {
+		var override models.ScheduleOverride
+		if err := rows.Scan(&override.Doctortag, &override.OverrideID, &override.Date, &override.StartTime, &override.EndTime); err != nil {
+			rows.Close()
+			log.Println("Failed to scan schedule override:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		schedule := schedules[override.Doctortag]
+		schedule.Overrides = append(schedule.Overrides, override)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over schedule overrides:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	rows, err = q.Query(Ctx,
+		`SELECT doctortag, time_off_id, starts_at, ends_at, COALESCE(reason, '') FROM doctor_time_off
+		 WHERE doctortag = ANY($1) AND ends_at > NOW() ORDER BY doctortag, starts_at`, doctortags)
+	if err != nil {
+		log.Println("Failed to fetch doctor time off:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var off models.TimeOff
+		if err := rows.Scan(&off.Doctortag, &off.TimeOffID, &off.StartsAt, &off.EndsAt, &off.Reason); err != nil {
+			log.Println("Failed to scan doctor time off:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		schedule := schedules[off.Doctortag]
+		schedule.TimeOff = append(schedule.TimeOff, off)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over doctor time off:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	for _, schedule := range schedules {
+		loc := loadLocation(schedule.TimeZone)
+		schedule.TimeZone = loc.String()
+		for i := range schedule.TimeOff {
+			schedule.TimeOff[i].StartsAt = schedule.TimeOff[i].StartsAt.In(loc)
+			schedule.TimeOff[i].EndsAt = schedule.TimeOff[i].EndsAt.In(loc)
+		}
+	}
+	return schedules, nil
+}
+
+// takenSlots reads the booked and live held slots of several doctors between from and to
+func takenSlots(q querier, doctortags []string, from, to time.Time) (map[string][]models.Slot, error) {
+	taken := make(map[string][]models.Slot)
+	rows, err := q.Query(Ctx,
+		`SELECT doctortag, starts_at, ends_at FROM appointment_slots WHERE doctortag = ANY($1) AND ends_at > $2 AND starts_at < $3
+		 AND (status = 'booked' OR (status = 'held' AND held_until > NOW()))`,
+		doctortags, from, to)
+	if err != nil {
+		log.Println("Failed to fetch booked slots:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var doctortag string
+		var slot models.Slot
+		if err := rows.Scan(&doctortag, &slot.StartsAt, &slot.EndsAt); err != nil {
+			log.Println("Failed to scan booked slot:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		taken[doctortag] = append(taken[doctortag], slot)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over booked slots:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return taken, nil
+}
+
+// freeSlots is the generated schedule minus slots overlapping taken ones. Taken slots may have been cut from an
+// older schedule, so anything overlapping them is unavailable too
+func freeSlots(schedule models.DoctorSchedule, taken []models.Slot, from, to time.Time) []models.Slot {
+	var open []models.Slot
+	for _, slot := range generateSlots(schedule, from, to, loadLocation(schedule.TimeZone)) {
+		free := true
+		for _, t := range taken {
+			if slot.StartsAt.Before(t.EndsAt) && t.StartsAt.Before(slot.EndsAt) {
+				free = false
+				break
+			}
+		}
+		if free {
+			open = append(open, slot)
+		}
+	}
+	return open
+}
+
+// openSlots is the generated schedule minus slots that are already reserved or in the past
+func openSlots(q querier, doctortag string, from, to time.Time) ([]models.Slot, error) {
+	schedule, err := loadSchedule(q, doctortag)
+	if err != nil {
+		return nil, err
+	}
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+	taken, err := takenSlots(q, []string{doctortag}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return freeSlots(schedule, taken[doctortag], from, to), nil
+}
+
+// slotOverlapsTaken locks the doctor's slots against concurrent reservations and reports whether the slot
+// overlaps one already booked or held at a different start time, which the unique key cannot see. Slots the
+// appointment itself holds do not count, a proposed time may overlap the one it replaces
+func slotOverlapsTaken(tx pgx.Tx, doctortag string, slot models.Slot, appointmentID int) (bool, error) {
+	_, err := tx.Exec(Ctx, `SELECT doctortag FROM doctors WHERE doctortag = $1 FOR NO KEY UPDATE`, doctortag)
+	if err != nil {
+		log.Println("Failed to lock doctor for slot reservation:", err)
+		return false, errors.New(responses.SOMETHING_WRONG)
+	}
+	var overlaps bool
+	err = tx.QueryRow(Ctx,
+		`SELECT EXISTS (SELECT 1 FROM appointment_slots WHERE doctortag = $1 AND starts_at < $3 AND ends_at > $2 AND starts_at <> $2
+		 AND appointment_id IS DISTINCT FROM $4 AND (status = 'booked' OR (status = 'held' AND held_until > NOW())))`,
+		doctortag, slot.StartsAt, slot.EndsAt, appointmentID).Scan(&overlaps)
+	if err != nil {
+		log.Println("Failed to check overlapping slots:", err)
+		return false, errors.New(responses.SOMETHING_WRONG)
+	}
+	return overlaps, nil
+}
+
+// reserveSlot books the slot starting at startsAt for an appointment; the unique (doctortag, starts_at)
+// key makes concurrent bookings of the same slot fail instead of double booking, and slots overlapping it at
+// other start times are checked under the doctor lock. A slot held for the waitlist
+// only becomes bookable again once the hold runs out
+func reserveSlot(tx pgx.Tx, doctortag string, startsAt time.Time, appointmentID int) error {
+	schedule, err := loadSchedule(tx, doctortag)
+	if err != nil {
+		return err
+	}
+	slots := generateSlots(schedule, startsAt, startsAt.Add(time.Minute), loadLocation(schedule.TimeZone))
+	if len(slots) == 0 || !slots[0].StartsAt.Equal(startsAt) {
+		return ErrSlotTaken
+	}
+	overlaps, err := slotOverlapsTaken(tx, doctortag, slots[0], appointmentID)
+	if err != nil {
+		return err
+	}
+	if overlaps {
+		return ErrSlotTaken
+	}
+
+	var slotID int
+	err = tx.QueryRow(Ctx,
+		`INSERT INTO appointment_slots (doctortag, starts_at, ends_at, status, appointment_id)
+		 VALUES ($1, $2, $3, 'booked', $4)
+		 ON CONFLICT (doctortag, starts_at) DO UPDATE SET status = 'booked', appointment_id = EXCLUDED.appointment_id,
+		 held_until = NULL, waitlist_entry_id = NULL, updated_at = NOW()
+		 WHERE appointment_slots.status = 'open' OR (appointment_slots.status = 'held' AND appointment_slots.held_until <= NOW())
+		 RETURNING slot_id`,
+		doctortag, slots[0].StartsAt, slots[0].EndsAt, appointmentID).Scan(&slotID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSlotTaken
+		}
+		log.Println("Failed to reserve appointment slot:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	return nil
+}
+
+// releaseSlot reopens whatever slot an appointment was holding
+func releaseSlot(tx pgx.Tx, appointmentID int) error {
+	_, err := tx.Exec(Ctx,
+		`UPDATE appointment_slots SET status = 'open', appointment_id = NULL, updated_at = NOW() WHERE appointment_id = $1`, appointmentID)
+	if err != nil {
+		log.Println("Failed to release appointment slot:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	return nil
+}
+
+// releaseSlotAt reopens one of the slots an appointment holds, used when a proposed time replaces the booked one
+func releaseSlotAt(tx pgx.Tx, appointmentID int, startsAt time.Time) error {
+	_, err := tx.Exec(Ctx,
+		`UPDATE appointment_slots SET status = 'open', appointment_id = NULL, updated_at = NOW() WHERE appointment_id = $1 AND starts_at = $2`,
+		appointmentID, startsAt)
+	if err != nil {
+		log.Println("Failed to release appointment slot:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	return nil
+}
+
+func (ScheduleServer) GetSchedule(doctortag string) (any, error) {
+	return loadSchedule(Db, doctortag)
+}
+
+// UpdateSchedule replaces a doctor's weekly hours and breaks; slots that are already booked are kept
+func (ScheduleServer) UpdateSchedule(data models.UpdateScheduleReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	tag, err := tx.Exec(Ctx,
+		`UPDATE doctors SET slot_duration_minutes = $1, time_zone = COALESCE(NULLIF($2, ''), time_zone) WHERE doctortag = $3`,
+		data.SlotDurationMinutes, data.TimeZone, data.Doctortag)
+	if err != nil {
+		log.Println("Failed to update slot duration:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("doctor not found")
+	}
+	if _, err := tx.Exec(Ctx, `DELETE FROM doctor_working_hours WHERE doctortag = $1`, data.Doctortag); err != nil {
+		log.Println("Failed to clear working hours:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if _, err := tx.Exec(Ctx, `DELETE FROM doctor_breaks WHERE doctortag = $1`, data.Doctortag); err != nil {
+		log.Println("Failed to clear breaks:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	for _, hours := range data.WorkingHours {
+		_, err = tx.Exec(Ctx,
+			`INSERT INTO doctor_working_hours (doctortag, day_of_week, start_time, end_time) VALUES ($1, $2, $3::time, $4::time)`,
+			data.Doctortag, hours.DayOfWeek, hours.StartTime, hours.EndTime)
+		if err != nil {
+			log.Println("Failed to insert working hours:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	for _, b := range data.Breaks {
+		_, err = tx.Exec(Ctx,
+			`INSERT INTO doctor_breaks (doctortag, day_of_week, start_time, end_time) VALUES ($1, $2, $3::time, $4::time)`,
+			data.Doctortag, b.DayOfWeek, b.StartTime, b.EndTime)
+		if err != nil {
+			log.Println("Failed to insert break:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing schedule update:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	wakeWaitlist()
+	return map[string]string{"message": "Schedule updated successfully"}, nil
+}
+
+func (ScheduleServer) AddOverride(data models.ScheduleOverride) (any, error) {
+	var start, end *string
+	if data.StartTime != "" {
+		start, end = &data.StartTime, &data.EndTime
+	}
+	var overrideID int
+	err := Db.QueryRow(Ctx,
+		`INSERT INTO doctor_schedule_overrides (doctortag, override_date, start_time, end_time)
+		 VALUES ($1, $2::date, $3::time, $4::time) RETURNING override_id`,
+		data.Doctortag, data.Date, start, end).Scan(&overrideID)
+	if err != nil {
+		log.Println("Failed to add schedule override:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	wakeWaitlist()
+	return map[string]interface{}{"message": "Override added successfully", "override_id": overrideID}, nil
+}
+
+func (ScheduleServer) DeleteOverride(doctortag, overrideID string) (any, error) {
+	tag, err := Db.Exec(Ctx, `DELETE FROM doctor_schedule_overrides WHERE override_id = $1 AND doctortag = $2`, overrideID, doctortag)
+	if err != nil {
+		log.Println("Failed to delete schedule override:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("override not found")
+	}
+	wakeWaitlist()
+	return map[string]string{"message": "Override deleted successfully"}, nil
+}
+
+// AddTimeOff blocks a period and reports how many booked appointments fall inside it
+func (ScheduleServer) AddTimeOff(data models.TimeOff) (any, error) {
+	var timeOffID, affected int
+	err := Db.QueryRow(Ctx,
+		`INSERT INTO doctor_time_off (doctortag, starts_at, ends_at, reason) VALUES ($1, $2, $3, $4) RETURNING time_off_id`,
+		data.Doctortag, data.StartsAt, data.EndsAt, data.Reason).Scan(&timeOffID)
+	if err != nil {
+		log.Println("Failed to add doctor time off:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	err = Db.QueryRow(Ctx,
+		`SELECT COUNT(*) FROM appointment_slots WHERE doctortag = $1 AND status = 'booked' AND starts_at < $3 AND ends_at > $2`,
+		data.Doctortag, data.StartsAt, data.EndsAt).Scan(&affected)
+	if err != nil {
+		log.Println("Failed to count appointments during time off:", err)
+	}
+	return map[string]interface{}{
+		"message":               "Time off added successfully",
+		"time_off_id":           timeOffID,
+		"affected_appointments": affected,
+	}, nil
+}
+
+func (ScheduleServer) DeleteTimeOff(doctortag, timeOffID string) (any, error) {
+	tag, err := Db.Exec(Ctx, `DELETE FROM doctor_time_off WHERE time_off_id = $1 AND doctortag = $2`, timeOffID, doctortag)
+	if err != nil {
+		log.Println("Failed to delete doctor time off:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, errors.New("time off not found")
+	}
+	wakeWaitlist()
+	return map[string]string{"message": "Time off deleted successfully"}, nil
+}
+
+// parseRangeBound accepts an RFC3339 time or a plain date, which is read as midnight in the viewer's zone
+func parseRangeBound(value string, fallback time.Time, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return t, errors.New("dates must be YYYY-MM-DD or RFC3339")
+	}
+	return t, nil
+}
+
+// GetOpenSlots lists a doctor's bookable slots between from and to, shown in the patient's zone
+func (ScheduleServer) GetOpenSlots(data models.SlotsReq) (any, error) {
+	loc := userLocation(Db, data.Usertag)
+	from, err := parseRangeBound(data.From, time.Now(), loc)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseRangeBound(data.To, from.AddDate(0, 0, 7), loc)
+	if err != nil {
+		return nil, err
+	}
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	if to.Sub(from) > 31*24*time.Hour {
+		return nil, errors.New("you can only fetch up to 31 days of slots at a time")
+	}
+
+	slots, err := openSlots(Db, data.Doctortag, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for i := range slots {
+		slots[i].StartsAt = slots[i].StartsAt.In(loc)
+		slots[i].EndsAt = slots[i].EndsAt.In(loc)
+	}
+	return map[string]interface{}{
+		"doctortag": data.Doctortag,
+		"time_zone": loc.String(),
+		"slots":     slots,
+	}, nil
+}
+
+// escapeLike makes % and _ in user input match literally in a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// FirstAvailable finds the doctors in a specialization, optionally in a state, ordered by their earliest open slot
+// in the next two weeks. Every matching doctor is ranked, their schedules and taken slots are loaded in one go
+func (ScheduleServer) FirstAvailable(data models.FirstAvailableReq) (any, error) {
+	loc := userLocation(Db, data.Usertag)
+	from, err := parseRangeBound(data.From, time.Now(), loc)
+	if err != nil {
+		return nil, err
+	}
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+	to := from.AddDate(0, 0, 14)
+
+	args := []any{"%" + escapeLike(data.Specialization) + "%"}
+	sqlStatement := `SELECT d.doctortag, COALESCE(d.fullname, ''), COALESCE(d.specialization, ''), COALESCE(d.price_per_session, 0),
+		COALESCE(h.name, ''), COALESCE(h.state, ''), COALESCE(d.profile_pic_url, '')
+		FROM doctors d LEFT JOIN hospitals h ON h.hospital_id = d.hospital_id
+		WHERE d.specialization ILIKE $1`
+	if data.State != "" {
+		sqlStatement += ` AND h.state ILIKE $2`
+		args = append(args, escapeLike(data.State))
+	}
+
+	rows, err := Db.Query(Ctx, sqlStatement, args...)
+	if err != nil {
+		log.Println("Failed to search doctors:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	var candidates []models.AvailableDoctor
+	var doctortags []string
+	for rows.Next() {
+		var doctor models.AvailableDoctor
+		if err := rows.Scan(&doctor.Doctortag, &doctor.Fullname, &doctor.Specialization, &doctor.Price, &doctor.Hospital,
+			&doctor.State, &doctor.ProfilePicURL); err != nil {
+			rows.Close()
+			log.Println("Failed to scan doctor:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		candidates = append(candidates, doctor)
+		doctortags = append(doctortags, doctor.Doctortag)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over doctors:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	schedules, err := loadSchedules(Db, doctortags)
+	if err != nil {
+		return nil, err
+	}
+	taken, err := takenSlots(Db, doctortags, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var available []models.AvailableDoctor
+	for _, doctor := range candidates {
+		schedule, ok := schedules[doctor.Doctortag]
+		if !ok {
+			continue
+		}
+		slots := freeSlots(*schedule, taken[doctor.Doctortag], from, to)
+		if len(slots) == 0 {
+			continue
+		}
+		doctor.NextSlot = models.Slot{StartsAt: slots[0].StartsAt.In(loc), EndsAt: slots[0].EndsAt.In(loc)}
+		available = append(available, doctor)
+	}
+	sort.Slice(available, func(i, j int) bool { return available[i].NextSlot.StartsAt.Before(available[j].NextSlot.StartsAt) })
+	if len(available) > data.Limit {
+		available = available[:data.Limit]
+	}
+	return available, nil
+}
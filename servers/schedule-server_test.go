@@ -0,0 +1,233 @@
+package servers
+
+import (
+	"telemed/models"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestClockOn(t *testing.T) {
+	lagos := mustLocation(t, "Africa/Lagos")
+	newYork := mustLocation(t, "America/New_York")
+	tests := []struct {
+		name  string
+		day   time.Time
+		clock string
+		loc   *time.Location
+		want  string
+		ok    bool
+	}{
+		{"lagos morning", time.Date(2026, 5, 4, 0, 0, 0, 0, lagos), "09:30", lagos, "2026-05-04T08:30:00Z", true},
+		{"new york before spring forward", time.Date(2026, 3, 7, 0, 0, 0, 0, newYork), "09:00", newYork, "2026-03-07T14:00:00Z", true},
+		{"new york after spring forward", time.Date(2026, 3, 8, 0, 0, 0, 0, newYork), "09:00", newYork, "2026-03-08T13:00:00Z", true},
+		{"new york after fall back", time.Date(2026, 11, 1, 0, 0, 0, 0, newYork), "09:00", newYork, "2026-11-01T14:00:00Z", true},
+		{"midnight", time.Date(2026, 5, 4, 0, 0, 0, 0, lagos), "00:00", lagos, "2026-05-03T23:00:00Z", true},
+		{"not a clock", time.Date(2026, 5, 4, 0, 0, 0, 0, lagos), "9am", lagos, "", false},
+		{"out of range", time.Date(2026, 5, 4, 0, 0, 0, 0, lagos), "25:00", lagos, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := clockOn(tt.day, tt.clock, tt.loc)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got.UTC().Format(time.RFC3339) != tt.want {
+				t.Errorf("clockOn = %s, want %s", got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSlots(t *testing.T) {
+	lagos := mustLocation(t, "Africa/Lagos")
+	newYork := mustLocation(t, "America/New_York")
+	weekly := func(minutes int, hours ...models.WorkingHours) models.DoctorSchedule {
+		return models.DoctorSchedule{SlotDurationMinutes: minutes, WorkingHours: hours}
+	}
+	monday := models.WorkingHours{DayOfWeek: int(time.Monday), StartTime: "09:00", EndTime: "12:00"}
+	withBreak := weekly(60, monday)
+	withBreak.Breaks = []models.WorkingHours{{DayOfWeek: int(time.Monday), StartTime: "10:00", EndTime: "11:00"}}
+	overridden := withBreak
+	overridden.Overrides = []models.ScheduleOverride{{Date: "2026-05-04", StartTime: "14:00", EndTime: "15:30"}}
+	dayOff := withBreak
+	dayOff.Overrides = []models.ScheduleOverride{{Date: "2026-05-04"}}
+	timeOff := weekly(60, monday)
+	timeOff.TimeOff = []models.TimeOff{{StartsAt: time.Date(2026, 5, 4, 8, 30, 0, 0, time.UTC), EndsAt: time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)}}
+
+	tests := []struct {
+		name     string
+		schedule models.DoctorSchedule
+		from     time.Time
+		to       time.Time
+		loc      *time.Location
+		want     []string
+	}{
+		{
+			name: "spring forward keeps local hours",
+			schedule: weekly(60,
+				models.WorkingHours{DayOfWeek: int(time.Saturday), StartTime: "09:00", EndTime: "11:00"},
+				models.WorkingHours{DayOfWeek: int(time.Sunday), StartTime: "09:00", EndTime: "11:00"}),
+			from: time.Date(2026, 3, 7, 0, 0, 0, 0, newYork),
+			to:   time.Date(2026, 3, 9, 0, 0, 0, 0, newYork),
+			loc:  newYork,
+			want: []string{"2026-03-07T14:00:00Z", "2026-03-07T15:00:00Z", "2026-03-08T13:00:00Z", "2026-03-08T14:00:00Z"},
+		},
+		{
+			name:     "spring forward night loses an hour",
+			schedule: weekly(60, models.WorkingHours{DayOfWeek: int(time.Sunday), StartTime: "00:00", EndTime: "04:00"}),
+			from:     time.Date(2026, 3, 8, 0, 0, 0, 0, newYork),
+			to:       time.Date(2026, 3, 9, 0, 0, 0, 0, newYork),
+			loc:      newYork,
+			want:     []string{"2026-03-08T05:00:00Z", "2026-03-08T06:00:00Z", "2026-03-08T07:00:00Z"},
+		},
+		{
+			name:     "fall back night gains an hour",
+			schedule: weekly(60, models.WorkingHours{DayOfWeek: int(time.Sunday), StartTime: "00:00", EndTime: "04:00"}),
+			from:     time.Date(2026, 11, 1, 0, 0, 0, 0, newYork),
+			to:       time.Date(2026, 11, 2, 0, 0, 0, 0, newYork),
+			loc:      newYork,
+			want:     []string{"2026-11-01T04:00:00Z", "2026-11-01T05:00:00Z", "2026-11-01T06:00:00Z", "2026-11-01T07:00:00Z", "2026-11-01T08:00:00Z"},
+		},
+		{
+			name: "fall back keeps local hours",
+			schedule: weekly(60,
+				models.WorkingHours{DayOfWeek: int(time.Saturday), StartTime: "09:00", EndTime: "10:00"},
+				models.WorkingHours{DayOfWeek: int(time.Sunday), StartTime: "09:00", EndTime: "10:00"}),
+			from: time.Date(2026, 10, 31, 0, 0, 0, 0, newYork),
+			to:   time.Date(2026, 11, 2, 0, 0, 0, 0, newYork),
+			loc:  newYork,
+			want: []string{"2026-10-31T13:00:00Z", "2026-11-01T14:00:00Z"},
+		},
+		{
+			name:     "break in lagos",
+			schedule: withBreak,
+			from:     time.Date(2026, 5, 4, 0, 0, 0, 0, lagos),
+			to:       time.Date(2026, 5, 5, 0, 0, 0, 0, lagos),
+			loc:      lagos,
+			want:     []string{"2026-05-04T08:00:00Z", "2026-05-04T10:00:00Z"},
+		},
+		{
+			name:     "override replaces hours and breaks",
+			schedule: overridden,
+			from:     time.Date(2026, 5, 4, 0, 0, 0, 0, lagos),
+			to:       time.Date(2026, 5, 12, 0, 0, 0, 0, lagos),
+			loc:      lagos,
+			want:     []string{"2026-05-04T13:00:00Z", "2026-05-11T08:00:00Z", "2026-05-11T10:00:00Z"},
+		},
+		{
+			name:     "override without hours is a day off",
+			schedule: dayOff,
+			from:     time.Date(2026, 5, 4, 0, 0, 0, 0, lagos),
+			to:       time.Date(2026, 5, 5, 0, 0, 0, 0, lagos),
+			loc:      lagos,
+			want:     nil,
+		},
+		{
+			name:     "time off blocks overlapping slots",
+			schedule: timeOff,
+			from:     time.Date(2026, 5, 4, 0, 0, 0, 0, lagos),
+			to:       time.Date(2026, 5, 5, 0, 0, 0, 0, lagos),
+			loc:      lagos,
+			want:     []string{"2026-05-04T09:00:00Z", "2026-05-04T10:00:00Z"},
+		},
+		{
+			name:     "range starts mid window",
+			schedule: weekly(60, monday),
+			from:     time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC),
+			to:       time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC),
+			loc:      lagos,
+			want:     []string{"2026-05-04T09:00:00Z"},
+		},
+		{
+			name:     "no slot duration",
+			schedule: weekly(0, monday),
+			from:     time.Date(2026, 5, 4, 0, 0, 0, 0, lagos),
+			to:       time.Date(2026, 5, 5, 0, 0, 0, 0, lagos),
+			loc:      lagos,
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots := generateSlots(tt.schedule, tt.from, tt.to, tt.loc)
+			var got []string
+			for _, slot := range slots {
+				got = append(got, slot.StartsAt.UTC().Format(time.RFC3339))
+				if want := time.Duration(tt.schedule.SlotDurationMinutes) * time.Minute; slot.EndsAt.Sub(slot.StartsAt) != want {
+					t.Errorf("slot at %s lasts %s, want %s", got[len(got)-1], slot.EndsAt.Sub(slot.StartsAt), want)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("slots = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("slots = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	schedule := models.DoctorSchedule{
+		TimeZone:            "Africa/Lagos",
+		SlotDurationMinutes: 60,
+		WorkingHours:        []models.WorkingHours{{DayOfWeek: int(time.Monday), StartTime: "09:00", EndTime: "12:00"}},
+	}
+	from := time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	at := func(hour, minute int) time.Time { return time.Date(2026, 5, 4, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		name  string
+		taken []models.Slot
+		want  []string
+	}{
+		{"nothing taken", nil, []string{"08:00", "09:00", "10:00"}},
+		{"exact slot taken", []models.Slot{{StartsAt: at(9, 0), EndsAt: at(10, 0)}}, []string{"08:00", "10:00"}},
+		{"slot from an older schedule straddles two", []models.Slot{{StartsAt: at(8, 30), EndsAt: at(9, 30)}}, []string{"10:00"}},
+		{"touching ends do not overlap", []models.Slot{{StartsAt: at(7, 0), EndsAt: at(8, 0)}}, []string{"08:00", "09:00", "10:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, slot := range freeSlots(schedule, tt.taken, from, to) {
+				got = append(got, slot.StartsAt.UTC().Format("15:04"))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("free slots = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("free slots = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"cardiology": "cardiology",
+		"100%":       `100\%`,
+		"ent_":       `ent\_`,
+		`a\b`:        `a\\b`,
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
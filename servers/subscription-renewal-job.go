@@ -0,0 +1,180 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"telemed/config"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// StartSubscriptionRenewalJob renews due subscriptions and retries failed renewals
+func StartSubscriptionRenewalJob() {
+	ticker := time.NewTicker(time.Duration(config.SubscriptionJobIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		if err := RenewDueSubscriptions(); err != nil {
+			log.Println("Subscription renewal job failed:", err)
+		}
+		<-ticker.C
+	}
+}
+
+type dueSubscription struct {
+	subscriptionID    int
+	usertag           string
+	status            string
+	paymentMethod     string
+	cardID            *int
+	periodEnd         time.Time
+	cancelAtPeriodEnd bool
+	failedAttempts    int
+	planName          string
+	price             float64
+}
+
+// renewalDue matches subscriptions the job should renew now. A subscription being renewed has next_retry_at pushed
+// forward by its claim, so another instance skips it until the attempt is settled
+const renewalDue = `((s.status = 'active' AND s.current_period_end <= NOW() AND (s.next_retry_at IS NULL OR s.next_retry_at <= NOW()))
+	OR (s.status = 'past_due' AND s.next_retry_at <= NOW()))`
+
+func RenewDueSubscriptions() error {
+	rows, err := Db.Query(Ctx,
+		`SELECT s.subscription_id FROM subscriptions s WHERE `+renewalDue+` ORDER BY s.current_period_end ASC LIMIT 200`)
+	if err != nil {
+		return err
+	}
+	var due []int
+	for rows.Next() {
+		var subscriptionID int
+		if err := rows.Scan(&subscriptionID); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, subscriptionID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, subscriptionID := range due {
+		renewSubscription(subscriptionID)
+	}
+	return nil
+}
+
+// claimRenewal locks a due subscription and marks it in progress by pushing next_retry_at forward a retry interval,
+// so a crash after a card charge doesn't get it charged again on the next tick. ok is false when another instance
+// has it or it is no longer due
+func claimRenewal(subscriptionID int) (sub dueSubscription, ok bool, err error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return sub, false, err
+	}
+	defer tx.Rollback(Ctx)
+	err = tx.QueryRow(Ctx,
+		`SELECT s.subscription_id, s.usertag, s.status, s.payment_method, s.card_id, s.current_period_end, s.cancel_at_period_end,
+		 s.failed_attempts, p.name, p.monthly_price
+		 FROM subscriptions s JOIN subscription_plans p ON p.plan_id = s.plan_id
+		 WHERE s.subscription_id = $1 AND `+renewalDue+`
+		 FOR UPDATE OF s SKIP LOCKED`, subscriptionID).
+		Scan(&sub.subscriptionID, &sub.usertag, &sub.status, &sub.paymentMethod, &sub.cardID, &sub.periodEnd,
+			&sub.cancelAtPeriodEnd, &sub.failedAttempts, &sub.planName, &sub.price)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sub, false, nil
+		}
+		return sub, false, err
+	}
+	if sub.cancelAtPeriodEnd {
+		_, err = tx.Exec(Ctx, `UPDATE subscriptions SET status = 'cancelled' WHERE subscription_id = $1`, subscriptionID)
+	} else {
+		_, err = tx.Exec(Ctx, `UPDATE subscriptions SET next_retry_at = NOW() + make_interval(hours => $1) WHERE subscription_id = $2`,
+			config.SubscriptionRetryHours, subscriptionID)
+	}
+	if err != nil {
+		return sub, false, err
+	}
+	if err = tx.Commit(Ctx); err != nil {
+		return sub, false, err
+	}
+	return sub, !sub.cancelAtPeriodEnd, nil
+}
+
+func renewSubscription(subscriptionID int) {
+	sub, ok, err := claimRenewal(subscriptionID)
+	if err != nil {
+		log.Println("Failed to claim subscription", subscriptionID, "for renewal:", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	description := "Renewal of " + sub.planName
+	reference, err := chargeRenewal(sub, description)
+	if err == nil {
+		recordInvoice(sub.subscriptionID, sub.usertag, sub.price, description, "paid", sub.paymentMethod, reference, "")
+		return
+	}
+
+	reason := err.Error()
+	recordInvoice(sub.subscriptionID, sub.usertag, sub.price, description, "failed", sub.paymentMethod, "", reason)
+	attempts := sub.failedAttempts + 1
+	var message string
+	if attempts >= config.SubscriptionMaxRetries {
+		_, err = Db.Exec(Ctx, `UPDATE subscriptions SET status = 'expired', failed_attempts = $1, next_retry_at = NULL WHERE subscription_id = $2`,
+			attempts, sub.subscriptionID)
+		message = fmt.Sprintf("We could not renew your %s plan after %d attempts, so it has now ended. You can subscribe again at any time.", sub.planName, attempts)
+	} else {
+		_, err = Db.Exec(Ctx, `UPDATE subscriptions SET status = 'past_due', failed_attempts = $1, next_retry_at = $2 WHERE subscription_id = $3`,
+			attempts, time.Now().Add(time.Duration(config.SubscriptionRetryHours)*time.Hour), sub.subscriptionID)
+		message = fmt.Sprintf("We could not renew your %s plan (%s). We will try again in %d hours, please top up your wallet or update your card.",
+			sub.planName, reason, config.SubscriptionRetryHours)
+	}
+	if err != nil {
+		log.Println("Failed to update subscription after failed renewal", sub.subscriptionID, ":", err)
+	}
+	emailUser(sub.usertag, "Your subscription payment failed", message)
+}
+
+// chargeRenewal takes the payment and rolls the period in one transaction, a wallet debit commits or rolls back
+// together with the new period
+func chargeRenewal(sub dueSubscription, description string) (string, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		log.Println("Failed to begin renewal of subscription", sub.subscriptionID, ":", err)
+		return "", errors.New("renewal could not be processed")
+	}
+	defer tx.Rollback(Ctx)
+	reference, err := chargeSubscription(tx, sub.usertag, sub.paymentMethod, sub.cardID, sub.price, description)
+	if err != nil {
+		return "", err
+	}
+	// an on-time renewal continues from the old period end, a recovered one starts today
+	start := sub.periodEnd
+	if sub.status == "past_due" {
+		start = time.Now()
+	}
+	_, err = tx.Exec(Ctx,
+		`UPDATE subscriptions SET status = 'active', current_period_start = $1, current_period_end = $2, consultations_used = 0,
+		 failed_attempts = 0, next_retry_at = NULL WHERE subscription_id = $3`,
+		start, start.AddDate(0, 1, 0), sub.subscriptionID)
+	if err == nil {
+		err = tx.Commit(Ctx)
+	}
+	if err != nil {
+		log.Println("Failed to roll subscription period", sub.subscriptionID, "after charging", reference, ":", err)
+		if sub.paymentMethod == "card" {
+			// the card has been charged but the period didn't move, the money goes to the wallet
+			if _, err := creditWallet(sub.usertag, sub.price, "Refund: subscription could not be renewed"); err != nil {
+				log.Println("Failed to refund card charge", reference, ":", err)
+			}
+		}
+		return "", errors.New("renewal could not be processed")
+	}
+	return reference, nil
+}
@@ -0,0 +1,704 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"telemed/models"
+	"telemed/responses"
+	"telemed/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type SubscriptionServer struct{}
+
+const subscriptionColumns = `s.subscription_id, s.usertag, s.status, s.payment_method, s.card_id, s.current_period_start, s.current_period_end,
+	s.consultations_used, s.cancel_at_period_end, s.failed_attempts, s.next_retry_at,
+	p.plan_id, p.name, COALESCE(p.description, ''), p.monthly_price, p.consultations_per_cycle, p.medication_discount_percent, p.is_active, p.created_at`
+
+func scanSubscription(row pgx.Row) (models.Subscription, error) {
+	var sub models.Subscription
+	err := row.Scan(&sub.SubscriptionID, &sub.Usertag, &sub.Status, &sub.PaymentMethod, &sub.CardID, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd,
+		&sub.ConsultationsUsed, &sub.CancelAtPeriodEnd, &sub.FailedAttempts, &sub.NextRetryAt,
+		&sub.Plan.PlanID, &sub.Plan.Name, &sub.Plan.Description, &sub.Plan.MonthlyPrice, &sub.Plan.ConsultationsPerCycle,
+		&sub.Plan.MedicationDiscountPercent, &sub.Plan.IsActive, &sub.Plan.Created_at)
+	sub.ConsultationsLeft = max(sub.Plan.ConsultationsPerCycle-sub.ConsultationsUsed, 0)
+	return sub, err
+}
+
+func fetchPlan(planID int) (models.SubscriptionPlan, error) {
+	var plan models.SubscriptionPlan
+	err := Db.QueryRow(Ctx,
+		`SELECT plan_id, name, COALESCE(description, ''), monthly_price, consultations_per_cycle, medication_discount_percent, is_active, created_at
+		 FROM subscription_plans WHERE plan_id = $1`, planID).
+		Scan(&plan.PlanID, &plan.Name, &plan.Description, &plan.MonthlyPrice, &plan.ConsultationsPerCycle,
+			&plan.MedicationDiscountPercent, &plan.IsActive, &plan.Created_at)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return plan, errors.New("plan not found")
+		}
+		log.Println("Failed to fetch subscription plan:", err)
+		return plan, errors.New(responses.SOMETHING_WRONG)
+	}
+	return plan, nil
+}
+
+// saveCardAuthorization stores a reusable card from a successful charge so it can be billed later
+func saveCardAuthorization(reference string, auth map[string]interface{}) {
+	reusable, _ := auth["reusable"].(bool)
+	code, _ := auth["authorization_code"].(string)
+	if !reusable || code == "" {
+		return
+	}
+	str := func(key string) string {
+		value, _ := auth[key].(string)
+		return value
+	}
+	_, err := Db.Exec(Ctx,
+		`INSERT INTO saved_cards (usertag, authorization_code, signature, last4, card_type, bank, exp_month, exp_year)
+		 SELECT usertag, $2, $3, $4, $5, $6, $7, $8 FROM wallet_transactions WHERE transaction_reference = $1
+		 ON CONFLICT (authorization_code) DO NOTHING`,
+		reference, code, str("signature"), str("last4"), str("card_type"), str("bank"), str("exp_month"), str("exp_year"))
+	if err != nil {
+		log.Println("Failed to save card authorization:", err)
+	}
+}
+
+// subscriptionReferencePrefix marks subscription charges, card ones are settled by ChargeAuthorization so the
+// charge.success webhook Paystack still sends for them has no top-up to complete
+const subscriptionReferencePrefix = "subscription_"
+
+func newSubscriptionReference(usertag string) string {
+	return fmt.Sprintf("%s%s_%d", subscriptionReferencePrefix, usertag, time.Now().UnixNano())
+}
+
+// chargeSubscription collects a subscription payment from a saved card, or from the wallet inside the caller's
+// transaction so the debit commits together with whatever the payment is for
+func chargeSubscription(tx pgx.Tx, usertag, method string, cardID *int, amount float64, narration string) (string, error) {
+	reference := newSubscriptionReference(usertag)
+	var err error
+	if method == "card" {
+		err = chargeCard(usertag, cardID, amount, reference)
+	} else {
+		err = debitWallet(tx, usertag, amount, reference, narration)
+	}
+	if err != nil {
+		return "", err
+	}
+	return reference, nil
+}
+
+func chargeCard(usertag string, cardID *int, amount float64, reference string) error {
+	if cardID == nil {
+		return errors.New("no card on file for this subscription")
+	}
+	var email, authorizationCode string
+	err := Db.QueryRow(Ctx,
+		`SELECT u.email, c.authorization_code FROM saved_cards c JOIN users u ON u.usertag = c.usertag
+		 WHERE c.card_id = $1 AND c.usertag = $2 AND c.is_active = true`, *cardID, usertag).Scan(&email, &authorizationCode)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("saved card not found")
+		}
+		log.Println("Failed to fetch saved card:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	ok, reason, err := utils.ChargeAuthorization(email, authorizationCode, reference, amount)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("card charge failed: " + reason)
+	}
+	return nil
+}
+
+// debitWallet takes a payment from the wallet inside the caller's transaction and records it in the ledger
+func debitWallet(tx pgx.Tx, usertag string, amount float64, reference, narration string) error {
+	var balance float64
+	var walletStatus string
+	err := tx.QueryRow(Ctx, `SELECT balance, wallet_status FROM wallets WHERE usertag=$1 FOR UPDATE`, usertag).Scan(&balance, &walletStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("wallet not found")
+		}
+		log.Println("Failed to lock wallet for debit:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	if walletStatus != "active" {
+		return errors.New("wallet is not active")
+	}
+	if balance < amount {
+		return errors.New("insufficient wallet balance")
+	}
+	if err := checkKycLimits(tx, usertag, "payment", amount); err != nil {
+		return err
+	}
+	_, err = tx.Exec(Ctx, `UPDATE wallets SET balance = balance - $1 WHERE usertag=$2`, amount, usertag)
+	if err != nil {
+		log.Println("Failed to debit wallet:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO wallet_transactions (usertag, amount, transaction_type, transaction_reference, status, created_at, narration)
+		 VALUES ($1, $2, 'debit', $3, 'success', $4, $5)`,
+		usertag, amount, reference, time.Now(), narration)
+	if err != nil {
+		log.Println("Failed to record wallet debit:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	return nil
+}
+
+// creditWallet pays money back into the wallet in a transaction of its own
+func creditWallet(usertag string, amount float64, narration string) (string, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return "", errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	reference, err := creditWalletTx(tx, usertag, amount, narration)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing wallet credit:", err)
+		return "", errors.New(responses.SOMETHING_WRONG)
+	}
+	return reference, nil
+}
+
+// creditWalletTx pays money back into the wallet inside the caller's transaction and records it in the ledger
+func creditWalletTx(tx pgx.Tx, usertag string, amount float64, narration string) (string, error) {
+	reference := fmt.Sprintf("credit_%s_%d", usertag, time.Now().UnixNano())
+	_, err := tx.Exec(Ctx, `UPDATE wallets SET balance = balance + $1 WHERE usertag=$2`, amount, usertag)
+	if err != nil {
+		log.Println("Failed to credit wallet:", err)
+		return "", errors.New(responses.SOMETHING_WRONG)
+	}
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO wallet_transactions (usertag, amount, transaction_type, transaction_reference, status, created_at, narration)
+		 VALUES ($1, $2, 'credit', $3, 'success', $4, $5)`,
+		usertag, amount, reference, time.Now(), narration)
+	if err != nil {
+		log.Println("Failed to record wallet credit:", err)
+		return "", errors.New(responses.SOMETHING_WRONG)
+	}
+	return reference, nil
+}
+
+func recordInvoice(subscriptionID int, usertag string, amount float64, description, status, method, reference, reason string) {
+	_, err := Db.Exec(Ctx,
+		`INSERT INTO subscription_invoices (subscription_id, usertag, amount, description, status, payment_method, transaction_reference, failure_reason)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		subscriptionID, usertag, amount, description, status, method, reference, reason)
+	if err != nil {
+		log.Println("Failed to record subscription invoice:", err)
+	}
+}
+
+// consumeConsultation uses one consultation from the patient's plan if they have any left this cycle
+func consumeConsultation(tx pgx.Tx, usertag string) (int, bool, error) {
+	var subscriptionID, used, allowance int
+	err := tx.QueryRow(Ctx,
+		`SELECT s.subscription_id, s.consultations_used, p.consultations_per_cycle
+		 FROM subscriptions s JOIN subscription_plans p ON p.plan_id = s.plan_id
+		 WHERE s.usertag = $1 AND s.status = 'active' AND s.current_period_end > NOW()
+		 FOR UPDATE OF s`, usertag).Scan(&subscriptionID, &used, &allowance)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, nil
+		}
+		log.Println("Failed to check subscription entitlement:", err)
+		return 0, false, errors.New(responses.SOMETHING_WRONG)
+	}
+	if used >= allowance {
+		return subscriptionID, false, nil
+	}
+	_, err = tx.Exec(Ctx, `UPDATE subscriptions SET consultations_used = consultations_used + 1 WHERE subscription_id = $1`, subscriptionID)
+	if err != nil {
+		log.Println("Failed to consume subscription consultation:", err)
+		return 0, false, errors.New(responses.SOMETHING_WRONG)
+	}
+	return subscriptionID, true, nil
+}
+
+func (SubscriptionServer) GetPlans() (any, error) {
+	var plans []models.SubscriptionPlan
+	rows, err := Db.Query(Ctx,
+		`SELECT plan_id, name, COALESCE(description, ''), monthly_price, consultations_per_cycle, medication_discount_percent, is_active, created_at
+		 FROM subscription_plans WHERE is_active = true ORDER BY monthly_price ASC`)
+	if err != nil {
+		log.Println("Failed to fetch subscription plans:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var plan models.SubscriptionPlan
+		if err := rows.Scan(&plan.PlanID, &plan.Name, &plan.Description, &plan.MonthlyPrice, &plan.ConsultationsPerCycle,
+			&plan.MedicationDiscountPercent, &plan.IsActive, &plan.Created_at); err != nil {
+			log.Println("Failed to scan subscription plan:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		plans = append(plans, plan)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over subscription plans:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return plans, nil
+}
+
+func (SubscriptionServer) GetSavedCards(usertag string) (any, error) {
+	var cards []models.SavedCard
+	rows, err := Db.Query(Ctx,
+		`SELECT card_id, COALESCE(last4, ''), COALESCE(card_type, ''), COALESCE(bank, ''), COALESCE(exp_month, ''), COALESCE(exp_year, '')
+		 FROM saved_cards WHERE usertag = $1 AND is_active = true ORDER BY created_at DESC`, usertag)
+	if err != nil {
+		log.Println("Failed to fetch saved cards:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var card models.SavedCard
+		if err := rows.Scan(&card.CardID, &card.Last4, &card.CardType, &card.Bank, &card.ExpMonth, &card.ExpYear); err != nil {
+			log.Println("Failed to scan saved card:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		cards = append(cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over saved cards:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return cards, nil
+}
+
+// Subscribe claims the user's one live subscription before taking payment, so a second request waits on the lock
+// and is turned away rather than paying for a subscription it cannot have
+func (SubscriptionServer) Subscribe(data models.SubscribeReq) (any, error) {
+	plan, err := fetchPlan(data.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.IsActive {
+		return nil, errors.New("plan is no longer available")
+	}
+	var cardID *int
+	if data.PaymentMethod == "card" {
+		cardID = &data.CardID
+	}
+
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	_, err = tx.Exec(Ctx, `SELECT usertag FROM users WHERE usertag = $1 FOR UPDATE`, data.Usertag)
+	if err != nil {
+		log.Println("Failed to lock user for subscription:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	var live int
+	err = tx.QueryRow(Ctx, `SELECT COUNT(*) FROM subscriptions WHERE usertag = $1 AND status IN ('active', 'past_due')`, data.Usertag).Scan(&live)
+	if err != nil {
+		log.Println("Failed to check existing subscriptions:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if live > 0 {
+		return nil, errors.New("you already have a subscription, change your plan instead")
+	}
+	start := time.Now()
+	end := start.AddDate(0, 1, 0)
+	var subscriptionID int
+	err = tx.QueryRow(Ctx,
+		`INSERT INTO subscriptions (usertag, plan_id, status, payment_method, card_id, current_period_start, current_period_end)
+		 VALUES ($1, $2, 'active', $3, $4, $5, $6) RETURNING subscription_id`,
+		data.Usertag, plan.PlanID, data.PaymentMethod, cardID, start, end).Scan(&subscriptionID)
+	if err != nil {
+		log.Println("Failed to create subscription:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	reference, err := chargeSubscription(tx, data.Usertag, data.PaymentMethod, cardID, plan.MonthlyPrice, "Subscription: "+plan.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing subscription", reference, ":", err)
+		if data.PaymentMethod == "card" {
+			// the card has been charged but the subscription is gone, the money goes to the wallet
+			if _, err := creditWallet(data.Usertag, plan.MonthlyPrice, "Refund: subscription could not be created"); err != nil {
+				log.Println("Failed to refund card charge", reference, ":", err)
+			}
+			return nil, errors.New("could not create your subscription, the charge has been refunded to your wallet")
+		}
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	recordInvoice(subscriptionID, data.Usertag, plan.MonthlyPrice, "First month of "+plan.Name, "paid", data.PaymentMethod, reference, "")
+
+	return map[string]interface{}{
+		"message":            "subscribed to " + plan.Name,
+		"subscription_id":    subscriptionID,
+		"current_period_end": end,
+	}, nil
+}
+
+func (SubscriptionServer) GetSubscription(usertag string) (any, error) {
+	sub, err := scanSubscription(Db.QueryRow(Ctx,
+		`SELECT `+subscriptionColumns+` FROM subscriptions s JOIN subscription_plans p ON p.plan_id = s.plan_id
+		 WHERE s.usertag = $1 ORDER BY s.created_at DESC LIMIT 1`, usertag))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("you do not have a subscription")
+		}
+		log.Println("Failed to fetch subscription:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return sub, nil
+}
+
+func (SubscriptionServer) GetInvoices(usertag string) (any, error) {
+	var invoices []models.SubscriptionInvoice
+	rows, err := Db.Query(Ctx,
+		`SELECT invoice_id, subscription_id, amount, COALESCE(description, ''), status, COALESCE(payment_method, ''),
+		 COALESCE(transaction_reference, ''), COALESCE(failure_reason, ''), created_at
+		 FROM subscription_invoices WHERE usertag = $1 ORDER BY created_at DESC`, usertag)
+	if err != nil {
+		log.Println("Failed to fetch subscription invoices:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var invoice models.SubscriptionInvoice
+		if err := rows.Scan(&invoice.InvoiceID, &invoice.SubscriptionID, &invoice.Amount, &invoice.Description, &invoice.Status,
+			&invoice.PaymentMethod, &invoice.TransactionReference, &invoice.FailureReason, &invoice.Created_at); err != nil {
+			log.Println("Failed to scan subscription invoice:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		invoices = append(invoices, invoice)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over subscription invoices:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return invoices, nil
+}
+
+// proratedDifference is what switching from oldPrice to newPrice costs for the part of the period still to run,
+// negative when it is owed back
+func proratedDifference(oldPrice, newPrice float64, start, end, now time.Time) float64 {
+	period := end.Sub(start)
+	remaining := end.Sub(now)
+	fraction := 0.0
+	if period > 0 && remaining > 0 {
+		fraction = min(remaining.Seconds()/period.Seconds(), 1)
+	}
+	return math.Round((newPrice-oldPrice)*fraction*100) / 100
+}
+
+// ChangePlan switches plans mid-cycle, charging or refunding the difference for the days left. The subscription
+// stays locked until the new plan is saved so two changes can't both be prorated from the old plan
+func (SubscriptionServer) ChangePlan(data models.ChangePlanReq) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	sub, err := scanSubscription(tx.QueryRow(Ctx,
+		`SELECT `+subscriptionColumns+` FROM subscriptions s JOIN subscription_plans p ON p.plan_id = s.plan_id
+		 WHERE s.usertag = $1 AND s.status = 'active' FOR UPDATE OF s`, data.Usertag))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("you do not have an active subscription")
+		}
+		log.Println("Failed to fetch subscription:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if sub.Plan.PlanID == data.PlanID {
+		return nil, errors.New("you are already on this plan")
+	}
+	plan, err := fetchPlan(data.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.IsActive {
+		return nil, errors.New("plan is no longer available")
+	}
+
+	net := proratedDifference(sub.Plan.MonthlyPrice, plan.MonthlyPrice, sub.CurrentPeriodStart, sub.CurrentPeriodEnd, time.Now())
+	description := fmt.Sprintf("Proration from %s to %s", sub.Plan.Name, plan.Name)
+	var reference string
+	if net > 0 {
+		reference, err = chargeSubscription(tx, data.Usertag, sub.PaymentMethod, sub.CardID, net, description)
+		if err != nil {
+			recordInvoice(sub.SubscriptionID, data.Usertag, net, description, "failed", sub.PaymentMethod, "", err.Error())
+			return nil, err
+		}
+	} else if net < 0 {
+		// downgrades are refunded to the wallet whichever way the plan was paid for
+		reference, err = creditWalletTx(tx, data.Usertag, -net, description)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(Ctx, `UPDATE subscriptions SET plan_id = $1, cancel_at_period_end = false WHERE subscription_id = $2`, plan.PlanID, sub.SubscriptionID)
+	if err != nil {
+		log.Println("Failed to change subscription plan:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing plan change", reference, ":", err)
+		if net > 0 && sub.PaymentMethod == "card" {
+			// the card has been charged but the plan didn't change, the money goes to the wallet
+			if _, err := creditWallet(data.Usertag, net, "Refund: plan could not be changed"); err != nil {
+				log.Println("Failed to refund card charge", reference, ":", err)
+			}
+			return nil, errors.New("could not change your plan, the charge has been refunded to your wallet")
+		}
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if net > 0 {
+		recordInvoice(sub.SubscriptionID, data.Usertag, net, description, "paid", sub.PaymentMethod, reference, "")
+	} else if net < 0 {
+		recordInvoice(sub.SubscriptionID, data.Usertag, -net, description, "refunded", "wallet", reference, "")
+	}
+	return map[string]interface{}{
+		"message":         "plan changed to " + plan.Name,
+		"prorated_amount": net,
+	}, nil
+}
+
+func (SubscriptionServer) CancelSubscription(usertag string) (any, error) {
+	tag, err := Db.Exec(Ctx,
+		`UPDATE subscriptions SET cancel_at_period_end = true WHERE usertag = $1 AND status = 'active'`, usertag)
+	if err != nil {
+		log.Println("Failed to cancel subscription:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if tag.RowsAffected() == 0 {
+		// a past due plan has nothing left to use so it ends straight away
+		tag, err = Db.Exec(Ctx, `UPDATE subscriptions SET status = 'cancelled' WHERE usertag = $1 AND status = 'past_due'`, usertag)
+		if err != nil {
+			log.Println("Failed to cancel subscription:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, errors.New("you do not have a subscription to cancel")
+		}
+	}
+	return map[string]string{"message": "subscription will not renew"}, nil
+}
+
+type cartLine struct {
+	ProductID int     `json:"product_id"`
+	ItemName  string  `json:"item_name"`
+	Price     float64 `json:"price"`
+	Quantity  int     `json:"quantity"`
+	stock     int
+}
+
+// priceCart totals the cart with the plan's medication discount, the summary and the charge both come from here
+func priceCart(q querier, usertag string, lock bool) ([]cartLine, models.CheckoutSummary, error) {
+	var lines []cartLine
+	var summary models.CheckoutSummary
+	query := `SELECT i.product_id, COALESCE(i.name, ''), i.price, c.quantity, i.quantity
+		 FROM carts c JOIN inventory i ON i.product_id = c.product_id WHERE c.usertag = $1 ORDER BY i.product_id`
+	if lock {
+		query += ` FOR UPDATE OF i`
+	}
+	rows, err := q.Query(Ctx, query, usertag)
+	if err != nil {
+		log.Println("Failed to fetch cart:", err)
+		return nil, summary, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var line cartLine
+		if err := rows.Scan(&line.ProductID, &line.ItemName, &line.Price, &line.Quantity, &line.stock); err != nil {
+			log.Println("Failed to scan cart line:", err)
+			return nil, summary, errors.New(responses.SOMETHING_WRONG)
+		}
+		summary.Subtotal += line.Price * float64(line.Quantity)
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over cart:", err)
+		return nil, summary, errors.New(responses.SOMETHING_WRONG)
+	}
+	err = q.QueryRow(Ctx,
+		`SELECT p.medication_discount_percent, p.name FROM subscriptions s JOIN subscription_plans p ON p.plan_id = s.plan_id
+		 WHERE s.usertag = $1 AND s.status = 'active' AND s.current_period_end > NOW()`, usertag).
+		Scan(&summary.DiscountPercent, &summary.PlanName)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Println("Failed to fetch subscription discount:", err)
+		return nil, summary, errors.New(responses.SOMETHING_WRONG)
+	}
+	summary.Subtotal = math.Round(summary.Subtotal*100) / 100
+	summary.Discount = math.Round(summary.Subtotal*summary.DiscountPercent) / 100
+	summary.Total = summary.Subtotal - summary.Discount
+	return lines, summary, nil
+}
+
+func (SubscriptionServer) GetCheckoutSummary(usertag string) (any, error) {
+	_, summary, err := priceCart(Db, usertag, false)
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// Checkout pays for the cart from the wallet at the discounted total and turns it into an order
+func (SubscriptionServer) Checkout(usertag string) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	lines, summary, err := priceCart(tx, usertag, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("your cart is empty")
+	}
+	for _, line := range lines {
+		if line.stock < line.Quantity {
+			return nil, fmt.Errorf("insufficient stock for %s: only %d available", line.ItemName, line.stock)
+		}
+	}
+	reference := fmt.Sprintf("order_%s_%d", usertag, time.Now().UnixNano())
+	if summary.Total > 0 {
+		if err := debitWallet(tx, usertag, summary.Total, reference, "Medication order"); err != nil {
+			return nil, err
+		}
+	}
+	for _, line := range lines {
+		_, err = tx.Exec(Ctx, `UPDATE inventory SET quantity = quantity - $1 WHERE product_id = $2`, line.Quantity, line.ProductID)
+		if err != nil {
+			log.Println("Failed to reduce inventory:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+	}
+	items, err := json.Marshal(lines)
+	if err != nil {
+		log.Println("Failed to marshal order items:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	var orderID int
+	err = tx.QueryRow(Ctx,
+		`INSERT INTO orders (usertag, total, status, items) VALUES ($1, $2, 'pending', $3) RETURNING order_id`,
+		usertag, summary.Total, items).Scan(&orderID)
+	if err != nil {
+		log.Println("Failed to create order:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	_, err = tx.Exec(Ctx, `DELETE FROM carts WHERE usertag = $1`, usertag)
+	if err != nil {
+		log.Println("Failed to clear cart:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing checkout:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]interface{}{
+		"message":   "order placed",
+		"order_id":  orderID,
+		"reference": reference,
+		"summary":   summary,
+	}, nil
+}
+
+func (AdminServer) GetSubscriptionPlans() (any, error) {
+	var plans []models.SubscriptionPlan
+	rows, err := Db.Query(Ctx,
+		`SELECT plan_id, name, COALESCE(description, ''), monthly_price, consultations_per_cycle, medication_discount_percent, is_active, created_at
+		 FROM subscription_plans ORDER BY created_at DESC`)
+	if err != nil {
+		log.Println("Failed to fetch subscription plans:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var plan models.SubscriptionPlan
+		if err := rows.Scan(&plan.PlanID, &plan.Name, &plan.Description, &plan.MonthlyPrice, &plan.ConsultationsPerCycle,
+			&plan.MedicationDiscountPercent, &plan.IsActive, &plan.Created_at); err != nil {
+			log.Println("Failed to scan subscription plan:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		plans = append(plans, plan)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over subscription plans:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return plans, nil
+}
+
+func (AdminServer) CreateSubscriptionPlan(data models.SubscriptionPlan) (any, error) {
+	var planID int
+	err := Db.QueryRow(Ctx,
+		`INSERT INTO subscription_plans (name, description, monthly_price, consultations_per_cycle, medication_discount_percent, is_active)
+		 VALUES ($1, $2, $3, $4, $5, true) RETURNING plan_id`,
+		data.Name, data.Description, data.MonthlyPrice, data.ConsultationsPerCycle, data.MedicationDiscountPercent).Scan(&planID)
+	if err != nil {
+		log.Println("Failed to create subscription plan:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]interface{}{"message": "Plan created successfully", "plan_id": planID}, nil
+}
+
+// UpdateSubscriptionPlan changes a plan; new prices apply to existing subscribers from their next renewal
+func (AdminServer) UpdateSubscriptionPlan(data models.SubscriptionPlan) (any, error) {
+	_, err := Db.Exec(Ctx,
+		`UPDATE subscription_plans SET name = $1, description = $2, monthly_price = $3, consultations_per_cycle = $4,
+		 medication_discount_percent = $5, is_active = $6 WHERE plan_id = $7`,
+		data.Name, data.Description, data.MonthlyPrice, data.ConsultationsPerCycle, data.MedicationDiscountPercent, data.IsActive, data.PlanID)
+	if err != nil {
+		log.Println("Failed to update subscription plan:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return map[string]string{"message": "Plan updated successfully"}, nil
+}
+
+func (AdminServer) GetSubscriptions(data models.GetDataReq) (any, error) {
+	var subscriptions []models.Subscription
+	var args []any
+	argIndex := 1
+	offset := data.Limit*data.Page - data.Limit
+
+	sqlStatement := `SELECT ` + subscriptionColumns + ` FROM subscriptions s JOIN subscription_plans p ON p.plan_id = s.plan_id`
+	if data.Status != "" {
+		sqlStatement += fmt.Sprintf(" WHERE s.status = $%d", argIndex)
+		args = append(args, data.Status)
+		argIndex++
+	}
+	sqlStatement += fmt.Sprintf(" ORDER BY s.created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, data.Limit, offset)
+
+	rows, err := Db.Query(Ctx, sqlStatement, args...)
+	if err != nil {
+		log.Println("Failed to fetch subscriptions:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			log.Println("Failed to scan subscription:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over subscriptions:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return subscriptions, nil
+}
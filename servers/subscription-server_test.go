@@ -0,0 +1,37 @@
+package servers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProratedDifference(t *testing.T) {
+	start := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0) // 30 days
+	day := func(n float64) time.Time { return start.Add(time.Duration(n * 24 * float64(time.Hour))) }
+	tests := []struct {
+		name     string
+		oldPrice float64
+		newPrice float64
+		end      time.Time
+		now      time.Time
+		want     float64
+	}{
+		{"upgrade on the first day", 5000, 8000, end, start, 3000},
+		{"upgrade halfway", 5000, 8000, end, day(15), 1500},
+		{"downgrade halfway", 8000, 5000, end, day(15), -1500},
+		{"upgrade with a third left", 5000, 8000, end, day(20), 1000},
+		{"rounded to kobo", 5000, 6000, end, day(10), 666.67},
+		{"period already over", 5000, 8000, end, end.Add(time.Hour), 0},
+		{"same price", 5000, 5000, end, day(3), 0},
+		{"clock before the period started", 5000, 8000, end, start.Add(-time.Hour), 3000},
+		{"empty period", 5000, 8000, start, start, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := proratedDifference(tt.oldPrice, tt.newPrice, start, tt.end, tt.now); got != tt.want {
+				t.Errorf("proratedDifference(%.2f, %.2f) = %.2f, want %.2f", tt.oldPrice, tt.newPrice, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package servers
+
+import (
+	"log"
+	"telemed/config"
+	"time"
+)
+
+// loadLocation resolves an IANA zone name, falling back to the default zone when it is empty or unknown
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		name = config.DefaultTimeZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Println("Unknown time zone", name, ":", err)
+		if loc, err = time.LoadLocation(config.DefaultTimeZone); err != nil {
+			return time.UTC
+		}
+	}
+	return loc
+}
+
+// userLocation is the zone a patient wants times shown in
+func userLocation(q querier, usertag string) *time.Location {
+	var name string
+	if err := q.QueryRow(Ctx, `SELECT COALESCE(time_zone, '') FROM users WHERE usertag = $1`, usertag).Scan(&name); err != nil {
+		log.Println("Failed to fetch user time zone:", err)
+	}
+	return loadLocation(name)
+}
+
+// doctorLocation is the zone a doctor works in, taken from their hospital when they have not set one
+func doctorLocation(q querier, doctortag string) *time.Location {
+	var name string
+	err := q.QueryRow(Ctx,
+		`SELECT COALESCE(d.time_zone, h.time_zone, '') FROM doctors d LEFT JOIN hospitals h ON h.hospital_id = d.hospital_id
+		 WHERE d.doctortag = $1`, doctortag).Scan(&name)
+	if err != nil {
+		log.Println("Failed to fetch doctor time zone:", err)
+	}
+	return loadLocation(name)
+}
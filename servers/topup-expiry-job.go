@@ -0,0 +1,143 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+)
+
+// StartTopUpExpiryJob periodically settles top-ups that were started but never paid
+func StartTopUpExpiryJob() {
+	ticker := time.NewTicker(time.Duration(config.TopUpExpiryIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		expired, err := ExpireAbandonedTopUps()
+		if err != nil {
+			log.Println("Top-up expiry job failed:", err)
+		} else if expired > 0 {
+			log.Println("Top-up expiry job expired", expired, "abandoned top-ups")
+		}
+		<-ticker.C
+	}
+}
+
+// ExpireAbandonedTopUps checks every stale pending top-up with Paystack first, crediting the ones that were
+// actually paid and expiring the rest
+func ExpireAbandonedTopUps() (int, error) {
+	rows, err := Db.Query(Ctx,
+		`SELECT transaction_reference FROM wallet_transactions
+		 WHERE transaction_type = 'credit' AND status = 'pending' AND transaction_reference LIKE 'wallet_topup_%'
+		 AND created_at < NOW() - make_interval(mins => $1)
+		 ORDER BY created_at ASC LIMIT 100`, config.TopUpExpiryMinutes)
+	if err != nil {
+		return 0, err
+	}
+	var references []string
+	for rows.Next() {
+		var reference string
+		if err := rows.Scan(&reference); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		references = append(references, reference)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, reference := range references {
+		status, amountKobo, err := fetchPaystackTransactionStatus(reference)
+		if err != nil {
+			// leave it pending and try again on the next run
+			log.Println("Could not verify pending top-up", reference, ":", err)
+			continue
+		}
+		if status == "success" {
+			if err := completeTopUp(reference, float64(amountKobo)/100); err != nil {
+				log.Println("Failed to credit late top-up", reference, ":", err)
+			}
+			continue
+		}
+		if status == "ongoing" || status == "pending" || status == "processing" || status == "queued" {
+			continue
+		}
+		tag, err := Db.Exec(Ctx,
+			`UPDATE wallet_transactions SET status = 'expired' WHERE transaction_reference = $1 AND status = 'pending'`, reference)
+		if err != nil {
+			log.Println("Failed to expire top-up", reference, ":", err)
+			continue
+		}
+		if tag.RowsAffected() > 0 {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// fetchPaystackTransactionStatus returns the Paystack status for a reference, or "not_found" when the
+// transaction was never initialized on their side
+func fetchPaystackTransactionStatus(reference string) (string, int64, error) {
+	url := config.PaystackBaseURL + "/transaction/verify/" + reference
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.PaystackSecretKey)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		return "not_found", 0, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, errors.New("paystack verify returned status " + resp.Status)
+	}
+	resBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	var response models.VerifyTransactionResponse
+	if err := json.Unmarshal(resBody, &response); err != nil {
+		return "", 0, err
+	}
+	if !response.Status {
+		return "not_found", 0, nil
+	}
+	return response.Data.Status, response.Data.Amount, nil
+}
+
+func (AdminServer) GetTopUpSummary() (any, error) {
+	var summary models.TopUpSummary
+	err := Db.QueryRow(Ctx,
+		`SELECT
+			COUNT(*) FILTER (WHERE status = 'pending'),
+			COALESCE(SUM(amount) FILTER (WHERE status = 'pending'), 0),
+			COUNT(*) FILTER (WHERE status = 'pending' AND created_at < NOW() - make_interval(mins => $1)),
+			COUNT(*) FILTER (WHERE status = 'expired'),
+			COALESCE(SUM(amount) FILTER (WHERE status = 'expired'), 0),
+			COUNT(*) FILTER (WHERE status = 'success'),
+			COALESCE(SUM(amount) FILTER (WHERE status = 'success'), 0)
+		 FROM wallet_transactions
+		 WHERE transaction_type = 'credit' AND transaction_reference LIKE 'wallet_topup_%'`, config.TopUpExpiryMinutes).
+		Scan(&summary.PendingCount, &summary.PendingAmount, &summary.StalePendingCount, &summary.ExpiredCount, &summary.ExpiredAmount,
+			&summary.SuccessCount, &summary.SuccessAmount)
+	if err != nil {
+		log.Println("Failed to fetch top-up summary:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	summary.ExpiryWindowMinutes = config.TopUpExpiryMinutes
+	return summary, nil
+}
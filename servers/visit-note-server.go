@@ -0,0 +1,263 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type VisitNoteServer struct{}
+
+// icd10Code matches ICD-10 codes such as J06.9 or E11.65
+var icd10Code = regexp.MustCompile(`^[A-TV-Z][0-9][0-9AB](\.[0-9A-TV-Z]{1,4})?$`)
+
+func validDiagnoses(diagnoses []models.Diagnosis) error {
+	for i := range diagnoses {
+		diagnoses[i].Code = strings.ToUpper(strings.TrimSpace(diagnoses[i].Code))
+		if !icd10Code.MatchString(diagnoses[i].Code) {
+			return fmt.Errorf("%q is not a valid ICD-10 code", diagnoses[i].Code)
+		}
+	}
+	return nil
+}
+
+// noteAppointment checks the doctor owns the appointment and that there was a visit to write up
+func noteAppointment(q querier, appointmentID int, doctortag string) error {
+	var owner, status string
+	err := q.QueryRow(Ctx, `SELECT doctor_tag, status FROM appointments WHERE appointment_id = $1`, appointmentID).Scan(&owner, &status)
+	if err != nil || owner != doctortag {
+		return errors.New("appointment not found")
+	}
+	if status != "confirmed" && status != "completed" {
+		return fmt.Errorf("notes cannot be written for a %s appointment", status)
+	}
+	return nil
+}
+
+func fetchAddenda(noteID int) ([]models.Addendum, error) {
+	addenda := []models.Addendum{}
+	rows, err := Db.Query(Ctx, `SELECT addendum_id, body, created_at FROM visit_note_addenda WHERE note_id = $1 ORDER BY created_at ASC`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.Addendum
+		if err := rows.Scan(&a.AddendumID, &a.Body, &a.Created_at); err != nil {
+			return nil, err
+		}
+		addenda = append(addenda, a)
+	}
+	return addenda, rows.Err()
+}
+
+func fetchVisitNote(q querier, appointmentID int, lock bool) (models.VisitNote, error) {
+	var note models.VisitNote
+	var diagnoses []byte
+	query := `SELECT note_id, appointment_id, doctortag, COALESCE(subjective, ''), COALESCE(objective, ''), COALESCE(assessment, ''),
+		COALESCE(plan, ''), diagnoses, status, signed_at, created_at, updated_at FROM visit_notes WHERE appointment_id = $1`
+	if lock {
+		query += " FOR UPDATE"
+	}
+	err := q.QueryRow(Ctx, query, appointmentID).Scan(&note.NoteID, &note.AppointmentID, &note.Doctortag, &note.Subjective,
+		&note.Objective, &note.Assessment, &note.Plan, &diagnoses, &note.Status, &note.SignedAt, &note.Created_at, &note.Updated_at)
+	if err != nil {
+		return note, err
+	}
+	note.Diagnoses = []models.Diagnosis{}
+	if len(diagnoses) > 0 {
+		_ = json.Unmarshal(diagnoses, &note.Diagnoses)
+	}
+	return note, nil
+}
+
+func (VisitNoteServer) GetNote(doctortag string, appointmentID int) (any, error) {
+	var owner string
+	if err := Db.QueryRow(Ctx, `SELECT doctor_tag FROM appointments WHERE appointment_id = $1`, appointmentID).Scan(&owner); err != nil || owner != doctortag {
+		return nil, errors.New("appointment not found")
+	}
+	note, err := fetchVisitNote(Db, appointmentID, false)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("no notes have been written for this appointment")
+		}
+		log.Println("Failed to fetch visit note:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if note.Addenda, err = fetchAddenda(note.NoteID); err != nil {
+		log.Println("Failed to fetch addenda:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return note, nil
+}
+
+// SaveNote creates the appointment's note or overwrites the draft, a signed note can only take addenda
+func (VisitNoteServer) SaveNote(data models.VisitNoteReq) (any, error) {
+	if err := validDiagnoses(data.Diagnoses); err != nil {
+		return nil, err
+	}
+	if data.Diagnoses == nil {
+		data.Diagnoses = []models.Diagnosis{}
+	}
+	diagnoses, err := json.Marshal(data.Diagnoses)
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	if err := noteAppointment(tx, data.AppointmentID, data.Doctortag); err != nil {
+		return nil, err
+	}
+	existing, err := fetchVisitNote(tx, data.AppointmentID, true)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Println("Failed to fetch visit note:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err == nil && existing.Status == "signed" {
+		return nil, errors.New("this note is signed, add an addendum instead")
+	}
+
+	_, err = tx.Exec(Ctx,
+		`INSERT INTO visit_notes (appointment_id, doctortag, subjective, objective, assessment, plan, diagnoses)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (appointment_id) DO UPDATE SET subjective = EXCLUDED.subjective, objective = EXCLUDED.objective,
+		 assessment = EXCLUDED.assessment, plan = EXCLUDED.plan, diagnoses = EXCLUDED.diagnoses, updated_at = NOW()`,
+		data.AppointmentID, data.Doctortag, data.Subjective, data.Objective, data.Assessment, data.Plan, diagnoses)
+	if err != nil {
+		log.Println("Failed to save visit note:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	note, err := fetchVisitNote(tx, data.AppointmentID, false)
+	if err != nil {
+		log.Println("Failed to fetch visit note:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing visit note:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	note.Addenda = []models.Addendum{}
+	return note, nil
+}
+
+// SignNote locks the note for good and releases the visit summary to the patient
+func (VisitNoteServer) SignNote(doctortag string, appointmentID int) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+	if err := noteAppointment(tx, appointmentID, doctortag); err != nil {
+		return nil, err
+	}
+	note, err := fetchVisitNote(tx, appointmentID, true)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("no notes have been written for this appointment")
+		}
+		log.Println("Failed to fetch visit note:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if note.Status == "signed" {
+		return nil, errors.New("this note is already signed")
+	}
+	if strings.TrimSpace(note.Assessment) == "" || strings.TrimSpace(note.Plan) == "" {
+		return nil, errors.New("assessment and plan are required before signing")
+	}
+	now := time.Now()
+	if _, err := tx.Exec(Ctx, `UPDATE visit_notes SET status = 'signed', signed_at = $1, updated_at = $1 WHERE note_id = $2`, now, note.NoteID); err != nil {
+		log.Println("Failed to sign visit note:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	var patientTag string
+	if err := tx.QueryRow(Ctx, `SELECT patient_tag FROM appointments WHERE appointment_id = $1`, appointmentID).Scan(&patientTag); err != nil {
+		log.Println("Failed to fetch patient for visit note:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing visit note signature:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+
+	notifyPatient(patientTag, "Visit summary ready", "Your doctor has shared the summary of your consultation, you can view it in the app.")
+	note.Status = "signed"
+	note.SignedAt = &now
+	note.Addenda = []models.Addendum{}
+	return note, nil
+}
+
+func (VisitNoteServer) AddAddendum(data models.AddendumReq) (any, error) {
+	data.Body = strings.TrimSpace(data.Body)
+	if data.Body == "" {
+		return nil, errors.New("addendum cannot be empty")
+	}
+	var owner string
+	if err := Db.QueryRow(Ctx, `SELECT doctor_tag FROM appointments WHERE appointment_id = $1`, data.AppointmentID).Scan(&owner); err != nil || owner != data.Doctortag {
+		return nil, errors.New("appointment not found")
+	}
+	note, err := fetchVisitNote(Db, data.AppointmentID, false)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("no notes have been written for this appointment")
+		}
+		log.Println("Failed to fetch visit note:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if note.Status != "signed" {
+		return nil, errors.New("the note is still a draft, edit it directly")
+	}
+	var addendum models.Addendum
+	err = Db.QueryRow(Ctx,
+		`INSERT INTO visit_note_addenda (note_id, doctortag, body) VALUES ($1, $2, $3) RETURNING addendum_id, body, created_at`,
+		note.NoteID, data.Doctortag, data.Body).Scan(&addendum.AddendumID, &addendum.Body, &addendum.Created_at)
+	if err != nil {
+		log.Println("Failed to save addendum:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return addendum, nil
+}
+
+// GetVisitSummary shows the patient their signed visit note
+func (VisitNoteServer) GetVisitSummary(usertag string, appointmentID int) (any, error) {
+	var summary models.VisitSummary
+	var diagnoses []byte
+	var status string
+	var noteID int
+	err := Db.QueryRow(Ctx,
+		`SELECT a.appointment_id, COALESCE(d.fullname, ''), COALESCE(dp.firstname || ' ' || dp.lastname, CONCAT(u.firstname, ' ', u.lastname)),
+		 a.scheduled_at, n.note_id, n.diagnoses, COALESCE(n.assessment, ''), COALESCE(n.plan, ''), n.status, n.signed_at
+		 FROM visit_notes n JOIN appointments a ON n.appointment_id = a.appointment_id JOIN doctors d ON a.doctor_tag = d.doctortag
+		 JOIN users u ON u.usertag = a.patient_tag LEFT JOIN dependents dp ON dp.dependent_id = a.dependent_id
+		 WHERE a.appointment_id = $1 AND a.patient_tag = $2`, appointmentID, usertag).
+		Scan(&summary.AppointmentID, &summary.DoctorName, &summary.PatientName, &summary.VisitDate, &noteID, &diagnoses, &summary.Assessment,
+			&summary.Plan, &status, &summary.SignedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Println("Failed to fetch visit summary:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err != nil || status != "signed" {
+		return nil, errors.New("the visit summary is not ready yet")
+	}
+	summary.VisitDate = summary.VisitDate.In(userLocation(Db, usertag))
+	summary.Diagnoses = []models.Diagnosis{}
+	if len(diagnoses) > 0 {
+		_ = json.Unmarshal(diagnoses, &summary.Diagnoses)
+	}
+	if summary.Addenda, err = fetchAddenda(noteID); err != nil {
+		log.Println("Failed to fetch addenda:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return summary, nil
+}
@@ -0,0 +1,224 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"telemed/config"
+	"telemed/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// StartWaitlistJob offers open slots to waitlisted patients, on a timer and whenever a slot may have been freed
+func StartWaitlistJob() {
+	ticker := time.NewTicker(time.Duration(config.WaitlistIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		offered, err := ProcessWaitlist()
+		if err != nil {
+			log.Println("Waitlist job failed:", err)
+		} else if offered > 0 {
+			log.Println("Waitlist job offered", offered, "slots")
+		}
+		select {
+		case <-ticker.C:
+		case <-waitlistWake:
+		}
+	}
+}
+
+// ProcessWaitlist lapses offers nobody answered, closes entries whose range has passed and then walks the
+// queue oldest first, holding the earliest open slot in range for each entry
+func ProcessWaitlist() (int, error) {
+	if err := lapseWaitlistOffers(); err != nil {
+		return 0, err
+	}
+	rows, err := Db.Query(Ctx,
+		`UPDATE waitlist_entries SET status = 'expired'
+		 WHERE status = 'waiting' AND latest_at <= NOW() + make_interval(mins => $1) RETURNING usertag`, config.WaitlistMinLeadMinutes)
+	if err != nil {
+		return 0, err
+	}
+	var expired []string
+	for rows.Next() {
+		var usertag string
+		if err := rows.Scan(&usertag); err == nil {
+			expired = append(expired, usertag)
+		}
+	}
+	rows.Close()
+	for _, usertag := range expired {
+		notifyPatient(usertag, "Waitlist ended", "No slot opened up in the time range you picked, you can join the waitlist again with new dates.")
+	}
+
+	type waiting struct {
+		id             int
+		usertag        string
+		doctortag      string
+		specialization string
+		earliest       time.Time
+		latest         time.Time
+	}
+	var queue []waiting
+	rows, err = Db.Query(Ctx,
+		`SELECT entry_id, usertag, COALESCE(doctortag, ''), COALESCE(specialization, ''), earliest_at, latest_at
+		 FROM waitlist_entries WHERE status = 'waiting' ORDER BY queued_at ASC LIMIT 200`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var w waiting
+		if err := rows.Scan(&w.id, &w.usertag, &w.doctortag, &w.specialization, &w.earliest, &w.latest); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		queue = append(queue, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	offered := 0
+	for _, w := range queue {
+		doctors := []string{w.doctortag}
+		if w.doctortag == "" {
+			if doctors, err = doctorsBySpecialization(w.specialization); err != nil {
+				return offered, err
+			}
+		}
+		from := time.Now().Add(time.Duration(config.WaitlistMinLeadMinutes) * time.Minute)
+		if w.earliest.After(from) {
+			from = w.earliest
+		}
+
+		var best models.Slot
+		var bestDoctor string
+		for _, doctortag := range doctors {
+			slots, err := openSlots(Db, doctortag, from, w.latest)
+			if err != nil || len(slots) == 0 {
+				continue
+			}
+			if bestDoctor == "" || slots[0].StartsAt.Before(best.StartsAt) {
+				best, bestDoctor = slots[0], doctortag
+			}
+		}
+		if bestDoctor == "" {
+			continue
+		}
+		ok, err := holdSlotForEntry(w.id, bestDoctor, best)
+		if err != nil {
+			log.Println("Failed to hold slot for waitlist entry", w.id, ":", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		offered++
+		at := best.StartsAt.In(userLocation(Db, w.usertag)).Format("Mon 2 Jan 15:04 MST")
+		notifyPatient(w.usertag, "A slot opened up",
+			fmt.Sprintf("A consultation slot on %s is being held for you for %d minutes. Accept it in the app to book it.", at, config.WaitlistHoldMinutes))
+	}
+	return offered, nil
+}
+
+func doctorsBySpecialization(specialization string) ([]string, error) {
+	rows, err := Db.Query(Ctx, `SELECT doctortag FROM doctors WHERE specialization ILIKE $1`, specialization)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var doctors []string
+	for rows.Next() {
+		var doctortag string
+		if err := rows.Scan(&doctortag); err != nil {
+			return nil, err
+		}
+		doctors = append(doctors, doctortag)
+	}
+	return doctors, rows.Err()
+}
+
+// holdSlotForEntry takes the slot for the entry if it is still open and the entry still waiting; false means
+// someone got there first
+func holdSlotForEntry(entryID int, doctortag string, slot models.Slot) (bool, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(Ctx)
+
+	overlaps, err := slotOverlapsTaken(tx, doctortag, slot, 0)
+	if err != nil || overlaps {
+		return false, err
+	}
+	holdUntil := time.Now().Add(time.Duration(config.WaitlistHoldMinutes) * time.Minute)
+	var slotID int
+	err = tx.QueryRow(Ctx,
+		`INSERT INTO appointment_slots (doctortag, starts_at, ends_at, status, held_until, waitlist_entry_id)
+		 VALUES ($1, $2, $3, 'held', $4, $5)
+		 ON CONFLICT (doctortag, starts_at) DO UPDATE SET status = 'held', held_until = EXCLUDED.held_until,
+		 waitlist_entry_id = EXCLUDED.waitlist_entry_id, appointment_id = NULL, updated_at = NOW()
+		 WHERE appointment_slots.status = 'open' OR (appointment_slots.status = 'held' AND appointment_slots.held_until <= NOW())
+		 RETURNING slot_id`,
+		doctortag, slot.StartsAt, slot.EndsAt, holdUntil, entryID).Scan(&slotID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec(Ctx,
+		`UPDATE waitlist_entries SET status = 'offered', offered_doctortag = $1, offered_starts_at = $2, hold_expires_at = $3
+		 WHERE entry_id = $4 AND status = 'waiting'`, doctortag, slot.StartsAt, holdUntil, entryID)
+	if err != nil {
+		return false, err
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+	return true, tx.Commit(Ctx)
+}
+
+// lapseWaitlistOffers drops offers whose hold ran out, the patient leaves the waitlist and the slot reopens
+func lapseWaitlistOffers() error {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(Ctx)
+
+	rows, err := tx.Query(Ctx,
+		`UPDATE waitlist_entries SET status = 'lapsed' WHERE status = 'offered' AND hold_expires_at <= NOW() RETURNING usertag`)
+	if err != nil {
+		return err
+	}
+	var lapsed []string
+	for rows.Next() {
+		var usertag string
+		if err := rows.Scan(&usertag); err != nil {
+			rows.Close()
+			return err
+		}
+		lapsed = append(lapsed, usertag)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = tx.Exec(Ctx,
+		`UPDATE appointment_slots SET status = 'open', held_until = NULL, waitlist_entry_id = NULL, updated_at = NOW()
+		 WHERE status = 'held' AND held_until <= NOW()`)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		return err
+	}
+	for _, usertag := range lapsed {
+		notifyPatient(usertag, "Waitlist offer expired", "The slot held for you was not accepted in time and has been offered to someone else.")
+	}
+	return nil
+}
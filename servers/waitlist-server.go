@@ -0,0 +1,246 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"telemed/config"
+	"telemed/models"
+	"telemed/responses"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type WaitlistServer struct{}
+
+// waitlistWake lets a freed slot be offered straight away instead of on the next tick
+var waitlistWake = make(chan struct{}, 1)
+
+func wakeWaitlist() {
+	select {
+	case waitlistWake <- struct{}{}:
+	default:
+	}
+}
+
+func (WaitlistServer) JoinWaitlist(data models.JoinWaitlistReq) (any, error) {
+	now := time.Now()
+	if data.EarliestAt.Before(now) {
+		data.EarliestAt = now
+	}
+	if data.LatestAt.IsZero() {
+		data.LatestAt = data.EarliestAt.AddDate(0, 0, 14)
+	}
+	if !data.LatestAt.After(data.EarliestAt) {
+		return nil, errors.New("latest_at must be after earliest_at")
+	}
+	if data.LatestAt.Sub(data.EarliestAt) > time.Duration(config.WaitlistMaxRangeDays)*24*time.Hour {
+		return nil, fmt.Errorf("the waitlist range can be at most %d days", config.WaitlistMaxRangeDays)
+	}
+	if data.Doctortag != "" {
+		var exists bool
+		if err := Db.QueryRow(Ctx, `SELECT EXISTS (SELECT 1 FROM doctors WHERE doctortag = $1)`, data.Doctortag).Scan(&exists); err != nil || !exists {
+			return nil, errors.New("doctor not found")
+		}
+	}
+	if data.DependentID != nil {
+		if err := checkDependent(Db, data.Usertag, *data.DependentID); err != nil {
+			return nil, err
+		}
+	}
+
+	var count int
+	err := Db.QueryRow(Ctx,
+		`SELECT COUNT(*) FROM waitlist_entries WHERE usertag = $1 AND status IN ('waiting', 'offered')
+		 AND COALESCE(doctortag, '') = $2 AND COALESCE(specialization, '') = $3 AND dependent_id IS NOT DISTINCT FROM $4`,
+		data.Usertag, data.Doctortag, data.Specialization, data.DependentID).Scan(&count)
+	if err != nil {
+		log.Println("Failed to check waitlist:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if count > 0 {
+		return nil, errors.New("you are already on this waitlist")
+	}
+
+	var entryID int
+	err = Db.QueryRow(Ctx,
+		`INSERT INTO waitlist_entries (usertag, doctortag, specialization, earliest_at, latest_at, reason, dependent_id)
+		 VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7) RETURNING entry_id`,
+		data.Usertag, data.Doctortag, data.Specialization, data.EarliestAt, data.LatestAt, data.Reason, data.DependentID).Scan(&entryID)
+	if err != nil {
+		log.Println("Failed to join waitlist:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	wakeWaitlist()
+	return map[string]interface{}{"message": "You have been added to the waitlist", "entry_id": entryID}, nil
+}
+
+func (WaitlistServer) GetWaitlist(usertag string) (any, error) {
+	var entries []models.WaitlistEntry
+	rows, err := Db.Query(Ctx,
+		`SELECT w.entry_id, COALESCE(w.doctortag, ''), COALESCE(w.specialization, ''), w.earliest_at, w.latest_at, COALESCE(w.reason, ''), w.dependent_id,
+		 w.status, COALESCE(w.offered_doctortag, ''), w.offered_starts_at, w.hold_expires_at, w.appointment_id, w.created_at,
+		 CASE WHEN w.status = 'waiting' THEN (SELECT COUNT(*) FROM waitlist_entries q WHERE q.status = 'waiting'
+		   AND q.queued_at <= w.queued_at AND (q.doctortag = w.doctortag OR q.specialization = w.specialization)) ELSE 0 END
+		 FROM waitlist_entries w WHERE w.usertag = $1 ORDER BY w.created_at DESC`, usertag)
+	if err != nil {
+		log.Println("Failed to fetch waitlist:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer rows.Close()
+	loc := userLocation(Db, usertag)
+	for rows.Next() {
+		var e models.WaitlistEntry
+		if err := rows.Scan(&e.EntryID, &e.Doctortag, &e.Specialization, &e.EarliestAt, &e.LatestAt, &e.Reason, &e.DependentID, &e.Status,
+			&e.OfferedDoctortag, &e.OfferedStartsAt, &e.HoldExpiresAt, &e.AppointmentID, &e.Created_at, &e.Position); err != nil {
+			log.Println("Failed to scan waitlist entry:", err)
+			return nil, errors.New(responses.SOMETHING_WRONG)
+		}
+		e.EarliestAt, e.LatestAt = e.EarliestAt.In(loc), e.LatestAt.In(loc)
+		if e.OfferedStartsAt != nil {
+			offered := e.OfferedStartsAt.In(loc)
+			e.OfferedStartsAt = &offered
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over waitlist:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	return entries, nil
+}
+
+type waitlistOffer struct {
+	status      string
+	doctortag   string
+	startsAt    *time.Time
+	holdExpires *time.Time
+	reason      string
+	dependentID *int
+}
+
+func lockWaitlistEntry(tx pgx.Tx, usertag string, entryID int) (waitlistOffer, error) {
+	var o waitlistOffer
+	err := tx.QueryRow(Ctx,
+		`SELECT status, COALESCE(offered_doctortag, ''), offered_starts_at, hold_expires_at, COALESCE(reason, ''), dependent_id
+		 FROM waitlist_entries WHERE entry_id = $1 AND usertag = $2 FOR UPDATE`, entryID, usertag).
+		Scan(&o.status, &o.doctortag, &o.startsAt, &o.holdExpires, &o.reason, &o.dependentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return o, errors.New("waitlist entry not found")
+		}
+		log.Println("Failed to fetch waitlist entry:", err)
+		return o, errors.New(responses.SOMETHING_WRONG)
+	}
+	return o, nil
+}
+
+// releaseHold reopens the slot held for a waitlist entry, if any
+func releaseHold(tx pgx.Tx, entryID int) error {
+	_, err := tx.Exec(Ctx,
+		`UPDATE appointment_slots SET status = 'open', held_until = NULL, waitlist_entry_id = NULL, updated_at = NOW()
+		 WHERE waitlist_entry_id = $1 AND status = 'held'`, entryID)
+	if err != nil {
+		log.Println("Failed to release waitlist hold:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	return nil
+}
+
+// AcceptOffer turns the held slot into a paid booking at the doctor's session price
+func (WaitlistServer) AcceptOffer(usertag string, entryID int) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	o, err := lockWaitlistEntry(tx, usertag, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if o.status != "offered" || o.holdExpires == nil || time.Now().After(*o.holdExpires) {
+		return nil, errors.New("there is no open offer on this waitlist entry")
+	}
+	var price float64
+	if err := tx.QueryRow(Ctx, `SELECT COALESCE(price_per_session, 0) FROM doctors WHERE doctortag = $1`, o.doctortag).Scan(&price); err != nil {
+		log.Println("Failed to fetch doctor price:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	// the hold steps aside for the booking inside the same transaction, so nobody else can take the slot
+	if err := releaseHold(tx, entryID); err != nil {
+		return nil, err
+	}
+	resp, err := createBooking(tx, models.BookAppointment{
+		Usertag:      usertag,
+		Doctortag:    o.doctortag,
+		Scheduled_at: *o.startsAt,
+		Reason:       o.reason,
+		Amount:       price,
+		DependentID:  o.dependentID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	appointmentID, _ := strconv.Atoi(resp.AppointmentID)
+	_, err = tx.Exec(Ctx, `UPDATE waitlist_entries SET status = 'booked', appointment_id = $1 WHERE entry_id = $2`, appointmentID, entryID)
+	if err != nil {
+		log.Println("Failed to mark waitlist entry booked:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing waitlist booking:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	notifyDoctor(o.doctortag, "New appointment", "A patient from your waitlist booked "+
+		o.startsAt.In(doctorLocation(Db, o.doctortag)).Format("Mon 2 Jan 15:04 MST")+", please confirm it.")
+	invitePatient(usertag, appointmentID, "Appointment booked", "Your appointment on "+
+		o.startsAt.In(userLocation(Db, usertag)).Format("Mon 2 Jan 15:04 MST")+" is booked and waiting for the doctor to confirm it.")
+	inviteDoctor(o.doctortag, appointmentID, "New appointment", "A patient from your waitlist booked "+
+		o.startsAt.In(doctorLocation(Db, o.doctortag)).Format("Mon 2 Jan 15:04 MST")+", please confirm it.")
+	return resp, nil
+}
+
+// DeclineOffer gives the slot to the next person and puts the patient back at the end of the line
+func (WaitlistServer) DeclineOffer(usertag string, entryID int) (any, error) {
+	return updateWaitlistEntry(usertag, entryID, []string{"offered"},
+		`UPDATE waitlist_entries SET status = 'waiting', queued_at = NOW(), offered_doctortag = NULL, offered_starts_at = NULL,
+		 hold_expires_at = NULL WHERE entry_id = $1`, "Offer declined, you are still on the waitlist")
+}
+
+func (WaitlistServer) LeaveWaitlist(usertag string, entryID int) (any, error) {
+	return updateWaitlistEntry(usertag, entryID, []string{"waiting", "offered"},
+		`UPDATE waitlist_entries SET status = 'cancelled' WHERE entry_id = $1`, "You have left the waitlist")
+}
+
+func updateWaitlistEntry(usertag string, entryID int, from []string, query, message string) (any, error) {
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
+
+	o, err := lockWaitlistEntry(tx, usertag, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(from, o.status) {
+		return nil, fmt.Errorf("a %s waitlist entry cannot be changed", o.status)
+	}
+	if err := releaseHold(tx, entryID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(Ctx, query, entryID); err != nil {
+		log.Println("Failed to update waitlist entry:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	if err := tx.Commit(Ctx); err != nil {
+		log.Println("Error committing waitlist update:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	wakeWaitlist()
+	return map[string]string{"message": message}, nil
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strings"
 	"telemed/config"
 	"telemed/models"
 	"telemed/responses"
@@ -55,12 +56,17 @@ func (WalletServer) TopUp(data models.WalletTopUp) (any, error) {
 			return nil, errors.New(responses.SOMETHING_WRONG)
 		}
 	}
-	//check wallet status
+	//check wallet status, locking the wallet so a parallel top-up sees this one's pending credit in its limit check
+	tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
+	defer tx.Rollback(Ctx)
 	var walletStatus string
-	query = `SELECT wallet_status FROM wallets WHERE usertag=$1`
-	err = Db.QueryRow(Ctx,query, data.Usertag).Scan(&walletStatus)
+	query = `SELECT wallet_status FROM wallets WHERE usertag=$1 FOR UPDATE`
+	err = tx.QueryRow(Ctx,query, data.Usertag).Scan(&walletStatus)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, errors.New("wallet not found")
 		}else {
 			log.Println("Error fetching wallet status:", err)
@@ -71,16 +77,24 @@ func (WalletServer) TopUp(data models.WalletTopUp) (any, error) {
 	if walletStatus != "active" {
 		return nil, errors.New("wallet is not active")
 	}
+	//enforce kyc tier limits
+	if err = checkKycLimits(tx, data.Usertag, "credit", data.Amount); err != nil {
+		return nil, err
+	}
 	//converting amount to kobo
 	paystackAmount := int(data.Amount * 100)
 	reference := fmt.Sprintf("wallet_topup_%s_%d", data.Usertag, time.Now().Unix())
 	//insert transaction record into wallet_transactions table with status pending
 	query = `INSERT INTO wallet_transactions (usertag, amount,transaction_type, transaction_reference, status, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err = Db.Exec(Ctx,query, data.Usertag, data.Amount, "credit", reference, "pending", time.Now())
+	_, err = tx.Exec(Ctx,query, data.Usertag, data.Amount, "credit", reference, "pending", time.Now())
 	if err != nil {
 		log.Println("Error inserting wallet transaction:", err)
 		return nil, errors.New(responses.SOMETHING_WRONG)
 	}
+	if err = tx.Commit(Ctx); err != nil {
+		log.Println("Error committing wallet top-up:", err)
+		return nil, errors.New(responses.SOMETHING_WRONG)
+	}
 	payload := map[string]interface{}{
 		"email":        email,
 		"amount":       paystackAmount,
@@ -220,23 +234,43 @@ func handleChargeSuccess(data interface{}) error {
     d := data.(map[string]interface{})
     reference := d["reference"].(string)
     amount := d["amount"].(float64) / 100 // Paystack sends kobo
+    if strings.HasPrefix(reference, subscriptionReferencePrefix) {
+        // saved-card charges for subscriptions were settled when they were made, there is no top-up behind them
+        return nil
+    }
+    if err := completeTopUp(reference, amount); err != nil {
+        return err
+    }
+    // Keep reusable cards so subscriptions can be renewed without the user present
+    if authorization, ok := d["authorization"].(map[string]interface{}); ok {
+        saveCardAuthorization(reference, authorization)
+    }
+    return nil
+}
+
+// completeTopUp credits a paid top-up, including one the expiry job already gave up on
+func completeTopUp(reference string, amount float64) error {
    // Begin transaction
     tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
     if err != nil {
         return err
     }
     defer tx.Rollback(Ctx)
-    var usertag string
-    err = tx.QueryRow(Ctx, `SELECT usertag FROM wallet_transactions WHERE transaction_reference=$1`, reference).Scan(&usertag)
+    var usertag, status string
+    err = tx.QueryRow(Ctx, `SELECT usertag, status FROM wallet_transactions WHERE transaction_reference=$1 FOR UPDATE`, reference).Scan(&usertag, &status)
     if err != nil {
-        if err == sql.ErrNoRows {
+        if err == pgx.ErrNoRows {
             log.Println("Transaction not found:", reference)
             return fmt.Errorf("transaction not found: %s", reference)
         }
         log.Println("Error querying transaction:", err)
         return err
     }
-    _, err = tx.Exec(Ctx, `UPDATE wallet_transactions SET status='success' WHERE transaction_reference=$1`, reference)
+    if status == "success" {
+        log.Println("Top-up already credited, skipping:", reference)
+        return nil
+    }
+    _, err = tx.Exec(Ctx, `UPDATE wallet_transactions SET status='success', credited_at=NOW() WHERE transaction_reference=$1`, reference)
     if err != nil {
         log.Println("Error updating transaction status:", err)
         return err
@@ -552,33 +586,67 @@ func (WalletServer) Withdraw(data models.WithdrawReq) (any, error) {
     // Verify pin
     if !utils.VerifyPassword(data.Transaction_pin, hash) {
         log.Println("Invalid transaction pin for user:", data.Usertag)
+        recordFailedPin(data.Usertag)
         return nil, errors.New(responses.INVALID_PIN)
     }
 
+    reference := fmt.Sprintf("wallet_withdrawal_%s_%d", data.Usertag, time.Now().Unix())
+
+    // Lock the wallet for the checks and the reservation, as transferFunds does
+    tx, err := Db.BeginTx(Ctx, pgx.TxOptions{})
+    if err != nil {
+        return nil, errors.New(responses.SOMETHING_WRONG)
+    }
+    defer tx.Rollback(Ctx)
+
     // Check wallet balances
-    var balance, pendingBalance float64
-    err = Db.QueryRow(Ctx, `SELECT balance, pending_balance FROM wallets WHERE usertag=$1`, data.Usertag).
-        Scan(&balance, &pendingBalance)
+    var balance float64
+    var walletStatus string
+    err = tx.QueryRow(Ctx, `SELECT balance, wallet_status FROM wallets WHERE usertag=$1 FOR UPDATE`, data.Usertag).
+        Scan(&balance, &walletStatus)
     if err != nil {
-        if errors.Is(err, sql.ErrNoRows) {
+        if errors.Is(err, pgx.ErrNoRows) {
             return nil, errors.New("wallet not found")
         }
         return nil, errors.New(responses.SOMETHING_WRONG)
     }
 
+    if walletStatus != "active" {
+        return nil, errors.New("wallet is not active")
+    }
+
     if balance < data.Amount {
         return nil, errors.New("insufficient wallet balance")
     }
 
-    reference := fmt.Sprintf("wallet_withdrawal_%s_%d", data.Usertag, time.Now().Unix())
+    // Enforce kyc tier limits
+    if err = checkKycLimits(tx, data.Usertag, "debit", data.Amount); err != nil {
+        return nil, err
+    }
 
-    // Reserve funds: move to pending balance
-    tx, err := Db.Begin(Ctx)
+    // Score the withdrawal against the fraud rules
+    assessment, err := scoreWithdrawal(tx, data.Usertag, data.RecipientCode, data.Amount)
     if err != nil {
-        return nil, errors.New(responses.SOMETHING_WRONG)
+        return nil, err
+    }
+
+    if assessment.Decision == RiskBlock {
+        log.Println("Withdrawal blocked for user:", data.Usertag, "score:", assessment.Score, assessment.Reasons)
+        if err = recordWithdrawalReview(tx, data, reference, assessment, "blocked"); err != nil {
+            log.Println("Error recording blocked withdrawal:", err)
+            return nil, errors.New(responses.SOMETHING_WRONG)
+        }
+        if err = tx.Commit(Ctx); err != nil {
+            return nil, errors.New(responses.SOMETHING_WRONG)
+        }
+        return nil, errors.New("withdrawal blocked for security reasons, please contact support")
+    }
+    status := "initiated"
+    if assessment.Decision == RiskReview {
+        status = "held"
     }
-    defer tx.Rollback(Ctx)
 
+    // Reserve funds: move to pending balance
     _, err = tx.Exec(Ctx,
         `UPDATE wallets 
          SET balance = balance - $1, pending_balance = pending_balance + $1 
@@ -587,33 +655,36 @@ func (WalletServer) Withdraw(data models.WithdrawReq) (any, error) {
         return nil, errors.New(responses.SOMETHING_WRONG)
     }
 
-    // Insert transaction record with "initiated"
+    // Insert transaction record with "initiated", or "held" when it needs manual review
     _, err = tx.Exec(Ctx,
         `INSERT INTO wallet_transactions (usertag, amount, transaction_type, transaction_reference, status, created_at)
          VALUES ($1, $2, $3, $4, $5, $6)`,
-        data.Usertag, data.Amount, "debit", reference, "initiated", time.Now())
+        data.Usertag, data.Amount, "debit", reference, status, time.Now())
     if err != nil {
         return nil, errors.New(responses.SOMETHING_WRONG)
     }
 
+    if status == "held" {
+        if err = recordWithdrawalReview(tx, data, reference, assessment, "pending"); err != nil {
+            log.Println("Error recording held withdrawal:", err)
+            return nil, errors.New(responses.SOMETHING_WRONG)
+        }
+    }
+
     if err = tx.Commit(Ctx); err != nil {
         return nil, errors.New(responses.SOMETHING_WRONG)
     }
 
-    // Call Paystack with retry logic
-    transferCode, err := utils.InitiateTransferWithRetry(data, reference, 3)
-    if err != nil {
-        log.Println("Error initiating transfer after retries:", err)
-        // Optional: mark transaction as failed here
-        return nil, errors.New("could not initiate transfer, please try again later")
+    if status == "held" {
+        return map[string]string{
+            "message": "Withdrawal is being reviewed, funds reserved in pending balance.",
+            "reference": reference,
+        }, nil
     }
 
-    // Update transaction with transfer code
-    _, err = Db.Exec(Ctx,
-        `UPDATE wallet_transactions SET transfer_code=$1, status='pending' WHERE transaction_reference=$2`,
-        transferCode, reference)
-    if err != nil {
-        log.Println("Error updating wallet transaction with transfer code:", err)
+    // Call Paystack with retry logic
+    if err = dispatchWithdrawal(data, reference); err != nil {
+        return nil, err
     }
 
     return map[string]string{
@@ -622,23 +693,36 @@ func (WalletServer) Withdraw(data models.WithdrawReq) (any, error) {
     }, nil
 }
 
-
-func (WalletServer) InitiateTransfer(tx pgx.Tx, fromTag, toTag string, amount float64, narration string) (string, error) {
+// transferFunds moves money between wallets. kind prefixes the reference and limitType is what the sender's
+// limits treat it as, a plain transfer counts towards the daily limit and a payment does not
+func transferFunds(tx pgx.Tx, kind, limitType, fromTag, toTag string, amount float64, narration string) (string, error) {
 	// Transaction reference
-	reference := fmt.Sprintf("txn_%s_%s_%d", fromTag, toTag, time.Now().Unix())
+	reference := fmt.Sprintf("%s_%s_%s_%d", kind, fromTag, toTag, time.Now().Unix())
 
 	// Lock sender wallet row
 	var balance float64
+	var walletStatus string
 	err := tx.QueryRow(Ctx,
-		`SELECT balance FROM wallets WHERE usertag=$1 FOR UPDATE`, fromTag).
-		Scan(&balance)
+		`SELECT balance, wallet_status FROM wallets WHERE usertag=$1 FOR UPDATE`, fromTag).
+		Scan(&balance, &walletStatus)
 	if err != nil {
 		return "", errors.New(responses.SOMETHING_WRONG)
 	}
+	if walletStatus != "active" {
+		return "", errors.New("wallet is not active")
+	}
 	if balance < amount {
 		return "", errors.New("insufficient funds")
 	}
 
+	// Enforce sender kyc tier limits
+	if err := checkKycLimits(tx, fromTag, limitType, amount); err != nil {
+		return "", err
+	}
+	if err := checkReceiverBalance(tx, toTag, amount); err != nil {
+		return "", err
+	}
+
 	// Deduct sender
 	_, err = tx.Exec(Ctx,
 		`UPDATE wallets SET balance = balance - $1 WHERE usertag=$2`,
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalBackend keeps files under Dir on the app's own disk
+type LocalBackend struct {
+	Dir string
+}
+
+func (l *LocalBackend) path(key string) (string, error) {
+	path := filepath.Join(l.Dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(l.Dir)+string(os.PathSeparator)) {
+		return "", errors.New("invalid storage key")
+	}
+	return path, nil
+}
+
+func (l *LocalBackend) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func (l *LocalBackend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (l *LocalBackend) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// PresignGet has nothing to offer, local files are streamed by the app behind its own signed links
+func (l *LocalBackend) PresignGet(ctx context.Context, key, fileName string, ttl time.Duration) (string, error) {
+	return "", nil
+}
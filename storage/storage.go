@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log"
+	"telemed/config"
+	"time"
+)
+
+// Backend is where uploaded files live. Keys are generated by the caller and never come from user input
+type Backend interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// PresignGet returns a URL the client can download from directly until ttl passes, or "" when the backend
+	// cannot serve files itself and downloads have to go through the app
+	PresignGet(ctx context.Context, key, fileName string, ttl time.Duration) (string, error)
+}
+
+// NewBackend picks the backend from STORAGE_BACKEND, local disk unless set to s3
+func NewBackend() Backend {
+	switch config.StorageBackend {
+	case "s3":
+		backend, err := newS3Backend()
+		if err != nil {
+			panic(err)
+		}
+		log.Println("storing uploads in bucket", config.S3Bucket)
+		return backend
+	default:
+		log.Println("storing uploads on disk at", config.LocalStorageDir)
+		return &LocalBackend{Dir: config.LocalStorageDir}
+	}
+}
@@ -2,10 +2,13 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/smtp"
+	"strings"
 	"telemed/config"
+	"telemed/models"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -72,6 +75,90 @@ func GenerateJWT(usertag string) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
+// GenerateAdminJWT issues a token for the admin console, the role claim comes from the admins table and is what
+// AdminProtected checks, a patient token cannot pass for it
+func GenerateAdminJWT(admintag, role string) (string, error) {
+	secret := config.JwtSecret
+	if secret == "" {
+		return "", errors.New("no secret key found")
+	}
+
+	claims := jwt.MapClaims{
+		"admintag": admintag,
+		"role":     role,
+		"exp":      time.Now().Add(1 * time.Hour).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// GenerateDoctorJWT issues a token for the doctor app, the role claim keeps it from passing as a patient token
+func GenerateDoctorJWT(doctortag string) (string, error) {
+	secret := config.JwtSecret
+	if secret == "" {
+		return "", errors.New("no secret key found")
+	}
+
+	claims := jwt.MapClaims{
+		"doctortag": doctortag,
+		"role":      "doctor",
+		"exp":       time.Now().Add(1 * time.Hour).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// GenerateRoomToken lets one party of an appointment open the call signaling or chat socket for it
+func GenerateRoomToken(room models.RoomClaims, expiresAt time.Time) (string, error) {
+	secret := config.JwtSecret
+	if secret == "" {
+		return "", errors.New("no secret key found")
+	}
+
+	claims := jwt.MapClaims{
+		"typ":            room.Kind,
+		"session_id":     room.SessionID,
+		"appointment_id": room.AppointmentID,
+		"role":           room.Role,
+		"tag":            room.Tag,
+		"exp":            expiresAt.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ParseRoomToken only accepts tokens issued for the given kind of socket
+func ParseRoomToken(tokenString, kind string) (models.RoomClaims, error) {
+	var room models.RoomClaims
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(config.JwtSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return room, errors.New("invalid or expired room token")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != kind {
+		return room, errors.New("invalid or expired room token")
+	}
+	sessionID, _ := claims["session_id"].(float64)
+	appointmentID, _ := claims["appointment_id"].(float64)
+	room.Kind = kind
+	room.SessionID = int(sessionID)
+	room.AppointmentID = int(appointmentID)
+	room.Role, _ = claims["role"].(string)
+	room.Tag, _ = claims["tag"].(string)
+	if room.AppointmentID == 0 || room.Role == "" || room.Tag == "" {
+		return room, errors.New("invalid or expired room token")
+	}
+	return room, nil
+}
+
 func HashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -79,3 +166,60 @@ func HashPassword(password string) (string, error) {
 	}
 	return string(hashedPassword), nil
 }
+
+func SendEmail(Email, subject, body string) error {
+	smtpHost := "smtp.gmail.com"
+	smtpPort := "587"
+	senderEmail := config.AppEmail
+	senderPassword := config.AppPassword
+
+	auth := smtp.PlainAuth("", senderEmail, senderPassword, smtpHost)
+
+	message := []byte("Subject: " + subject + "\r\n" +
+		"To: " + Email + "\r\n" +
+		"From: " + senderEmail + "\r\n" +
+		"\r\n" +
+		body + "\r\n")
+
+	return smtp.SendMail(smtpHost+":"+smtpPort, auth, senderEmail, []string{Email}, message)
+}
+
+// SendEmailWithAttachment sends a plain text email with one file attached, contentType may carry parameters
+// such as the method of a calendar invite
+func SendEmailWithAttachment(Email, subject, body, filename, contentType string, data []byte) error {
+	smtpHost := "smtp.gmail.com"
+	smtpPort := "587"
+	senderEmail := config.AppEmail
+	senderPassword := config.AppPassword
+
+	auth := smtp.PlainAuth("", senderEmail, senderPassword, smtpHost)
+
+	boundary := fmt.Sprintf("telemed-%d", time.Now().UnixNano())
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var attachment strings.Builder
+	for len(encoded) > 76 {
+		attachment.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	attachment.WriteString(encoded)
+
+	message := []byte("Subject: " + subject + "\r\n" +
+		"To: " + Email + "\r\n" +
+		"From: " + senderEmail + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"" + boundary + "\"\r\n" +
+		"\r\n" +
+		"--" + boundary + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		body + "\r\n" +
+		"--" + boundary + "\r\n" +
+		"Content-Type: " + contentType + "; name=\"" + filename + "\"\r\n" +
+		"Content-Disposition: attachment; filename=\"" + filename + "\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		attachment.String() + "\r\n" +
+		"--" + boundary + "--\r\n")
+
+	return smtp.SendMail(smtpHost+":"+smtpPort, auth, senderEmail, []string{Email}, message)
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"telemed/config"
+	"telemed/models"
+	"time"
+)
+
+const icalTimeFormat = "20060102T150405Z"
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// parameter values are quoted, which leaves no way to write a double quote or a line break inside them
+var icalParamEscaper = strings.NewReplacer(`"`, "'", "\r", " ", "\n", " ")
+
+// BuildCalendar renders events as an RFC 5545 calendar. method is REQUEST or CANCEL for email invites and
+// empty for subscription feeds, which must not carry one
+func BuildCalendar(method, name string, events []models.CalendarEvent) []byte {
+	var b strings.Builder
+	line := func(l string) {
+		// content lines are folded at 75 octets, continuation lines start with a space
+		for len(l) > 75 {
+			cut := 75
+			for cut > 0 && l[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			b.WriteString(l[:cut] + "\r\n")
+			l = " " + l[cut:]
+		}
+		b.WriteString(l + "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Telemed//Appointments//EN")
+	line("CALSCALE:GREGORIAN")
+	if method != "" {
+		line("METHOD:" + method)
+	}
+	if name != "" {
+		line("X-WR-CALNAME:" + icalEscaper.Replace(name))
+	}
+	stamp := time.Now().UTC().Format(icalTimeFormat)
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + e.Start.UTC().Format(icalTimeFormat))
+		line("DTEND:" + e.End.UTC().Format(icalTimeFormat))
+		line("SUMMARY:" + icalEscaper.Replace(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + icalEscaper.Replace(e.Description))
+		}
+		if method != "" && config.AppEmail != "" {
+			// invites need an organizer, the app's sender address plays that part
+			line("ORGANIZER;CN=Telemed:mailto:" + config.AppEmail)
+		}
+		if method != "" {
+			for _, a := range e.Attendees {
+				line(`ATTENDEE;CN="` + icalParamEscaper.Replace(a.Name) + `";RSVP=FALSE:mailto:` + a.Email)
+			}
+		}
+		line("STATUS:" + e.Status)
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"strings"
+	"telemed/models"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// unfold joins folded content lines back together, as a calendar client would
+func unfold(ics string) []string {
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(ics, "\r\n ", ""), "\r\n"), "\r\n")
+}
+
+func TestBuildCalendarFolding(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary string
+	}{
+		{"short line", "Consultation"},
+		{"ascii over 75 octets", strings.Repeat("a", 200)},
+		{"multibyte runes across the fold", strings.Repeat("é", 60)},
+		{"mixed widths", "Consultation with Dr " + strings.Repeat("Ọlájídé ", 12)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ics := string(BuildCalendar("", "", []models.CalendarEvent{{UID: "1@test", Summary: tt.summary, Status: "CONFIRMED"}}))
+			for _, l := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+				if len(l) > 75 {
+					t.Errorf("line of %d octets: %q", len(l), l)
+				}
+				if !utf8.ValidString(l) {
+					t.Errorf("fold split a rune: %q", l)
+				}
+			}
+			found := false
+			for _, l := range unfold(ics) {
+				if l == "SUMMARY:"+tt.summary {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("SUMMARY did not survive folding:\n%s", ics)
+			}
+		})
+	}
+}
+
+func TestBuildCalendarEscaping(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a, b; c", `a\, b\; c`},
+		{`back\slash`, `back\\slash`},
+		{"two\nlines", `two\nlines`},
+		{"crlf\r\nline", `crlf\nline`},
+	}
+	for _, tt := range tests {
+		ics := string(BuildCalendar("", "", []models.CalendarEvent{{UID: "1@test", Summary: "s", Description: tt.text, Status: "CONFIRMED"}}))
+		if !strings.Contains(strings.Join(unfold(ics), "\n"), "\nDESCRIPTION:"+tt.want+"\n") {
+			t.Errorf("Description %q not escaped to %q:\n%s", tt.text, tt.want, ics)
+		}
+	}
+}
+
+func TestBuildCalendarMethod(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.FixedZone("WAT", 3600))
+	event := models.CalendarEvent{UID: "7@test", Sequence: 2, Start: start, End: start.Add(30 * time.Minute), Summary: "s", Status: "CANCELLED",
+		Attendees: []models.CalendarAttendee{{Name: `Ada "Ade" Obi`, Email: "ada@example.com"}}}
+	tests := []struct {
+		method  string
+		want    []string
+		missing []string
+	}{
+		{
+			method: "CANCEL",
+			want: []string{"METHOD:CANCEL", "SEQUENCE:2", "DTSTART:20260301T080000Z", "DTEND:20260301T083000Z", "STATUS:CANCELLED",
+				`ATTENDEE;CN="Ada 'Ade' Obi";RSVP=FALSE:mailto:ada@example.com`},
+		},
+		{
+			// feeds must not carry a method or attendees
+			method:  "",
+			want:    []string{"DTSTART:20260301T080000Z"},
+			missing: []string{"METHOD:", "ATTENDEE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run("method "+tt.method, func(t *testing.T) {
+			lines := unfold(string(BuildCalendar(tt.method, "", []models.CalendarEvent{event})))
+			joined := strings.Join(lines, "\n")
+			for _, w := range tt.want {
+				if !strings.Contains("\n"+joined+"\n", "\n"+w+"\n") {
+					t.Errorf("missing line %q in:\n%s", w, joined)
+				}
+			}
+			for _, m := range tt.missing {
+				if strings.Contains(joined, m) {
+					t.Errorf("unexpected %q in:\n%s", m, joined)
+				}
+			}
+		})
+	}
+}
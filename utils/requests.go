@@ -204,3 +204,103 @@ func InitiateTransfer(data models.WithdrawReq, reference string) (string, error)
     // Return the transfer code (important for later reconciliation/verification)
     return response.Data.TransferCode, nil
 }
+
+
+func SendSMSOTP(phoneNo, otp string) error {
+	return SendSMS(phoneNo, fmt.Sprintf("Your Helcare verification code is: %s and it will expire in 5 mins", otp))
+}
+
+func SendSMS(phoneNo, message string) error {
+	url := config.TermiiBaseURL + "/api/sms/send"
+	reqBody := map[string]interface{}{
+		"api_key": config.TermiiAPIKey,
+		"to":      phoneNo,
+		"from":    config.TermiiSenderID,
+		"sms":     message,
+		"type":    "plain",
+		"channel": "generic",
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		log.Println("Error marshaling sms request:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		log.Println("Error creating sms request:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Println("Error sending sms:", err)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Println("SMS provider returned non-200 status:", resp.StatusCode)
+		return errors.New(responses.SOMETHING_WRONG)
+	}
+	return nil
+}
+
+// ChargeAuthorization charges a saved card through Paystack and reports whether the charge went through
+func ChargeAuthorization(email, authorizationCode, reference string, amount float64) (bool, string, error) {
+	url := config.PaystackBaseURL + "/transaction/charge_authorization"
+	reqBody := map[string]interface{}{
+		"email":              email,
+		"amount":             int64(amount * 100),
+		"authorization_code": authorizationCode,
+		"reference":          reference,
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		log.Println("Error marshaling charge authorization request:", err)
+		return false, "", errors.New(responses.SOMETHING_WRONG)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		log.Println("Error creating charge authorization request:", err)
+		return false, "", errors.New(responses.SOMETHING_WRONG)
+	}
+	req.Header.Set("Authorization", "Bearer "+config.PaystackSecretKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Println("Error sending charge authorization request:", err)
+		return false, "", errors.New(responses.SOMETHING_WRONG)
+	}
+	defer resp.Body.Close()
+
+	resBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Println("Error reading charge authorization response:", err)
+		return false, "", errors.New(responses.SOMETHING_WRONG)
+	}
+
+	var response struct {
+		Status  bool   `json:"status"`
+		Message string `json:"message"`
+		Data    struct {
+			Status          string `json:"status"`
+			GatewayResponse string `json:"gateway_response"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(resBody, &response); err != nil {
+		log.Println("Error unmarshaling charge authorization response:", err)
+		return false, "", errors.New(responses.SOMETHING_WRONG)
+	}
+	if !response.Status {
+		return false, response.Message, nil
+	}
+	return response.Data.Status == "success", response.Data.GatewayResponse, nil
+}